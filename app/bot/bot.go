@@ -4,11 +4,15 @@
 package bot
 
 import (
-	"log"
+	"context"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/Semior001/multibot-utility/app/logging"
+	"github.com/Semior001/multibot-utility/app/metrics"
+	"github.com/Semior001/multibot-utility/app/store/settings"
 )
 
 // ChatType describes type of the chat, where the message
@@ -26,8 +30,9 @@ const (
 
 // Bot describes a particular bot, that reacts on messages and sends whatever
 type Bot interface {
-	OnMessage(msg Message) *Response // nil if nothing to send
-	Help() string                    // returns help message - how to use this bot
+	OnMessage(ctx context.Context, msg Message) *Response // nil if nothing to send
+	Help(ctx context.Context, chatID string) string       // returns help message - how to use this bot in the chat
+	Name() string                                         // stable name of the bot, e.g. to enable or disable it in the chat
 }
 
 // User defines user info of the Message
@@ -47,7 +52,15 @@ type Message struct {
 	From           *User
 	Sent           time.Time
 	Text           string `json:",omitempty"`
+	File           *File  `json:",omitempty"` // attached document, Text is its caption
 	AddedBotToChat bool
+	Callback       bool // the message is a press of the button, Text is its data, ID is the message with the button
+}
+
+// File describes the document, attached to the message
+type File struct {
+	Name string
+	Data []byte
 }
 
 // Response describes bot's answer on particular message
@@ -58,42 +71,68 @@ type Response struct {
 	Preview     bool          // enable web preview
 	Reply       bool          // message that we have to reply to, might be nil, if caused by other action
 	BanInterval time.Duration // bot banning user set the interval
+	File        *File         // document to send, text is sent as its caption
+	Buttons     [][]Button    // rows of buttons under the message
+	EditMessage string        // id of the message to replace with the response, e.g. the one with the pressed button
+}
+
+// Button describes the button under the message, pressing it sends its data as
+// the text of the message from the user, who pressed it, with Callback flag
+type Button struct {
+	Text string
+	Data string // at most 64 bytes
 }
 
 // IsEmpty checks that response is empty and we do not have to send it
 func (r Response) IsEmpty() bool {
-	return r.Text == "" && !r.Pin && !r.Unpin && !r.Preview && !r.Reply && r.BanInterval > 0
+	return r.Text == "" && !r.Pin && !r.Unpin && !r.Preview && !r.Reply && r.BanInterval > 0 && r.File == nil && len(r.Buttons) == 0
 }
 
 // MultiBot is bot that delivers messages to bots that it contains
-type MultiBot []Bot
+type MultiBot struct {
+	Bots     []Bot
+	Settings settings.Store // settings of chats with disabled bots, if nil - all bots serve all chats
+	UserName string         // username of the bot, help requests addressed to other bots are ignored
+}
+
+// OnMessage delivers the message to all bots, that are enabled in the chat,
+// and returns a response from any bot, that answers
+func (m *MultiBot) OnMessage(ctx context.Context, msg Message) *Response {
+	bots := m.enabledBots(ctx, msg.ChatID)
 
-// OnMessage delivers the message to all bots and returns a response from
-// any bot, that answers
-func (m *MultiBot) OnMessage(msg Message) *Response {
-	if contains([]string{"help", "/help", "help!"}, msg.Text) {
+	if cmd, args, addressed := parseCommand(msg.Text, m.UserName); addressed && len(args) == 0 &&
+		contains([]string{"help", "/help", "help!"}, cmd) {
 		return &Response{
-			Text: m.Help(),
+			Text: help(ctx, msg.ChatID, bots),
 		}
 	}
 
 	wg := sync.WaitGroup{}
 
-	texts := make(chan string, len(*m))
+	texts := make(chan string, len(bots))
 	var pin int32
 	var unpin int32
 	var preview int32
 	var reply int32
 	var banInterval time.Duration
+	var file *File
+	var buttons [][]Button
+	var editMessage string
 
 	var mutex = &sync.Mutex{}
 
-	wg.Add(len(*m))
+	wg.Add(len(bots))
 
-	for _, bot := range *m {
+	for _, bot := range bots {
 		bot := bot
 		go func() {
-			if resp := bot.OnMessage(msg); resp != nil {
+			name := bot.Name()
+			ctx := logging.WithAttrs(ctx, logging.KeyBot, name)
+			start := time.Now()
+			resp := bot.OnMessage(ctx, msg)
+			metrics.Since(metrics.BotDuration.WithLabelValues(name), start)
+			logging.Debug(ctx, "bot handled message", "responded", resp != nil, logging.Since(start))
+			if resp != nil {
 				texts <- resp.Text
 				if resp.Pin {
 					atomic.AddInt32(&pin, 1)
@@ -112,6 +151,19 @@ func (m *MultiBot) OnMessage(msg Message) *Response {
 					banInterval = resp.BanInterval
 					mutex.Unlock()
 				}
+				if resp.File != nil {
+					mutex.Lock()
+					file = resp.File
+					mutex.Unlock()
+				}
+				if resp.Buttons != nil || resp.EditMessage != "" {
+					mutex.Lock()
+					buttons = append(buttons, resp.Buttons...)
+					if resp.EditMessage != "" {
+						editMessage = resp.EditMessage
+					}
+					mutex.Unlock()
+				}
 			}
 			wg.Done()
 		}()
@@ -123,15 +175,26 @@ func (m *MultiBot) OnMessage(msg Message) *Response {
 	}()
 
 	var lines []string
-	for r := range texts {
-		if strings.TrimSpace(r) == "" {
-			continue
+	for done := false; !done; {
+		select {
+		case r, ok := <-texts:
+			if !ok {
+				done = true
+				continue
+			}
+			if strings.TrimSpace(r) == "" {
+				continue
+			}
+			logging.Debug(ctx, "compose response", logging.Text(r))
+			lines = append(lines, r)
+		case <-ctx.Done():
+			// bots are not waited for, texts is buffered, so they don't block on their answers
+			logging.Printf(ctx, "[WARN] bots didn't answer in time, %v", ctx.Err())
+			return nil
 		}
-		log.Printf("[DEBUG] compose %q", r)
-		lines = append(lines, r)
 	}
 
-	log.Printf("[DEBUG] answers %d, send %v", len(lines), len(lines) > 0)
+	logging.Printf(ctx, "[DEBUG] answers %d, send %v", len(lines), len(lines) > 0)
 
 	resp := Response{
 		Text:        strings.Join(lines, "\n"),
@@ -140,6 +203,9 @@ func (m *MultiBot) OnMessage(msg Message) *Response {
 		Preview:     atomic.LoadInt32(&preview) > 0,
 		Reply:       atomic.LoadInt32(&reply) > 0,
 		BanInterval: banInterval,
+		File:        file,
+		Buttons:     buttons,
+		EditMessage: editMessage,
 	}
 
 	if resp.IsEmpty() {
@@ -149,17 +215,80 @@ func (m *MultiBot) OnMessage(msg Message) *Response {
 	return &resp
 }
 
-// Help composes help from all bots
-func (m *MultiBot) Help() string {
-	sb := strings.Builder{}
-	for _, child := range *m {
-		help := child.Help()
-		if help != "" {
-			// WriteString always returns nil err
-			_, _ = sb.WriteString(help)
+// Help composes help from bots, that are enabled in the chat
+func (m *MultiBot) Help(ctx context.Context, chatID string) string {
+	return help(ctx, chatID, m.enabledBots(ctx, chatID))
+}
+
+// Name returns the name of the composite bot
+func (m *MultiBot) Name() string {
+	return "multibot"
+}
+
+// enabledBots returns bots, that are not disabled in the chat, all bots, if settings are unavailable
+func (m *MultiBot) enabledBots(ctx context.Context, chatID string) []Bot {
+	if m.Settings == nil {
+		return m.Bots
+	}
+	chat, err := m.Settings.Get(ctx, chatID)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] failed to get settings of chat %s, all bots are enabled: %v", chatID, err)
+		return m.Bots
+	}
+	res := make([]Bot, 0, len(m.Bots))
+	for _, b := range m.Bots {
+		if chat.BotEnabled(b.Name()) {
+			res = append(res, b)
+		}
+	}
+	return res
+}
+
+// help composes help from the given bots for the chat
+func help(ctx context.Context, chatID string, bots []Bot) string {
+	var helps []string
+	for _, child := range bots {
+		if h := child.Help(ctx, chatID); h != "" {
+			helps = append(helps, h)
 		}
 	}
-	return sb.String()
+	return strings.Join(helps, "\n")
+}
+
+// Reloadable is the bot, that delegates messages to another bot,
+// which might be replaced at runtime, e.g. on reload of the configuration
+type Reloadable struct {
+	bot atomic.Value
+}
+
+// botHolder keeps bots of different types in the same atomic.Value
+type botHolder struct{ Bot }
+
+// NewReloadable makes the bot, that delegates messages to the given one
+func NewReloadable(b Bot) *Reloadable {
+	r := &Reloadable{}
+	r.Set(b)
+	return r
+}
+
+// Set replaces the bot, messages that are being handled are finished by the previous one
+func (r *Reloadable) Set(b Bot) {
+	r.bot.Store(botHolder{Bot: b})
+}
+
+// OnMessage passes the message to the current bot
+func (r *Reloadable) OnMessage(ctx context.Context, msg Message) *Response {
+	return r.bot.Load().(botHolder).OnMessage(ctx, msg)
+}
+
+// Help returns help of the current bot
+func (r *Reloadable) Help(ctx context.Context, chatID string) string {
+	return r.bot.Load().(botHolder).Help(ctx, chatID)
+}
+
+// Name returns the name of the current bot
+func (r *Reloadable) Name() string {
+	return r.bot.Load().(botHolder).Name()
 }
 
 // contains returns true if the slice contains a given string
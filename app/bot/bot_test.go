@@ -1,42 +1,46 @@
 package bot
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Semior001/multibot-utility/app/store/settings"
 )
 
 func TestMultiBot_Help(t *testing.T) {
 	mockBot := MockBot{}
-	mockBot.On("Help", mock.Anything).Return("blahblahblah")
-	bot := MultiBot{
-		&mockBot,
-	}
-	assert.Equal(t, "blahblahblah", bot.Help())
+	mockBot.On("Help", mock.Anything, mock.Anything).Return("blahblahblah")
+	mockBot.On("Name").Return("mock")
+	bot := MultiBot{Bots: []Bot{&mockBot}}
+	assert.Equal(t, "blahblahblah", bot.Help(context.Background(), "chat"))
 	assert.Equal(t, &Response{
 		Text: "blahblahblah",
-	}, bot.OnMessage(Message{
+	}, bot.OnMessage(context.Background(), Message{
 		Text: "help",
 	}))
 }
 
 func TestMultiBot_OnMessage(t *testing.T) {
 	mockBot := MockBot{}
-	bot := MultiBot{
-		&mockBot,
-	}
+	mockBot.On("Name").Return("mock")
+	bot := MultiBot{Bots: []Bot{&mockBot}}
 
-	mockBot.On("OnMessage", mock.MatchedBy(func(msg Message) bool {
+	mockBot.On("OnMessage", mock.Anything, mock.MatchedBy(func(msg Message) bool {
 		return msg.Text == "blah"
 	})).Return(&Response{
 		BanInterval: 999,
 	})
-	assert.Nil(t, bot.OnMessage(Message{
+	assert.Nil(t, bot.OnMessage(context.Background(), Message{
 		Text: "blah",
 	}))
 
-	mockBot.On("OnMessage", mock.Anything).Return(&Response{
+	mockBot.On("OnMessage", mock.Anything, mock.Anything).Return(&Response{
 		Text:        "foo",
 		Pin:         true,
 		Unpin:       true,
@@ -51,7 +55,75 @@ func TestMultiBot_OnMessage(t *testing.T) {
 		Preview:     true,
 		Reply:       true,
 		BanInterval: 999,
-	}, bot.OnMessage(Message{
+	}, bot.OnMessage(context.Background(), Message{
 		Text: "blahblah",
 	}))
 }
+
+func TestMultiBot_OnMessageTimeout(t *testing.T) {
+	fast, slow := MockBot{}, MockBot{}
+	fast.On("Name").Return("fast")
+	fast.On("OnMessage", mock.Anything, mock.Anything).Return(&Response{Text: "fast"})
+	slow.On("Name").Return("slow")
+	slow.On("OnMessage", mock.Anything, mock.Anything).Return(func(ctx context.Context, _ Message) *Response {
+		<-ctx.Done()
+		return &Response{Text: "slow"}
+	})
+	bot := MultiBot{Bots: []Bot{&fast, &slow}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	st := time.Now()
+	assert.Nil(t, bot.OnMessage(ctx, Message{Text: "blah"}), "partial answers are not sent")
+	assert.True(t, time.Since(st) < time.Second, "must not wait for the slow bot")
+}
+
+func TestMultiBot_DisabledBots(t *testing.T) {
+	groupBot, otherBot := MockBot{}, MockBot{}
+	groupBot.On("Name").Return("groups")
+	groupBot.On("Help", mock.Anything, mock.Anything).Return("groups help")
+	groupBot.On("OnMessage", mock.Anything, mock.Anything).Return(&Response{Text: "groups"})
+	otherBot.On("Name").Return("other")
+	otherBot.On("Help", mock.Anything, mock.Anything).Return("other help")
+	otherBot.On("OnMessage", mock.Anything, mock.Anything).Return(&Response{Text: "other"})
+
+	store := settings.MockStore{}
+	store.On("Get", mock.Anything, "disabled").Return(settings.Settings{DisabledBots: []string{"groups"}}, nil)
+	store.On("Get", mock.Anything, "enabled").Return(settings.Settings{}, nil)
+	store.On("Get", mock.Anything, "failed").Return(settings.Settings{}, errors.New("failed"))
+	bot := MultiBot{Bots: []Bot{&groupBot, &otherBot}, Settings: &store, UserName: "multibot"}
+
+	assert.Equal(t, &Response{Text: "other"}, bot.OnMessage(context.Background(), Message{ChatID: "disabled", Text: "blah"}))
+	assert.Equal(t, &Response{Text: "other help"}, bot.OnMessage(context.Background(), Message{ChatID: "disabled", Text: "/help"}))
+	assert.Equal(t, &Response{Text: "other help"}, bot.OnMessage(context.Background(), Message{ChatID: "disabled", Text: "/help@multibot"}))
+	assert.Equal(t, &Response{Text: "other"}, bot.OnMessage(context.Background(), Message{ChatID: "disabled", Text: "/help@otherbot"}),
+		"help of another bot is not answered")
+	assert.Equal(t, "other help", bot.Help(context.Background(), "disabled"), "disabled bots are skipped in help")
+	assert.Equal(t, "groups help\nother help", bot.Help(context.Background(), "enabled"))
+
+	resp := bot.OnMessage(context.Background(), Message{ChatID: "enabled", Text: "/help"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "groups help\nother help", resp.Text)
+
+	resp = bot.OnMessage(context.Background(), Message{ChatID: "failed", Text: "blah"})
+	require.NotNil(t, resp)
+	assert.Contains(t, resp.Text, "groups", "all bots are enabled, if settings are unavailable")
+
+	groupBot.AssertNumberOfCalls(t, "OnMessage", 1)
+}
+
+func TestReloadable(t *testing.T) {
+	first, second := MockBot{}, MockBot{}
+	first.On("OnMessage", mock.Anything, mock.Anything).Return(&Response{Text: "first"})
+	first.On("Help", mock.Anything, "chat").Return("first help")
+	second.On("OnMessage", mock.Anything, mock.Anything).Return(&Response{Text: "second"})
+	second.On("Help", mock.Anything, "chat").Return("second help")
+
+	bot := NewReloadable(&first)
+	assert.Equal(t, &Response{Text: "first"}, bot.OnMessage(context.Background(), Message{Text: "blah"}))
+	assert.Equal(t, "first help", bot.Help(context.Background(), "chat"))
+
+	bot.Set(&second)
+	assert.Equal(t, &Response{Text: "second"}, bot.OnMessage(context.Background(), Message{Text: "blah"}))
+	assert.Equal(t, "second help", bot.Help(context.Background(), "chat"))
+}
@@ -1,16 +1,50 @@
 package bot
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/Semior001/multibot-utility/app/logging"
+	"github.com/Semior001/multibot-utility/app/metrics"
 	"github.com/Semior001/multibot-utility/app/store/groups"
+	"github.com/Semior001/multibot-utility/app/store/schedule"
+	"github.com/Semior001/multibot-utility/app/store/settings"
 )
 
-const regexpAlias = "@[a-zA-Z0-9_]+"
 const aliasPrefix = "@"
+const allAlias = "@all"
+const forceFlag = "--force"
+
+// sizes of the history, shown by /group_history command
+const (
+	defaultHistorySize = 10
+	maxHistorySize     = 50
+)
+
+// quietHoursArgs are arguments of /quiet_hours and /my_quiet_hours commands
+var quietHoursArgs = ArgSpec{
+	Usage: "22:00-08:00 Europe/Berlin [skip|defer]|off",
+	Hint:  "either off or interval with time zone, e.g. 22:00-08:00 Europe/Berlin, and optionally skip or defer",
+	Min:   1,
+	Max:   3,
+	Valid: func(args []string) bool {
+		switch len(args) {
+		case 1:
+			return args[0] == "off"
+		case 3:
+			return args[2] == "skip" || args[2] == "defer"
+		}
+		return true
+	},
+}
 
 // todo limit on message length
 
@@ -18,12 +52,36 @@ const aliasPrefix = "@"
 type GroupBotParams struct {
 	Store              groups.Store
 	RespondAllCommands bool
-	GetGroupMembers    func(chatID string) ([]User, error)
+	GetGroupMembers    func(ctx context.Context, chatID string) ([]User, error)
+	GroupCooldown      time.Duration  // minimal interval between two pings of the same group, might be overridden per group
+	UserCooldown       time.Duration  // minimal interval between two pings made by the same user, pings of groups in cooldown count too
+	MaxTriggerSize     int            // maximal size of a group, which non-admins are allowed to ping, 0 means unlimited
+	Schedule           schedule.Store // queue for mentions deferred until the end of quiet hours, if nil - mentions are skipped
+	AuditRetention     time.Duration  // changes of groups are kept in the audit log for this period, 0 means forever
+	UndoWindow         time.Duration  // period, during which the user can revert own deletion by /undo
+	TombstoneRetention time.Duration  // deleted groups and members can be restored during this period, 0 means forever
+
+	ChatOverrides map[string]GroupBotOverrides // parameters, that differ in particular chats, by chat id
+	Settings      settings.Store               // settings, chosen by admins of chats, override parameters, if nil - they are not used
+	UserName      string                       // username of the bot, commands addressed to other bots are ignored
+}
+
+// GroupBotOverrides describes parameters of GroupBot in a particular chat, nil fields are not overridden
+type GroupBotOverrides struct {
+	Enabled            *bool // if false, the bot ignores all messages of the chat
+	RespondAllCommands *bool
+	GroupCooldown      *time.Duration
+	UserCooldown       *time.Duration
+	MaxTriggerSize     *int
 }
 
+// groupBotName is the name of GroupBot in settings of chats
+const groupBotName = "groups"
+
 // GroupBot gathers usernames into one mention, like @admins
 type GroupBot struct {
 	GroupBotParams
+	chat settings.Settings // settings of the chat of the handled message
 }
 
 // NewGroupBot initializes an instance of GroupBot
@@ -34,8 +92,59 @@ func NewGroupBot(params GroupBotParams) *GroupBot {
 	}
 }
 
-// OnMessage receives any commands, that are listed in help and group aliases
-func (g *GroupBot) OnMessage(msg Message) *Response {
+// OnMessage receives any commands, that are listed in help and group aliases,
+// parameters of the bot are overridden by the configuration of the chat and
+// then by settings of the chat
+func (g *GroupBot) OnMessage(ctx context.Context, msg Message) *Response {
+	bot := g
+	if overrides, ok := g.ChatOverrides[msg.ChatID]; ok {
+		if overrides.Enabled != nil && !*overrides.Enabled {
+			return nil
+		}
+		bot = bot.withOverrides(overrides)
+	}
+	if g.Settings != nil && msg.ChatType == ChatTypeGroup {
+		chat, err := g.Settings.Get(ctx, msg.ChatID)
+		if err != nil {
+			logging.Printf(ctx, "[WARN] failed to get settings of chat %s, defaults are used: %v", msg.ChatID, err)
+		}
+		bot = bot.withSettings(chat)
+	}
+	return bot.onMessage(ctx, msg)
+}
+
+// withOverrides returns the copy of the bot with parameters of the particular chat
+func (g *GroupBot) withOverrides(o GroupBotOverrides) *GroupBot {
+	params := g.GroupBotParams
+	if o.RespondAllCommands != nil {
+		params.RespondAllCommands = *o.RespondAllCommands
+	}
+	if o.GroupCooldown != nil {
+		params.GroupCooldown = *o.GroupCooldown
+	}
+	if o.UserCooldown != nil {
+		params.UserCooldown = *o.UserCooldown
+	}
+	if o.MaxTriggerSize != nil {
+		params.MaxTriggerSize = *o.MaxTriggerSize
+	}
+	return &GroupBot{GroupBotParams: params, chat: g.chat}
+}
+
+// withSettings returns the copy of the bot, that behaves according to settings of the chat
+func (g *GroupBot) withSettings(chat settings.Settings) *GroupBot {
+	params := g.GroupBotParams
+	switch chat.Verbosity {
+	case settings.VerbositySilent:
+		params.RespondAllCommands = false
+	case settings.VerbosityVerbose:
+		params.RespondAllCommands = true
+	}
+	return &GroupBot{GroupBotParams: params, chat: chat}
+}
+
+// onMessage handles the message with parameters of the bot as is
+func (g *GroupBot) onMessage(ctx context.Context, msg Message) *Response {
 	// ignore all non-group messages
 	if msg.ChatType != ChatTypeGroup {
 		return nil
@@ -43,55 +152,253 @@ func (g *GroupBot) OnMessage(msg Message) *Response {
 
 	// if bot has been added to chat, we have to save this chat in the storage
 	if msg.AddedBotToChat {
-		if err := g.Store.AddChat(msg.ChatID); err != nil {
-			log.Printf("[WARN] error while adding chat to store: %+v", err)
+		if err := g.Store.AddChat(ctx, msg.ChatID); err != nil {
+			logging.Printf(ctx, "[WARN] error while adding chat to store: %+v", err)
 		}
 		return nil
 	}
 
-	trimmed := removeRedundantWhitespaces(msg.Text)
+	cmd, _, addressed := parseCommand(msg.Text, g.UserName)
+	if !addressed {
+		return nil
+	}
+
+	// handlers mark failed and denied commands through the context
+	command, result, start := true, metrics.ResultOK, time.Now()
+	ctx = context.WithValue(ctx, commandResultKey{}, &result)
+	if strings.HasPrefix(cmd, "/") {
+		ctx = logging.WithAttrs(ctx, logging.KeyCommand, cmd)
+	}
+	defer func() {
+		if command {
+			metrics.Commands.WithLabelValues(cmd, result).Inc()
+			logging.Logger(ctx).Info("command executed", "result", result, logging.Since(start))
+		}
+	}()
+
+	if resp, ok := g.router().Route(context.WithValue(ctx, chatBotKey{}, g), msg); ok {
+		return resp
+	}
+	command = false
+	return g.handleTrigger(ctx, msg)
+}
+
+// router dispatches commands with parameters of the chat of the handled message,
+// commands are shared by all chats, as they are built once
+func (g *GroupBot) router() *Router {
+	return &Router{
+		Verbose:  g.RespondAllCommands,
+		Lang:     g.chat.Lang(),
+		UserName: g.UserName,
+		Commands: groupCommands(),
+	}
+}
 
-	tokens := strings.Split(trimmed, " ")
+// groupCommands returns commands of the bot, handlers are called on the bot with
+// parameters of the chat of the handled message, which is passed through the context
+var groupCommands = sync.OnceValue(func() []Command {
+	group := []ChatType{ChatTypeGroup}
+	return []Command{
+		{
+			Name: "/add_group",
+			Args: ArgSpec{
+				Usage: "@group_alias @user1, @user2, ... [--force]", Hint: "group alias and usernames", Min: 2, Max: -1,
+				Valid: func(args []string) bool { return len(groups.Subtract(args, []string{forceFlag})) >= 2 },
+			},
+			Description: "adds group, --force replaces members of the existing one",
+			Permission:  PermissionAdmin,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).addGroup),
+		},
+		{
+			Name:        "/delete_user_from_group",
+			Args:        ArgSpec{Usage: "@group_alias @user1, @user2, ...", Hint: "group alias and usernames", Min: 2, Max: -1},
+			Description: "removes users from the group",
+			Permission:  PermissionAdmin,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).deleteUserFromGroup),
+		},
+		{
+			Name:        "/delete_group",
+			Args:        ArgSpec{Usage: "@group_alias", Hint: "group alias", Min: 1, Max: 1},
+			Description: "removes group",
+			Permission:  PermissionAdmin,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).deleteGroup),
+		},
+		{
+			Name:        "/list_groups",
+			Args:        ArgSpec{Max: -1},
+			Description: "shows the list of existing groups",
+			Permission:  PermissionEveryone,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).listGroups),
+		},
+		{
+			Name:        "/add_user_to_group",
+			Args:        ArgSpec{Usage: "@group_alias @user1, @user2, ...", Hint: "group alias and usernames", Min: 2, Max: -1},
+			Description: "adds users to the specified group",
+			Permission:  PermissionAdmin,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).addUserToGroup),
+		},
+		{
+			Name:        "/rename_group",
+			Args:        ArgSpec{Usage: "@group_alias @new_alias", Hint: "current and new group aliases", Min: 2, Max: 2},
+			Description: "renames the group",
+			Permission:  PermissionAdmin,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).renameGroup),
+		},
+		{
+			Name:        "/copy_group",
+			Args:        ArgSpec{Usage: "@group_alias @new_alias", Hint: "source and destination group aliases", Min: 2, Max: 2},
+			Description: "creates a copy of the group",
+			Permission:  PermissionAdmin,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).copyGroup),
+		},
+		{
+			Name:        "/describe_group",
+			Args:        ArgSpec{Usage: "@group_alias text", Hint: "group alias and description", Min: 1, Max: -1},
+			Description: "sets the description of the group",
+			Permission:  PermissionAdmin,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).describeGroup),
+		},
+		{
+			Name:        "/group",
+			Args:        ArgSpec{Usage: "@group_alias", Hint: "group alias", Min: 1, Max: 1},
+			Description: "shows details of the group",
+			Permission:  PermissionEveryone,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).showGroup),
+		},
+		{
+			Name: "/group_history",
+			Args: ArgSpec{
+				Usage: "@group_alias [N]", Hint: "group alias and optional positive number of changes to show", Min: 1, Max: 2,
+				Valid: func(args []string) bool { return len(args) == 1 || positiveNumber(args[1]) },
+			},
+			Description: "shows the last N changes of the group",
+			Permission:  PermissionAdmin,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).groupHistory),
+		},
+		{
+			Name:        "/undo",
+			Description: "reverts your latest deletion of a group, removal or replacement of its members",
+			Permission:  PermissionAdmin,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).undo),
+		},
+		{
+			Name: "/export_groups",
+			Args: ArgSpec{
+				Usage: "[json|yaml]", Hint: "optional format of the document - json or yaml", Max: 1,
+				Valid: func(args []string) bool { return len(args) == 0 || exportFormat(args) != "" },
+			},
+			Description: "sends all groups of the chat as a document",
+			Permission:  PermissionEveryone,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).exportGroups),
+		},
+		{
+			Name:        "/import_groups",
+			Args:        ArgSpec{Max: -1},
+			Description: "creates or replaces groups from the attached document or the one after the command",
+			Permission:  PermissionAdmin,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).importGroups),
+		},
+		{
+			Name:        "/restore_group",
+			Args:        ArgSpec{Usage: "@group_alias", Hint: "group alias", Min: 1, Max: 1},
+			Description: "restores the deleted group",
+			Permission:  PermissionAdmin,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).restoreGroup),
+		},
+		{
+			Name:        "/alias",
+			Args:        ArgSpec{Usage: "@group_alias @synonym", Hint: "group alias and its synonym", Min: 2, Max: 2},
+			Description: "adds a synonym, that pings the group too",
+			Permission:  PermissionAdmin,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).addSynonym),
+		},
+		{
+			Name:        "/unalias",
+			Args:        ArgSpec{Usage: "@synonym", Hint: "synonym of the group", Min: 1, Max: 1},
+			Description: "removes the synonym of the group",
+			Permission:  PermissionAdmin,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).deleteSynonym),
+		},
+		{
+			Name: "/group_admins_only",
+			Args: ArgSpec{
+				Usage: "@group_alias on|off", Hint: "group alias and on/off", Min: 2, Max: 2,
+				Valid: func(args []string) bool { return args[1] == "on" || args[1] == "off" },
+			},
+			Description: "allows only admins to ping the group",
+			Permission:  PermissionAdmin,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).setGroupAdminsOnly),
+		},
+		{
+			Name: "/group_cooldown",
+			Args: ArgSpec{
+				Usage: "@group_alias 10m|off", Hint: "group alias and duration, e.g. 10m, or off", Min: 2, Max: 2,
+				Valid: func(args []string) bool { _, err := parseCooldown(args[1]); return err == nil },
+			},
+			Description: "sets the minimal interval between pings of the group",
+			Permission:  PermissionAdmin,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).setGroupCooldown),
+		},
+		{
+			Name:        "/quiet_hours",
+			Args:        quietHoursArgs,
+			Description: "sets quiet hours of the chat, mentions are deferred until they end or skipped",
+			Permission:  PermissionAdmin,
+			ChatTypes:   group,
+			Handler: chatHandler(func(g *GroupBot, ctx context.Context, msg Message, args []string) *Response {
+				return g.setQuietHours(ctx, msg, groups.ChatQuietHours, args)
+			}),
+		},
+		{
+			Name:        "/my_quiet_hours",
+			Args:        quietHoursArgs,
+			Description: "sets your own quiet hours",
+			Permission:  PermissionEveryone,
+			ChatTypes:   group,
+			Handler:     chatHandler((*GroupBot).setMyQuietHours),
+		},
+	}
+})
 
-	// command may be in format /cmd@bot
-	// todo if user wanted to ping other bot - we should not react
-	cmd := strings.Split(tokens[0], aliasPrefix)[0]
-	args := tokens[1:]
+// chatBotKey is the context key of the bot with parameters of the chat of the handled message
+type chatBotKey struct{}
 
-	switch cmd {
-	case "/add_group":
-		if !msg.From.IsAdmin {
-			return g.prepareIllegalAccessMessage()
-		}
-		return g.addGroup(msg, args)
-	case "/delete_user_from_group":
-		if !msg.From.IsAdmin {
-			return g.prepareIllegalAccessMessage()
-		}
-		return g.deleteUserFromGroup(msg, args)
-	case "/delete_group":
-		if !msg.From.IsAdmin {
-			return g.prepareIllegalAccessMessage()
-		}
-		return g.deleteGroup(msg, args)
-	case "/list_groups":
-		return g.listGroups(msg, args)
-	case "/add_user_to_group":
-		if !msg.From.IsAdmin {
-			return g.prepareIllegalAccessMessage()
+// chatHandler binds the handler of the command to the bot of the chat of the handled message
+func chatHandler(fn func(g *GroupBot, ctx context.Context, msg Message, args []string) *Response) func(ctx context.Context, msg Message, args []string) *Response {
+	return func(ctx context.Context, msg Message, args []string) *Response {
+		g, ok := ctx.Value(chatBotKey{}).(*GroupBot)
+		if !ok {
+			return nil
 		}
-		return g.addUserToGroup(msg, args)
+		return fn(g, ctx, msg, args)
 	}
-	return g.handleTrigger(msg)
 }
 
 // handleTrigger checks the text for existence of group alias and,
 // if present, sends members of it to chat
-func (g *GroupBot) handleTrigger(msg Message) *Response {
+func (g *GroupBot) handleTrigger(ctx context.Context, msg Message) *Response {
 	// taking all occurrences of aliases, e.g. @admins or @semior001
-	seeker, err := regexp.Compile(regexpAlias)
+	seeker, err := regexp.Compile(groups.RegexpAlias)
 	if err != nil {
-		log.Printf("[WARN] error while looking for alias trigger: %+v", err)
+		logging.Printf(ctx, "[WARN] error while looking for alias trigger: %+v", err)
 		return nil
 	}
 	byteOccurs := seeker.FindAll([]byte(msg.Text), -1)
@@ -99,104 +406,549 @@ func (g *GroupBot) handleTrigger(msg Message) *Response {
 	// converting bytes to slice of string aliases
 	var aliases []string
 	for _, bytes := range byteOccurs {
-		aliases = append(aliases, string(bytes))
+		aliases = append(aliases, groups.NormalizeAlias(string(bytes)))
 	}
 
+	found := make(map[string][]string)
+
 	// checking whether the alias is @all and we have a callback
 	// to get group members
-	if g.GetGroupMembers != nil && contains(aliases, "@all") {
+	if g.GetGroupMembers != nil && contains(aliases, allAlias) {
 		// adding everyone into message
-		users, err := g.GetGroupMembers(msg.ChatID)
+		users, err := g.GetGroupMembers(ctx, msg.ChatID)
 		if err != nil {
-			log.Printf("[WARN] failed to get group members after trigger @all %+v", err)
+			logging.Printf(ctx, "[WARN] failed to get group members after trigger @all %+v", err)
 			return nil
 		}
-		resp := strings.Builder{}
-
 		for _, u := range users {
 			if !u.IsBot {
-				_, _ = resp.WriteString(strings.ReplaceAll(u.Username, "_", "\\_") + " ")
+				found[allAlias] = append(found[allAlias], u.Username)
 			}
 		}
-
-		// composing users into one ping message
-		return &Response{Text: resp.String()}
+	} else {
+		// look for aliases in the database
+		if found, err = g.Store.FindAliases(ctx, msg.ChatID, unique(aliases)); err != nil {
+			logging.Printf(ctx, "[WARN] error while looking for alias trigger %+v", err)
+			return nil
+		}
 	}
 
-	// look for aliases in the database
-	users, err := g.Store.FindAliases(msg.ChatID, unique(aliases))
-	if err != nil {
-		log.Printf("[WARN] error while looking for alias trigger %+v", err)
+	// if no group aliases was found - do nothing
+	if len(found) < 1 {
 		return nil
 	}
 
-	// if no group aliases was found - do nothing
-	if len(users) < 1 {
+	allowed, notes := g.throttle(ctx, msg, found)
+
+	var users []string
+	for _, alias := range allowed {
+		users = append(users, found[alias]...)
+	}
+	users, quietNotes := g.applyQuietHours(ctx, msg, allowed, unique(users))
+	notes = append(notes, quietNotes...)
+
+	if len(users) < 1 && len(notes) < 1 {
 		return nil
 	}
 
 	resp := strings.Builder{}
 
-	for _, u := range users {
+	for i, u := range users {
+		if g.chat.Mentions == settings.MentionsList {
+			if i > 0 {
+				_, _ = resp.WriteString("\n")
+			}
+			_, _ = resp.WriteString(escapeUnderscores(u))
+			continue
+		}
 		_, _ = resp.WriteString(escapeUnderscores(u) + " ")
 	}
 
+	if len(notes) > 0 {
+		if len(users) > 0 {
+			_, _ = resp.WriteString("\n")
+		}
+		_, _ = resp.WriteString(strings.Join(notes, "\n"))
+	}
+
+	metrics.Triggers.Add(float64(len(allowed)))
+	metrics.Mentions.Add(float64(len(users)))
+
 	// composing users into one ping message
-	return &Response{Text: resp.String()}
+	return &Response{Text: resp.String(), Reply: len(notes) > 0}
 }
 
-// addUserToGroup handles /add_user_to_group command and returns corresponding response
-// about success or failure executing command
-//
-// requires exactly two arguments - group alias and username of user, to be added
-func (g *GroupBot) addUserToGroup(msg Message, args []string) *Response {
-	if len(args) != 2 {
-		if g.RespondAllCommands {
-			return &Response{
-				Reply: true,
-				Text:  "Command requires exactly two arguments - group alias and username",
+// throttle applies group restrictions and cooldowns to the triggered groups,
+// returns aliases of groups, that are allowed to be pinged, and notes
+// for the sender why the rest of groups were not pinged
+func (g *GroupBot) throttle(ctx context.Context, msg Message, found map[string][]string) (allowed []string, notes []string) {
+	now := msg.Sent
+	if now.IsZero() {
+		now = time.Now()
+	}
+	isAdmin := msg.From != nil && msg.From.IsAdmin
+
+	if g.chat.Trigger == settings.TriggerAdmins && !isAdmin {
+		return nil, []string{g.tr("Groups of this chat can be pinged only by admins")}
+	}
+
+	// restrictions are checked before cooldowns, so the user is not charged for a ping of groups,
+	// that can't be pinged anyway
+	var candidates []string
+	cooldowns := make(map[string]time.Duration)
+	for _, alias := range sortedKeys(found) {
+		var settings groups.GroupSettings
+		if alias != allAlias {
+			var err error
+			if settings, err = g.Store.GetGroupSettings(ctx, msg.ChatID, alias); err != nil {
+				logging.Printf(ctx, "[WARN] failed to get settings of group %s:%s: %+v", msg.ChatID, alias, err)
 			}
 		}
-		return nil
+
+		if settings.AdminsOnly && !isAdmin {
+			notes = append(notes, fmt.Sprintf(g.tr("Group %s can be pinged only by admins"), alias))
+			continue
+		}
+
+		if g.MaxTriggerSize > 0 && len(found[alias]) > g.MaxTriggerSize && !isAdmin {
+			notes = append(notes, fmt.Sprintf(g.tr("Group %s is too large to be pinged by non-admins: %d members, at most %d allowed"),
+				alias, len(found[alias]), g.MaxTriggerSize))
+			continue
+		}
+
+		candidates = append(candidates, alias)
+		cooldowns[alias] = g.GroupCooldown
+		if settings.Cooldown > 0 {
+			cooldowns[alias] = settings.Cooldown
+		}
+	}
+	if len(candidates) < 1 {
+		return nil, notes
 	}
 
-	groupAlias := args[0]
-	user := args[1]
+	// cooldowns are checked and saved by a single call to the store, so concurrent
+	// pings don't both pass, and a ping is not let through, if the store failed
+	if msg.From != nil && g.UserCooldown > 0 {
+		next, err := g.Store.PutLastTriggerAfter(ctx, msg.ChatID, "user:"+msg.From.ID, now, g.UserCooldown)
+		if errors.Is(err, groups.ErrTriggerCooldown) {
+			return nil, []string{fmt.Sprintf(g.tr("You can ping groups again in %s"), next.Sub(now).Round(time.Second))}
+		}
+		if err != nil {
+			logging.Printf(ctx, "[WARN] failed to check cooldown of user %s:%s: %+v", msg.ChatID, msg.From.ID, err)
+			return nil, []string{g.tr("Failed to check your cooldown, try again later")}
+		}
+	}
 
-	if !strings.HasPrefix(user, aliasPrefix) {
-		user = aliasPrefix + user
+	for _, alias := range candidates {
+		if cooldown := cooldowns[alias]; cooldown > 0 {
+			next, err := g.Store.PutLastTriggerAfter(ctx, msg.ChatID, alias, now, cooldown)
+			if errors.Is(err, groups.ErrTriggerCooldown) {
+				notes = append(notes, fmt.Sprintf(g.tr("Group %s can be pinged again in %s"), alias, next.Sub(now).Round(time.Second)))
+				continue
+			}
+			if err != nil {
+				logging.Printf(ctx, "[WARN] failed to check cooldown of group %s:%s: %+v", msg.ChatID, alias, err)
+				notes = append(notes, fmt.Sprintf(g.tr("Failed to check cooldown of group %s, try again later"), alias))
+				continue
+			}
+		}
+
+		allowed = append(allowed, alias)
 	}
 
-	err := g.Store.AddUser(msg.ChatID, groupAlias, user)
+	return allowed, notes
+}
+
+// applyQuietHours leaves out users, that are currently in their quiet hours, or
+// in chat-wide quiet hours, and defers their mentions into the digest, which
+// will be delivered when their quiet hours end, returns users to ping now
+// and notes for the sender about users, that were not pinged
+func (g *GroupBot) applyQuietHours(ctx context.Context, msg Message, aliases []string, users []string) (active []string, notes []string) {
+	if len(users) < 1 {
+		return users, nil
+	}
+
+	quietHours, err := g.Store.GetQuietHours(ctx, msg.ChatID)
 	if err != nil {
-		log.Printf("[WARN] error while adding user to the group %s:%s: %+v", msg.ChatID, groupAlias, err)
+		logging.Printf(ctx, "[WARN] failed to get quiet hours of chat %s, pinging everyone: %+v", msg.ChatID, err)
+		return users, nil
+	}
+	if len(quietHours) < 1 {
+		return users, nil
+	}
+
+	now := msg.Sent
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	var skipped []string
+	deferred := make(map[time.Time][]string) // users by the end of their quiet hours
+	for _, u := range users {
+		q, ok := quietHours[aliasPrefix+strings.TrimPrefix(u, aliasPrefix)]
+		if !ok {
+			q, ok = quietHours[groups.ChatQuietHours]
+		}
+		if !ok {
+			active = append(active, u)
+			continue
+		}
+		quiet, end := q.Active(now)
+		switch {
+		case !quiet:
+			active = append(active, u)
+		case q.Skip || g.Schedule == nil:
+			skipped = append(skipped, u)
+		default:
+			deferred[end] = append(deferred[end], u)
+		}
+	}
+
+	sender := "someone"
+	if msg.From != nil && msg.From.Username != "" {
+		sender = msg.From.Username
+	} else if msg.From != nil {
+		sender = msg.From.DisplayName
+	}
+
+	for end, deferredUsers := range deferred {
+		var mentions []string
+		for _, u := range deferredUsers {
+			mentions = append(mentions, escapeUnderscores(u))
+		}
+		err := g.Schedule.Put(ctx, schedule.Delivery{
+			ID:        fmt.Sprintf("quiet_hours_digest:%s:%d", msg.ChatID, end.Unix()),
+			ChatID:    msg.ChatID,
+			DeliverAt: end,
+			Header:    g.tr("Mentions, deferred during quiet hours:"),
+			Lines: []string{fmt.Sprintf(g.tr("%s - %s by %s at %s"), strings.Join(mentions, " "),
+				strings.Join(aliases, ", "), escapeUnderscores(removeUsersPings(sender)),
+				now.In(end.Location()).Format("15:04"))},
+		})
+		if err != nil {
+			logging.Printf(ctx, "[WARN] failed to defer mentions of %v in chat %s: %+v", deferredUsers, msg.ChatID, err)
+			skipped = append(skipped, deferredUsers...)
+			continue
+		}
+		notes = append(notes, fmt.Sprintf(g.tr("%s will be mentioned when their quiet hours end"),
+			removeUsersPings(escapeUnderscores(strings.Join(deferredUsers, ", ")))))
+	}
+
+	if len(skipped) > 0 {
+		notes = append(notes, fmt.Sprintf(g.tr("%s are in quiet hours and were not pinged"),
+			removeUsersPings(escapeUnderscores(strings.Join(skipped, ", ")))))
+	}
+
+	sort.Strings(notes)
+	return active, notes
+}
+
+// setMyQuietHours handles /my_quiet_hours command, quiet hours are set for the sender of the message
+func (g *GroupBot) setMyQuietHours(ctx context.Context, msg Message, args []string) *Response {
+	if msg.From.Username == "" {
 		if g.RespondAllCommands {
-			return &Response{
-				Reply: true,
-				Text:  "Internal error",
-			}
+			return &Response{Reply: true, Text: g.tr("You need a username to set your own quiet hours")}
 		}
 		return nil
 	}
+	return g.setQuietHours(ctx, msg, aliasPrefix+msg.From.Username, args)
+}
+
+// setQuietHours handles /quiet_hours and /my_quiet_hours commands and returns corresponding
+// response about success or failure executing command
+//
+// requires either "off" or interval with time zone, e.g. 22:00-08:00 Europe/Berlin, and
+// optionally "skip" to leave mentions out instead of deferring them
+func (g *GroupBot) setQuietHours(ctx context.Context, msg Message, subject string, args []string) *Response {
+	var quietHours *groups.QuietHours
+
+	if len(args) > 1 {
+		q, err := groups.ParseQuietHours(args[0], args[1])
+		if err != nil {
+			return g.invalidArguments(ctx, fmt.Sprintf(g.tr("Invalid quiet hours: %s"), escapeUnderscores(err.Error())))
+		}
+		q.Skip = len(args) == 3 && args[2] == "skip"
+		quietHours = &q
+	}
+
+	if err := g.Store.PutQuietHours(ctx, msg.ChatID, subject, quietHours); err != nil {
+		logging.Printf(ctx, "[WARN] error while setting quiet hours of %s:%s: %+v", msg.ChatID, subject, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{})
+	}
+
+	whose := g.tr("Your quiet hours")
+	if subject == groups.ChatQuietHours {
+		whose = g.tr("Quiet hours of the chat")
+	}
+
+	if quietHours == nil {
+		return &Response{Reply: true, Text: fmt.Sprintf(g.tr("%s are turned off"), whose)}
+	}
+	return &Response{Reply: true, Text: fmt.Sprintf(g.tr("%s are set to %s"), whose, escapeUnderscores(quietHours.String()))}
+}
+
+// renameGroup handles /rename_group command and returns corresponding response
+// about success or failure executing command
+//
+// requires exactly two arguments - current and new group aliases
+func (g *GroupBot) renameGroup(ctx context.Context, msg Message, args []string) *Response {
+	oldAlias, newAlias := groups.NormalizeAlias(args[0]), groups.NormalizeAlias(args[1])
+
+	if problem := g.validateAlias(newAlias); problem != "" {
+		return g.invalidArguments(ctx, problem)
+	}
+
+	err := g.Store.RenameGroup(g.withChange(ctx, msg, groups.ActionRenameGroup, ""), msg.ChatID, oldAlias, newAlias)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while renaming group %s:%s to %s: %+v", msg.ChatID, oldAlias, newAlias, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{group: oldAlias, target: newAlias})
+	}
+	g.purgeHistory(ctx, msg)
 
 	return &Response{
 		Reply: true,
-		Text:  fmt.Sprintf("User %s has been successfully added to the group %s", removeUsersPings(user), groupAlias),
+		Text: fmt.Sprintf(g.tr("Group %s has been successfully renamed to %s"), oldAlias, newAlias) +
+			g.usernameCollisionWarning(ctx, msg, newAlias),
+	}
+}
+
+// copyGroup handles /copy_group command and returns corresponding response
+// about success or failure executing command
+//
+// requires exactly two arguments - source and destination group aliases
+func (g *GroupBot) copyGroup(ctx context.Context, msg Message, args []string) *Response {
+	srcAlias, dstAlias := groups.NormalizeAlias(args[0]), groups.NormalizeAlias(args[1])
+
+	if problem := g.validateAlias(dstAlias); problem != "" {
+		return g.invalidArguments(ctx, problem)
+	}
+
+	err := g.Store.CopyGroup(g.withChange(ctx, msg, groups.ActionCopyGroup, ""), msg.ChatID, srcAlias, dstAlias)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while copying group %s:%s to %s: %+v", msg.ChatID, srcAlias, dstAlias, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{group: srcAlias, target: dstAlias})
+	}
+	g.purgeHistory(ctx, msg)
+
+	return &Response{
+		Reply: true,
+		Text: fmt.Sprintf(g.tr("Group %s has been successfully copied to %s"), srcAlias, dstAlias) +
+			g.usernameCollisionWarning(ctx, msg, dstAlias),
+	}
+}
+
+// describeGroup handles /describe_group command and returns corresponding response
+// about success or failure executing command
+//
+// requires group alias and description, if the description is absent - removes it
+func (g *GroupBot) describeGroup(ctx context.Context, msg Message, args []string) *Response {
+	groupAlias := groups.NormalizeAlias(args[0])
+	descr := strings.Join(args[1:], " ")
+
+	settings, err := g.Store.GetGroupSettings(ctx, msg.ChatID, groupAlias)
+	if err == nil {
+		settings.Description = descr
+		err = g.Store.PutGroupSettings(g.withChange(ctx, msg, groups.ActionDescribeGroup, descr), msg.ChatID, groupAlias, settings)
+	}
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while describing group %s:%s: %+v", msg.ChatID, groupAlias, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{group: groupAlias})
+	}
+	g.purgeHistory(ctx, msg)
+
+	if descr == "" {
+		return &Response{Reply: true, Text: fmt.Sprintf(g.tr("Description of group %s has been removed"), groupAlias)}
+	}
+	return &Response{Reply: true, Text: fmt.Sprintf(g.tr("Description of group %s has been successfully updated"), groupAlias)}
+}
+
+// addSynonym handles /alias command and returns corresponding response
+// about success or failure executing command
+//
+// requires exactly two arguments - group alias and its synonym
+func (g *GroupBot) addSynonym(ctx context.Context, msg Message, args []string) *Response {
+	groupAlias, synonym := groups.NormalizeAlias(args[0]), groups.NormalizeAlias(args[1])
+
+	if problem := g.validateAlias(synonym); problem != "" {
+		return g.invalidArguments(ctx, problem)
+	}
+
+	err := g.Store.AddSynonym(g.withChange(ctx, msg, groups.ActionAddSynonym, ""), msg.ChatID, groupAlias, synonym)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while adding synonym %s to group %s:%s: %+v", synonym, msg.ChatID, groupAlias, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{group: groupAlias, target: synonym})
+	}
+	g.purgeHistory(ctx, msg)
+
+	return &Response{
+		Reply: true,
+		Text: fmt.Sprintf(g.tr("%s is now a synonym of group %s"), synonym, groupAlias) +
+			g.usernameCollisionWarning(ctx, msg, synonym),
+	}
+}
+
+// deleteSynonym handles /unalias command and returns corresponding response
+// about success or failure executing command
+//
+// requires exactly one argument - synonym of the group
+func (g *GroupBot) deleteSynonym(ctx context.Context, msg Message, args []string) *Response {
+	synonym := groups.NormalizeAlias(args[0])
+
+	err := g.Store.DeleteSynonym(g.withChange(ctx, msg, groups.ActionDeleteSynonym, ""), msg.ChatID, synonym)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while deleting synonym %s:%s: %+v", msg.ChatID, synonym, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{group: synonym})
+	}
+	g.purgeHistory(ctx, msg)
+
+	return &Response{Reply: true, Text: fmt.Sprintf(g.tr("Synonym %s has been successfully deleted"), synonym)}
+}
+
+// showGroup handles /group command and returns details of the group -
+// its description, members and restrictions
+//
+// requires exactly one argument - group alias
+func (g *GroupBot) showGroup(ctx context.Context, msg Message, args []string) *Response {
+	groupAlias := groups.NormalizeAlias(args[0])
+
+	users, err := g.Store.GetGroup(ctx, msg.ChatID, groupAlias)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while getting group %s:%s: %+v", msg.ChatID, groupAlias, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{group: groupAlias})
+	}
+
+	settings, err := g.Store.GetGroupSettings(ctx, msg.ChatID, groupAlias)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while getting settings of group %s:%s: %+v", msg.ChatID, groupAlias, err)
+	}
+
+	synonyms, err := g.Store.GetSynonyms(ctx, msg.ChatID)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while getting synonyms of group %s:%s: %+v", msg.ChatID, groupAlias, err)
+	}
+
+	// the group might be requested by its synonym
+	for canonical, groupSynonyms := range synonyms {
+		if contains(groupSynonyms, groupAlias) {
+			groupAlias = canonical
+		}
+	}
+
+	lines := []string{fmt.Sprintf(g.tr("Group %s"), escapeUnderscores(groupAlias))}
+	if settings.Description != "" {
+		lines = append(lines, escapeMarkdown(settings.Description))
+	}
+	if len(synonyms[groupAlias]) > 0 {
+		lines = append(lines, g.tr("Synonyms: ")+escapeUnderscores(strings.Join(synonyms[groupAlias], ", ")))
+	}
+	lines = append(lines, fmt.Sprintf(g.tr("Members (%d): %s"), len(users),
+		removeUsersPings(escapeUnderscores(strings.Join(users, ", ")))))
+	if settings.AdminsOnly {
+		lines = append(lines, g.tr("Can be pinged only by admins"))
+	}
+	if settings.Cooldown > 0 {
+		lines = append(lines, fmt.Sprintf(g.tr("Can be pinged once in %s"), settings.Cooldown))
+	}
+
+	return &Response{Reply: true, Text: strings.Join(lines, "\n")}
+}
+
+// setGroupAdminsOnly handles /group_admins_only command and returns corresponding response
+// about success or failure executing command
+//
+// requires exactly two arguments - group alias and "on" or "off"
+func (g *GroupBot) setGroupAdminsOnly(ctx context.Context, msg Message, args []string) *Response {
+	groupAlias := groups.NormalizeAlias(args[0])
+
+	settings, err := g.Store.GetGroupSettings(ctx, msg.ChatID, groupAlias)
+	if err == nil {
+		settings.AdminsOnly = args[1] == "on"
+		err = g.Store.PutGroupSettings(g.withChange(ctx, msg, groups.ActionAdminsOnly, args[1]), msg.ChatID, groupAlias, settings)
+	}
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while setting admins only flag of group %s:%s: %+v", msg.ChatID, groupAlias, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{group: groupAlias})
+	}
+	g.purgeHistory(ctx, msg)
+
+	if settings.AdminsOnly {
+		return &Response{Reply: true, Text: fmt.Sprintf(g.tr("Group %s now can be pinged only by admins"), groupAlias)}
+	}
+	return &Response{Reply: true, Text: fmt.Sprintf(g.tr("Group %s now can be pinged by anyone"), groupAlias)}
+}
+
+// setGroupCooldown handles /group_cooldown command and returns corresponding response
+// about success or failure executing command
+//
+// requires exactly two arguments - group alias and duration, e.g. 10m, or "off"
+// to fall back to the default cooldown
+func (g *GroupBot) setGroupCooldown(ctx context.Context, msg Message, args []string) *Response {
+	cooldown, _ := parseCooldown(args[1])
+	groupAlias := groups.NormalizeAlias(args[0])
+
+	settings, err := g.Store.GetGroupSettings(ctx, msg.ChatID, groupAlias)
+	if err == nil {
+		settings.Cooldown = cooldown
+		err = g.Store.PutGroupSettings(g.withChange(ctx, msg, groups.ActionCooldown, args[1]), msg.ChatID, groupAlias, settings)
 	}
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while setting cooldown of group %s:%s: %+v", msg.ChatID, groupAlias, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{group: groupAlias})
+	}
+	g.purgeHistory(ctx, msg)
+
+	if cooldown == 0 {
+		return &Response{Reply: true, Text: fmt.Sprintf(g.tr("Group %s now uses the default cooldown"), groupAlias)}
+	}
+	return &Response{Reply: true, Text: fmt.Sprintf(g.tr("Group %s now can be pinged once in %s"), groupAlias, cooldown)}
+}
+
+// addUserToGroup handles /add_user_to_group command and returns corresponding response
+// about success or failure executing command
+//
+// requires at least two arguments - group alias and usernames of users, to be added
+func (g *GroupBot) addUserToGroup(ctx context.Context, msg Message, args []string) *Response {
+	groupAlias := groups.NormalizeAlias(args[0])
+	users := groups.PrefixUsernames(args[1:])
+
+	added, err := g.Store.AddUsers(g.withChange(ctx, msg, groups.ActionAddUsers, ""), msg.ChatID, groupAlias, users)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while adding users to the group %s:%s: %+v", msg.ChatID, groupAlias, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{group: groupAlias})
+	}
+	g.purgeHistory(ctx, msg)
+
+	var text string
+	switch {
+	case len(users) == 1 && added == 1:
+		text = fmt.Sprintf(g.tr("User %s has been successfully added to the group %s"), removeUsersPings(users[0]), groupAlias)
+	case len(users) == 1:
+		text = fmt.Sprintf(g.tr("User %s is already a member of group %s"), removeUsersPings(users[0]), groupAlias)
+	case added == len(users):
+		text = fmt.Sprintf(g.tr("%d users have been successfully added to the group %s"), added, groupAlias)
+	default:
+		text = fmt.Sprintf(g.tr("%d of %d users have been added to the group %s, the rest are already there"),
+			added, len(users), groupAlias)
+	}
+	return &Response{Reply: true, Text: text}
 }
 
 // listGroups handles /list_groups command and returns list of existing
 // group in this chat
 //
 // does not require any arguments
-func (g *GroupBot) listGroups(msg Message, _ []string) *Response {
-	groupList, err := g.Store.GetGroups(msg.ChatID)
+func (g *GroupBot) listGroups(ctx context.Context, msg Message, _ []string) *Response {
+	groupList, err := g.Store.GetGroups(ctx, msg.ChatID)
+	if err != nil && errors.Is(err, groups.ErrChatNotFound) {
+		return &Response{Reply: true, Text: g.tr("There's no groups in this chat yet")}
+	}
 	if err != nil {
-		log.Printf("[WARN] error while listing groups of chat %s: %+v", msg.ChatID, err)
+		logging.Printf(ctx, "[WARN] error while listing groups of chat %s: %+v", msg.ChatID, err)
+		setCommandResult(ctx, metrics.ResultFailed)
 		if g.RespondAllCommands {
 			return &Response{
 				Reply: true,
-				Text:  "Internal error",
+				Text:  g.tr("Internal error"),
 			}
 		}
 		return nil
@@ -204,19 +956,39 @@ func (g *GroupBot) listGroups(msg Message, _ []string) *Response {
 
 	// if no groups are registered in the store - send corresponding response
 	if len(groupList) == 0 {
-		return &Response{Reply: true, Text: "There's no groups in this chat yet"}
+		return &Response{Reply: true, Text: g.tr("There's no groups in this chat yet")}
+	}
+
+	settings, err := g.Store.GetAllGroupSettings(ctx, msg.ChatID)
+	if err != nil {
+		// descriptions are optional, so listing groups without them
+		logging.Printf(ctx, "[WARN] error while listing settings of groups of chat %s: %+v", msg.ChatID, err)
+	}
+
+	synonyms, err := g.Store.GetSynonyms(ctx, msg.ChatID)
+	if err != nil {
+		// synonyms are optional too
+		logging.Printf(ctx, "[WARN] error while listing synonyms of groups of chat %s: %+v", msg.ChatID, err)
 	}
 
 	var groupStrings []string
 
 	// preparing output text in format
-	// @group: @user1, @user2, ...
-	for alias, users := range groupList {
-		groupStrings = append(groupStrings, fmt.Sprintf("%s : %s", alias,
+	// @group (@synonym1, @synonym2): @user1, @user2, ... - description
+	for _, alias := range sortedKeys(groupList) {
+		name := alias
+		if len(synonyms[alias]) > 0 {
+			name = fmt.Sprintf("%s (%s)", alias, strings.Join(synonyms[alias], ", "))
+		}
+		line := fmt.Sprintf("%s : %s", name,
 			removeUsersPings(escapeUnderscores(
-				strings.Join(users, ", "),
+				strings.Join(groupList[alias], ", "),
 			)),
-		))
+		)
+		if descr := settings[alias].Description; descr != "" {
+			line += " - " + escapeMarkdown(descr)
+		}
+		groupStrings = append(groupStrings, line)
 	}
 
 	return &Response{Reply: true, Text: strings.Join(groupStrings, "\n")}
@@ -226,120 +998,523 @@ func (g *GroupBot) listGroups(msg Message, _ []string) *Response {
 // about success or failure executing command
 //
 // requires exactly one argument - group alias
-func (g *GroupBot) deleteGroup(msg Message, args []string) *Response {
-	// command requires exactly one argument - group alias
-	if len(args) != 1 {
-		if g.RespondAllCommands {
-			return &Response{Reply: true, Text: "Command requires exactly one argument - group alias"}
-		}
-		return nil
+func (g *GroupBot) deleteGroup(ctx context.Context, msg Message, args []string) *Response {
+	groupAlias := groups.NormalizeAlias(args[0])
+
+	// the store keeps the tombstone of the group with its settings and synonyms
+	err := g.Store.DeleteGroup(g.withChange(ctx, msg, groups.ActionDeleteGroup, ""), msg.ChatID, groupAlias)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while deleting group %s:%s: %+v", msg.ChatID, groupAlias, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{group: groupAlias})
 	}
+	g.purgeHistory(ctx, msg)
+	return &Response{Reply: true, Text: fmt.Sprintf(g.tr("Group %s has been successfully deleted"), groupAlias)}
+}
 
-	groupAlias := args[0]
-	err := g.Store.DeleteGroup(msg.ChatID, groupAlias)
+// deleteUserFromGroup handles /delete_user_from_group command and returns corresponding response
+// about success or failure executing command
+//
+// requires at least two arguments - group alias and usernames of users, to be deleted
+func (g *GroupBot) deleteUserFromGroup(ctx context.Context, msg Message, args []string) *Response {
+	groupAlias := groups.NormalizeAlias(args[0])
+	users := groups.PrefixUsernames(args[1:])
+
+	removed, err := g.Store.DeleteUsers(g.withChange(ctx, msg, groups.ActionDeleteUsers, ""), msg.ChatID, groupAlias, users)
 	if err != nil {
-		log.Printf("[WARN] error while deleting group %s:%s: %+v", msg.ChatID, groupAlias, err)
-		if g.RespondAllCommands {
+		logging.Printf(ctx, "[WARN] error while deleting users from group %s:%s: %+v", msg.ChatID, groupAlias, err)
+		if len(users) > 1 && errors.Is(err, groups.ErrUserNotInGroup) && g.RespondAllCommands {
 			return &Response{
 				Reply: true,
-				Text:  "Internal error",
+				Text:  escapeUnderscores(fmt.Sprintf(g.tr("None of the users are members of group %s"), groupAlias)),
 			}
 		}
-		return nil
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{group: groupAlias, user: users[0]})
+	}
+	g.purgeHistory(ctx, msg)
+
+	var text string
+	switch {
+	case len(users) == 1:
+		text = fmt.Sprintf(g.tr("User %s has been successfully deleted from group %s"), removeUsersPings(users[0]), groupAlias)
+	case removed == len(users):
+		text = fmt.Sprintf(g.tr("%d users have been successfully deleted from group %s"), removed, groupAlias)
+	default:
+		text = fmt.Sprintf(g.tr("%d of %d users have been deleted from group %s, the rest are not its members"),
+			removed, len(users), groupAlias)
 	}
-	return &Response{Reply: true, Text: fmt.Sprintf("Group %s has been successfully deleted", groupAlias)}
+	return &Response{Reply: true, Text: text}
 }
 
-// deleteUserFromGroup handles /delete_user_from_group command and returns corresponding response
+// addGroup handles /add_group command and returns corresponding response
 // about success or failure executing command
 //
-// requires exactly two arguments - group alias and username of user, to be deleted
-func (g *GroupBot) deleteUserFromGroup(msg Message, args []string) *Response {
-	// command requires exactly one group alias and exactly one username
-	if len(args) != 2 {
-		if g.RespondAllCommands {
-			return &Response{Reply: true, Text: "Command requires exactly two arguments - group alias and username"}
+// requires at least two arguments - group alias and usernames, the existing
+// group is replaced only if --force flag is present among arguments
+func (g *GroupBot) addGroup(ctx context.Context, msg Message, args []string) *Response {
+	force := false
+	var rest []string
+	for _, arg := range args {
+		if arg == forceFlag {
+			force = true
+			continue
 		}
-		return nil
+		rest = append(rest, arg)
 	}
+	args = rest
 
-	groupAlias := args[0]
-	user := args[1]
+	groupAlias := groups.NormalizeAlias(args[0])
+	users := groups.PrefixUsernames(args[1:])
 
-	err := g.Store.DeleteUserFromGroup(msg.ChatID, groupAlias, user)
+	if problem := g.validateAlias(groupAlias); problem != "" {
+		return g.invalidArguments(ctx, problem)
+	}
+
+	text := g.tr("Group %s has been successfully added")
+	err := g.Store.CreateGroup(g.withChange(ctx, msg, groups.ActionCreateGroup, ""), msg.ChatID, groupAlias, users)
+	if errors.Is(err, groups.ErrGroupExists) && force {
+		text = g.tr("Group %s has been successfully replaced")
+		err = g.Store.PutGroup(g.withChange(ctx, msg, groups.ActionReplaceGroup, ""), msg.ChatID, groupAlias, users)
+	}
 	if err != nil {
-		log.Printf("[WARN] error while deleting user from group %s:%s: %+v", msg.ChatID, groupAlias, err)
-		if g.RespondAllCommands {
-			return &Response{
-				Reply: true,
-				Text:  "Internal error",
-			}
+		logging.Printf(ctx, "[WARN] error while adding group alias %s:%s: %+v", msg.ChatID, groupAlias, err)
+		if errors.Is(err, groups.ErrGroupExists) && !force && g.RespondAllCommands {
+			return &Response{Reply: true, Text: escapeUnderscores(fmt.Sprintf(
+				g.tr("Group or synonym %s already exists, add %s to replace members of the group"), groupAlias, forceFlag,
+			))}
 		}
-		return nil
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{target: groupAlias})
 	}
+	g.purgeHistory(ctx, msg)
 
 	return &Response{
 		Reply: true,
-		Text:  fmt.Sprintf("User %s has been successfully deleted from group %s", removeUsersPings(user), groupAlias),
+		Text:  fmt.Sprintf(text, groupAlias) + g.usernameCollisionWarning(ctx, msg, groupAlias),
 	}
 }
 
-// addGroup handles /add_group command and returns corresponding response
-// about success or failure executing command
+// groupHistory handles /group_history command and returns the latest changes of the group
 //
-// requires at least two arguments - group alias and usernames
-func (g *GroupBot) addGroup(msg Message, args []string) *Response {
-	// command requires group alias and at least one username
-	if len(args) < 2 {
-		if g.RespondAllCommands {
-			return &Response{Reply: true, Text: "Not enough parameters to add group"}
+// requires group alias and optional number of changes to show
+func (g *GroupBot) groupHistory(ctx context.Context, msg Message, args []string) *Response {
+	limit := defaultHistorySize
+	if len(args) == 2 {
+		limit, _ = strconv.Atoi(args[1])
+	}
+	if limit > maxHistorySize {
+		limit = maxHistorySize
+	}
+
+	groupAlias := groups.NormalizeAlias(args[0])
+	entries, err := g.Store.GetAuditLog(ctx, msg.ChatID, groupAlias, limit)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while getting history of group %s:%s: %+v", msg.ChatID, groupAlias, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{group: groupAlias})
+	}
+	if len(entries) == 0 {
+		return &Response{Reply: true, Text: escapeUnderscores(fmt.Sprintf(g.tr("There's no history of group %s yet"), groupAlias))}
+	}
+
+	lines := []string{escapeUnderscores(fmt.Sprintf(g.tr("Latest changes of group %s:"), groupAlias))}
+	for _, entry := range entries {
+		lines = append(lines, formatAuditEntry(entry))
+	}
+	return &Response{Reply: true, Text: strings.Join(lines, "\n")}
+}
+
+// undo handles /undo command and reverts the latest deletion of the group, removal or
+// replacement of its members, made by the sender of the message within the undo window,
+// only these changes keep tombstones, so other ones, e.g. renames, are not reverted
+//
+// requires no arguments
+func (g *GroupBot) undo(ctx context.Context, msg Message, args []string) *Response {
+	tombstones, err := g.Store.GetTombstones(ctx, msg.ChatID)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while getting tombstones of chat %s: %+v", msg.ChatID, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{})
+	}
+
+	actor, since := messageActor(msg), messageTime(msg).Add(-g.UndoWindow)
+	for _, tombstone := range tombstones {
+		if tombstone.Actor == actor && !tombstone.At.Before(since) {
+			return g.restore(ctx, msg, tombstone)
 		}
-		return nil
 	}
 
-	groupAlias := args[0]
-	users := args[1:]
+	if g.RespondAllCommands {
+		return &Response{Reply: true, Text: g.tr("Nothing to undo")}
+	}
+	return nil
+}
 
-	for i := range users {
-		if !strings.HasPrefix(users[i], aliasPrefix) {
-			users[i] = aliasPrefix + users[i]
+// restoreGroup handles /restore_group command and restores the latest deleted
+// group with the given alias along with its settings and synonyms
+//
+// requires exactly one argument - group alias
+func (g *GroupBot) restoreGroup(ctx context.Context, msg Message, args []string) *Response {
+	groupAlias := groups.NormalizeAlias(args[0])
+	tombstones, err := g.Store.GetTombstones(ctx, msg.ChatID)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while getting tombstones of chat %s: %+v", msg.ChatID, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{group: groupAlias})
+	}
+
+	for _, tombstone := range tombstones {
+		if tombstone.GroupDeleted && tombstone.Group == groupAlias {
+			return g.restore(ctx, msg, tombstone)
 		}
 	}
 
-	err := g.Store.PutGroup(msg.ChatID, groupAlias, users)
+	if g.RespondAllCommands {
+		return &Response{Reply: true, Text: escapeUnderscores(fmt.Sprintf(g.tr("There's no deleted group %s to restore"), groupAlias))}
+	}
+	return nil
+}
+
+// restore reverts the change, kept in the tombstone, and removes the tombstone
+func (g *GroupBot) restore(ctx context.Context, msg Message, tombstone groups.Tombstone) *Response {
+	action := groups.ActionRestoreUsers
+	if tombstone.GroupDeleted {
+		action = groups.ActionRestoreGroup
+	}
+	err := g.Store.RestoreTombstone(g.withChange(ctx, msg, action, ""), msg.ChatID, tombstone)
+	if errors.Is(err, groups.ErrTombstoneNotFound) {
+		return &Response{Reply: true, Text: g.tr("The change has already been reverted")}
+	}
 	if err != nil {
-		log.Printf("[WARN] error while adding group alias %s:%s: %+v", msg.ChatID, groupAlias, err)
-		if g.RespondAllCommands {
-			return &Response{
-				Reply: true,
-				Text:  "Internal error",
-			}
+		logging.Printf(ctx, "[WARN] error while restoring group %s:%s: %+v", msg.ChatID, tombstone.Group, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{group: tombstone.Group, target: tombstone.Group})
+	}
+
+	g.purgeHistory(ctx, msg)
+
+	text := fmt.Sprintf(g.tr("%d users have been successfully restored to group %s"), len(tombstone.Members), tombstone.Group)
+	switch {
+	case tombstone.GroupDeleted:
+		text = fmt.Sprintf(g.tr("Group %s has been successfully restored with %d members"), tombstone.Group, len(tombstone.Members))
+	case tombstone.Replaced:
+		text = fmt.Sprintf(g.tr("Previous %d members of group %s have been successfully restored"), len(tombstone.Members), tombstone.Group)
+	}
+	return &Response{Reply: true, Text: escapeUnderscores(text)}
+}
+
+// exportGroups handles /export_groups command and sends all groups of the chat
+// with their settings and synonyms as a document
+//
+// requires optional format of the document - json or yaml, json by default
+func (g *GroupBot) exportGroups(ctx context.Context, msg Message, args []string) *Response {
+	format := exportFormat(args)
+
+	snapshots, err := groups.ExportGroups(ctx, g.Store, msg.ChatID)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while exporting groups of chat %s: %+v", msg.ChatID, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{})
+	}
+	if len(snapshots) == 0 {
+		return &Response{Reply: true, Text: g.tr("There's no groups in this chat yet")}
+	}
+
+	data, err := groups.MarshalDocument(groups.NewDocument(msg.ChatID, snapshots), format)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] error while exporting groups of chat %s: %+v", msg.ChatID, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{})
+	}
+	return &Response{
+		Reply: true,
+		Text:  fmt.Sprintf(g.tr("%d groups of the chat"), len(snapshots)),
+		File:  &File{Name: "groups." + format, Data: data},
+	}
+}
+
+// importGroups handles /import_groups command, the document is taken from the attached
+// file or from the text after the command, groups of the document are created or replaced
+// with their settings and synonyms, other groups of the chat are kept as is
+//
+// requires the document in format of /export_groups
+func (g *GroupBot) importGroups(ctx context.Context, msg Message, _ []string) *Response {
+	data := []byte(documentFromText(msg.Text))
+	if msg.File != nil {
+		data = msg.File.Data
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return g.invalidArguments(ctx, g.tr("Command requires the document with groups, attached or put after the command"))
+	}
+
+	invalid := func(problem string) *Response {
+		return g.invalidArguments(ctx, g.tr("Invalid document: ")+escapeMarkdown(problem))
+	}
+
+	doc, err := groups.UnmarshalDocument(data)
+	if err != nil {
+		return invalid(err.Error())
+	}
+	snapshots, err := doc.Snapshots()
+	if err != nil {
+		return invalid(err.Error())
+	}
+
+	current, err := groups.ExportGroups(ctx, g.Store, msg.ChatID)
+	if err != nil && !errors.Is(err, groups.ErrChatNotFound) {
+		logging.Printf(ctx, "[WARN] error while importing groups of chat %s: %+v", msg.ChatID, err)
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{})
+	}
+	diff := groups.DiffSnapshots(current, snapshots)
+	if len(diff) == 0 {
+		return &Response{Reply: true, Text: g.tr("Nothing to import, groups are up to date")}
+	}
+
+	if err = g.Store.ImportGroups(g.withChange(ctx, msg, groups.ActionImportGroup, ""), msg.ChatID, snapshots); err != nil {
+		logging.Printf(ctx, "[WARN] error while importing groups of chat %s: %+v", msg.ChatID, err)
+		if errors.Is(err, groups.ErrGroupExists) && g.RespondAllCommands {
+			return &Response{Reply: true, Text: g.tr("Some alias of the document is already used as a synonym of another group")}
+		}
+		return g.prepareStoreErrorMessage(ctx, err, storeErrSubjects{})
+	}
+
+	g.purgeHistory(ctx, msg)
+
+	lines := []string{fmt.Sprintf(g.tr("%d groups have been successfully imported, changes:"), len(snapshots))}
+	for _, line := range diff {
+		lines = append(lines, escapeMarkdown(removeUsersPings(line)))
+	}
+	return &Response{Reply: true, Text: strings.Join(lines, "\n")}
+}
+
+// documentFromText returns the text after the command, surrounding
+// code block markers with the language of the block are removed
+func documentFromText(text string) string {
+	idx := strings.IndexAny(text, " \t\n")
+	if idx < 0 {
+		return ""
+	}
+	doc := strings.TrimSpace(text[idx:])
+	if !strings.HasPrefix(doc, "```") {
+		return doc
+	}
+	doc = strings.TrimSuffix(strings.TrimPrefix(doc, "```"), "```")
+	// the first line of the code block might be its language, e.g. ```yaml
+	if nl := strings.Index(doc, "\n"); nl >= 0 && !strings.ContainsAny(doc[:nl], ":{") {
+		doc = doc[nl+1:]
+	}
+	return doc
+}
+
+// withChange returns the context, which makes the store record the change, made by the
+// sender of the message, into the audit log and keep the tombstone of removed data
+// along with the change itself
+func (g *GroupBot) withChange(ctx context.Context, msg Message, action, details string) context.Context {
+	return groups.WithChange(ctx, groups.Change{
+		Actor:   messageActor(msg),
+		Action:  action,
+		Details: details,
+		At:      messageTime(msg),
+	})
+}
+
+// purgeHistory removes entries of the audit log and tombstones of the chat, that are older
+// than their retention, failures are only logged, as the change itself has been already made
+func (g *GroupBot) purgeHistory(ctx context.Context, msg Message) {
+	if g.AuditRetention > 0 {
+		if _, err := g.Store.PurgeAuditLog(ctx, msg.ChatID, messageTime(msg).Add(-g.AuditRetention)); err != nil {
+			logging.Printf(ctx, "[WARN] failed to purge audit log of chat %s: %+v", msg.ChatID, err)
 		}
+	}
+	if g.TombstoneRetention > 0 {
+		if _, err := g.Store.PurgeTombstones(ctx, msg.ChatID, messageTime(msg).Add(-g.TombstoneRetention)); err != nil {
+			logging.Printf(ctx, "[WARN] failed to purge tombstones of chat %s: %+v", msg.ChatID, err)
+		}
+	}
+}
+
+// messageActor returns the username of the sender, prefixed with aliasPrefix, or id, if there's no username
+func messageActor(msg Message) string {
+	if msg.From == nil {
+		return ""
+	}
+	if msg.From.Username != "" {
+		return aliasPrefix + msg.From.Username
+	}
+	return msg.From.ID
+}
+
+// messageTime returns the time, when the message was sent, or the current time, if it is unknown
+func messageTime(msg Message) time.Time {
+	if msg.Sent.IsZero() {
+		return time.Now()
+	}
+	return msg.Sent
+}
+
+// formatAuditEntry describes the change in a single line in format
+// 2020-05-01 10:00 UTC user action: +added, -removed - details
+func formatAuditEntry(entry groups.AuditEntry) string {
+	line := fmt.Sprintf("%s %s %s", entry.At.UTC().Format("2006-01-02 15:04 MST"),
+		removeUsersPings(entry.Actor), strings.ReplaceAll(entry.Action, "_", " "))
+
+	var diff []string
+	for _, u := range groups.Subtract(entry.NewMembers, entry.OldMembers) {
+		diff = append(diff, "+"+removeUsersPings(u))
+	}
+	for _, u := range groups.Subtract(entry.OldMembers, entry.NewMembers) {
+		diff = append(diff, "-"+removeUsersPings(u))
+	}
+	if len(diff) > 0 {
+		line += ": " + strings.Join(diff, ", ")
+	}
+	if entry.Details != "" {
+		line += " - " + entry.Details
+	}
+	return escapeMarkdown(line)
+}
+
+// Name returns the name of the bot
+func (g *GroupBot) Name() string {
+	return groupBotName
+}
+
+// Help returns the usage of this bot, nothing, if the bot is disabled in the chat by configuration
+func (g *GroupBot) Help(_ context.Context, chatID string) string {
+	if overrides, ok := g.ChatOverrides[chatID]; ok && overrides.Enabled != nil && !*overrides.Enabled {
+		return ""
+	}
+	return "Groups bot - gathers usernames into one mention, like @admins\n" + g.router().Help() +
+		"\n@group\\_alias - triggers bot to send message with all participants of the group"
+}
+
+// validateAlias checks that the alias can be mentioned in the text and does not
+// have any special meaning, returns the explanation for user if it is not so
+func (g *GroupBot) validateAlias(alias string) (problem string) {
+	err := groups.ValidateAlias(alias)
+	switch {
+	case errors.Is(err, groups.ErrReservedAlias):
+		return fmt.Sprintf(g.tr("Group alias %s is reserved"), alias)
+	case err != nil:
+		return fmt.Sprintf(g.tr("Invalid group alias %s, it must start with @ and contain only letters, digits, underscores and hyphens between them"),
+			escapeUnderscores(alias))
+	}
+	return ""
+}
+
+// positiveNumber returns true if the argument is a positive integer
+func positiveNumber(arg string) bool {
+	n, err := strconv.Atoi(arg)
+	return err == nil && n > 0
+}
+
+// exportFormat returns the format of the document, requested by arguments
+// of /export_groups command, json by default, empty if the format is unknown
+func exportFormat(args []string) string {
+	if len(args) == 0 {
+		return groups.FormatJSON
+	}
+	if format := strings.ToLower(args[0]); format == groups.FormatJSON || format == groups.FormatYAML {
+		return format
+	}
+	return ""
+}
+
+// parseCooldown parses the cooldown of the group, "off" means the default one
+func parseCooldown(arg string) (time.Duration, error) {
+	if arg == "off" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(arg)
+	if err == nil && d < 0 {
+		return 0, fmt.Errorf("negative cooldown %s", arg)
+	}
+	return d, err
+}
+
+// usernameCollisionWarning returns a warning, if the alias matches the username of
+// the known chat member, as the mention of such alias pings the user too
+func (g *GroupBot) usernameCollisionWarning(ctx context.Context, msg Message, alias string) string {
+	var usernames []string
+
+	if msg.From != nil {
+		usernames = append(usernames, msg.From.Username)
+	}
+
+	groupList, err := g.Store.GetGroups(ctx, msg.ChatID)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] failed to get groups of chat %s to check alias collisions: %+v", msg.ChatID, err)
+	}
+	for _, members := range groupList {
+		usernames = append(usernames, members...)
+	}
+
+	if g.GetGroupMembers != nil {
+		users, err := g.GetGroupMembers(ctx, msg.ChatID)
+		if err != nil {
+			logging.Printf(ctx, "[WARN] failed to get members of chat %s to check alias collisions: %+v", msg.ChatID, err)
+		}
+		for _, u := range users {
+			usernames = append(usernames, u.Username)
+		}
+	}
+
+	for _, u := range usernames {
+		if u != "" && strings.EqualFold(aliasPrefix+strings.TrimPrefix(u, aliasPrefix), alias) {
+			return "\n" + fmt.Sprintf(g.tr("Warning: %s is also a username of the chat member, who will be pinged along with the group"),
+				escapeUnderscores(alias))
+		}
+	}
+	return ""
+}
+
+// tr translates the text into the language of the chat
+func (g *GroupBot) tr(text string) string {
+	return translate(g.chat.Lang(), text)
+}
+
+// storeErrSubjects names entities, that the failed store operation was applied to
+type storeErrSubjects struct {
+	group  string // group or synonym, that was supposed to exist
+	target string // alias, that was supposed to be free
+	user   string // member of the group
+}
+
+// prepareStoreErrorMessage creates a response to the failed store operation,
+// explaining the reason of failure, if it is known - if in bot parameters
+// defined to respond all commands - it will return a message, otherwise - nothing
+func (g *GroupBot) prepareStoreErrorMessage(ctx context.Context, err error, subj storeErrSubjects) *Response {
+	setCommandResult(ctx, metrics.ResultFailed)
+	if !g.RespondAllCommands {
 		return nil
 	}
 
-	return &Response{Reply: true, Text: fmt.Sprintf("Group %s has been successfully added", groupAlias)}
+	text := g.tr("Internal error")
+	switch {
+	case errors.Is(err, groups.ErrChatNotFound):
+		text = g.tr("There's no groups in this chat yet")
+	case errors.Is(err, groups.ErrGroupNotFound):
+		text = fmt.Sprintf(g.tr("Group %s does not exist"), subj.group)
+	case errors.Is(err, groups.ErrSynonymNotFound):
+		text = fmt.Sprintf(g.tr("Synonym %s does not exist"), subj.group)
+	case errors.Is(err, groups.ErrGroupExists):
+		text = fmt.Sprintf(g.tr("Group or synonym %s already exists"), subj.target)
+	case errors.Is(err, groups.ErrUserNotInGroup):
+		text = fmt.Sprintf(g.tr("User %s is not a member of group %s"), removeUsersPings(subj.user), subj.group)
+	}
+	return &Response{Reply: true, Text: escapeUnderscores(text)}
 }
 
-// Help returns the usage of this bot
-func (g *GroupBot) Help() string {
-	return `Groups bot - gathers usernames into one mention, like @admins
-/add\_group @group\_alias @user1, @user2, ... - add user
-/delete\_user\_from\_group @group\_alias @user - removes user from the group
-/delete\_group @group\_alias - removes group
-/list\_groups - shows the list of existing groups
-/add\_user\_to\_group @group\_alias @user - adds user to the specified group
-@group\_alias - triggers bot to send message with all participants of the group`
+// invalidArguments marks the command as called with invalid arguments and
+// explains the problem to the user, if the bot responds to all commands
+func (g *GroupBot) invalidArguments(ctx context.Context, problem string) *Response {
+	setCommandResult(ctx, metrics.ResultInvalid)
+	if !g.RespondAllCommands {
+		return nil
+	}
+	return &Response{Reply: true, Text: problem}
 }
 
-// prepareIllegalAccessMessage creates a response to the illegal
-// command execution - if in bot parameters defined to respond all
-// commands - it will return a message, otherwise - nothing
-func (g *GroupBot) prepareIllegalAccessMessage() *Response {
-	if g.RespondAllCommands {
-		return &Response{Reply: true, Text: "You don't have admin rights to execute this command"}
+// commandResultKey is the context key of the pointer to the result of the executed command
+type commandResultKey struct{}
+
+// setCommandResult sets the result of the command, that is being executed
+func setCommandResult(ctx context.Context, result string) {
+	if res, ok := ctx.Value(commandResultKey{}).(*string); ok {
+		*res = result
 	}
-	return nil
 }
 
 // removeUsersPings removes all aliasPrefix occurrences from string to not ping user in chat
@@ -352,20 +1527,35 @@ func escapeUnderscores(s string) string {
 	return strings.ReplaceAll(s, "_", "\\_")
 }
 
+// markdownEscaper escapes all characters, that have special meaning in telegram markdown
+var markdownEscaper = strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[")
+
+// escapeMarkdown escapes the user-provided text to show it as is
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
 // unique returns slice of unique string occurrences from the source one
+// in order of their first occurrence
 func unique(sl []string) []string {
 	m := make(map[string]struct{})
+	var res []string
 	for _, s := range sl {
+		if _, ok := m[s]; ok {
+			continue
+		}
 		m[s] = struct{}{}
-	}
-	var res []string
-	for s := range m {
 		res = append(res, s)
 	}
 	return res
 }
 
-// remove all excess whitespaces from string
-func removeRedundantWhitespaces(s string) string {
-	return strings.Join(strings.Fields(strings.TrimSpace(s)), " ")
+// sortedKeys returns keys of the map in the sorted order
+func sortedKeys(m map[string][]string) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
 }
@@ -1,40 +1,84 @@
 package bot
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/mock"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/Semior001/multibot-utility/app/metrics"
 	"github.com/Semior001/multibot-utility/app/store/groups"
+	"github.com/Semior001/multibot-utility/app/store/schedule"
+	"github.com/Semior001/multibot-utility/app/store/settings"
 
 	"github.com/stretchr/testify/require"
 )
 
 func TestGroupBot_Help(t *testing.T) {
 	require.Equal(t, `Groups bot - gathers usernames into one mention, like @admins
-/add\_group @group\_alias @user1, @user2, ... - add user
-/delete\_user\_from\_group @group\_alias @user - removes user from the group
+/add\_group @group\_alias @user1, @user2, ... [--force] - adds group, --force replaces members of the existing one
+/delete\_user\_from\_group @group\_alias @user1, @user2, ... - removes users from the group
 /delete\_group @group\_alias - removes group
 /list\_groups - shows the list of existing groups
-/add\_user\_to\_group @group\_alias @user - adds user to the specified group
-@group\_alias - triggers bot to send message with all participants of the group`, (&GroupBot{}).Help())
+/add\_user\_to\_group @group\_alias @user1, @user2, ... - adds users to the specified group
+/rename\_group @group\_alias @new\_alias - renames the group
+/copy\_group @group\_alias @new\_alias - creates a copy of the group
+/describe\_group @group\_alias text - sets the description of the group
+/group @group\_alias - shows details of the group
+/group\_history @group\_alias [N] - shows the last N changes of the group
+/undo - reverts your latest deletion of a group, removal or replacement of its members
+/export\_groups [json|yaml] - sends all groups of the chat as a document
+/import\_groups - creates or replaces groups from the attached document or the one after the command
+/restore\_group @group\_alias - restores the deleted group
+/alias @group\_alias @synonym - adds a synonym, that pings the group too
+/unalias @synonym - removes the synonym of the group
+/group\_admins\_only @group\_alias on|off - allows only admins to ping the group
+/group\_cooldown @group\_alias 10m|off - sets the minimal interval between pings of the group
+/quiet\_hours 22:00-08:00 Europe/Berlin [skip|defer]|off - sets quiet hours of the chat, mentions are deferred until they end or skipped
+/my\_quiet\_hours 22:00-08:00 Europe/Berlin [skip|defer]|off - sets your own quiet hours
+@group\_alias - triggers bot to send message with all participants of the group`, (&GroupBot{}).Help(context.Background(), "chat"))
+
+	disabled := false
+	b := NewGroupBot(GroupBotParams{ChatOverrides: map[string]GroupBotOverrides{"off": {Enabled: &disabled}}})
+	assert.Empty(t, b.Help(context.Background(), "off"), "bot, disabled in the chat, has no help there")
+	assert.NotEmpty(t, b.Help(context.Background(), "on"))
+}
+
+func TestGroupBot_RouterCommandsBuiltOnce(t *testing.T) {
+	b := NewGroupBot(GroupBotParams{Store: groups.NewMemory()})
+	chat := b.withSettings(settings.Settings{Verbosity: settings.VerbositySilent, Language: "ru"})
+
+	r1, r2 := b.router(), chat.router()
+	assert.True(t, &r1.Commands[0] == &r2.Commands[0], "commands are shared by bots of all chats")
+	assert.True(t, r1.Verbose != r2.Verbose || r1.Lang != r2.Lang, "parameters of the chat are applied")
+
+	resp := chat.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup,
+		From: &User{ID: "1", IsAdmin: true}, Text: "/add_group @devs @blah"})
+	require.NotNil(t, resp, "handlers are called on the bot of the chat")
+	assert.Equal(t, "Группа @devs успешно добавлена", resp.Text)
 }
 
 func TestGroupBot_AddGroup(t *testing.T) {
 	mockGroupStore := groups.MockStore{}
 	mockGroupStore.On(
-		"PutGroup",
+		"CreateGroup",
+		mock.Anything,
 		mock.Anything,
 		mock.Anything,
 		mock.Anything,
 	).Return(nil)
+	mockGroupStore.On("GetGroups", mock.Anything, mock.Anything).Return(map[string][]string{}, nil)
 
 	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: false})
 
-	resp := b.OnMessage(Message{
+	resp := b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -50,7 +94,8 @@ func TestGroupBot_AddGroup(t *testing.T) {
 func TestGroupBot_ListGroups(t *testing.T) {
 	mockGroupStore := groups.MockStore{}
 	mockGroupStore.On(
-		"PutGroup",
+		"CreateGroup",
+		mock.Anything,
 		mock.Anything,
 		mock.Anything,
 		mock.Anything,
@@ -58,6 +103,7 @@ func TestGroupBot_ListGroups(t *testing.T) {
 	mockGroupStore.On(
 		"GetGroups",
 		mock.Anything,
+		mock.Anything,
 	).Return(map[string][]string{
 		"@admins_0": {"@test", "@test1", "@test2", "@test3"},
 		"@admins_1": {"@test", "@test1", "@test2", "@test3"},
@@ -70,11 +116,17 @@ func TestGroupBot_ListGroups(t *testing.T) {
 		"@admins_8": {"@test", "@test1", "@test2", "@test3"},
 		"@admins_9": {"@test", "@test1", "@test2", "@test3"},
 	}, nil)
+	mockGroupStore.On("GetAllGroupSettings", mock.Anything, mock.Anything).Return(map[string]groups.GroupSettings{
+		"@admins_1": {Description: "first *admins*"},
+	}, nil)
+	mockGroupStore.On("GetSynonyms", mock.Anything, mock.Anything).Return(map[string][]string{
+		"@admins_2": {"@adm2", "@admins2"},
+	}, nil)
 
 	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: false})
 
 	for i := 0; i < 10; i++ {
-		b.OnMessage(Message{
+		b.OnMessage(context.Background(), Message{
 			ChatType: ChatTypeGroup,
 			From: &User{
 				Username:    "blah",
@@ -85,34 +137,44 @@ func TestGroupBot_ListGroups(t *testing.T) {
 		})
 	}
 
-	resp := b.OnMessage(Message{
+	resp := b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		Text:     "/list_groups",
 	})
 
 	for i := 0; i < 10; i++ {
-		assert.Contains(t, resp.Text, fmt.Sprintf("@admins_%d : test, test1, test2, test3", i))
+		name := fmt.Sprintf("@admins_%d", i)
+		if i == 2 {
+			name += " (@adm2, @admins2)"
+		}
+		assert.Contains(t, resp.Text, name+" : test, test1, test2, test3")
 	}
+	assert.Contains(t, resp.Text, "@admins_1 : test, test1, test2, test3 - first \\*admins\\*\n")
 }
 
 func TestGroupBot_DeleteUserFromGroup(t *testing.T) {
 	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("AddTombstone", mock.Anything, mock.Anything).Return(nil)
+	mockGroupStore.On("GetGroup", mock.Anything, mock.Anything, mock.Anything).Return([]string{}, nil)
 	mockGroupStore.On(
-		"PutGroup",
+		"CreateGroup",
+		mock.Anything,
 		mock.Anything,
 		mock.Anything,
 		mock.Anything,
 	).Return(nil)
+	mockGroupStore.On("GetGroups", mock.Anything, mock.Anything).Return(map[string][]string{}, nil)
 	mockGroupStore.On(
-		"DeleteUserFromGroup",
+		"DeleteUsers",
 		mock.Anything,
 		mock.Anything,
 		mock.Anything,
-	).Return(nil)
+		mock.Anything,
+	).Return(1, nil)
 
 	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: false})
 
-	b.OnMessage(Message{
+	b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -122,7 +184,7 @@ func TestGroupBot_DeleteUserFromGroup(t *testing.T) {
 		Text: "/add_group @admins @test @test1 @test2 @test3",
 	})
 
-	resp := b.OnMessage(Message{
+	resp := b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -137,8 +199,13 @@ func TestGroupBot_DeleteUserFromGroup(t *testing.T) {
 
 func TestGroupBot_DeleteGroup(t *testing.T) {
 	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("AddTombstone", mock.Anything, mock.Anything).Return(nil)
+	mockGroupStore.On("GetSynonyms", mock.Anything, mock.Anything).Return(map[string][]string{}, nil)
+	mockGroupStore.On("GetGroupSettings", mock.Anything, mock.Anything, mock.Anything).Return(groups.GroupSettings{}, nil)
+	mockGroupStore.On("GetGroup", mock.Anything, mock.Anything, mock.Anything).Return([]string{}, nil)
 	mockGroupStore.On(
-		"PutGroup",
+		"CreateGroup",
+		mock.Anything,
 		mock.Anything,
 		mock.Anything,
 		mock.Anything,
@@ -147,15 +214,17 @@ func TestGroupBot_DeleteGroup(t *testing.T) {
 		"DeleteGroup",
 		mock.Anything,
 		mock.Anything,
+		mock.Anything,
 	).Return(nil)
 	mockGroupStore.On(
 		"GetGroups",
 		mock.Anything,
+		mock.Anything,
 	).Return(map[string][]string{}, nil)
 
 	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: false})
 
-	b.OnMessage(Message{
+	b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -165,7 +234,7 @@ func TestGroupBot_DeleteGroup(t *testing.T) {
 		Text: "/add_group @admins @test @test1 @test2 @test3",
 	})
 
-	resp := b.OnMessage(Message{ChatType: ChatTypeGroup,
+	resp := b.OnMessage(context.Background(), Message{ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
 			DisplayName: "blahblah",
@@ -175,7 +244,7 @@ func TestGroupBot_DeleteGroup(t *testing.T) {
 	})
 	assert.Equal(t, "Group @admins has been successfully deleted", resp.Text)
 
-	resp = b.OnMessage(Message{
+	resp = b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		Text:     "/list_groups",
 	})
@@ -184,15 +253,17 @@ func TestGroupBot_DeleteGroup(t *testing.T) {
 
 func TestGroupBot_AddUser(t *testing.T) {
 	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("GetGroup", mock.Anything, mock.Anything, mock.Anything).Return([]string{}, nil)
 	mockGroupStore.On(
-		"AddUser",
+		"AddUsers",
+		mock.Anything,
 		"",
 		"@some_students",
-		"@blah",
-	).Return(nil)
+		[]string{"@blah"},
+	).Return(1, nil)
 	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: false})
 
-	resp := b.OnMessage(Message{
+	resp := b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -208,23 +279,35 @@ func TestGroupBot_AddUser(t *testing.T) {
 func TestGroupBot_Trigger(t *testing.T) {
 	mockGroupStore := groups.MockStore{}
 	mockGroupStore.On(
-		"PutGroup",
+		"CreateGroup",
+		mock.Anything,
 		mock.Anything,
 		mock.Anything,
 		mock.Anything,
 	).Return(nil)
+	mockGroupStore.On("GetGroups", mock.Anything, mock.Anything).Return(map[string][]string{}, nil)
 	mockGroupStore.On(
 		"FindAliases",
+		mock.Anything,
 		mock.Anything, []string{"@some_students", "@kek"},
-	).Return([]string{"@blah", "@blah1", "@blah2", "@blah3", "@blah4"}, nil)
+	).Return(map[string][]string{
+		"@some_students": {"@blah", "@blah1", "@blah2"},
+		"@kek":           {"@blah", "@blah3", "@blah4"},
+	}, nil)
 	mockGroupStore.On(
 		"FindAliases",
+		mock.Anything,
 		mock.Anything, []string{"@kek", "@some_students"},
-	).Return([]string{"@blah", "@blah1", "@blah2", "@blah3", "@blah4"}, nil)
+	).Return(map[string][]string{
+		"@some_students": {"@blah", "@blah1", "@blah2"},
+		"@kek":           {"@blah", "@blah3", "@blah4"},
+	}, nil)
+	mockGroupStore.On("GetGroupSettings", mock.Anything, mock.Anything, mock.Anything).Return(groups.GroupSettings{}, nil)
+	mockGroupStore.On("GetQuietHours", mock.Anything, mock.Anything).Return(map[string]groups.QuietHours{}, nil)
 
 	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: false})
 
-	b.OnMessage(Message{
+	b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -234,7 +317,7 @@ func TestGroupBot_Trigger(t *testing.T) {
 		Text: "/add_group @some_students @blah @blah1 @blah2",
 	})
 
-	b.OnMessage(Message{ChatType: ChatTypeGroup,
+	b.OnMessage(context.Background(), Message{ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
 			DisplayName: "blahblah",
@@ -243,7 +326,7 @@ func TestGroupBot_Trigger(t *testing.T) {
 		Text: "/add_group @kek @blah @blah3 @blah4",
 	})
 
-	b.OnMessage(Message{
+	b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -253,7 +336,7 @@ func TestGroupBot_Trigger(t *testing.T) {
 		Text: "/add_group @lol @blah5 @blah6 @blah7",
 	})
 
-	resp := b.OnMessage(Message{
+	resp := b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		Text:     "There is a reference to @some_students and @kek",
 	})
@@ -268,6 +351,944 @@ func TestGroupBot_Trigger(t *testing.T) {
 	assert.NotContains(t, resp.Text, "@blah7")
 }
 
+func TestGroupBot_UnicodeAliases(t *testing.T) {
+	b := NewGroupBot(GroupBotParams{Store: groups.NewMemory(), RespondAllCommands: true})
+	admin := &User{ID: "1", Username: "admin", IsAdmin: true}
+	send := func(text string) string {
+		resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: text})
+		require.NotNil(t, resp, text)
+		return resp.Text
+	}
+
+	assert.Equal(t, "Group @бэкенд has been successfully added", send("/add_group @Бэкенд @blah @blah1"))
+	assert.Equal(t, "@бэк is now a synonym of group @бэкенд", send("/alias @бэкенд @Бэк"))
+	assert.Equal(t, "@blah @blah1 ", send("Привет, @БЭК-, глянь"), "alias is found in cyrillic text")
+	assert.Equal(t, "Invalid group alias @бэк✓, it must start with @ and contain only letters, digits, "+
+		"underscores and hyphens between them", send("/add_group @бэк✓ @blah"))
+}
+
+func TestGroupBot_TriggerCooldown(t *testing.T) {
+	ctx := context.Background()
+	store := groups.NewMemory()
+	require.NoError(t, store.PutGroup(ctx, "chat", "@devs", []string{"@blah", "@blah1"}))
+	require.NoError(t, store.PutGroup(ctx, "chat", "@admins", []string{"@blah2"}))
+	require.NoError(t, store.PutGroupSettings(ctx, "chat", "@admins", groups.GroupSettings{AdminsOnly: true}))
+
+	sent := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	b := NewGroupBot(GroupBotParams{
+		Store:         store,
+		GroupCooldown: 10 * time.Minute,
+		UserCooldown:  time.Minute,
+	})
+
+	// the user is not charged for groups, that can't be pinged anyway
+	resp := b.OnMessage(ctx, Message{
+		ChatID:   "chat",
+		ChatType: ChatTypeGroup,
+		From:     &User{ID: "1"},
+		Sent:     sent.Add(-30 * time.Second),
+		Text:     "ping @admins",
+	})
+	require.NotNil(t, resp)
+	assert.Equal(t, "Group @admins can be pinged only by admins", resp.Text)
+	last, err := store.GetLastTrigger(ctx, "chat", "user:1")
+	require.NoError(t, err)
+	assert.True(t, last.IsZero())
+
+	resp = b.OnMessage(ctx, Message{
+		ChatID:   "chat",
+		ChatType: ChatTypeGroup,
+		From:     &User{ID: "1"},
+		Sent:     sent,
+		Text:     "ping @devs",
+	})
+	require.NotNil(t, resp)
+	assert.Equal(t, "@blah @blah1 ", resp.Text)
+	for _, subject := range []string{"@devs", "user:1"} {
+		last, err = store.GetLastTrigger(ctx, "chat", subject)
+		require.NoError(t, err)
+		assert.Equal(t, sent, last, subject)
+	}
+
+	// the same user is throttled by user cooldown
+	resp = b.OnMessage(context.Background(), Message{
+		ChatID:   "chat",
+		ChatType: ChatTypeGroup,
+		From:     &User{ID: "1"},
+		Sent:     sent.Add(30 * time.Second),
+		Text:     "ping @devs",
+	})
+	require.NotNil(t, resp)
+	assert.Equal(t, "You can ping groups again in 30s", resp.Text)
+	assert.True(t, resp.Reply)
+
+	// the other user is throttled by group cooldown
+	resp = b.OnMessage(context.Background(), Message{
+		ChatID:   "chat",
+		ChatType: ChatTypeGroup,
+		From:     &User{ID: "2"},
+		Sent:     sent.Add(time.Minute),
+		Text:     "ping @devs",
+	})
+	require.NotNil(t, resp)
+	assert.Equal(t, "Group @devs can be pinged again in 9m0s", resp.Text)
+	assert.True(t, resp.Reply)
+
+	// cooldown is over
+	resp = b.OnMessage(context.Background(), Message{
+		ChatID:   "chat",
+		ChatType: ChatTypeGroup,
+		From:     &User{ID: "2"},
+		Sent:     sent.Add(10 * time.Minute),
+		Text:     "ping @devs",
+	})
+	require.NotNil(t, resp)
+	assert.Equal(t, "@blah @blah1 ", resp.Text)
+}
+
+func TestGroupBot_TriggerCooldownStoreFailed(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("FindAliases", mock.Anything, "chat", mock.Anything).Return(map[string][]string{
+		"@devs": {"@blah"},
+		"@qa":   {"@blah1"},
+	}, nil)
+	mockGroupStore.On("GetGroupSettings", mock.Anything, "chat", mock.Anything).Return(groups.GroupSettings{}, nil)
+	mockGroupStore.On("GetQuietHours", mock.Anything, "chat").Return(map[string]groups.QuietHours{}, nil)
+	mockGroupStore.On("PutLastTriggerAfter", mock.Anything, "chat", "user:1", mock.Anything, time.Minute).
+		Return(time.Time{}, nil).Once()
+	mockGroupStore.On("PutLastTriggerAfter", mock.Anything, "chat", "user:1", mock.Anything, time.Minute).
+		Return(time.Time{}, errors.New("db is closed")).Once()
+	mockGroupStore.On("PutLastTriggerAfter", mock.Anything, "chat", "@devs", mock.Anything, 10*time.Minute).
+		Return(time.Time{}, errors.New("db is closed"))
+	mockGroupStore.On("PutLastTriggerAfter", mock.Anything, "chat", "@qa", mock.Anything, 10*time.Minute).
+		Return(time.Time{}, nil)
+
+	b := NewGroupBot(GroupBotParams{
+		Store:         &mockGroupStore,
+		GroupCooldown: 10 * time.Minute,
+		UserCooldown:  time.Minute,
+	})
+
+	msg := Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{ID: "1"}, Text: "ping @devs @qa"}
+	resp := b.OnMessage(context.Background(), msg)
+	require.NotNil(t, resp)
+	assert.Equal(t, "@blah1 \nFailed to check cooldown of group @devs, try again later", resp.Text)
+
+	resp = b.OnMessage(context.Background(), msg)
+	require.NotNil(t, resp)
+	assert.Equal(t, "Failed to check your cooldown, try again later", resp.Text)
+	mockGroupStore.AssertExpectations(t)
+}
+
+func TestGroupBot_TriggerRestrictions(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("FindAliases", mock.Anything, "chat", mock.Anything).Return(map[string][]string{
+		"@admins": {"@blah"},
+		"@devs":   {"@blah1", "@blah2", "@blah3"},
+		"@qa":     {"@blah4"},
+	}, nil)
+	mockGroupStore.On("GetGroupSettings", mock.Anything, "chat", "@admins").Return(groups.GroupSettings{AdminsOnly: true}, nil)
+	mockGroupStore.On("GetGroupSettings", mock.Anything, "chat", mock.Anything).Return(groups.GroupSettings{}, nil)
+	mockGroupStore.On("GetQuietHours", mock.Anything, "chat").Return(map[string]groups.QuietHours{}, nil)
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, MaxTriggerSize: 2})
+
+	resp := b.OnMessage(context.Background(), Message{
+		ChatID:   "chat",
+		ChatType: ChatTypeGroup,
+		From:     &User{ID: "1"},
+		Text:     "ping @admins @devs @qa",
+	})
+	require.NotNil(t, resp)
+	assert.Equal(t, "@blah4 \n"+
+		"Group @admins can be pinged only by admins\n"+
+		"Group @devs is too large to be pinged by non-admins: 3 members, at most 2 allowed", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{
+		ChatID:   "chat",
+		ChatType: ChatTypeGroup,
+		From:     &User{ID: "1", IsAdmin: true},
+		Text:     "ping @admins @devs @qa",
+	})
+	require.NotNil(t, resp)
+	for _, u := range []string{"@blah", "@blah1", "@blah2", "@blah3", "@blah4"} {
+		assert.Contains(t, resp.Text, u)
+	}
+	assert.False(t, resp.Reply)
+}
+
+func TestGroupBot_ChatOverrides(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("FindAliases", mock.Anything, mock.Anything, mock.Anything).Return(map[string][]string{
+		"@devs": {"@blah1", "@blah2", "@blah3"},
+	}, nil)
+	mockGroupStore.On("GetGroupSettings", mock.Anything, mock.Anything, mock.Anything).Return(groups.GroupSettings{}, nil)
+	mockGroupStore.On("GetQuietHours", mock.Anything, mock.Anything).Return(map[string]groups.QuietHours{}, nil)
+
+	unlimited, disabled := 0, false
+	b := NewGroupBot(GroupBotParams{
+		Store:          &mockGroupStore,
+		MaxTriggerSize: 2,
+		ChatOverrides: map[string]GroupBotOverrides{
+			"large":    {MaxTriggerSize: &unlimited},
+			"disabled": {Enabled: &disabled},
+		},
+	})
+
+	msg := Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{ID: "1"}, Text: "ping @devs"}
+	resp := b.OnMessage(context.Background(), msg)
+	require.NotNil(t, resp)
+	assert.Equal(t, "Group @devs is too large to be pinged by non-admins: 3 members, at most 2 allowed", resp.Text)
+
+	msg.ChatID = "large"
+	resp = b.OnMessage(context.Background(), msg)
+	require.NotNil(t, resp)
+	assert.Contains(t, resp.Text, "@blah3")
+	assert.Equal(t, 2, b.MaxTriggerSize, "overrides must not change parameters of other chats")
+
+	msg.ChatID = "disabled"
+	assert.Nil(t, b.OnMessage(context.Background(), msg))
+}
+
+func TestGroupBot_ChatSettings(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("FindAliases", mock.Anything, mock.Anything, mock.Anything).Return(map[string][]string{
+		"@devs": {"@blah1", "@blah2"},
+	}, nil)
+	mockGroupStore.On("GetGroupSettings", mock.Anything, mock.Anything, mock.Anything).Return(groups.GroupSettings{}, nil)
+	mockGroupStore.On("GetQuietHours", mock.Anything, mock.Anything).Return(map[string]groups.QuietHours{}, nil)
+	mockSettings := settings.MockStore{}
+	mockSettings.On("Get", mock.Anything, "list").Return(settings.Settings{Mentions: settings.MentionsList}, nil)
+	mockSettings.On("Get", mock.Anything, "admins").Return(settings.Settings{Trigger: settings.TriggerAdmins, Language: "ru"}, nil)
+	mockSettings.On("Get", mock.Anything, "silent").Return(settings.Settings{Verbosity: settings.VerbositySilent}, nil)
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, Settings: &mockSettings, RespondAllCommands: true})
+	user := &User{ID: "1"}
+
+	resp := b.OnMessage(context.Background(), Message{ChatID: "list", ChatType: ChatTypeGroup, From: user, Text: "ping @devs"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "@blah1\n@blah2", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "admins", ChatType: ChatTypeGroup, From: user, Text: "ping @devs"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "Группы этого чата могут упоминать только администраторы", resp.Text)
+	resp = b.OnMessage(context.Background(), Message{ChatID: "admins", ChatType: ChatTypeGroup,
+		From: &User{ID: "2", IsAdmin: true}, Text: "ping @devs"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "@blah1 @blah2 ", resp.Text)
+
+	assert.Nil(t, b.OnMessage(context.Background(), Message{ChatID: "silent", ChatType: ChatTypeGroup, From: user, Text: "/add_group"}),
+		"invalid commands are ignored in silent chats")
+}
+
+func TestGroupBot_GroupSettingsCommands(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("GetGroupSettings", mock.Anything, "chat", "@devs").Return(groups.GroupSettings{Cooldown: time.Hour}, nil)
+	mockGroupStore.On("PutGroupSettings", mock.Anything, "chat", "@devs", groups.GroupSettings{AdminsOnly: true, Cooldown: time.Hour}).Return(nil)
+	mockGroupStore.On("PutGroupSettings", mock.Anything, "chat", "@devs", groups.GroupSettings{Cooldown: 5 * time.Minute}).Return(nil)
+	mockGroupStore.On("PutGroupSettings", mock.Anything, "chat", "@devs", groups.GroupSettings{}).Return(nil)
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true})
+
+	admin := &User{ID: "1", IsAdmin: true}
+
+	resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/group_admins_only @devs on"})
+	assert.Equal(t, "Group @devs now can be pinged only by admins", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/group_cooldown @devs 5m"})
+	assert.Equal(t, "Group @devs now can be pinged once in 5m0s", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/group_cooldown @devs off"})
+	assert.Equal(t, "Group @devs now uses the default cooldown", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/group_cooldown @devs soon"})
+	assert.Equal(t, "Command requires exactly two arguments - group alias and duration, e.g. 10m, or off", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/group_admins_only @devs"})
+	assert.Equal(t, "Command requires exactly two arguments - group alias and on/off", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{ID: "2"}, Text: "/group_admins_only @devs off"})
+	assert.Equal(t, "You don't have admin rights to execute this command", resp.Text)
+}
+
+func TestGroupBot_TriggerQuietHours(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("FindAliases", mock.Anything, "chat", mock.Anything).Return(map[string][]string{
+		"@devs": {"@blah", "@blah1", "@blah2", "@blah3"},
+	}, nil)
+	mockGroupStore.On("GetGroupSettings", mock.Anything, "chat", "@devs").Return(groups.GroupSettings{}, nil)
+	mockGroupStore.On("GetQuietHours", mock.Anything, "chat").Return(map[string]groups.QuietHours{
+		groups.ChatQuietHours: {From: 22 * 60, To: 8 * 60, Location: "UTC"},
+		"@blah":               {From: 9 * 60, To: 10 * 60, Location: "UTC"},             // not in quiet hours
+		"@blah1":              {From: 23 * 60, To: 7 * 60, Location: "UTC"},             // deferred until 07:00
+		"@blah2":              {From: 23 * 60, To: 7 * 60, Location: "UTC", Skip: true}, // skipped
+	}, nil)
+
+	mockSchedule := schedule.MockStore{}
+	mockSchedule.On("Put", mock.Anything, schedule.Delivery{
+		ID:        "quiet_hours_digest:chat:1588316400",
+		ChatID:    "chat",
+		DeliverAt: time.Date(2020, 5, 1, 7, 0, 0, 0, time.UTC),
+		Header:    "Mentions, deferred during quiet hours:",
+		Lines:     []string{"@blah1 - @devs by some\\_user at 23:30"},
+	}).Return(nil)
+	mockSchedule.On("Put", mock.Anything, schedule.Delivery{
+		ID:        "quiet_hours_digest:chat:1588320000",
+		ChatID:    "chat",
+		DeliverAt: time.Date(2020, 5, 1, 8, 0, 0, 0, time.UTC),
+		Header:    "Mentions, deferred during quiet hours:",
+		Lines:     []string{"@blah3 - @devs by some\\_user at 23:30"},
+	}).Return(nil)
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, Schedule: &mockSchedule})
+
+	resp := b.OnMessage(context.Background(), Message{
+		ChatID:   "chat",
+		ChatType: ChatTypeGroup,
+		From:     &User{ID: "1", Username: "some_user"},
+		Sent:     time.Date(2020, 4, 30, 23, 30, 0, 0, time.UTC),
+		Text:     "ping @devs",
+	})
+	require.NotNil(t, resp)
+	assert.Equal(t, "@blah \n"+
+		"blah1 will be mentioned when their quiet hours end\n"+
+		"blah2 are in quiet hours and were not pinged\n"+
+		"blah3 will be mentioned when their quiet hours end", resp.Text)
+	mockSchedule.AssertExpectations(t)
+}
+
+func TestGroupBot_TranslatedReplies(t *testing.T) {
+	ctx := context.Background()
+	store := groups.NewMemory()
+	require.NoError(t, store.PutGroup(ctx, "chat", "@devs", []string{"@blah", "@blah1"}))
+	require.NoError(t, store.PutQuietHours(ctx, "chat", "@blah1", &groups.QuietHours{From: 23 * 60, To: 7 * 60, Location: "UTC"}))
+	mockSettings := settings.MockStore{}
+	mockSettings.On("Get", mock.Anything, "chat").Return(settings.Settings{Language: "ru"}, nil)
+	mockSchedule := schedule.MockStore{}
+	mockSchedule.On("Put", mock.Anything, schedule.Delivery{
+		ID:        "quiet_hours_digest:chat:1588316400",
+		ChatID:    "chat",
+		DeliverAt: time.Date(2020, 5, 1, 7, 0, 0, 0, time.UTC),
+		Header:    "Упоминания, отложенные на время тихих часов:",
+		Lines:     []string{"@blah1 - @devs от some\\_user в 23:30"},
+	}).Return(nil)
+
+	b := NewGroupBot(GroupBotParams{Store: store, Settings: &mockSettings, Schedule: &mockSchedule,
+		GroupCooldown: 10 * time.Minute, RespondAllCommands: true})
+	sent := time.Date(2020, 4, 30, 23, 30, 0, 0, time.UTC)
+	send := func(from *User, at time.Time, text string) string {
+		resp := b.OnMessage(ctx, Message{ChatID: "chat", ChatType: ChatTypeGroup, From: from, Sent: at, Text: text})
+		require.NotNil(t, resp, text)
+		return resp.Text
+	}
+
+	assert.Equal(t, "@blah \nblah1 будут упомянуты, когда закончатся их тихие часы",
+		send(&User{ID: "1", Username: "some_user"}, sent, "ping @devs"))
+	mockSchedule.AssertExpectations(t)
+	assert.Equal(t, "Группу @devs можно будет снова упомянуть через 9m0s",
+		send(&User{ID: "2"}, sent.Add(time.Minute), "ping @devs"), "throttled trigger")
+	assert.Equal(t, "Группу @devs теперь можно упоминать раз в 5m0s",
+		send(&User{ID: "3", IsAdmin: true}, sent, "/group_cooldown @devs 5m"))
+	assert.Equal(t, "Группа @qa не существует", send(&User{ID: "3", IsAdmin: true}, sent, "/group_cooldown @qa 5m"))
+}
+
+func TestGroupBot_SetQuietHours(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("PutQuietHours", mock.Anything, "chat", groups.ChatQuietHours,
+		&groups.QuietHours{From: 22 * 60, To: 8 * 60, Location: "Europe/Berlin"}).Return(nil)
+	mockGroupStore.On("PutQuietHours", mock.Anything, "chat", "@blah",
+		&groups.QuietHours{From: 23 * 60, To: 7 * 60, Location: "UTC", Skip: true}).Return(nil)
+	mockGroupStore.On("PutQuietHours", mock.Anything, "chat", "@blah", (*groups.QuietHours)(nil)).Return(nil)
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true})
+
+	resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{IsAdmin: true},
+		Text: "/quiet_hours 22:00-08:00 Europe/Berlin"})
+	assert.Equal(t, "Quiet hours of the chat are set to 22:00-08:00 Europe/Berlin, deferring mentions", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{Username: "blah"},
+		Text: "/quiet_hours 22:00-08:00 Europe/Berlin"})
+	assert.Equal(t, "You don't have admin rights to execute this command", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{Username: "blah"},
+		Text: "/my_quiet_hours 23:00-07:00 UTC skip"})
+	assert.Equal(t, "Your quiet hours are set to 23:00-07:00 UTC, skipping mentions", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{Username: "blah"},
+		Text: "/my_quiet_hours off"})
+	assert.Equal(t, "Your quiet hours are turned off", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{Username: "blah"},
+		Text: "/my_quiet_hours 23:00-07:00 Mars/Olympus"})
+	assert.Equal(t, `Invalid quiet hours: invalid time zone "Mars/Olympus": unknown time zone Mars/Olympus`, resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{},
+		Text: "/my_quiet_hours off"})
+	assert.Equal(t, "You need a username to set your own quiet hours", resp.Text)
+}
+
+func TestGroupBot_RenameCopyDescribeGroup(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("GetGroups", mock.Anything, "chat").Return(map[string][]string{}, nil)
+	mockGroupStore.On("RenameGroup", mock.Anything, "chat", "@be", "@backend").Return(nil)
+	mockGroupStore.On("CopyGroup", mock.Anything, "chat", "@backend", "@be").Return(nil)
+	mockGroupStore.On("CopyGroup", mock.Anything, "chat", "@backend", "@fe").Return(groups.ErrGroupExists)
+	mockGroupStore.On("GetGroupSettings", mock.Anything, "chat", "@backend").Return(groups.GroupSettings{AdminsOnly: true}, nil)
+	mockGroupStore.On("PutGroupSettings", mock.Anything, "chat", "@backend",
+		groups.GroupSettings{AdminsOnly: true, Description: "backend developers"}).Return(nil)
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true})
+	admin := &User{ID: "1", IsAdmin: true}
+
+	resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/rename_group @be @backend"})
+	assert.Equal(t, "Group @be has been successfully renamed to @backend", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/copy_group @backend @be"})
+	assert.Equal(t, "Group @backend has been successfully copied to @be", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/copy_group @backend @fe"})
+	assert.Equal(t, "Group or synonym @fe already exists", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/describe_group @backend backend   developers"})
+	assert.Equal(t, "Description of group @backend has been successfully updated", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/rename_group @be"})
+	assert.Equal(t, "Command requires exactly two arguments - current and new group aliases", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{ID: "2"}, Text: "/describe_group @be blah"})
+	assert.Equal(t, "You don't have admin rights to execute this command", resp.Text)
+}
+
+func TestGroupBot_ShowGroup(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("GetGroup", mock.Anything, "chat", "@be").Return([]string{"@blah", "@blah_1"}, nil)
+	mockGroupStore.On("GetSynonyms", mock.Anything, "chat").Return(map[string][]string{"@backend": {"@back_end", "@be"}}, nil)
+	mockGroupStore.On("GetGroupSettings", mock.Anything, "chat", "@be").Return(groups.GroupSettings{
+		AdminsOnly:  true,
+		Cooldown:    time.Hour,
+		Description: "backend developers",
+	}, nil)
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true})
+
+	resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{ID: "2"}, Text: "/group @BE"})
+	assert.Equal(t, "Group @backend\n"+
+		"backend developers\n"+
+		"Synonyms: @back\\_end, @be\n"+
+		"Members (2): blah, blah\\_1\n"+
+		"Can be pinged only by admins\n"+
+		"Can be pinged once in 1h0m0s", resp.Text)
+}
+
+func TestGroupBot_AddressedCommands(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("GetGroup", mock.Anything, "chat", "@be").Return([]string{"@blah"}, nil)
+	mockGroupStore.On("GetSynonyms", mock.Anything, "chat").Return(map[string][]string{}, nil)
+	mockGroupStore.On("GetGroupSettings", mock.Anything, "chat", "@be").Return(groups.GroupSettings{}, nil)
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true, UserName: "multibot"})
+	user := &User{ID: "2"}
+
+	// store doesn't expect looking for aliases, so the command to another bot is not taken for a trigger either
+	assert.Nil(t, b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: user, Text: "/group@otherbot @be"}))
+
+	for _, text := range []string{"/group @be", "/group@MultiBot @be", "@multibot /group @be", "/group @be @multibot"} {
+		resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: user, Text: text})
+		require.NotNil(t, resp, text)
+		assert.Equal(t, "Group @be\nMembers (1): blah", resp.Text, text)
+	}
+}
+
+func TestGroupBot_AliasValidation(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("GetGroups", mock.Anything, "chat").Return(map[string][]string{"@devs": {"@blah", "@Backend"}}, nil)
+	mockGroupStore.On("CreateGroup", mock.Anything, "chat", "@qa", []string{"@blah1"}).Return(nil)
+	mockGroupStore.On("CreateGroup", mock.Anything, "chat", "@q-a", []string{"@blah1"}).Return(nil)
+	mockGroupStore.On("CreateGroup", mock.Anything, "chat", "@backend", []string{"@blah1"}).Return(nil)
+	mockGroupStore.On("RenameGroup", mock.Anything, "chat", "@qa", "@semior001").Return(nil)
+
+	b := NewGroupBot(GroupBotParams{
+		Store:              &mockGroupStore,
+		RespondAllCommands: true,
+		GetGroupMembers: func(_ context.Context, chatID string) ([]User, error) {
+			return []User{{Username: "semior001"}}, nil
+		},
+	})
+	admin := &User{ID: "1", Username: "admin", IsAdmin: true}
+
+	resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/add_group @QA @blah1"})
+	assert.Equal(t, "Group @qa has been successfully added", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/add_group qa @blah1"})
+	assert.Equal(t, "Invalid group alias qa, it must start with @ and contain only letters, digits, underscores and hyphens between them", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/add_group @q.a @blah1"})
+	assert.Equal(t, "Invalid group alias @q.a, it must start with @ and contain only letters, digits, underscores and hyphens between them", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/add_group @qa- @blah1"})
+	assert.Equal(t, "Invalid group alias @qa-, it must start with @ and contain only letters, digits, underscores and hyphens between them", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/add_group @q-a @blah1"})
+	assert.Equal(t, "Group @q-a has been successfully added", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/add_group @All @blah1"})
+	assert.Equal(t, "Group alias @all is reserved", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/copy_group @qa @here"})
+	assert.Equal(t, "Group alias @here is reserved", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/add_group @backend @blah1"})
+	assert.Equal(t, "Group @backend has been successfully added\n"+
+		"Warning: @backend is also a username of the chat member, who will be pinged along with the group", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/rename_group @QA @semior001"})
+	assert.Equal(t, "Group @qa has been successfully renamed to @semior001\n"+
+		"Warning: @semior001 is also a username of the chat member, who will be pinged along with the group", resp.Text)
+}
+
+func TestGroupBot_TriggerCaseInsensitive(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("FindAliases", mock.Anything, "chat", []string{"@devs", "@qa"}).Return(map[string][]string{
+		"@devs": {"@blah"},
+	}, nil)
+	mockGroupStore.On("FindAliases", mock.Anything, "chat", []string{"@back-end", "@qa"}).Return(map[string][]string{
+		"@backend": {"@blah1"},
+	}, nil)
+	mockGroupStore.On("GetGroupSettings", mock.Anything, "chat", "@devs").Return(groups.GroupSettings{}, nil)
+	mockGroupStore.On("GetGroupSettings", mock.Anything, "chat", "@backend").Return(groups.GroupSettings{}, nil)
+	mockGroupStore.On("GetQuietHours", mock.Anything, "chat").Return(map[string]groups.QuietHours{}, nil)
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore})
+
+	resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, Text: "ping @DEVS, @Devs and @QA"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "@blah ", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, Text: "ping @Back-End and @qa-"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "@blah1 ", resp.Text, "aliases may contain hyphens, but not trailing ones")
+}
+
+func TestGroupBot_Synonyms(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("GetSynonyms", mock.Anything, mock.Anything).Return(map[string][]string{}, nil)
+	mockGroupStore.On("GetGroups", mock.Anything, "chat").Return(map[string][]string{"@backend": {"@blah"}}, nil)
+	mockGroupStore.On("AddSynonym", mock.Anything, "chat", "@backend", "@be").Return(nil)
+	mockGroupStore.On("DeleteSynonym", mock.Anything, "chat", "@be").Return(nil)
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true})
+	admin := &User{ID: "1", IsAdmin: true}
+
+	resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/alias @backend @BE"})
+	assert.Equal(t, "@be is now a synonym of group @backend", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/alias @backend @all"})
+	assert.Equal(t, "Group alias @all is reserved", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/alias @backend"})
+	assert.Equal(t, "Command requires exactly two arguments - group alias and its synonym", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/unalias @be"})
+	assert.Equal(t, "Synonym @be has been successfully deleted", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{ID: "2"}, Text: "/unalias @be"})
+	assert.Equal(t, "You don't have admin rights to execute this command", resp.Text)
+}
+
+func TestGroupBot_CreateOrReplaceGroup(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("GetGroup", mock.Anything, mock.Anything, mock.Anything).Return([]string{}, nil)
+	mockGroupStore.On("GetGroups", mock.Anything, "chat").Return(map[string][]string{}, nil)
+	mockGroupStore.On("CreateGroup", mock.Anything, "chat", "@devs", []string{"@blah", "@blah1"}).
+		Return(fmt.Errorf("failed to put group: %w", groups.ErrGroupExists))
+	mockGroupStore.On("PutGroup", mock.Anything, "chat", "@devs", []string{"@blah", "@blah1"}).Return(nil)
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true})
+	admin := &User{ID: "1", IsAdmin: true}
+
+	resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/add_group @devs @blah blah1"})
+	assert.Equal(t, "Group or synonym @devs already exists, add --force to replace members of the group", resp.Text)
+	mockGroupStore.AssertNotCalled(t, "PutGroup", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/add_group --force @devs @blah @blah1 @blah"})
+	assert.Equal(t, "Group @devs has been successfully replaced", resp.Text)
+	mockGroupStore.AssertCalled(t, "PutGroup", mock.Anything, "chat", "@devs", []string{"@blah", "@blah1"})
+}
+
+func TestGroupBot_MembersCounts(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("AddTombstone", mock.Anything, mock.Anything).Return(nil)
+	mockGroupStore.On("GetGroup", mock.Anything, mock.Anything, mock.Anything).Return([]string{}, nil)
+	mockGroupStore.On("AddUsers", mock.Anything, "chat", "@devs", []string{"@blah"}).Return(0, nil)
+	mockGroupStore.On("AddUsers", mock.Anything, "chat", "@devs", []string{"@blah", "@blah1"}).Return(2, nil)
+	mockGroupStore.On("AddUsers", mock.Anything, "chat", "@devs", []string{"@blah", "@blah1", "@blah2"}).Return(1, nil)
+	mockGroupStore.On("DeleteUsers", mock.Anything, "chat", "@devs", []string{"@blah", "@blah1"}).Return(2, nil)
+	mockGroupStore.On("DeleteUsers", mock.Anything, "chat", "@devs", []string{"@blah", "@blah1", "@blah2"}).Return(1, nil)
+	mockGroupStore.On("DeleteUsers", mock.Anything, "chat", "@devs", []string{"@blah3", "@blah4"}).
+		Return(0, fmt.Errorf("failed to delete users: %w", groups.ErrUserNotInGroup))
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true})
+	admin := &User{ID: "1", IsAdmin: true}
+
+	tbl := []struct {
+		text string
+		resp string
+	}{
+		{text: "/add_user_to_group @devs blah", resp: "User blah is already a member of group @devs"},
+		{text: "/add_user_to_group @devs @blah blah1 @blah", resp: "2 users have been successfully added to the group @devs"},
+		{text: "/add_user_to_group @devs @blah @blah1 @blah2", resp: "1 of 3 users have been added to the group @devs, the rest are already there"},
+		{text: "/delete_user_from_group @devs blah @blah1", resp: "2 users have been successfully deleted from group @devs"},
+		{text: "/delete_user_from_group @devs @blah @blah1 @blah2", resp: "1 of 3 users have been deleted from group @devs, the rest are not its members"},
+		{text: "/delete_user_from_group @devs @blah3 @blah4", resp: "None of the users are members of group @devs"},
+	}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: tt.text})
+			require.NotNil(t, resp)
+			assert.Equal(t, tt.resp, resp.Text)
+		})
+	}
+}
+
+func TestGroupBot_GroupHistory(t *testing.T) {
+	at := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("GetAuditLog", mock.Anything, "chat", "@devs", 10).Return([]groups.AuditEntry{
+		{ChatID: "chat", Group: "@devs", Actor: "@admin_1", Action: groups.ActionDeleteUsers,
+			OldMembers: []string{"@blah", "@blah_1"}, NewMembers: []string{"@blah"}, At: at.Add(time.Hour)},
+		{ChatID: "chat", Group: "@devs", Actor: "1", Action: groups.ActionDescribeGroup, Details: "*backend*", At: at},
+	}, nil)
+	mockGroupStore.On("GetAuditLog", mock.Anything, "chat", "@qa", 2).Return([]groups.AuditEntry{}, nil)
+	mockGroupStore.On("GetAuditLog", mock.Anything, "chat", "@qa", 50).Return([]groups.AuditEntry{}, nil)
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true})
+	admin := &User{ID: "1", IsAdmin: true}
+
+	resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/group_history @Devs"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "Latest changes of group @devs:\n"+
+		"2020-05-01 11:00 UTC admin\\_1 delete users: -blah\\_1\n"+
+		"2020-05-01 10:00 UTC 1 describe group - \\*backend\\*", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/group_history @qa 2"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "There's no history of group @qa yet", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/group_history @qa 1000"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "There's no history of group @qa yet", resp.Text, "size of history is limited")
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/group_history @qa ten"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "Command requires group alias and optional positive number of changes to show", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{ID: "2"}, Text: "/group_history @qa"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "You don't have admin rights to execute this command", resp.Text)
+}
+
+func TestGroupBot_RecordChanges(t *testing.T) {
+	sent := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	store := groups.NewMemory()
+	b := NewGroupBot(GroupBotParams{Store: store, RespondAllCommands: true, AuditRetention: 24 * time.Hour})
+	admin := &User{ID: "1", Username: "admin", IsAdmin: true}
+	send := func(text string) string {
+		resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Sent: sent, Text: text})
+		require.NotNil(t, resp, text)
+		return resp.Text
+	}
+
+	send("/add_group @backend @blah")
+	send("/alias @backend @be")
+	send("/add_user_to_group @be @blah1")
+	send("/add_user_to_group @be @blah1")
+	send("/rename_group @backend @devs")
+
+	entries, err := store.GetAuditLog(context.Background(), "chat", "@be", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []groups.AuditEntry{
+		{ChatID: "chat", Group: "@devs", Actor: "@admin", Action: groups.ActionRenameGroup, Details: "from @backend", At: sent},
+		{ChatID: "chat", Group: "@devs", Actor: "@admin", Action: groups.ActionAddUsers,
+			OldMembers: []string{"@blah"}, NewMembers: []string{"@blah", "@blah1"}, At: sent},
+		{ChatID: "chat", Group: "@devs", Actor: "@admin", Action: groups.ActionAddSynonym, Details: "@be", At: sent},
+		{ChatID: "chat", Group: "@devs", Actor: "@admin", Action: groups.ActionCreateGroup, NewMembers: []string{"@blah"}, At: sent},
+	}, entries, "changes made by synonym and before rename are in the history of the group")
+
+	assert.Contains(t, send("/group_history @be"), "add users: +blah1")
+
+	// entries older than the retention are purged on the next change
+	sent = sent.Add(48 * time.Hour)
+	send("/delete_group @be")
+	entries, err = store.GetAuditLog(context.Background(), "chat", "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []groups.AuditEntry{
+		{ChatID: "chat", Group: "@devs", Actor: "@admin", Action: groups.ActionDeleteGroup,
+			OldMembers: []string{"@blah", "@blah1"}, At: sent},
+	}, entries)
+}
+
+func TestGroupBot_KeepTombstones(t *testing.T) {
+	sent := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	store := groups.NewMemory()
+	b := NewGroupBot(GroupBotParams{Store: store, RespondAllCommands: true, TombstoneRetention: 24 * time.Hour})
+	admin := &User{ID: "1", Username: "admin", IsAdmin: true}
+	send := func(text string) string {
+		resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Sent: sent, Text: text})
+		require.NotNil(t, resp, text)
+		return resp.Text
+	}
+	tombstones := func() []groups.Tombstone {
+		res, err := store.GetTombstones(context.Background(), "chat")
+		require.NoError(t, err)
+		for i := range res {
+			res[i].ID = 0
+		}
+		return res
+	}
+
+	send("/add_group @devs @blah @blah1")
+	send("/group_admins_only @devs on")
+	send("/alias @devs @backend")
+	send("/delete_user_from_group @devs @blah1 @blah2")
+	send("/add_group @devs @blah3 --force")
+	send("/import_groups {\"groups\": [{\"alias\": \"@devs\", \"members\": [\"@blah4\"], \"synonyms\": [\"@backend\"]}]}")
+	send("/delete_group @backend")
+	assert.Equal(t, []groups.Tombstone{
+		{ChatID: "chat", Group: "@devs", Actor: "@admin", GroupDeleted: true, Members: []string{"@blah4"},
+			Synonyms: []string{"@backend"}, At: sent},
+		{ChatID: "chat", Group: "@devs", Actor: "@admin", Replaced: true, Members: []string{"@blah3"}, At: sent},
+		{ChatID: "chat", Group: "@devs", Actor: "@admin", Replaced: true, Members: []string{"@blah"}, At: sent},
+		{ChatID: "chat", Group: "@devs", Actor: "@admin", Members: []string{"@blah1"}, At: sent},
+	}, tombstones(), "members, replaced by --force and import, are kept too")
+
+	assert.Equal(t, "Group @devs has been successfully restored with 1 members", send("/restore_group @devs"))
+	assert.Equal(t, "Previous 1 members of group @devs have been successfully restored", send("/undo"))
+	users, err := store.GetGroup(context.Background(), "chat", "@backend")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah3"}, users, "members, replaced by import, are put back instead of imported ones")
+	assert.Equal(t, "Previous 1 members of group @devs have been successfully restored", send("/undo"))
+	users, err = store.GetGroup(context.Background(), "chat", "@devs")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah"}, users, "members, replaced by --force, are put back")
+	assert.Equal(t, "1 users have been successfully restored to group @devs", send("/undo"))
+	assert.Empty(t, tombstones())
+
+	// tombstones older than the retention are purged on the next change
+	sent = sent.Add(48 * time.Hour)
+	send("/delete_user_from_group @devs @blah")
+	assert.Equal(t, []groups.Tombstone{
+		{ChatID: "chat", Group: "@devs", Actor: "@admin", Members: []string{"@blah"}, At: sent},
+	}, tombstones())
+}
+
+func TestGroupBot_Undo(t *testing.T) {
+	sent := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("GetTombstones", mock.Anything, "chat").Return([]groups.Tombstone{
+		{ID: 3, ChatID: "chat", Group: "@qa", Actor: "@other", Members: []string{"@blah"}, At: sent},
+		{ID: 2, ChatID: "chat", Group: "@devs", Actor: "@admin", Members: []string{"@blah1"}, At: sent.Add(-5 * time.Minute)},
+		{ID: 1, ChatID: "chat", Group: "@ops", Actor: "@admin", GroupDeleted: true, Members: []string{"@blah2"}, At: sent.Add(-time.Hour)},
+	}, nil)
+	mockGroupStore.On("RestoreTombstone", mock.Anything, "chat", mock.MatchedBy(func(tombstone groups.Tombstone) bool {
+		return tombstone.ID == 2
+	})).Return(nil)
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true, UndoWindow: 15 * time.Minute})
+	admin := &User{ID: "1", Username: "admin", IsAdmin: true}
+
+	resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Sent: sent, Text: "/undo"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "1 users have been successfully restored to group @devs", resp.Text)
+	mockGroupStore.AssertNumberOfCalls(t, "RestoreTombstone", 1)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin,
+		Sent: sent.Add(20 * time.Minute), Text: "/undo"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "Nothing to undo", resp.Text, "changes beyond the undo window are not reverted")
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{ID: "2"},
+		Sent: sent, Text: "/undo"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "You don't have admin rights to execute this command", resp.Text)
+}
+
+func TestGroupBot_RestoreGroup(t *testing.T) {
+	sent := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	settings := groups.GroupSettings{AdminsOnly: true, Description: "backend team"}
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("GetTombstones", mock.Anything, "chat").Return([]groups.Tombstone{
+		{ID: 3, ChatID: "chat", Group: "@devs", Actor: "@other", Members: []string{"@blah"}, At: sent},
+		{ID: 2, ChatID: "chat", Group: "@devs", Actor: "@admin", GroupDeleted: true, Members: []string{"@blah", "@blah1"},
+			Settings: settings, Synonyms: []string{"@backend"}, At: sent.Add(-time.Hour)},
+		{ID: 1, ChatID: "chat", Group: "@ops", Actor: "@admin", GroupDeleted: true, Members: []string{"@blah2"}, At: sent},
+	}, nil)
+	restored := func(id int64) interface{} {
+		return mock.MatchedBy(func(tombstone groups.Tombstone) bool { return tombstone.ID == id })
+	}
+	mockGroupStore.On("RestoreTombstone", mock.Anything, "chat", restored(2)).Return(nil)
+	mockGroupStore.On("RestoreTombstone", mock.Anything, "chat", restored(1)).
+		Return(fmt.Errorf("failed to restore group: %w", groups.ErrGroupExists))
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true})
+	admin := &User{ID: "1", Username: "admin", IsAdmin: true}
+
+	resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Sent: sent,
+		Text: "/restore_group @Devs"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "Group @devs has been successfully restored with 2 members", resp.Text)
+	mockGroupStore.AssertCalled(t, "RestoreTombstone", mock.Anything, "chat", restored(2))
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Sent: sent,
+		Text: "/restore_group @ops"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "Group or synonym @ops already exists", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Sent: sent,
+		Text: "/restore_group @qa"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "There's no deleted group @qa to restore", resp.Text)
+}
+
+func TestGroupBot_ExportGroups(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("GetGroups", mock.Anything, "chat").
+		Return(map[string][]string{"@qa": {"@blah2"}, "@devs": {"@blah", "@blah1"}}, nil)
+	mockGroupStore.On("GetAllGroupSettings", mock.Anything, "chat").
+		Return(map[string]groups.GroupSettings{"@devs": {Cooldown: 10 * time.Minute}}, nil)
+	mockGroupStore.On("GetSynonyms", mock.Anything, "chat").Return(map[string][]string{"@devs": {"@backend"}}, nil)
+	mockGroupStore.On("GetGroups", mock.Anything, "empty").Return(map[string][]string{}, nil)
+	mockGroupStore.On("GetAllGroupSettings", mock.Anything, "empty").Return(map[string]groups.GroupSettings{}, nil)
+	mockGroupStore.On("GetSynonyms", mock.Anything, "empty").Return(map[string][]string{}, nil)
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true})
+	user := &User{ID: "1"}
+
+	resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: user, Text: "/export_groups YAML"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "2 groups of the chat", resp.Text)
+	require.NotNil(t, resp.File)
+	assert.Equal(t, "groups.yaml", resp.File.Name)
+	assert.Equal(t, `chat: chat
+groups:
+- alias: '@devs'
+  members:
+  - '@blah'
+  - '@blah1'
+  synonyms:
+  - '@backend'
+  cooldown: 10m0s
+- alias: '@qa'
+  members:
+  - '@blah2'
+`, string(resp.File.Data))
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: user, Text: "/export_groups"})
+	require.NotNil(t, resp)
+	require.NotNil(t, resp.File)
+	assert.Equal(t, "groups.json", resp.File.Name)
+	doc, err := groups.UnmarshalDocument(resp.File.Data)
+	require.NoError(t, err)
+	assert.Len(t, doc.Groups, 2)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: user, Text: "/export_groups xml"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "Command requires optional format of the document - json or yaml", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "empty", ChatType: ChatTypeGroup, From: user, Text: "/export_groups"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "There's no groups in this chat yet", resp.Text)
+	assert.Nil(t, resp.File)
+}
+
+func TestGroupBot_ImportGroups(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("GetGroups", mock.Anything, "chat").Return(map[string][]string{"@devs": {"@blah", "@blah1"}}, nil)
+	mockGroupStore.On("GetAllGroupSettings", mock.Anything, "chat").Return(map[string]groups.GroupSettings{}, nil)
+	mockGroupStore.On("GetSynonyms", mock.Anything, "chat").Return(map[string][]string{}, nil)
+	mockGroupStore.On("ImportGroups", mock.Anything, "chat", mock.Anything).Return(nil)
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true})
+	admin := &User{ID: "1", Username: "admin", IsAdmin: true}
+
+	resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin,
+		Text: "/import_groups\n```yaml\ngroups:\n  - alias: '@devs'\n    members: [blah1, blah2]\n    description: backend\n" +
+			"  - alias: '@qa'\n    members: ['@blah3']\n```"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "2 groups have been successfully imported, changes:\n"+
+		`~ devs: +blah2, -blah, description "backend"`+"\n+ qa: blah3", resp.Text)
+
+	expected := []groups.GroupSnapshot{
+		{Alias: "@devs", Members: []string{"@blah1", "@blah2"}, Settings: groups.GroupSettings{Description: "backend"}},
+		{Alias: "@qa", Members: []string{"@blah3"}},
+	}
+	mockGroupStore.AssertCalled(t, "ImportGroups", mock.Anything, "chat", expected)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/import_groups",
+		File: &File{Name: "groups.json", Data: []byte(`{"groups": [{"alias": "@devs", "members": ["@blah", "@blah1"]}]}`)}})
+	require.NotNil(t, resp)
+	assert.Equal(t, "Nothing to import, groups are up to date", resp.Text)
+	mockGroupStore.AssertNumberOfCalls(t, "ImportGroups", 1)
+
+	tbl := []struct {
+		text string
+		resp string
+	}{
+		{text: "/import_groups", resp: "Command requires the document with groups, attached or put after the command"},
+		{text: `/import_groups {"groups": [{"alias": "@all", "members": ["@blah"]}]}`,
+			resp: "Invalid document: invalid alias of group @all: alias @all: alias is reserved"},
+		{text: `/import_groups {"groups": [{"alias": "@devs", "members": ["@blah"], "synonyms": ["@back end"]}]}`,
+			resp: "Invalid document: invalid alias of group @devs: alias @back end: alias must start with @ and contain only letters, digits, underscores and hyphens between them"},
+		{text: `/import_groups {"groups": [{"alias": "@devs"}]}`, resp: "Invalid document: group @devs has no members"},
+		{text: "/import_groups groups: [", resp: "Invalid document: failed to parse yaml document: yaml: line 1: did not find expected node content"},
+	}
+	for _, tt := range tbl {
+		resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: tt.text})
+		require.NotNil(t, resp, tt.text)
+		assert.Equal(t, tt.resp, resp.Text, tt.text)
+	}
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{ID: "2"},
+		Text: "/import_groups groups: []"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "You don't have admin rights to execute this command", resp.Text)
+}
+
+func TestGroupBot_StoreErrors(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("GetGroupSettings", mock.Anything, mock.Anything, mock.Anything).Return(groups.GroupSettings{}, nil)
+	mockGroupStore.On("GetSynonyms", mock.Anything, mock.Anything).Return(map[string][]string{}, nil)
+	mockGroupStore.On("GetGroup", mock.Anything, mock.Anything, mock.Anything).Return([]string{}, nil)
+	mockGroupStore.On("DeleteUsers", mock.Anything, "chat", "@unknown", []string{"@blah"}).
+		Return(0, fmt.Errorf("failed to delete user: %w", groups.ErrGroupNotFound))
+	mockGroupStore.On("DeleteUsers", mock.Anything, "chat", "@devs", []string{"@blah_1"}).
+		Return(0, fmt.Errorf("failed to delete user: %w", groups.ErrUserNotInGroup))
+	mockGroupStore.On("DeleteGroup", mock.Anything, "chat", "@devs").Return(groups.ErrChatNotFound)
+	mockGroupStore.On("DeleteSynonym", mock.Anything, "chat", "@dev").Return(groups.ErrSynonymNotFound)
+	mockGroupStore.On("AddUsers", mock.Anything, "chat", "@devs", []string{"@blah"}).Return(0, errors.New("disk is full"))
+	mockGroupStore.On("GetGroups", mock.Anything, "other").Return(nil, groups.ErrChatNotFound)
+
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true})
+	admin := &User{ID: "1", IsAdmin: true}
+
+	resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/delete_user_from_group @unknown @blah"})
+	assert.Equal(t, "Group @unknown does not exist", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/delete_user_from_group @devs @blah_1"})
+	assert.Equal(t, "User blah\\_1 is not a member of group @devs", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/delete_group @devs"})
+	assert.Equal(t, "There's no groups in this chat yet", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/unalias @dev"})
+	assert.Equal(t, "Synonym @dev does not exist", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/add_user_to_group @devs @blah"})
+	assert.Equal(t, "Internal error", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "other", ChatType: ChatTypeGroup, From: admin, Text: "/list_groups"})
+	assert.Equal(t, "There's no groups in this chat yet", resp.Text)
+}
+
 func TestGroupBot_Unique(t *testing.T) {
 	queried := unique([]string{"@blah", "@blah1", "@blah", "@blah1", "@blah3"})
 	m := make(map[string]int)
@@ -285,19 +1306,22 @@ func TestGroupBot_Unique(t *testing.T) {
 func TestGroupBot_TriggerNoAliases(t *testing.T) {
 	mockGroupStore := groups.MockStore{}
 	mockGroupStore.On(
-		"PutGroup",
+		"CreateGroup",
+		mock.Anything,
 		mock.Anything,
 		mock.Anything,
 		mock.Anything,
 	).Return(nil)
+	mockGroupStore.On("GetGroups", mock.Anything, mock.Anything).Return(map[string][]string{}, nil)
 	mockGroupStore.On(
 		"FindAliases",
+		mock.Anything,
 		mock.Anything, mock.Anything,
-	).Return([]string{}, nil)
+	).Return(map[string][]string{}, nil)
 
 	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: false})
 
-	b.OnMessage(Message{
+	b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -307,7 +1331,7 @@ func TestGroupBot_TriggerNoAliases(t *testing.T) {
 		Text: "/add_group @some_students @blah @blah1 @blah2",
 	})
 
-	b.OnMessage(Message{
+	b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -317,7 +1341,7 @@ func TestGroupBot_TriggerNoAliases(t *testing.T) {
 		Text: "/add_group @kek @blah @blah3 @blah4",
 	})
 
-	b.OnMessage(Message{
+	b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -327,7 +1351,7 @@ func TestGroupBot_TriggerNoAliases(t *testing.T) {
 		Text: "/add_group @lol @blah5 @blah6 @blah7",
 	})
 
-	resp := b.OnMessage(Message{
+	resp := b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		Text:     "There is a reference to nobody",
 	})
@@ -338,14 +1362,15 @@ func TestGroupBot_IllegalArgumentsNumber(t *testing.T) {
 	// add user
 	mockGroupStore := groups.MockStore{}
 	mockGroupStore.On(
-		"AddUser",
+		"AddUsers",
+		mock.Anything,
 		"",
 		"@some_students",
-		"@blah",
-	).Return(nil)
+		[]string{"@blah"},
+	).Return(1, nil)
 	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true})
 
-	resp := b.OnMessage(Message{
+	resp := b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -355,10 +1380,10 @@ func TestGroupBot_IllegalArgumentsNumber(t *testing.T) {
 		Text: "/add_user_to_group @some_students",
 	})
 
-	assert.Equal(t, "Command requires exactly two arguments - group alias and username", resp.Text)
+	assert.Equal(t, "Command requires at least two arguments - group alias and usernames", resp.Text)
 
 	// delete user from group
-	resp = b.OnMessage(Message{
+	resp = b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -368,10 +1393,10 @@ func TestGroupBot_IllegalArgumentsNumber(t *testing.T) {
 		Text: "/delete_user_from_group @some_students",
 	})
 
-	assert.Equal(t, "Command requires exactly two arguments - group alias and username", resp.Text)
+	assert.Equal(t, "Command requires at least two arguments - group alias and usernames", resp.Text)
 
 	// delete group
-	resp = b.OnMessage(Message{
+	resp = b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -384,7 +1409,7 @@ func TestGroupBot_IllegalArgumentsNumber(t *testing.T) {
 	assert.Equal(t, "Command requires exactly one argument - group alias", resp.Text)
 
 	// add group
-	resp = b.OnMessage(Message{
+	resp = b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -394,12 +1419,12 @@ func TestGroupBot_IllegalArgumentsNumber(t *testing.T) {
 		Text: "/add_group @blah",
 	})
 
-	assert.Equal(t, "Not enough parameters to add group", resp.Text)
+	assert.Equal(t, "Command requires at least two arguments - group alias and usernames", resp.Text)
 
 	// without responding
 	b = NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: false})
 
-	resp = b.OnMessage(Message{
+	resp = b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -412,7 +1437,7 @@ func TestGroupBot_IllegalArgumentsNumber(t *testing.T) {
 	assert.Nil(t, resp)
 
 	// delete user from group
-	resp = b.OnMessage(Message{
+	resp = b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -425,7 +1450,7 @@ func TestGroupBot_IllegalArgumentsNumber(t *testing.T) {
 	assert.Nil(t, resp)
 
 	// delete group
-	resp = b.OnMessage(Message{
+	resp = b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -438,7 +1463,7 @@ func TestGroupBot_IllegalArgumentsNumber(t *testing.T) {
 	assert.Nil(t, resp)
 
 	// add group
-	resp = b.OnMessage(Message{
+	resp = b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -456,7 +1481,7 @@ func TestGroupBot_IllegalAccess(t *testing.T) {
 	mockGroupStore := groups.MockStore{}
 	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: false})
 
-	resp := b.OnMessage(Message{
+	resp := b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -467,7 +1492,7 @@ func TestGroupBot_IllegalAccess(t *testing.T) {
 	})
 	assert.Equal(t, (*Response)(nil), resp)
 
-	resp = b.OnMessage(Message{
+	resp = b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -478,7 +1503,7 @@ func TestGroupBot_IllegalAccess(t *testing.T) {
 	})
 	assert.Equal(t, (*Response)(nil), resp)
 
-	resp = b.OnMessage(Message{
+	resp = b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -489,7 +1514,7 @@ func TestGroupBot_IllegalAccess(t *testing.T) {
 	})
 	assert.Equal(t, (*Response)(nil), resp)
 
-	resp = b.OnMessage(Message{
+	resp = b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -502,7 +1527,7 @@ func TestGroupBot_IllegalAccess(t *testing.T) {
 
 	// with responding
 	b = NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true})
-	resp = b.OnMessage(Message{
+	resp = b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		From: &User{
 			Username:    "blah",
@@ -517,10 +1542,10 @@ func TestGroupBot_IllegalAccess(t *testing.T) {
 
 func TestGroupBot_AddChat(t *testing.T) {
 	mockGroupStore := groups.MockStore{}
-	mockGroupStore.On("AddChat", mock.Anything).Return(nil)
+	mockGroupStore.On("AddChat", mock.Anything, mock.Anything).Return(nil)
 
 	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: false})
-	resp := b.OnMessage(Message{
+	resp := b.OnMessage(context.Background(), Message{
 		ChatType:       ChatTypeGroup,
 		ChatID:         "qwerty",
 		AddedBotToChat: true,
@@ -531,10 +1556,11 @@ func TestGroupBot_AddChat(t *testing.T) {
 func TestGroupBot_TriggerAll(t *testing.T) {
 	// add user
 	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("GetQuietHours", mock.Anything, mock.Anything).Return(map[string]groups.QuietHours{}, nil)
 	b := NewGroupBot(GroupBotParams{
 		Store:              &mockGroupStore,
 		RespondAllCommands: false,
-		GetGroupMembers: func(chatID string) (users []User, err error) {
+		GetGroupMembers: func(_ context.Context, chatID string) (users []User, err error) {
 			return []User{
 				{
 					Username: "@semior001",
@@ -555,7 +1581,7 @@ func TestGroupBot_TriggerAll(t *testing.T) {
 			}, nil
 		},
 	})
-	resp := b.OnMessage(Message{
+	resp := b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeGroup,
 		Text:     "There is a reference to @all",
 	})
@@ -578,12 +1604,69 @@ func TestGroupBot_escapeUnderscores(t *testing.T) {
 
 func TestGroupBot_ignoreMsgNotFromChat(t *testing.T) {
 	b := &GroupBot{}
-	resp := b.OnMessage(Message{
+	resp := b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypePrivate,
 	})
 	assert.Nil(t, resp)
-	resp = b.OnMessage(Message{
+	resp = b.OnMessage(context.Background(), Message{
 		ChatType: ChatTypeChannel,
 	})
 	assert.Nil(t, resp)
 }
+
+func TestGroupBot_CommandMetrics(t *testing.T) {
+	mockGroupStore := groups.MockStore{}
+	mockGroupStore.On("GetGroups", mock.Anything, "ok").Return(map[string][]string{"@devs": {"@blah"}}, nil)
+	mockGroupStore.On("GetGroups", mock.Anything, "failed").Return(nil, errors.New("failed"))
+	mockGroupStore.On("GetAllGroupSettings", mock.Anything, mock.Anything).Return(map[string]groups.GroupSettings{}, nil)
+	mockGroupStore.On("GetSynonyms", mock.Anything, mock.Anything).Return(map[string][]string{}, nil)
+	mockGroupStore.On("GetGroupSettings", mock.Anything, mock.Anything, mock.Anything).Return(groups.GroupSettings{}, nil)
+	mockGroupStore.On("GetQuietHours", mock.Anything, mock.Anything).Return(map[string]groups.QuietHours{}, nil)
+	mockGroupStore.On("FindAliases", mock.Anything, mock.Anything, mock.Anything).
+		Return(map[string][]string{"@devs": {"@blah", "@blah1"}}, nil)
+	b := NewGroupBot(GroupBotParams{Store: &mockGroupStore, RespondAllCommands: true})
+
+	count := func(command, result string) float64 {
+		return testutil.ToFloat64(metrics.Commands.WithLabelValues(command, result))
+	}
+	ok, failed, denied := count("/list_groups", metrics.ResultOK), count("/list_groups", metrics.ResultFailed),
+		count("/delete_group", metrics.ResultDenied)
+	invalidArgs, invalidAlias := count("/group", metrics.ResultInvalid), count("/rename_group", metrics.ResultInvalid)
+	triggers, mentions := testutil.ToFloat64(metrics.Triggers), testutil.ToFloat64(metrics.Mentions)
+
+	user := &User{Username: "blah"}
+	b.OnMessage(context.Background(), Message{ChatID: "ok", ChatType: ChatTypeGroup, From: user, Text: "/list_groups"})
+	b.OnMessage(context.Background(), Message{ChatID: "failed", ChatType: ChatTypeGroup, From: user, Text: "/list_groups"})
+	b.OnMessage(context.Background(), Message{ChatID: "ok", ChatType: ChatTypeGroup, From: user, Text: "/delete_group @devs"})
+	b.OnMessage(context.Background(), Message{ChatID: "ok", ChatType: ChatTypeGroup, From: user, Text: "ping @devs"})
+	b.OnMessage(context.Background(), Message{ChatID: "ok", ChatType: ChatTypeGroup, From: user, Text: "/group"})
+	admin := &User{Username: "admin", IsAdmin: true}
+	b.OnMessage(context.Background(), Message{ChatID: "ok", ChatType: ChatTypeGroup, From: admin, Text: "/rename_group @devs @all"})
+
+	assert.Equal(t, ok+1, count("/list_groups", metrics.ResultOK))
+	assert.Equal(t, failed+1, count("/list_groups", metrics.ResultFailed))
+	assert.Equal(t, denied+1, count("/delete_group", metrics.ResultDenied))
+	assert.Equal(t, invalidArgs+1, count("/group", metrics.ResultInvalid))
+	assert.Equal(t, invalidAlias+1, count("/rename_group", metrics.ResultInvalid))
+	assert.Equal(t, triggers+1, testutil.ToFloat64(metrics.Triggers))
+	assert.Equal(t, mentions+2, testutil.ToFloat64(metrics.Mentions))
+}
+
+func TestGroupBot_ManageGroupBySynonym(t *testing.T) {
+	b := NewGroupBot(GroupBotParams{Store: groups.NewMemory(), RespondAllCommands: true, UndoWindow: time.Hour})
+	admin := &User{ID: "1", Username: "admin", IsAdmin: true}
+	send := func(text string) string {
+		resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: text})
+		require.NotNil(t, resp, text)
+		return resp.Text
+	}
+
+	send("/add_group @backend @blah")
+	assert.Equal(t, "@back-end is now a synonym of group @backend", send("/alias @backend @back-end"))
+	assert.Equal(t, "@be is now a synonym of group @back-end", send("/alias @back-end @be"))
+	assert.Equal(t, "Group @be has been successfully copied to @api", send("/copy_group @be @api"))
+	assert.Equal(t, "Group @be has been successfully renamed to @server", send("/rename_group @be @server"))
+	assert.Equal(t, "Group @be has been successfully deleted", send("/delete_group @be"))
+	assert.Contains(t, send("/undo"), "@server")
+	assert.Contains(t, send("/group @back-end"), "blah", "synonyms are restored with the group")
+}
@@ -0,0 +1,112 @@
+package bot
+
+// translations of texts into languages other than english, by language and english text,
+// texts without translation are sent in english
+var translations = map[string]map[string]string{
+	"ru": {
+		"You don't have admin rights to execute this command": "У вас нет прав администратора для выполнения этой команды",
+		"Groups of this chat can be pinged only by admins":    "Группы этого чата могут упоминать только администраторы",
+
+		"Group %s can be pinged only by admins":                                            "Группу %s могут упоминать только администраторы",
+		"Group %s is too large to be pinged by non-admins: %d members, at most %d allowed": "Группа %s слишком большая, чтобы её упоминали не администраторы: участников %d, допустимо не более %d",
+		"You can ping groups again in %s":                                                  "Вы сможете снова упоминать группы через %s",
+		"Failed to check your cooldown, try again later":                                   "Не удалось проверить ваш интервал между упоминаниями, попробуйте позже",
+		"Group %s can be pinged again in %s":                                               "Группу %s можно будет снова упомянуть через %s",
+		"Failed to check cooldown of group %s, try again later":                            "Не удалось проверить интервал между упоминаниями группы %s, попробуйте позже",
+
+		"Mentions, deferred during quiet hours:":          "Упоминания, отложенные на время тихих часов:",
+		"%s - %s by %s at %s":                             "%s - %s от %s в %s",
+		"%s will be mentioned when their quiet hours end": "%s будут упомянуты, когда закончатся их тихие часы",
+		"%s are in quiet hours and were not pinged":       "%s в тихих часах и не были упомянуты",
+		"You need a username to set your own quiet hours": "Чтобы установить свои тихие часы, нужно имя пользователя",
+		"Invalid quiet hours: %s":                         "Неверные тихие часы: %s",
+		"Your quiet hours":                                "Ваши тихие часы",
+		"Quiet hours of the chat":                         "Тихие часы чата",
+		"%s are turned off":                               "%s выключены",
+		"%s are set to %s":                                "%s установлены на %s",
+
+		"Group %s has been successfully added":                                       "Группа %s успешно добавлена",
+		"Group %s has been successfully replaced":                                    "Группа %s успешно заменена",
+		"Group %s has been successfully deleted":                                     "Группа %s успешно удалена",
+		"Group %s has been successfully renamed to %s":                               "Группа %s успешно переименована в %s",
+		"Group %s has been successfully copied to %s":                                "Группа %s успешно скопирована в %s",
+		"Group or synonym %s already exists, add %s to replace members of the group": "Группа или синоним %s уже существует, добавьте %s, чтобы заменить участников группы",
+		"Description of group %s has been removed":                                   "Описание группы %s удалено",
+		"Description of group %s has been successfully updated":                      "Описание группы %s успешно обновлено",
+		"%s is now a synonym of group %s":                                            "%s теперь синоним группы %s",
+		"Synonym %s has been successfully deleted":                                   "Синоним %s успешно удален",
+		"Group %s now can be pinged only by admins":                                  "Группу %s теперь могут упоминать только администраторы",
+		"Group %s now can be pinged by anyone":                                       "Группу %s теперь могут упоминать все",
+		"Group %s now uses the default cooldown":                                     "Для группы %s теперь действует интервал по умолчанию",
+		"Group %s now can be pinged once in %s":                                      "Группу %s теперь можно упоминать раз в %s",
+		"Group alias %s is reserved":                                                 "Псевдоним группы %s зарезервирован",
+		"Invalid group alias %s, it must start with @ and contain only letters, digits, underscores and hyphens between them": "Неверный псевдоним группы %s, он должен начинаться с @ и содержать только буквы, цифры, подчеркивания и дефисы между ними",
+		"Warning: %s is also a username of the chat member, who will be pinged along with the group":                          "Внимание: %s также имя участника чата, который будет упомянут вместе с группой",
+
+		"User %s has been successfully added to the group %s":                          "Пользователь %s успешно добавлен в группу %s",
+		"User %s is already a member of group %s":                                      "Пользователь %s уже состоит в группе %s",
+		"%d users have been successfully added to the group %s":                        "Пользователи успешно добавлены в группу %[2]s: %[1]d",
+		"%d of %d users have been added to the group %s, the rest are already there":   "В группу %[3]s добавлено пользователей: %[1]d из %[2]d, остальные уже в ней",
+		"User %s has been successfully deleted from group %s":                          "Пользователь %s успешно удален из группы %s",
+		"%d users have been successfully deleted from group %s":                        "Пользователи успешно удалены из группы %[2]s: %[1]d",
+		"%d of %d users have been deleted from group %s, the rest are not its members": "Из группы %[3]s удалено пользователей: %[1]d из %[2]d, остальные в ней не состоят",
+		"None of the users are members of group %s":                                    "Никто из пользователей не состоит в группе %s",
+
+		"There's no groups in this chat yet": "В этом чате пока нет групп",
+		"Group %s":                           "Группа %s",
+		"Synonyms: ":                         "Синонимы: ",
+		"Members (%d): %s":                   "Участники (%d): %s",
+		"Can be pinged only by admins":       "Могут упоминать только администраторы",
+		"Can be pinged once in %s":           "Можно упоминать раз в %s",
+		"There's no history of group %s yet": "У группы %s пока нет истории",
+		"Latest changes of group %s:":        "Последние изменения группы %s:",
+
+		"Nothing to undo":                                                 "Нечего отменять",
+		"There's no deleted group %s to restore":                          "Нет удаленной группы %s, чтобы ее восстановить",
+		"The change has already been reverted":                            "Изменение уже отменено",
+		"%d users have been successfully restored to group %s":            "Пользователи успешно возвращены в группу %[2]s: %[1]d",
+		"Group %s has been successfully restored with %d members":         "Группа %s успешно восстановлена, участников: %d",
+		"Previous %d members of group %s have been successfully restored": "Прежние участники группы %[2]s успешно восстановлены: %[1]d",
+
+		"%d groups of the chat": "Группы чата: %d",
+		"Command requires the document with groups, attached or put after the command": "Команде нужен документ с группами, приложенный или указанный после команды",
+		"Invalid document: ":                       "Неверный документ: ",
+		"Nothing to import, groups are up to date": "Нечего импортировать, группы уже актуальны",
+		"Some alias of the document is already used as a synonym of another group": "Один из псевдонимов документа уже используется как синоним другой группы",
+		"%d groups have been successfully imported, changes:":                      "Группы успешно импортированы: %d, изменения:",
+
+		"Internal error":                      "Внутренняя ошибка",
+		"Group %s does not exist":             "Группа %s не существует",
+		"Synonym %s does not exist":           "Синоним %s не существует",
+		"Group or synonym %s already exists":  "Группа или синоним %s уже существует",
+		"User %s is not a member of group %s": "Пользователь %s не состоит в группе %s",
+
+		"Settings of the chat":    "Настройки чата",
+		"Failed to get settings":  "Не удалось получить настройки",
+		"Failed to save settings": "Не удалось сохранить настройки",
+		"Verbosity":               "Подробность ответов",
+		"Language":                "Язык",
+		"Pings":                   "Упоминания групп",
+		"Mentions":                "Упоминания участников",
+		"Bot":                     "Бот",
+		"default":                 "по умолчанию",
+		"silent":                  "молча",
+		"verbose":                 "подробно",
+		"everyone":                "все",
+		"admins":                  "администраторы",
+		"inline":                  "в строку",
+		"list":                    "списком",
+		"Bot %s is enabled":       "Бот %s включен",
+		"Bot %s is disabled":      "Бот %s выключен",
+		"on":                      "включен",
+		"off":                     "выключен",
+	},
+}
+
+// translate returns the text in the given language
+func translate(lang string, text string) string {
+	if tr, ok := translations[lang][text]; ok {
+		return tr
+	}
+	return text
+}
@@ -2,6 +2,7 @@
 
 package bot
 
+import context "context"
 import mock "github.com/stretchr/testify/mock"
 
 // MockBot is an autogenerated mock type for the Bot type
@@ -9,8 +10,22 @@ type MockBot struct {
 	mock.Mock
 }
 
-// Help provides a mock function with given fields:
-func (_m *MockBot) Help() string {
+// Help provides a mock function with given fields: ctx, chatID
+func (_m *MockBot) Help(ctx context.Context, chatID string) string {
+	ret := _m.Called(ctx, chatID)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
+		r0 = rf(ctx, chatID)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// Name provides a mock function with given fields:
+func (_m *MockBot) Name() string {
 	ret := _m.Called()
 
 	var r0 string
@@ -23,13 +38,13 @@ func (_m *MockBot) Help() string {
 	return r0
 }
 
-// OnMessage provides a mock function with given fields: msg
-func (_m *MockBot) OnMessage(msg Message) *Response {
-	ret := _m.Called(msg)
+// OnMessage provides a mock function with given fields: ctx, msg
+func (_m *MockBot) OnMessage(ctx context.Context, msg Message) *Response {
+	ret := _m.Called(ctx, msg)
 
 	var r0 *Response
-	if rf, ok := ret.Get(0).(func(Message) *Response); ok {
-		r0 = rf(msg)
+	if rf, ok := ret.Get(0).(func(context.Context, Message) *Response); ok {
+		r0 = rf(ctx, msg)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*Response)
@@ -0,0 +1,182 @@
+package bot
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/Semior001/multibot-utility/app/metrics"
+)
+
+// Permission describes who is allowed to execute the command
+type Permission int
+
+// Permission enum
+const (
+	PermissionEveryone Permission = iota
+	PermissionAdmin
+)
+
+// ArgSpec describes arguments of the command
+type ArgSpec struct {
+	Usage string                   // arguments as shown in help, e.g. @group_alias [N]
+	Hint  string                   // explanation of arguments, shown when they are wrong
+	Min   int                      // minimal number of arguments
+	Max   int                      // maximal number of arguments, negative means unlimited
+	Valid func(args []string) bool // optional check of values of arguments, called when their number is fine
+}
+
+// Command describes the command, that is handled by the Router
+type Command struct {
+	Name        string // name of the command with the leading slash, e.g. /list_groups
+	Args        ArgSpec
+	Description string
+	Permission  Permission
+	ChatTypes   []ChatType // types of chats, where the command is handled, any if empty
+	Handler     func(ctx context.Context, msg Message, args []string) *Response
+}
+
+// Router dispatches commands to their handlers, checking permissions of the
+// sender and arguments of the command, and describes commands in help
+type Router struct {
+	Commands []Command
+	Verbose  bool   // if false, denied commands and commands with wrong arguments are ignored silently
+	Lang     string // language of answers to denied commands
+	UserName string // username of the bot, commands addressed to other bots are ignored, if empty - none are
+}
+
+// Route calls the handler of the command in the message, returns false,
+// if the message is not a command, known by the router, or it is addressed to another bot
+func (r *Router) Route(ctx context.Context, msg Message) (resp *Response, ok bool) {
+	name, args, addressed := parseCommand(msg.Text, r.UserName)
+	cmd, found := r.find(name)
+	if !addressed || !found || !cmd.handles(msg.ChatType) {
+		return nil, false
+	}
+
+	if cmd.Permission == PermissionAdmin && (msg.From == nil || !msg.From.IsAdmin) {
+		setCommandResult(ctx, metrics.ResultDenied)
+		if !r.Verbose {
+			return nil, true
+		}
+		return &Response{Reply: true, Text: translate(r.Lang, "You don't have admin rights to execute this command")}, true
+	}
+
+	if !cmd.Args.valid(args) {
+		setCommandResult(ctx, metrics.ResultInvalid)
+		if !r.Verbose {
+			return nil, true
+		}
+		return &Response{Reply: true, Text: cmd.Args.usageError()}, true
+	}
+
+	return cmd.Handler(ctx, msg, args), true
+}
+
+// Help returns the line of help for each command in the order of registration
+func (r *Router) Help() string {
+	lines := make([]string, 0, len(r.Commands))
+	for _, cmd := range r.Commands {
+		usage := cmd.Name
+		if cmd.Args.Usage != "" {
+			usage += " " + cmd.Args.Usage
+		}
+		lines = append(lines, escapeUnderscores(usage)+" - "+cmd.Description)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// find returns the command with the given name
+func (r *Router) find(name string) (Command, bool) {
+	for _, cmd := range r.Commands {
+		if cmd.Name == name {
+			return cmd, true
+		}
+	}
+	return Command{}, false
+}
+
+// handles returns true if the command is handled in the chat of the given type
+func (c Command) handles(chatType ChatType) bool {
+	if len(c.ChatTypes) == 0 {
+		return true
+	}
+	for _, t := range c.ChatTypes {
+		if t == chatType {
+			return true
+		}
+	}
+	return false
+}
+
+// valid checks the number of arguments and their values
+func (a ArgSpec) valid(args []string) bool {
+	if len(args) < a.Min || (a.Max >= 0 && len(args) > a.Max) {
+		return false
+	}
+	return a.Valid == nil || a.Valid(args)
+}
+
+// usageError explains to the user, which arguments the command requires
+func (a ArgSpec) usageError() string {
+	var text string
+	switch {
+	case a.Min == a.Max && a.Min == 0:
+		return "Command requires no arguments"
+	case a.Min == a.Max:
+		text = "exactly " + countArguments(a.Min)
+	case a.Max < 0:
+		text = "at least " + countArguments(a.Min)
+	default:
+		// ranges of arguments are explained by the hint only
+		return "Command requires " + a.Hint
+	}
+	if a.Hint != "" {
+		text += " - " + a.Hint
+	}
+	return "Command requires " + text
+}
+
+// countArguments returns the number of arguments in words, e.g. two arguments
+func countArguments(n int) string {
+	words := []string{"no", "one", "two", "three", "four", "five"}
+	count := strconv.Itoa(n)
+	if n < len(words) {
+		count = words[n]
+	}
+	if n == 1 {
+		return count + " argument"
+	}
+	return count + " arguments"
+}
+
+// parseCommand splits the text of the message into the command and its arguments,
+// the command may be addressed to the bot with the given username in format /cmd@bot
+// or by the mention of the bot anywhere in the text, such mentions are not arguments,
+// addressed is false if the command is addressed to another bot
+func parseCommand(text, userName string) (cmd string, args []string, addressed bool) {
+	var tokens []string
+	for _, token := range strings.Fields(text) {
+		if !mentionsBot(token, userName) {
+			tokens = append(tokens, token)
+		}
+	}
+	if len(tokens) == 0 {
+		return "", nil, true
+	}
+
+	parts := strings.SplitN(tokens[0], aliasPrefix, 2)
+	cmd, addressed = parts[0], true
+	if strings.HasPrefix(cmd, "/") && len(parts) == 2 && userName != "" {
+		addressed = strings.EqualFold(parts[1], strings.TrimPrefix(userName, aliasPrefix))
+	}
+	return cmd, tokens[1:], addressed
+}
+
+// mentionsBot returns true if the token is the mention of the bot with the given username, e.g. @bot or @bot:
+func mentionsBot(token, userName string) bool {
+	if userName == "" || !strings.HasPrefix(token, aliasPrefix) {
+		return false
+	}
+	return strings.EqualFold(strings.TrimRight(token, ",:"), aliasPrefix+strings.TrimPrefix(userName, aliasPrefix))
+}
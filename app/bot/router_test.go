@@ -0,0 +1,114 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter_Route(t *testing.T) {
+	var calledWith []string
+	handler := func(_ context.Context, _ Message, args []string) *Response {
+		calledWith = args
+		return &Response{Text: "handled " + strings.Join(args, " ")}
+	}
+	r := &Router{
+		Verbose:  true,
+		UserName: "bot",
+		Commands: []Command{
+			{Name: "/ping", Handler: handler},
+			{Name: "/echo", Args: ArgSpec{Hint: "text", Min: 1, Max: -1}, Handler: handler},
+			{Name: "/pair", Args: ArgSpec{Hint: "key and value", Min: 2, Max: 2}, Handler: handler},
+			{
+				Name:    "/mode",
+				Args:    ArgSpec{Hint: "optional on or off", Max: 1, Valid: func(args []string) bool { return len(args) == 0 || args[0] == "on" }},
+				Handler: handler,
+			},
+			{Name: "/ban", Args: ArgSpec{Hint: "username", Min: 1, Max: 1}, Permission: PermissionAdmin, Handler: handler},
+			{Name: "/group_only", ChatTypes: []ChatType{ChatTypeGroup}, Handler: handler},
+		},
+	}
+	user, admin := &User{ID: "1"}, &User{ID: "2", IsAdmin: true}
+
+	tbl := []struct {
+		msg     Message
+		handled bool
+		resp    *Response
+	}{
+		{msg: Message{Text: "hello", From: user}},
+		{msg: Message{Text: "/unknown", From: user}},
+		{msg: Message{Text: "/ping", From: user}, handled: true, resp: &Response{Text: "handled "}},
+		{msg: Message{Text: "/ping@bot", From: user}, handled: true, resp: &Response{Text: "handled "}},
+		{msg: Message{Text: "/ping@other", From: user}},
+		{msg: Message{Text: "/ping  extra", From: user}, handled: true, resp: &Response{Reply: true, Text: "Command requires no arguments"}},
+		{msg: Message{Text: "/echo   a  b", From: user}, handled: true, resp: &Response{Text: "handled a b"}},
+		{msg: Message{Text: "/echo", From: user}, handled: true, resp: &Response{Reply: true, Text: "Command requires at least one argument - text"}},
+		{msg: Message{Text: "/pair a", From: user}, handled: true, resp: &Response{Reply: true, Text: "Command requires exactly two arguments - key and value"}},
+		{msg: Message{Text: "/mode off", From: user}, handled: true, resp: &Response{Reply: true, Text: "Command requires optional on or off"}},
+		{msg: Message{Text: "/mode on", From: user}, handled: true, resp: &Response{Text: "handled on"}},
+		{msg: Message{Text: "/ban @user", From: user}, handled: true, resp: &Response{Reply: true, Text: "You don't have admin rights to execute this command"}},
+		{msg: Message{Text: "/ban @user"}, handled: true, resp: &Response{Reply: true, Text: "You don't have admin rights to execute this command"}},
+		{msg: Message{Text: "/ban", From: admin}, handled: true, resp: &Response{Reply: true, Text: "Command requires exactly one argument - username"}},
+		{msg: Message{Text: "/ban @user", From: admin}, handled: true, resp: &Response{Text: "handled @user"}},
+		{msg: Message{Text: "/group_only", From: user, ChatType: ChatTypePrivate}},
+		{msg: Message{Text: "/group_only", From: user, ChatType: ChatTypeGroup}, handled: true, resp: &Response{Text: "handled "}},
+	}
+	for i, tt := range tbl {
+		resp, handled := r.Route(context.Background(), tt.msg)
+		assert.Equal(t, tt.handled, handled, "case #%d", i)
+		assert.Equal(t, tt.resp, resp, "case #%d", i)
+	}
+
+	// silent router ignores denied commands and wrong arguments
+	r.Verbose = false
+	calledWith = nil
+	resp, handled := r.Route(context.Background(), Message{Text: "/ban @user", From: user})
+	assert.True(t, handled)
+	assert.Nil(t, resp)
+	resp, handled = r.Route(context.Background(), Message{Text: "/pair a b c", From: user})
+	assert.True(t, handled)
+	assert.Nil(t, resp)
+	assert.Nil(t, calledWith, "handler must not be called")
+
+	// denial is translated
+	r.Verbose, r.Lang = true, "ru"
+	resp, _ = r.Route(context.Background(), Message{Text: "/ban @user", From: user})
+	assert.Equal(t, "У вас нет прав администратора для выполнения этой команды", resp.Text)
+}
+
+func TestRouter_Help(t *testing.T) {
+	r := &Router{Commands: []Command{
+		{Name: "/list_items", Description: "shows the list of items"},
+		{Name: "/add_item", Args: ArgSpec{Usage: "@item_name [N]"}, Description: "adds the item"},
+	}}
+	assert.Equal(t, "/list\\_items - shows the list of items\n/add\\_item @item\\_name [N] - adds the item", r.Help())
+}
+
+func TestParseCommand(t *testing.T) {
+	tbl := []struct {
+		text, userName string
+		cmd            string
+		args           []string
+		addressed      bool
+	}{
+		{text: "", userName: "bot", addressed: true},
+		{text: "/cmd  a b", userName: "bot", cmd: "/cmd", args: []string{"a", "b"}, addressed: true},
+		{text: "/cmd@bot a", userName: "bot", cmd: "/cmd", args: []string{"a"}, addressed: true},
+		{text: "/cmd@Bot a", userName: "@bot", cmd: "/cmd", args: []string{"a"}, addressed: true},
+		{text: "/cmd@other a", userName: "bot", cmd: "/cmd", args: []string{"a"}, addressed: false},
+		{text: "/cmd@other a", userName: "", cmd: "/cmd", args: []string{"a"}, addressed: true},
+		{text: "@bot /cmd a", userName: "bot", cmd: "/cmd", args: []string{"a"}, addressed: true},
+		{text: "@bot, /cmd a @bot", userName: "bot", cmd: "/cmd", args: []string{"a"}, addressed: true},
+		{text: "@bot /cmd@other", userName: "bot", cmd: "/cmd", args: []string{}, addressed: false},
+		{text: "@botanic /cmd", userName: "bot", cmd: "", args: []string{"/cmd"}, addressed: true},
+		{text: "@admins hello", userName: "bot", cmd: "", args: []string{"hello"}, addressed: true},
+	}
+	for i, tt := range tbl {
+		cmd, args, addressed := parseCommand(tt.text, tt.userName)
+		assert.Equal(t, tt.cmd, cmd, "case #%d", i)
+		assert.Equal(t, tt.args, args, "case #%d", i)
+		assert.Equal(t, tt.addressed, addressed, "case #%d", i)
+	}
+}
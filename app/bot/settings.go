@@ -0,0 +1,218 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Semior001/multibot-utility/app/logging"
+	"github.com/Semior001/multibot-utility/app/store/settings"
+)
+
+// commands of SettingsBot
+const (
+	settingsCmd = "/settings"
+	enableCmd   = "/enable"
+	disableCmd  = "/disable"
+)
+
+const settingsUsage = "Usage: /settings [verbosity silent|verbose] [language en|ru] " +
+	"[trigger everyone|admins] [mentions inline|list] [bot name on|off]"
+
+// values of settings in the order they are switched by buttons
+var (
+	verbosities        = []string{string(settings.VerbositySilent), string(settings.VerbosityVerbose)}
+	triggerPermissions = []string{string(settings.TriggerEveryone), string(settings.TriggerAdmins)}
+	mentionStyles      = []string{string(settings.MentionsInline), string(settings.MentionsList)}
+	switches           = []string{"on", "off"}
+)
+
+// SettingsBot lets admins of the chat change settings of the chat, that are
+// read by other bots, with /settings command and buttons under its answer
+type SettingsBot struct {
+	Store    settings.Store
+	Bots     []string // names of bots, that might be disabled in the chat
+	UserName string   // username of the bot, commands addressed to other bots are ignored
+}
+
+// NewSettingsBot initializes an instance of SettingsBot
+func NewSettingsBot(store settings.Store, bots []string, userName string) *SettingsBot {
+	return &SettingsBot{Store: store, Bots: bots, UserName: userName}
+}
+
+// OnMessage shows settings of the chat or changes them by /settings command,
+// bots are also enabled and disabled by /enable and /disable commands
+func (s *SettingsBot) OnMessage(ctx context.Context, msg Message) *Response {
+	if msg.ChatType != ChatTypeGroup {
+		return nil
+	}
+	cmd, args, addressed := parseCommand(msg.Text, s.UserName)
+	if !addressed {
+		return nil
+	}
+	usage := settingsUsage
+	switch cmd {
+	case settingsCmd:
+	case enableCmd, disableCmd:
+		usage = fmt.Sprintf("Usage: %s name, where name is one of %s", cmd, strings.Join(s.Bots, ", "))
+		if len(args) != 1 {
+			return &Response{Reply: true, Text: escapeUnderscores(usage)}
+		}
+		state := "on"
+		if cmd == disableCmd {
+			state = "off"
+		}
+		args = []string{"bot", args[0], state}
+	default:
+		return nil
+	}
+
+	chat, err := s.Store.Get(ctx, msg.ChatID)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] failed to get settings of chat %s: %v", msg.ChatID, err)
+		return &Response{Reply: true, Text: translate(chat.Lang(), "Failed to get settings")}
+	}
+	if msg.From == nil || !msg.From.IsAdmin {
+		return &Response{Reply: true, Text: translate(chat.Lang(), "You don't have admin rights to execute this command")}
+	}
+
+	if len(args) > 0 {
+		change, err := s.change(args)
+		if err != nil {
+			return &Response{Reply: true, Text: escapeUnderscores(err.Error() + "\n" + usage)}
+		}
+		err = s.Store.Update(ctx, msg.ChatID, func(st *settings.Settings) error {
+			change(st)
+			chat = *st
+			return nil
+		})
+		if err != nil {
+			logging.Printf(ctx, "[WARN] failed to save settings of chat %s: %v", msg.ChatID, err)
+			return &Response{Reply: true, Text: translate(chat.Lang(), "Failed to save settings")}
+		}
+		logging.Printf(ctx, "[INFO] settings of chat %s changed by %s: %s", msg.ChatID, msg.From.ID, strings.Join(args, " "))
+	}
+
+	if cmd != settingsCmd {
+		text := fmt.Sprintf(translate(chat.Lang(), "Bot %s is enabled"), args[1])
+		if cmd == disableCmd {
+			text = fmt.Sprintf(translate(chat.Lang(), "Bot %s is disabled"), args[1])
+		}
+		return &Response{Reply: true, Text: escapeUnderscores(text)}
+	}
+
+	resp := s.menu(chat)
+	if msg.Callback {
+		resp.EditMessage = msg.ID
+	}
+	return resp
+}
+
+// change validates arguments of the command, e.g. verbosity silent, and returns
+// the function, that changes the described setting
+func (s *SettingsBot) change(args []string) (func(chat *settings.Settings), error) {
+	if args[0] == "bot" {
+		if len(args) != 3 || !containsString(s.Bots, args[1]) || !containsString(switches, args[2]) {
+			return nil, fmt.Errorf("bot must be one of %s and followed by on or off", strings.Join(s.Bots, ", "))
+		}
+		return func(chat *settings.Settings) { chat.SetBotEnabled(args[1], args[2] == "on") }, nil
+	}
+
+	if len(args) != 2 {
+		return nil, fmt.Errorf("setting %s requires a single value", args[0])
+	}
+	key, value := args[0], args[1]
+	var allowed []string
+	var fn func(chat *settings.Settings)
+	switch key {
+	case "verbosity":
+		allowed = verbosities
+		fn = func(chat *settings.Settings) { chat.Verbosity = settings.Verbosity(value) }
+	case "language":
+		allowed = settings.Languages
+		fn = func(chat *settings.Settings) { chat.Language = value }
+	case "trigger":
+		allowed = triggerPermissions
+		fn = func(chat *settings.Settings) { chat.Trigger = settings.TriggerPermission(value) }
+	case "mentions":
+		allowed = mentionStyles
+		fn = func(chat *settings.Settings) { chat.Mentions = settings.MentionStyle(value) }
+	default:
+		return nil, fmt.Errorf("unknown setting %s", key)
+	}
+	if !containsString(allowed, value) {
+		return nil, fmt.Errorf("%s must be one of %s", key, strings.Join(allowed, ", "))
+	}
+	return fn, nil
+}
+
+// menu describes settings of the chat with buttons, each of which switches the setting to the next value
+func (s *SettingsBot) menu(chat settings.Settings) *Response {
+	lang := chat.Lang()
+	var lines []string
+	var buttons [][]Button
+	add := func(title, key, value string, values []string) {
+		shown := translate(lang, "default")
+		if value != "" {
+			shown = translate(lang, value)
+		}
+		text := title + ": " + shown
+		lines = append(lines, escapeUnderscores(text))
+		buttons = append(buttons, []Button{{Text: text, Data: settingsCmd + " " + key + " " + next(values, value)}})
+	}
+
+	add(translate(lang, "Verbosity"), "verbosity", string(chat.Verbosity), verbosities)
+	add(translate(lang, "Language"), "language", lang, settings.Languages)
+	add(translate(lang, "Pings"), "trigger", string(chat.Trigger), triggerPermissions)
+	add(translate(lang, "Mentions"), "mentions", string(chat.Mentions), mentionStyles)
+	for _, name := range s.Bots {
+		state := "on"
+		if !chat.BotEnabled(name) {
+			state = "off"
+		}
+		add(translate(lang, "Bot")+" "+name, "bot "+name, state, switches)
+	}
+
+	return &Response{
+		Text:    "*" + translate(lang, "Settings of the chat") + "*\n" + strings.Join(lines, "\n"),
+		Buttons: buttons,
+	}
+}
+
+// Help returns the description of settings commands
+func (s *SettingsBot) Help(_ context.Context, _ string) string {
+	return `Settings bot - lets admins change the behavior of bots in the chat
+/settings - shows settings of the chat with buttons to change them
+/settings verbosity silent|verbose - ignores invalid commands or explains what is wrong with them
+/settings language en|ru - sets the language of answers, command help stays in english
+/settings trigger everyone|admins - allows everyone or only admins to ping groups
+/settings mentions inline|list - puts mentions of members into one line or each on its own line
+/settings bot name on|off - enables or disables the bot in the chat
+/enable name - enables the bot in the chat
+/disable name - disables the bot in the chat`
+}
+
+// Name returns the name of the bot
+func (s *SettingsBot) Name() string {
+	return "settings"
+}
+
+// next returns the value after the current one in the cycle, the first one, if the current one is not set
+func next(values []string, current string) string {
+	for i, v := range values {
+		if v == current {
+			return values[(i+1)%len(values)]
+		}
+	}
+	return values[0]
+}
+
+// containsString returns true if the slice contains exactly the given string
+func containsString(s []string, e string) bool {
+	for _, a := range s {
+		if a == e {
+			return true
+		}
+	}
+	return false
+}
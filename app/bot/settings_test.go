@@ -0,0 +1,118 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Semior001/multibot-utility/app/store/settings"
+)
+
+func TestSettingsBot_Menu(t *testing.T) {
+	store := settings.MockStore{}
+	store.On("Get", mock.Anything, "chat").Return(settings.Settings{
+		Verbosity:    settings.VerbositySilent,
+		DisabledBots: []string{"groups"},
+	}, nil)
+	b := NewSettingsBot(&store, []string{"groups"}, "multibot")
+
+	admin := &User{ID: "1", IsAdmin: true}
+	resp := b.OnMessage(context.Background(), Message{ID: "10", ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/settings"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "*Settings of the chat*\n"+
+		"Verbosity: silent\n"+
+		"Language: en\n"+
+		"Pings: default\n"+
+		"Mentions: default\n"+
+		"Bot groups: off", resp.Text)
+	assert.Equal(t, [][]Button{
+		{{Text: "Verbosity: silent", Data: "/settings verbosity verbose"}},
+		{{Text: "Language: en", Data: "/settings language ru"}},
+		{{Text: "Pings: default", Data: "/settings trigger everyone"}},
+		{{Text: "Mentions: default", Data: "/settings mentions inline"}},
+		{{Text: "Bot groups: off", Data: "/settings bot groups on"}},
+	}, resp.Buttons)
+	assert.Empty(t, resp.EditMessage)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{ID: "2"}, Text: "/settings"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "You don't have admin rights to execute this command", resp.Text)
+	assert.Empty(t, resp.Buttons)
+
+	assert.Nil(t, b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/list_groups"}))
+	assert.Nil(t, b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypePrivate, From: admin, Text: "/settings"}))
+}
+
+func TestSettingsBot_Change(t *testing.T) {
+	store := settings.MockStore{}
+	store.On("Get", mock.Anything, "chat").Return(settings.Settings{}, nil)
+	expectUpdate(&store, settings.Settings{}, settings.Settings{Language: "ru"}, nil)
+	expectUpdate(&store, settings.Settings{}, settings.Settings{DisabledBots: []string{"groups"}}, errors.New("failed"))
+	b := NewSettingsBot(&store, []string{"groups"}, "multibot")
+
+	admin := &User{ID: "1", IsAdmin: true}
+	resp := b.OnMessage(context.Background(), Message{
+		ID: "10", ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/settings language ru", Callback: true,
+	})
+	require.NotNil(t, resp)
+	assert.Equal(t, "10", resp.EditMessage, "menu under the pressed button is replaced")
+	assert.Contains(t, resp.Text, "*Настройки чата*\n")
+	assert.Equal(t, Button{Text: "Язык: ru", Data: "/settings language en"}, resp.Buttons[1][0])
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/settings bot groups off"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "Failed to save settings", resp.Text)
+
+	for _, text := range []string{"/settings language de", "/settings colour red", "/settings bot other off", "/settings verbosity"} {
+		resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: text})
+		require.NotNil(t, resp, text)
+		assert.Contains(t, resp.Text, "Usage: /settings", text)
+	}
+	store.AssertExpectations(t)
+}
+
+func TestSettingsBot_EnableDisable(t *testing.T) {
+	store := settings.MockStore{}
+	store.On("Get", mock.Anything, "chat").Return(settings.Settings{Language: "ru"}, nil)
+	expectUpdate(&store, settings.Settings{Language: "ru"}, settings.Settings{Language: "ru", DisabledBots: []string{"groups"}}, nil)
+	expectUpdate(&store, settings.Settings{Language: "ru", DisabledBots: []string{"groups"}}, settings.Settings{Language: "ru"}, nil)
+	b := NewSettingsBot(&store, []string{"groups"}, "multibot")
+
+	admin := &User{ID: "1", IsAdmin: true}
+	resp := b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/disable groups"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "Бот groups выключен", resp.Text)
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/enable@multibot groups"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "Бот groups включен", resp.Text)
+
+	assert.Nil(t, b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: "/disable@otherbot groups"}),
+		"command, addressed to another bot, is ignored")
+
+	for _, text := range []string{"/enable", "/disable settings", "/enable groups other"} {
+		resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: admin, Text: text})
+		require.NotNil(t, resp, text)
+		assert.Contains(t, resp.Text, "Usage: /", text)
+	}
+
+	resp = b.OnMessage(context.Background(), Message{ChatID: "chat", ChatType: ChatTypeGroup, From: &User{ID: "2"}, Text: "/disable groups"})
+	require.NotNil(t, resp)
+	assert.Equal(t, "У вас нет прав администратора для выполнения этой команды", resp.Text)
+	store.AssertExpectations(t)
+}
+
+// expectUpdate expects the single update of settings of the chat, that changes
+// the stored settings to the expected ones
+func expectUpdate(store *settings.MockStore, stored, expected settings.Settings, err error) {
+	changes := func(fn func(*settings.Settings) error) bool {
+		s := stored
+		return fn(&s) == nil && reflect.DeepEqual(expected, s)
+	}
+	store.On("Update", mock.Anything, "chat", mock.MatchedBy(changes)).Return(err).Once()
+}
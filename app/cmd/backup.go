@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Semior001/multibot-utility/app/store/groups"
+)
+
+// BackupCmd makes the consistent copy of the bolt storage, the database of the running
+// bot is locked, so its backup is downloaded from the admin server of the bot
+type BackupCmd struct {
+	Db struct {
+		Location string `long:"location" env:"LOCATION" description:"location of the bolt storage file, if the bot is stopped"`
+	} `group:"db" namespace:"db" env-namespace:"DB"`
+	Admin struct {
+		URL   string `long:"url" env:"URL" description:"url of the admin server of the running bot, e.g. http://localhost:8080"`
+		Token string `long:"token" env:"TOKEN" description:"bearer token of the admin server"`
+	} `group:"admin" namespace:"admin" env-namespace:"ADMIN"`
+	Output string `long:"output" short:"o" env:"OUTPUT" description:"file to write the backup to" required:"true"`
+}
+
+// RestoreCmd replaces the bolt storage with the validated backup, the bot must be stopped
+type RestoreCmd struct {
+	Db struct {
+		Location string `long:"location" env:"LOCATION" description:"location of the bolt storage file" required:"true"`
+	} `group:"db" namespace:"db" env-namespace:"DB"`
+	Input string `long:"input" short:"i" env:"INPUT" description:"backup file to restore" required:"true"`
+}
+
+// Execute makes the backup
+func (s BackupCmd) Execute(_ []string) error {
+	if (s.Db.Location == "") == (s.Admin.URL == "") {
+		return errors.New("either --db.location or --admin.url must be set")
+	}
+
+	ctx := context.Background()
+	backup := s.downloadBackup
+	if s.Db.Location != "" {
+		// opening read-only, so the backup is made without applying migrations
+		db, err := bolt.Open(s.Db.Location, 0600, &bolt.Options{ReadOnly: true, Timeout: openTimeout})
+		if err != nil {
+			return errors.Wrap(err, "failed to open database, use --admin.url to backup the running bot")
+		}
+		defer db.Close() //nolint:errcheck // nothing is written
+		backup = func(_ context.Context, w io.Writer) (n int64, err error) {
+			err = db.View(func(tx *bolt.Tx) error {
+				n, err = tx.WriteTo(w)
+				return err
+			})
+			return n, errors.Wrapf(err, "failed to backup boltdb %s", s.Db.Location)
+		}
+	}
+
+	f, err := os.OpenFile(s.Output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s", s.Output)
+	}
+	n, err := backup(ctx, f)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = errors.Wrapf(closeErr, "failed to close %s", s.Output)
+	}
+	if err == nil {
+		err = groups.ValidateBoltBackup(s.Output)
+	}
+	if err != nil {
+		_ = os.Remove(s.Output)
+		return err
+	}
+	log.Printf("[INFO] backup of %d bytes saved to %s", n, s.Output)
+	return nil
+}
+
+// downloadBackup writes the backup, made by the running bot
+func (s BackupCmd) downloadBackup(ctx context.Context, w io.Writer) (int64, error) {
+	url := strings.TrimSuffix(s.Admin.URL, "/") + "/backup"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to make request to %s", url)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.Admin.Token)
+
+	resp, err := (&http.Client{Timeout: 10 * time.Minute}).Do(req)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to download backup from %s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, errors.Errorf("failed to download backup from %s, status %s", url, resp.Status)
+	}
+	n, err := io.Copy(w, resp.Body)
+	return n, errors.Wrapf(err, "failed to download backup from %s", url)
+}
+
+// Execute restores the backup
+func (s RestoreCmd) Execute(_ []string) error {
+	kept, err := groups.RestoreBoltDB(s.Input, s.Db.Location, bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return err
+	}
+	if kept != "" {
+		log.Printf("[INFO] previous database is kept at %s", kept)
+	}
+	log.Printf("[INFO] database %s restored from %s", s.Db.Location, s.Input)
+	return nil
+}
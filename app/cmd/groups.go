@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Semior001/multibot-utility/app/store/groups"
+)
+
+// cliActor is recorded in the audit log as the author of changes, made from the command line
+const cliActor = "cli"
+
+// stdout receives listings, documents and changes, printed by offline commands
+var stdout io.Writer = os.Stdout
+
+// GroupsCmd contains commands to inspect and edit groups in the database without starting the bot
+type GroupsCmd struct {
+	Chats struct {
+		List ChatsListCmd `command:"list" description:"list all chats"`
+	} `command:"chats" description:"inspect chats"`
+	List    GroupsListCmd   `command:"list" description:"list groups of the chat"`
+	Add     GroupsAddCmd    `command:"add" description:"create the group"`
+	Remove  GroupsRemoveCmd `command:"remove" description:"delete the group"`
+	Rename  GroupsRenameCmd `command:"rename" description:"rename the group"`
+	Members struct {
+		Add    MembersAddCmd    `command:"add" description:"add users to the group"`
+		Remove MembersRemoveCmd `command:"remove" description:"remove users from the group"`
+	} `command:"members" description:"edit members of groups"`
+	Export GroupsExportCmd `command:"export" description:"export groups of the chat as a json or yaml document"`
+	Import GroupsImportCmd `command:"import" description:"create or replace groups of the chat from the document"`
+}
+
+// StoreOpts defines the database, that offline commands work with
+type StoreOpts struct {
+	Db struct {
+		Type     string `long:"type" env:"TYPE" description:"type of the storage" choice:"bolt" choice:"sqlite" choice:"postgres" default:"bolt"`
+		Location string `long:"location" env:"LOCATION" description:"location of the storage file or postgres connection url" required:"true"`
+	} `group:"db" namespace:"db" env-namespace:"DB"`
+}
+
+// GroupsExportCmd writes groups of the chat with their settings and synonyms as a document
+type GroupsExportCmd struct {
+	StoreOpts
+	Chat   string `long:"chat" env:"CHAT" description:"id of the chat" required:"true"`
+	Format string `long:"format" env:"FORMAT" description:"format of the document" choice:"json" choice:"yaml" default:"json"`
+	Output string `long:"output" short:"o" env:"OUTPUT" description:"file to write the document to, stdout by default"`
+}
+
+// GroupsImportCmd creates or replaces groups of the chat from the document, groups,
+// that are not mentioned in the document, are kept as is
+type GroupsImportCmd struct {
+	StoreOpts
+	Chat   string `long:"chat" env:"CHAT" description:"id of the chat" required:"true"`
+	Input  string `long:"input" short:"i" env:"INPUT" description:"file to read the document from, stdin by default"`
+	DryRun bool   `long:"dry-run" env:"DRY_RUN" description:"show changes without applying them"`
+}
+
+// Execute exports groups of the chat
+func (s GroupsExportCmd) Execute(_ []string) error {
+	ctx := context.Background()
+	svc, closer, err := s.openStore()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	snapshots, err := groups.ExportGroups(ctx, svc, s.Chat)
+	if err != nil {
+		return err
+	}
+	data, err := groups.MarshalDocument(groups.NewDocument(s.Chat, snapshots), s.Format)
+	if err != nil {
+		return err
+	}
+
+	if s.Output == "" {
+		_, err = stdout.Write(data)
+		return errors.Wrap(err, "failed to write document")
+	}
+	if err = ioutil.WriteFile(s.Output, data, 0600); err != nil {
+		return errors.Wrapf(err, "failed to write document to %s", s.Output)
+	}
+	log.Printf("[INFO] %d groups of chat %s exported to %s", len(snapshots), s.Chat, s.Output)
+	return nil
+}
+
+// Execute validates the document, shows changes and applies them in a single transaction
+func (s GroupsImportCmd) Execute(_ []string) error {
+	ctx := context.Background()
+
+	var data []byte
+	var err error
+	if s.Input == "" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(s.Input)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read document")
+	}
+
+	doc, err := groups.UnmarshalDocument(data)
+	if err != nil {
+		return err
+	}
+	snapshots, err := doc.Snapshots()
+	if err != nil {
+		return errors.Wrap(err, "invalid document")
+	}
+
+	svc, closer, err := s.openStore()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	current, err := groups.ExportGroups(ctx, svc, s.Chat)
+	if err != nil && !errors.Is(err, groups.ErrChatNotFound) {
+		return err
+	}
+	diff := groups.DiffSnapshots(current, snapshots)
+	if len(diff) == 0 {
+		log.Printf("[INFO] nothing to import, groups of chat %s are up to date", s.Chat)
+		return nil
+	}
+	for _, line := range diff {
+		fmt.Fprintln(stdout, line)
+	}
+	if s.DryRun {
+		return nil
+	}
+
+	if err = svc.ImportGroups(withChange(ctx, groups.ActionImportGroup), s.Chat, snapshots); err != nil {
+		return err
+	}
+	log.Printf("[INFO] %d groups imported into chat %s", len(snapshots), s.Chat)
+	return nil
+}
+
+// openStore opens the database of groups, bolt database is waited for
+// a limited time, as it might be locked by the running bot
+func (s StoreOpts) openStore() (groups.Store, io.Closer, error) {
+	switch s.Db.Type {
+	case "postgres":
+		svc, err := groups.NewPostgres(s.Db.Location, groups.PostgresOptions{})
+		return svc, svc, err
+	case "sqlite":
+		svc, err := groups.NewSQLite(s.Db.Location)
+		return svc, svc, err
+	default:
+		svc, err := groups.NewBoltDB(s.Db.Location, bolt.Options{Timeout: openTimeout})
+		return svc, svc, err
+	}
+}
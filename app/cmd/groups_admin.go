@@ -0,0 +1,297 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Semior001/multibot-utility/app/store/groups"
+)
+
+// OutputOpts defines the format of listings
+type OutputOpts struct {
+	Output string `long:"output" env:"OUTPUT" description:"format of the output" choice:"table" choice:"json" default:"table"`
+}
+
+// ChatsListCmd prints all chats with numbers of their groups
+type ChatsListCmd struct {
+	StoreOpts
+	OutputOpts
+}
+
+// GroupsListCmd prints groups of the chat with their members, synonyms and settings
+type GroupsListCmd struct {
+	StoreOpts
+	OutputOpts
+	Chat string `long:"chat" env:"CHAT" description:"id of the chat" required:"true"`
+}
+
+// GroupsAddCmd creates the group
+type GroupsAddCmd struct {
+	StoreOpts
+	Chat  string `long:"chat" env:"CHAT" description:"id of the chat" required:"true"`
+	Force bool   `long:"force" description:"replace members of the existing group"`
+	Args  struct {
+		Alias string   `positional-arg-name:"alias"`
+		Users []string `positional-arg-name:"users" required:"1"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// GroupsRemoveCmd deletes the group, it can be restored by /restore_group in the chat
+type GroupsRemoveCmd struct {
+	StoreOpts
+	Chat string `long:"chat" env:"CHAT" description:"id of the chat" required:"true"`
+	Args struct {
+		Alias string `positional-arg-name:"alias"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// GroupsRenameCmd changes the alias of the group
+type GroupsRenameCmd struct {
+	StoreOpts
+	Chat string `long:"chat" env:"CHAT" description:"id of the chat" required:"true"`
+	Args struct {
+		Alias    string `positional-arg-name:"alias"`
+		NewAlias string `positional-arg-name:"new-alias"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// MembersAddCmd adds users to the group
+type MembersAddCmd struct {
+	StoreOpts
+	Chat string `long:"chat" env:"CHAT" description:"id of the chat" required:"true"`
+	Args struct {
+		Alias string   `positional-arg-name:"alias"`
+		Users []string `positional-arg-name:"users" required:"1"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// MembersRemoveCmd removes users from the group
+type MembersRemoveCmd struct {
+	StoreOpts
+	Chat string `long:"chat" env:"CHAT" description:"id of the chat" required:"true"`
+	Args struct {
+		Alias string   `positional-arg-name:"alias"`
+		Users []string `positional-arg-name:"users" required:"1"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// Execute prints all chats
+func (s ChatsListCmd) Execute(_ []string) error {
+	ctx := context.Background()
+	svc, closer, err := s.openStore()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	ids, err := svc.GetChats(ctx)
+	if err != nil {
+		return err
+	}
+
+	type chat struct {
+		ID     string `json:"id"`
+		Groups int    `json:"groups"`
+	}
+	chats := make([]chat, 0, len(ids))
+	for _, id := range ids {
+		grps, err := svc.GetGroups(ctx, id)
+		if err != nil {
+			return err
+		}
+		chats = append(chats, chat{ID: id, Groups: len(grps)})
+	}
+
+	if s.Output == "json" {
+		return printJSON(chats)
+	}
+	rows := [][]string{{"CHAT", "GROUPS"}}
+	for _, c := range chats {
+		rows = append(rows, []string{c.ID, strconv.Itoa(c.Groups)})
+	}
+	return printTable(rows)
+}
+
+// Execute prints groups of the chat
+func (s GroupsListCmd) Execute(_ []string) error {
+	ctx := context.Background()
+	svc, closer, err := s.openStore()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	snapshots, err := groups.ExportGroups(ctx, svc, s.Chat)
+	if err != nil {
+		return err
+	}
+
+	doc := groups.NewDocument(s.Chat, snapshots)
+	if s.Output == "json" {
+		return printJSON(doc.Groups)
+	}
+	rows := [][]string{{"ALIAS", "COUNT", "MEMBERS", "SYNONYMS", "ADMINS ONLY", "COOLDOWN", "DESCRIPTION"}}
+	for _, g := range doc.Groups {
+		rows = append(rows, []string{
+			g.Alias,
+			strconv.Itoa(len(g.Members)),
+			strings.Join(g.Members, ", "),
+			strings.Join(g.Synonyms, ", "),
+			strconv.FormatBool(g.AdminsOnly),
+			g.Cooldown,
+			g.Description,
+		})
+	}
+	return printTable(rows)
+}
+
+// Execute creates the group or replaces its members, if forced
+func (s GroupsAddCmd) Execute(_ []string) error {
+	ctx := context.Background()
+	alias, err := checkAlias(s.Args.Alias)
+	if err != nil {
+		return err
+	}
+	users := groups.PrefixUsernames(s.Args.Users)
+
+	svc, closer, err := s.openStore()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	err = svc.CreateGroup(withChange(ctx, groups.ActionCreateGroup), s.Chat, alias, users)
+	if errors.Is(err, groups.ErrGroupExists) && s.Force {
+		err = svc.PutGroup(withChange(ctx, groups.ActionReplaceGroup), s.Chat, alias, users)
+	}
+	if errors.Is(err, groups.ErrGroupExists) {
+		return errors.Errorf("group %s already exists, use --force to replace its members", alias)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] group %s:%s saved with %d members", s.Chat, alias, len(users))
+	return nil
+}
+
+// Execute deletes the group and keeps its tombstone
+func (s GroupsRemoveCmd) Execute(_ []string) error {
+	ctx := context.Background()
+	alias := groups.NormalizeAlias(s.Args.Alias)
+
+	svc, closer, err := s.openStore()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	if err = svc.DeleteGroup(withChange(ctx, groups.ActionDeleteGroup), s.Chat, alias); err != nil {
+		return err
+	}
+	log.Printf("[INFO] group %s:%s deleted", s.Chat, alias)
+	return nil
+}
+
+// Execute renames the group
+func (s GroupsRenameCmd) Execute(_ []string) error {
+	ctx := context.Background()
+	oldAlias := groups.NormalizeAlias(s.Args.Alias)
+	newAlias, err := checkAlias(s.Args.NewAlias)
+	if err != nil {
+		return err
+	}
+
+	svc, closer, err := s.openStore()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	if err = svc.RenameGroup(withChange(ctx, groups.ActionRenameGroup), s.Chat, oldAlias, newAlias); err != nil {
+		return err
+	}
+	log.Printf("[INFO] group %s:%s renamed to %s", s.Chat, oldAlias, newAlias)
+	return nil
+}
+
+// Execute adds users to the group
+func (s MembersAddCmd) Execute(_ []string) error {
+	ctx := context.Background()
+	alias := groups.NormalizeAlias(s.Args.Alias)
+	users := groups.PrefixUsernames(s.Args.Users)
+
+	svc, closer, err := s.openStore()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	added, err := svc.AddUsers(withChange(ctx, groups.ActionAddUsers), s.Chat, alias, users)
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] %d of %d users added to group %s:%s", added, len(users), s.Chat, alias)
+	return nil
+}
+
+// Execute removes users from the group and keeps the tombstone of removed ones
+func (s MembersRemoveCmd) Execute(_ []string) error {
+	ctx := context.Background()
+	alias := groups.NormalizeAlias(s.Args.Alias)
+	users := groups.PrefixUsernames(s.Args.Users)
+
+	svc, closer, err := s.openStore()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	removed, err := svc.DeleteUsers(withChange(ctx, groups.ActionDeleteUsers), s.Chat, alias, users)
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] %d of %d users removed from group %s:%s", removed, len(users), s.Chat, alias)
+	return nil
+}
+
+// withChange returns the context, which makes the store record the change, made from the
+// command line, into the audit log and keep the tombstone of removed data along with it
+func withChange(ctx context.Context, action string) context.Context {
+	return groups.WithChange(ctx, groups.Change{Actor: cliActor, Action: action, At: time.Now()})
+}
+
+// checkAlias returns the normalized alias, if it can be used as a group alias,
+// aliases are checked the same way as by the bot, so they can be mentioned in the chat
+func checkAlias(alias string) (string, error) {
+	alias = groups.NormalizeAlias(alias)
+	if err := groups.ValidateAlias(alias); err != nil {
+		return "", errors.Wrap(err, "invalid group alias")
+	}
+	return alias, nil
+}
+
+// printJSON writes the value to stdout as indented json
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(v), "failed to write json")
+}
+
+// printTable writes rows to stdout as a table with aligned columns
+func printTable(rows [][]string) error {
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		if _, err := fmt.Fprintln(w, strings.Join(row, "\t")); err != nil {
+			return errors.Wrap(err, "failed to write table")
+		}
+	}
+	return errors.Wrap(w.Flush(), "failed to write table")
+}
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Semior001/multibot-utility/app/store/groups"
+)
+
+func TestGroupsCommands(t *testing.T) {
+	opts, teardown := prepStoreOpts(t)
+	defer teardown()
+
+	tbl := []struct {
+		name string
+		cmd  interface{ Execute([]string) error }
+		err  string
+	}{
+		{name: "add", cmd: groupsAdd(opts, "@devs", false, "user1", "@user2", "user1")},
+		{name: "add existing", cmd: groupsAdd(opts, "@DEVS", false, "user3"), err: "group @devs already exists"},
+		{name: "add forced", cmd: groupsAdd(opts, "@devs", true, "user1", "user2", "user3")},
+		{name: "add hyphen", cmd: groupsAdd(opts, "@back-end", false, "user4")},
+		{name: "add reserved", cmd: groupsAdd(opts, "@all", false, "user1"), err: "alias is reserved"},
+		{name: "add reserved upper", cmd: groupsAdd(opts, "@Everyone", false, "user1"), err: "alias is reserved"},
+		{name: "add trailing hyphen", cmd: groupsAdd(opts, "@back-", false, "user1"), err: "invalid group alias"},
+		{name: "add unicode", cmd: groupsAdd(opts, "@Бэк", false, "user1")},
+		{name: "add unicode symbol", cmd: groupsAdd(opts, "@бэк✓", false, "user1"), err: "invalid group alias"},
+		{name: "add no prefix", cmd: groupsAdd(opts, "devs", false, "user1"), err: "invalid group alias"},
+		{name: "members add", cmd: membersAdd(opts, "@devs", "user3", "user5")},
+		{name: "members add unknown group", cmd: membersAdd(opts, "@ops", "user1"), err: "not found"},
+		{name: "members remove", cmd: membersRemove(opts, "@devs", "@user1")},
+		{name: "rename", cmd: groupsRename(opts, "@back-end", "@backend")},
+		{name: "rename reserved", cmd: groupsRename(opts, "@backend", "@here"), err: "alias is reserved"},
+		{name: "rename invalid", cmd: groupsRename(opts, "@backend", "@back end"), err: "invalid group alias"},
+		{name: "rename unknown group", cmd: groupsRename(opts, "@ops", "@sre"), err: "not found"},
+		{name: "add to remove", cmd: groupsAdd(opts, "@qa", false, "user6")},
+		{name: "remove", cmd: groupsRemove(opts, "@qa")},
+		{name: "remove unknown group", cmd: groupsRemove(opts, "@qa"), err: "not found"},
+	}
+	for _, tt := range tbl {
+		err := tt.cmd.Execute(nil)
+		if tt.err != "" {
+			require.Error(t, err, tt.name)
+			assert.Contains(t, err.Error(), tt.err, tt.name)
+			continue
+		}
+		require.NoError(t, err, tt.name)
+	}
+
+	svc := openTestStore(t, opts)
+	defer svc.Close()
+	ctx := context.Background()
+
+	grps, err := svc.GetGroups(ctx, "chat")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"@devs":    {"@user2", "@user3", "@user5"},
+		"@backend": {"@user4"},
+		"@бэк":     {"@user1"},
+	}, sortedMembers(grps))
+
+	entries, err := svc.GetAuditLog(ctx, "chat", "@backend", 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, groups.ActionRenameGroup, entries[0].Action)
+	assert.Equal(t, groups.ActionCreateGroup, entries[1].Action)
+	assert.Equal(t, cliActor, entries[0].Actor)
+
+	tombstones, err := svc.GetTombstones(ctx, "chat")
+	require.NoError(t, err)
+	require.Len(t, tombstones, 2)
+	assert.Equal(t, "@qa", tombstones[0].Group)
+	assert.Equal(t, []string{"@user6"}, tombstones[0].Members)
+	assert.Equal(t, "@devs", tombstones[1].Group)
+	assert.Equal(t, []string{"@user1"}, tombstones[1].Members)
+}
+
+func TestGroupsImportCmd(t *testing.T) {
+	opts, teardown := prepStoreOpts(t)
+	defer teardown()
+	require.NoError(t, groupsAdd(opts, "@devs", false, "user1").Execute(nil))
+
+	tbl := []struct {
+		name string
+		doc  string
+		err  string
+	}{
+		{name: "reserved alias", doc: `{"groups":[{"alias":"@all","members":["@user1"]}]}`, err: "alias is reserved"},
+		{name: "reserved synonym", doc: `{"groups":[{"alias":"@ops","members":["@user1"],"synonyms":["@everyone"]}]}`,
+			err: "alias is reserved"},
+		{name: "hyphen at end", doc: `{"groups":[{"alias":"@back-","members":["@user1"]}]}`, err: "invalid alias"},
+		{name: "symbol in alias", doc: `{"groups":[{"alias":"@бэк✓","members":["@user1"]}]}`, err: "invalid alias"},
+		{name: "valid", doc: `{"groups":[{"alias":"@back-end","members":["@user2"],"synonyms":["@be"]}]}`},
+	}
+	for _, tt := range tbl {
+		input := filepath.Join(filepath.Dir(opts.Db.Location), "doc.json")
+		require.NoError(t, ioutil.WriteFile(input, []byte(tt.doc), 0600), tt.name)
+
+		out := captureStdout(t, func() error {
+			return GroupsImportCmd{StoreOpts: opts, Chat: "chat", Input: input}.Execute(nil)
+		}, tt.err)
+		if tt.err != "" {
+			assert.Empty(t, out, tt.name)
+			continue
+		}
+		assert.Contains(t, out, "@back-end", tt.name)
+	}
+
+	svc := openTestStore(t, opts)
+	defer svc.Close()
+	grps, err := svc.GetGroups(context.Background(), "chat")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"@devs": {"@user1"}, "@back-end": {"@user2"}}, sortedMembers(grps))
+}
+
+func TestListCommands_Output(t *testing.T) {
+	opts, teardown := prepStoreOpts(t)
+	defer teardown()
+	require.NoError(t, groupsAdd(opts, "@devs", false, "user1", "user2").Execute(nil))
+	require.NoError(t, groupsAdd(opts, "@qa", false, "user3").Execute(nil))
+
+	tbl := []struct {
+		name   string
+		cmd    func(output string) interface{ Execute([]string) error }
+		table  []string
+		json   interface{}
+		parsed interface{}
+	}{
+		{
+			name: "chats",
+			cmd: func(output string) interface{ Execute([]string) error } {
+				return ChatsListCmd{StoreOpts: opts, OutputOpts: OutputOpts{Output: output}}
+			},
+			table: []string{
+				"CHAT  GROUPS",
+				"chat  2",
+			},
+			json:   []map[string]interface{}{{"id": "chat", "groups": float64(2)}},
+			parsed: &[]map[string]interface{}{},
+		},
+		{
+			name: "groups",
+			cmd: func(output string) interface{ Execute([]string) error } {
+				return GroupsListCmd{StoreOpts: opts, OutputOpts: OutputOpts{Output: output}, Chat: "chat"}
+			},
+			table: []string{
+				"ALIAS  COUNT  MEMBERS         SYNONYMS  ADMINS ONLY  COOLDOWN  DESCRIPTION",
+				"@devs  2      @user1, @user2            false                  ",
+				"@qa    1      @user3                    false                  ",
+			},
+			json: []groups.DocumentGroup{
+				{Alias: "@devs", Members: []string{"@user1", "@user2"}},
+				{Alias: "@qa", Members: []string{"@user3"}},
+			},
+			parsed: &[]groups.DocumentGroup{},
+		},
+	}
+	for _, tt := range tbl {
+		out := captureStdout(t, func() error { return tt.cmd("table").Execute(nil) }, "")
+		assert.Equal(t, strings.Join(tt.table, "\n")+"\n", out, tt.name)
+
+		out = captureStdout(t, func() error { return tt.cmd("json").Execute(nil) }, "")
+		require.NoError(t, json.Unmarshal([]byte(out), tt.parsed), tt.name)
+		switch parsed := tt.parsed.(type) {
+		case *[]map[string]interface{}:
+			assert.Equal(t, tt.json, *parsed, tt.name)
+		case *[]groups.DocumentGroup:
+			assert.Equal(t, tt.json, *parsed, tt.name)
+		}
+	}
+}
+
+func groupsAdd(opts StoreOpts, alias string, force bool, users ...string) GroupsAddCmd {
+	c := GroupsAddCmd{StoreOpts: opts, Chat: "chat", Force: force}
+	c.Args.Alias, c.Args.Users = alias, users
+	return c
+}
+
+func groupsRemove(opts StoreOpts, alias string) GroupsRemoveCmd {
+	c := GroupsRemoveCmd{StoreOpts: opts, Chat: "chat"}
+	c.Args.Alias = alias
+	return c
+}
+
+func groupsRename(opts StoreOpts, alias, newAlias string) GroupsRenameCmd {
+	c := GroupsRenameCmd{StoreOpts: opts, Chat: "chat"}
+	c.Args.Alias, c.Args.NewAlias = alias, newAlias
+	return c
+}
+
+func membersAdd(opts StoreOpts, alias string, users ...string) MembersAddCmd {
+	c := MembersAddCmd{StoreOpts: opts, Chat: "chat"}
+	c.Args.Alias, c.Args.Users = alias, users
+	return c
+}
+
+func membersRemove(opts StoreOpts, alias string, users ...string) MembersRemoveCmd {
+	c := MembersRemoveCmd{StoreOpts: opts, Chat: "chat"}
+	c.Args.Alias, c.Args.Users = alias, users
+	return c
+}
+
+// captureStdout runs the command and returns everything it printed to stdout
+func captureStdout(t *testing.T, execute func() error, expectedErr string) string {
+	buf := &bytes.Buffer{}
+	stdout = buf
+	defer func() { stdout = os.Stdout }()
+
+	err := execute()
+	if expectedErr != "" {
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), expectedErr)
+		return buf.String()
+	}
+	require.NoError(t, err)
+	return buf.String()
+}
+
+func sortedMembers(grps map[string][]string) map[string][]string {
+	res := make(map[string][]string, len(grps))
+	for alias, users := range grps {
+		res[alias] = append([]string{}, users...)
+		sort.Strings(res[alias])
+	}
+	return res
+}
+
+func openTestStore(t *testing.T, opts StoreOpts) *groups.BoltDB {
+	svc, err := groups.NewBoltDB(opts.Db.Location, bolt.Options{Timeout: openTimeout})
+	require.NoError(t, err)
+	return svc
+}
+
+func prepStoreOpts(t *testing.T) (opts StoreOpts, teardown func()) {
+	loc, err := ioutil.TempDir("", "test_cmd_groups_multibot")
+	require.NoError(t, err)
+	opts.Db.Type = "bolt"
+	opts.Db.Location = filepath.Join(loc, "groups.db")
+	return opts, func() { require.NoError(t, os.RemoveAll(loc)) }
+}
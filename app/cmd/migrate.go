@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Semior001/multibot-utility/app/store/groups"
+)
+
+// openTimeout limits the waiting for the lock of the database, that is used by the running bot
+const openTimeout = 5 * time.Second
+
+// MigrateCmd brings the layout of the bolt storage up to date without starting the bot
+type MigrateCmd struct {
+	Db struct {
+		Location string `long:"location" env:"LOCATION" description:"location of the bolt storage file" required:"true"`
+	} `group:"db" namespace:"db" env-namespace:"DB"`
+	DryRun bool `long:"dry-run" env:"DRY_RUN" description:"report changes, that migrations would make, without applying them"`
+}
+
+// Execute applies pending migrations or reports them in dry run mode
+func (s MigrateCmd) Execute(_ []string) error {
+	opts := bolt.Options{Timeout: openTimeout}
+
+	if s.DryRun {
+		changes, err := groups.DryRunBoltMigrations(s.Db.Location, opts)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			log.Printf("[INFO] database %s is up to date", s.Db.Location)
+		}
+		for _, change := range changes {
+			log.Printf("[INFO] dry run: %s", change)
+		}
+		return nil
+	}
+
+	svc, err := groups.NewBoltDB(s.Db.Location, opts)
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] database %s is up to date", s.Db.Location)
+	return svc.Close()
+}
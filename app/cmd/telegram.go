@@ -2,51 +2,340 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 
 	"github.com/Semior001/multibot-utility/app/bot"
+	"github.com/Semior001/multibot-utility/app/config"
 	"github.com/Semior001/multibot-utility/app/ctrl"
 	"github.com/Semior001/multibot-utility/app/store/groups"
-	bolt "github.com/coreos/bbolt"
+	"github.com/Semior001/multibot-utility/app/store/schedule"
+	"github.com/Semior001/multibot-utility/app/store/settings"
+	bolt "go.etcd.io/bbolt"
 )
 
 // TelegramCmd runs the multibot instance over telegram
 type TelegramCmd struct {
+	Config   string `long:"config" env:"CONFIG" description:"yaml configuration file, that overrides flags and is reloaded on SIGHUP"`
 	Telegram struct {
-		Token    string `long:"token" env:"TOKEN" description:"telegram bot token" default:"test"`
-		UserName string `long:"username" env:"USERNAME" description:"telegram bot username" default:"test"`
+		Token         string        `long:"token" env:"TOKEN" description:"telegram bot token" default:"test"`
+		UserName      string        `long:"username" env:"USERNAME" description:"telegram bot username, the bot refuses to start if it differs from the one reported by telegram"`
+		UpdateTimeout time.Duration `long:"update_timeout" env:"UPDATE_TIMEOUT" description:"maximal time to process a single update" default:"30s"`
 	} `group:"telegram" namespace:"telegram" env-namespace:"TELEGRAM"`
 	Db struct {
-		Location string `long:"location" env:"LOCATION" description:"location of boltdb sotrage" required:"true"`
+		Type            string        `long:"type" env:"TYPE" description:"type of the storage" choice:"bolt" choice:"sqlite" choice:"postgres" default:"bolt"`
+		Location        string        `long:"location" env:"LOCATION" description:"location of the storage file or postgres connection url"`
+		MaxOpenConns    int           `long:"max_open_conns" env:"MAX_OPEN_CONNS" description:"maximal number of open postgres connections, 0 is unlimited" default:"10"`
+		MaxIdleConns    int           `long:"max_idle_conns" env:"MAX_IDLE_CONNS" description:"maximal number of idle postgres connections" default:"2"`
+		ConnMaxLifetime time.Duration `long:"conn_max_lifetime" env:"CONN_MAX_LIFETIME" description:"maximal time a postgres connection may be reused, 0 is unlimited" default:"30m"`
 	} `group:"db" namespace:"db" env-namespace:"DB"`
+	GroupBot struct {
+		GroupCooldown      time.Duration `long:"group_cooldown" env:"GROUP_COOLDOWN" description:"minimal interval between two pings of the same group" default:"0s"`
+		UserCooldown       time.Duration `long:"user_cooldown" env:"USER_COOLDOWN" description:"minimal interval between two pings made by the same user" default:"0s"`
+		MaxTriggerSize     int           `long:"max_trigger_size" env:"MAX_TRIGGER_SIZE" description:"maximal size of a group, which non-admins are allowed to ping, 0 is unlimited" default:"0"`
+		AuditRetention     time.Duration `long:"audit_retention" env:"AUDIT_RETENTION" description:"period to keep changes of groups in the audit log, 0 is forever" default:"2160h"`
+		UndoWindow         time.Duration `long:"undo_window" env:"UNDO_WINDOW" description:"period, during which the user can revert own deletion by /undo" default:"15m"`
+		TombstoneRetention time.Duration `long:"tombstone_retention" env:"TOMBSTONE_RETENTION" description:"period to keep deleted groups and members for restore, 0 is forever" default:"720h"`
+	} `group:"groupbot" namespace:"groupbot" env-namespace:"GROUPBOT"`
+	Schedule struct {
+		Interval time.Duration `long:"interval" env:"INTERVAL" description:"interval to check the queue of deferred messages" default:"1m"`
+		Expiry   time.Duration `long:"expiry" env:"EXPIRY" description:"period to retry deferred messages, that failed to be sent" default:"1h"`
+	} `group:"schedule" namespace:"schedule" env-namespace:"SCHEDULE"`
+	Backup struct {
+		Dir      string        `long:"dir" env:"DIR" description:"directory to keep scheduled backups of the bolt storage, empty disables them"`
+		Interval time.Duration `long:"interval" env:"INTERVAL" description:"interval between scheduled backups" default:"24h"`
+		Keep     int           `long:"keep" env:"KEEP" description:"number of scheduled backups to keep, 0 keeps all" default:"7"`
+	} `group:"backup" namespace:"backup" env-namespace:"BACKUP"`
+	Admin struct {
+		Address string `long:"address" env:"ADDRESS" description:"address of the admin http server with metrics and backups, e.g. :8080, empty disables it"`
+		Token   string `long:"token" env:"TOKEN" description:"bearer token to access the backup endpoint, empty disables it"`
+	} `group:"admin" namespace:"admin" env-namespace:"ADMIN"`
+	Health struct {
+		MaxPollAge   time.Duration `long:"max_poll_age" env:"MAX_POLL_AGE" description:"maximal time since the last successful poll of updates, after which the bot is reported stuck" default:"3m"`
+		CheckTimeout time.Duration `long:"check_timeout" env:"CHECK_TIMEOUT" description:"maximal time of health checks of the store and telegram" default:"5s"`
+	} `group:"health" namespace:"health" env-namespace:"HEALTH"`
 }
 
 // Execute runs the telegram bot
 func (s TelegramCmd) Execute(_ []string) error {
-	svc, err := groups.NewBoltDB(s.Db.Location, bolt.Options{})
+	cfg, err := s.loadConfig()
 	if err != nil {
-		log.Fatalf("failed to create boltdb at test_groups_multibot %+v", err)
+		log.Fatalf("invalid configuration: %v", err)
 	}
-	tbapi, err := tgbotapi.NewBotAPI(s.Telegram.Token)
+	st, err := s.makeStores(cfg.Store)
 	if err != nil {
-		log.Fatalf("failed to create boltdb at test_groups_multibot %+v", err)
+		log.Fatalf("failed to initialize %s storage: %+v", cfg.Store.Type, err)
 	}
 	t := ctrl.TelegramBotCtrl{
-		Token: s.Telegram.Token,
-		Bots: &bot.MultiBot{
-			bot.NewGroupBot(bot.GroupBotParams{
-				Store:              svc,
-				RespondAllCommands: true,
-			}),
-		},
-		API:      tbapi,
-		UserName: s.Telegram.UserName,
+		Token:            cfg.Telegram.Token,
+		UpdateTimeout:    cfg.Telegram.UpdateTimeout,
+		Schedule:         st.schedule,
+		ScheduleInterval: s.Schedule.Interval,
+		ScheduleExpiry:   s.Schedule.Expiry,
+	}
+	// polls are tracked on the transport level, as the client polls for updates in background
+	tbapi, err := tgbotapi.NewBotAPIWithClient(cfg.Telegram.Token, &http.Client{Transport: t.TrackPolls(nil)})
+	if err != nil {
+		log.Fatalf("failed to create telegram bot api %+v", err)
+	}
+	t.API = tbapi
+	// commands in groups are addressed to the bot by its real username, e.g. /list_groups@bot
+	userName, err := botUserName(cfg.Telegram.UserName, tbapi.Self.UserName)
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	t.UserName = userName
+	bots := bot.NewReloadable(makeBots(cfg, st, userName))
+	t.Bots = bots
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		log.Print("[INFO] interrupt signal received, shutting down")
+		cancel()
+	}()
+	if s.Config != "" {
+		go s.reloadOnSignal(ctx, cfg, bots, st, userName)
+	}
+
+	// backups are made within read transactions, so only bolt storage supports them
+	boltDB, _ := st.groups.(*groups.BoltDB)
+	if s.Backup.Dir != "" {
+		if boltDB == nil {
+			log.Fatalf("scheduled backups are supported only for bolt storage")
+		}
+		if s.Backup.Interval <= 0 {
+			log.Fatalf("interval of scheduled backups must be positive")
+		}
+		go s.runBackups(ctx, boltDB)
+	}
+	if s.Admin.Address != "" {
+		admin := &ctrl.AdminServer{
+			Address:      s.Admin.Address,
+			Token:        s.Admin.Token,
+			LiveChecks:   []ctrl.HealthCheck{t.CheckPolling(s.Health.MaxPollAge)},
+			ReadyChecks:  []ctrl.HealthCheck{t.CheckPolling(s.Health.MaxPollAge), t.CheckTelegram(), storeCheck(st.groups)},
+			CheckTimeout: s.Health.CheckTimeout,
+		}
+		if boltDB != nil {
+			admin.Backup = boltDB.Backup
+		}
+		go func() {
+			if err := admin.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("[WARN] admin server stopped, %v", err)
+			}
+		}()
+	}
+
+	err = t.Run(ctx)
+	if errors.Is(err, context.Canceled) {
+		return nil
 	}
-	err = t.Run(context.TODO())
 	if err != nil {
 		log.Fatalf("telegrambotctrl execution stopped, trace: %+v", err)
 	}
 	return nil
 }
+
+// stores of the bot, that share the same database
+type stores struct {
+	groups   groups.Store
+	schedule schedule.Store // queue of deferred messages
+	settings settings.Store // settings of chats
+}
+
+// makeStores creates all stores over the same database
+func (s TelegramCmd) makeStores(cfg config.Store) (res stores, err error) {
+	switch cfg.Type {
+	case "postgres":
+		svc, err := groups.NewPostgres(cfg.Location, groups.PostgresOptions{
+			MaxOpenConns:    cfg.MaxOpenConns,
+			MaxIdleConns:    cfg.MaxIdleConns,
+			ConnMaxLifetime: cfg.ConnMaxLifetime,
+		})
+		if err != nil {
+			return stores{}, err
+		}
+		res.groups = svc
+		if res.schedule, err = schedule.NewPostgres(svc.DB()); err != nil {
+			return stores{}, err
+		}
+		res.settings, err = settings.NewPostgres(svc.DB())
+		return res, err
+	case "sqlite":
+		svc, err := groups.NewSQLite(cfg.Location)
+		if err != nil {
+			return stores{}, err
+		}
+		res.groups = svc
+		if res.schedule, err = schedule.NewSQLite(svc.DB()); err != nil {
+			return stores{}, err
+		}
+		res.settings, err = settings.NewSQLite(svc.DB())
+		return res, err
+	default:
+		svc, err := groups.NewBoltDB(cfg.Location, bolt.Options{})
+		if err != nil {
+			return stores{}, err
+		}
+		res.groups = svc
+		if res.schedule, err = schedule.NewBoltDB(svc.DB()); err != nil {
+			return stores{}, err
+		}
+		res.settings, err = settings.NewBoltDB(svc.DB())
+		return res, err
+	}
+}
+
+// loadConfig returns the configuration from flags, overridden by the configuration file, if it is set
+func (s TelegramCmd) loadConfig() (config.Config, error) {
+	defaults := config.Config{
+		Telegram: config.Telegram{
+			Token:         s.Telegram.Token,
+			UserName:      s.Telegram.UserName,
+			UpdateTimeout: s.Telegram.UpdateTimeout,
+		},
+		Store: config.Store{
+			Type:            s.Db.Type,
+			Location:        s.Db.Location,
+			MaxOpenConns:    s.Db.MaxOpenConns,
+			MaxIdleConns:    s.Db.MaxIdleConns,
+			ConnMaxLifetime: s.Db.ConnMaxLifetime,
+		},
+		Bots: config.Bots{Groups: config.GroupBot{
+			Enabled:            true,
+			RespondAllCommands: true,
+			GroupCooldown:      s.GroupBot.GroupCooldown,
+			UserCooldown:       s.GroupBot.UserCooldown,
+			MaxTriggerSize:     s.GroupBot.MaxTriggerSize,
+			AuditRetention:     s.GroupBot.AuditRetention,
+			UndoWindow:         s.GroupBot.UndoWindow,
+			TombstoneRetention: s.GroupBot.TombstoneRetention,
+		}},
+	}
+	if s.Config == "" {
+		return defaults, defaults.Validate()
+	}
+	return config.Load(s.Config, defaults)
+}
+
+// reloadOnSignal rebuilds bots from the configuration file on SIGHUP, until the context is done,
+// the invalid configuration is reported and the bots keep working with the previous one,
+// the username of the bot is the one reported by telegram at start
+func (s TelegramCmd) reloadOnSignal(ctx context.Context, cfg config.Config, bots *bot.Reloadable, st stores, userName string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			reloaded, err := s.loadConfig()
+			if err != nil {
+				log.Printf("[WARN] configuration is not reloaded, %v", err)
+				continue
+			}
+			if reloaded.Telegram != cfg.Telegram || reloaded.Store != cfg.Store {
+				log.Printf("[WARN] changes of telegram and store settings are applied after restart only")
+			}
+			bots.Set(makeBots(reloaded, st, userName))
+			log.Printf("[INFO] configuration reloaded from %s", s.Config)
+		}
+	}
+}
+
+// makeBots creates all bots, enabled in the configuration, and the bot
+// to change settings of chats, which is always enabled, bots answer only
+// commands addressed to the given username
+func makeBots(cfg config.Config, st stores, userName string) bot.Bot {
+	var bots []bot.Bot
+	if grp := cfg.Bots.Groups; grp.Enabled {
+		overrides := map[string]bot.GroupBotOverrides{}
+		for chatID, chat := range cfg.Chats {
+			if o := chat.Bots.Groups; o != nil {
+				overrides[chatID] = bot.GroupBotOverrides{
+					Enabled:            o.Enabled,
+					RespondAllCommands: o.RespondAllCommands,
+					GroupCooldown:      o.GroupCooldown,
+					UserCooldown:       o.UserCooldown,
+					MaxTriggerSize:     o.MaxTriggerSize,
+				}
+			}
+		}
+		bots = append(bots, bot.NewGroupBot(bot.GroupBotParams{
+			Store:              st.groups,
+			RespondAllCommands: grp.RespondAllCommands,
+			GroupCooldown:      grp.GroupCooldown,
+			UserCooldown:       grp.UserCooldown,
+			MaxTriggerSize:     grp.MaxTriggerSize,
+			AuditRetention:     grp.AuditRetention,
+			UndoWindow:         grp.UndoWindow,
+			TombstoneRetention: grp.TombstoneRetention,
+			Schedule:           st.schedule,
+			ChatOverrides:      overrides,
+			Settings:           st.settings,
+			UserName:           userName,
+		}))
+	}
+
+	// the settings bot itself can't be disabled, otherwise it couldn't enable bots back
+	names := make([]string, 0, len(bots))
+	for _, b := range bots {
+		names = append(names, b.Name())
+	}
+	bots = append(bots, bot.NewSettingsBot(st.settings, names, userName))
+	return &bot.MultiBot{Bots: bots, Settings: st.settings, UserName: userName}
+}
+
+// botUserName returns the username of the bot, reported by telegram, the configured
+// username is optional and must match it, otherwise commands addressed to the bot
+// would be ignored
+func botUserName(configured, actual string) (string, error) {
+	if configured != "" && !strings.EqualFold(strings.TrimPrefix(configured, "@"), actual) {
+		return "", fmt.Errorf("configured username %s differs from the username of the bot %s", configured, actual)
+	}
+	return actual, nil
+}
+
+// storeCheck reports reachability of the groups store with a read transaction or a ping
+func storeCheck(svc groups.Store) ctrl.HealthCheck {
+	return ctrl.HealthCheck{Name: "store", Check: func(ctx context.Context) (string, error) {
+		start := time.Now()
+		if err := svc.Ping(ctx); err != nil {
+			return "", err
+		}
+		return "reachable in " + time.Since(start).Truncate(time.Microsecond).String(), nil
+	}}
+}
+
+// runBackups saves backups of the database into the backup directory by schedule,
+// until the context is done
+func (s TelegramCmd) runBackups(ctx context.Context, db *groups.BoltDB) {
+	ticker := time.NewTicker(s.Backup.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fileName, err := db.BackupToDir(ctx, s.Backup.Dir, s.Backup.Keep)
+			if err != nil {
+				log.Printf("[WARN] scheduled backup failed, %v", err)
+				continue
+			}
+			log.Printf("[INFO] database backed up to %s", fileName)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBotUserName(t *testing.T) {
+	tbl := []struct {
+		configured, actual string
+		res                string
+		err                bool
+	}{
+		{configured: "", actual: "realbot", res: "realbot"},
+		{configured: "realbot", actual: "realbot", res: "realbot"},
+		{configured: "@RealBot", actual: "realbot", res: "realbot"},
+		{configured: "test", actual: "realbot", err: true},
+	}
+	for i, tt := range tbl {
+		res, err := botUserName(tt.configured, tt.actual)
+		if tt.err {
+			assert.Error(t, err, "case #%d", i)
+			continue
+		}
+		assert.NoError(t, err, "case #%d", i)
+		assert.Equal(t, tt.res, res, "case #%d", i)
+	}
+}
@@ -0,0 +1,168 @@
+// Package config describes the configuration file of the telegram bot,
+// that declares enabled bots, their parameters and overrides of particular chats
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// supported types of the store
+var storeTypes = []string{"bolt", "sqlite", "postgres"}
+
+// Config is the configuration of the telegram bot, durations are set like 10m or 1h30m
+type Config struct {
+	Telegram Telegram        `yaml:"telegram"`
+	Store    Store           `yaml:"store"`
+	Bots     Bots            `yaml:"bots"`
+	Chats    map[string]Chat `yaml:"chats"` // overrides by chat id
+}
+
+// Telegram describes the connection to telegram, changes require restart
+type Telegram struct {
+	Token         string        `yaml:"token"`
+	UserName      string        `yaml:"username"` // optional, must match the username reported by telegram
+	UpdateTimeout time.Duration `yaml:"update_timeout"`
+}
+
+// Store describes the database, changes require restart
+type Store struct {
+	Type            string        `yaml:"type"` // bolt, sqlite or postgres
+	Location        string        `yaml:"location"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+// Bots lists all bots with their parameters
+type Bots struct {
+	Groups GroupBot `yaml:"groups"`
+}
+
+// GroupBot describes parameters of the bot, that gathers usernames into one mention
+type GroupBot struct {
+	Enabled            bool          `yaml:"enabled"`
+	RespondAllCommands bool          `yaml:"respond_all_commands"`
+	GroupCooldown      time.Duration `yaml:"group_cooldown"`
+	UserCooldown       time.Duration `yaml:"user_cooldown"`
+	MaxTriggerSize     int           `yaml:"max_trigger_size"`
+	AuditRetention     time.Duration `yaml:"audit_retention"`
+	UndoWindow         time.Duration `yaml:"undo_window"`
+	TombstoneRetention time.Duration `yaml:"tombstone_retention"`
+}
+
+// Chat describes overrides of the particular chat
+type Chat struct {
+	Bots ChatBots `yaml:"bots"`
+}
+
+// ChatBots lists overrides of bots in the chat, nil means no overrides
+type ChatBots struct {
+	Groups *GroupBotOverrides `yaml:"groups"`
+}
+
+// GroupBotOverrides describes parameters of GroupBot, that differ in the chat, nil fields are inherited
+type GroupBotOverrides struct {
+	Enabled            *bool          `yaml:"enabled"`
+	RespondAllCommands *bool          `yaml:"respond_all_commands"`
+	GroupCooldown      *time.Duration `yaml:"group_cooldown"`
+	UserCooldown       *time.Duration `yaml:"user_cooldown"`
+	MaxTriggerSize     *int           `yaml:"max_trigger_size"`
+}
+
+// Load reads the configuration file over the given defaults and validates the result,
+// unknown fields are reported as errors to catch typos
+func Load(fileName string, defaults Config) (Config, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return Config{}, errors.Wrapf(err, "failed to read config %s", fileName)
+	}
+	cfg := defaults
+	if err = yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return Config{}, errors.Wrapf(err, "failed to parse config %s", fileName)
+	}
+	if err = cfg.Validate(); err != nil {
+		return Config{}, errors.Wrapf(err, "config %s is invalid", fileName)
+	}
+	return cfg, nil
+}
+
+// Validate checks all parameters and reports all problems at once, each
+// problem is prefixed with the path of the parameter, e.g. store.location
+func (c Config) Validate() error {
+	var problems []string
+	check := func(ok bool, path, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, path+": "+fmt.Sprintf(format, args...))
+		}
+	}
+	nonNegative := func(d time.Duration, path string) {
+		check(d >= 0, path, "must not be negative, got %s", d)
+	}
+
+	check(c.Telegram.Token != "", "telegram.token", "must be set")
+	nonNegative(c.Telegram.UpdateTimeout, "telegram.update_timeout")
+
+	check(contains(storeTypes, c.Store.Type), "store.type", "must be one of %s, got %q",
+		strings.Join(storeTypes, ", "), c.Store.Type)
+	check(c.Store.Location != "", "store.location", "must be set")
+	check(c.Store.MaxOpenConns >= 0, "store.max_open_conns", "must not be negative, got %d", c.Store.MaxOpenConns)
+	check(c.Store.MaxIdleConns >= 0, "store.max_idle_conns", "must not be negative, got %d", c.Store.MaxIdleConns)
+	nonNegative(c.Store.ConnMaxLifetime, "store.conn_max_lifetime")
+
+	grp := c.Bots.Groups
+	check(grp.Enabled, "bots", "at least one bot must be enabled")
+	nonNegative(grp.GroupCooldown, "bots.groups.group_cooldown")
+	nonNegative(grp.UserCooldown, "bots.groups.user_cooldown")
+	check(grp.MaxTriggerSize >= 0, "bots.groups.max_trigger_size", "must not be negative, got %d", grp.MaxTriggerSize)
+	nonNegative(grp.AuditRetention, "bots.groups.audit_retention")
+	nonNegative(grp.UndoWindow, "bots.groups.undo_window")
+	nonNegative(grp.TombstoneRetention, "bots.groups.tombstone_retention")
+
+	chatIDs := make([]string, 0, len(c.Chats))
+	for id := range c.Chats {
+		chatIDs = append(chatIDs, id)
+	}
+	sort.Strings(chatIDs)
+	for _, id := range chatIDs {
+		path := "chats." + id
+		_, err := strconv.ParseInt(id, 10, 64)
+		check(err == nil, path, "chat id must be a number")
+		o := c.Chats[id].Bots.Groups
+		if o == nil {
+			continue
+		}
+		if o.GroupCooldown != nil {
+			nonNegative(*o.GroupCooldown, path+".bots.groups.group_cooldown")
+		}
+		if o.UserCooldown != nil {
+			nonNegative(*o.UserCooldown, path+".bots.groups.user_cooldown")
+		}
+		if o.MaxTriggerSize != nil {
+			check(*o.MaxTriggerSize >= 0, path+".bots.groups.max_trigger_size",
+				"must not be negative, got %d", *o.MaxTriggerSize)
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// contains returns true if the slice contains the given string
+func contains(s []string, e string) bool {
+	for _, a := range s {
+		if a == e {
+			return true
+		}
+	}
+	return false
+}
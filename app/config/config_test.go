@@ -0,0 +1,106 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	fileName := writeConfig(t, `
+telegram:
+  token: secret
+store:
+  location: /srv/var/multibot.db
+bots:
+  groups:
+    group_cooldown: 10m
+    max_trigger_size: 20
+chats:
+  "-1001":
+    bots:
+      groups:
+        max_trigger_size: 0
+        user_cooldown: 1m30s
+  "-1002":
+    bots:
+      groups:
+        enabled: false
+`)
+	cfg, err := Load(fileName, defaults())
+	require.NoError(t, err)
+
+	expected := defaults()
+	expected.Telegram.Token = "secret"
+	expected.Store.Location = "/srv/var/multibot.db"
+	expected.Bots.Groups.GroupCooldown = 10 * time.Minute
+	expected.Bots.Groups.MaxTriggerSize = 20
+	unlimited, cooldown, disabled := 0, 90*time.Second, false
+	expected.Chats = map[string]Chat{
+		"-1001": {Bots: ChatBots{Groups: &GroupBotOverrides{MaxTriggerSize: &unlimited, UserCooldown: &cooldown}}},
+		"-1002": {Bots: ChatBots{Groups: &GroupBotOverrides{Enabled: &disabled}}},
+	}
+	assert.Equal(t, expected, cfg)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	_, err := Load(filepath.Join(os.TempDir(), "unknown-multibot-config.yml"), defaults())
+	assert.Error(t, err)
+
+	_, err = Load(writeConfig(t, "bots:\n  groups:\n    group_cooldwn: 10m\n"), defaults())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field group_cooldwn not found")
+
+	_, err = Load(writeConfig(t, "bots:\n  groups:\n    group_cooldown: ten minutes\n"), defaults())
+	assert.Error(t, err)
+
+	_, err = Load(writeConfig(t, "store:\n  type: mysql\n"), defaults())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `store.type: must be one of bolt, sqlite, postgres, got "mysql"`)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, defaults().Validate())
+
+	negative, size := -time.Minute, -1
+	cfg := defaults()
+	cfg.Telegram.Token = ""
+	cfg.Store.Location = ""
+	cfg.Bots.Groups.Enabled = false
+	cfg.Bots.Groups.UndoWindow = negative
+	cfg.Chats = map[string]Chat{
+		"chat":  {},
+		"-1001": {Bots: ChatBots{Groups: &GroupBotOverrides{GroupCooldown: &negative, MaxTriggerSize: &size}}},
+	}
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Equal(t, "telegram.token: must be set; "+
+		"store.location: must be set; "+
+		"bots: at least one bot must be enabled; "+
+		"bots.groups.undo_window: must not be negative, got -1m0s; "+
+		"chats.-1001.bots.groups.group_cooldown: must not be negative, got -1m0s; "+
+		"chats.-1001.bots.groups.max_trigger_size: must not be negative, got -1; "+
+		"chats.chat: chat id must be a number", err.Error())
+}
+
+func defaults() Config {
+	return Config{
+		Telegram: Telegram{Token: "token", UserName: "multibot", UpdateTimeout: 30 * time.Second},
+		Store:    Store{Type: "bolt", Location: "multibot.db", MaxOpenConns: 10, MaxIdleConns: 2},
+		Bots:     Bots{Groups: GroupBot{Enabled: true, RespondAllCommands: true, UndoWindow: 15 * time.Minute}},
+	}
+}
+
+func writeConfig(t *testing.T, data string) string {
+	dir, err := ioutil.TempDir("", "multibot-config")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	fileName := filepath.Join(dir, "config.yml")
+	require.NoError(t, ioutil.WriteFile(fileName, []byte(data), 0600))
+	return fileName
+}
@@ -0,0 +1,109 @@
+package ctrl
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Semior001/multibot-utility/app/logging"
+	"github.com/Semior001/multibot-utility/app/metrics"
+)
+
+// AdminServer serves the HTTP API to operate the running bot
+type AdminServer struct {
+	Address string // address to listen, e.g. :8080
+	Token   string // bearer token to access protected endpoints, if empty - they are disabled
+
+	// Backup writes the consistent copy of the database, if nil - backups are disabled
+	Backup func(ctx context.Context, w io.Writer) (int64, error)
+
+	LiveChecks   []HealthCheck // checks of /healthz, that the bot is not stuck
+	ReadyChecks  []HealthCheck // checks of /readyz, that the bot and its dependencies are able to serve
+	CheckTimeout time.Duration // time for all checks of the endpoint to finish, 0 means unlimited
+}
+
+// Run starts the server and shuts it down, when the context is done
+func (a *AdminServer) Run(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              a.Address,
+		Handler:           a.routes(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logging.Printf(ctx, "[WARN] failed to shutdown admin server, %v", err)
+		}
+	}()
+
+	logging.Printf(ctx, "[INFO] admin server listens on %s", a.Address)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return errors.Wrapf(err, "admin server at %s failed", a.Address)
+	}
+	return ctx.Err()
+}
+
+// routes returns the handler of all endpoints
+func (a *AdminServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", a.healthHandler(a.LiveChecks))
+	mux.Handle("/readyz", a.healthHandler(a.ReadyChecks))
+	if a.Backup != nil && a.Token != "" {
+		mux.Handle("/backup", a.authorized(http.HandlerFunc(a.backupHandler)))
+	}
+	return withCorrelationID(mux)
+}
+
+// withCorrelationID correlates all logs of the request by its id
+func withCorrelationID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := logging.WithAttrs(r.Context(), logging.KeyCorrelationID, logging.NewCorrelationID())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authorized passes only requests with the valid bearer token
+func (a *AdminServer) authorized(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := []byte("Bearer " + a.Token)
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// backupHandler streams the backup of the database as the attachment
+func (a *AdminServer) backupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="multibot.%s.backup"`, time.Now().Format("20060102T150405")))
+	n, err := a.Backup(r.Context(), w)
+	if err != nil && n == 0 {
+		logging.Printf(r.Context(), "[WARN] failed to make backup, %v", err)
+		w.Header().Del("Content-Disposition")
+		http.Error(w, "failed to make backup", http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		// headers are already sent, so the client sees the truncated body only
+		logging.Printf(r.Context(), "[WARN] failed to send backup after %d bytes, %v", n, err)
+		return
+	}
+	logging.Printf(r.Context(), "[INFO] backup of %d bytes sent to %s", n, r.RemoteAddr)
+}
@@ -0,0 +1,86 @@
+package ctrl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Semior001/multibot-utility/app/metrics"
+)
+
+func TestAdminServer_Backup(t *testing.T) {
+	srv := AdminServer{
+		Token: "secret",
+		Backup: func(_ context.Context, w io.Writer) (int64, error) {
+			n, err := w.Write([]byte("database"))
+			return int64(n), err
+		},
+	}
+	ts := httptest.NewServer(srv.routes())
+	defer ts.Close()
+
+	get := func(token string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/backup", nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := get("")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+
+	resp = get("wrong")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+
+	resp = get("secret")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), "attachment")
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "database", string(body))
+
+	srv.Backup = func(context.Context, io.Writer) (int64, error) { return 0, errors.New("failed") }
+	resp = get("secret")
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+}
+
+func TestAdminServer_BackupDisabled(t *testing.T) {
+	srv := AdminServer{Backup: func(context.Context, io.Writer) (int64, error) { return 0, nil }}
+	ts := httptest.NewServer(srv.routes())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/backup")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "backups are not served without the token")
+	require.NoError(t, resp.Body.Close())
+}
+
+func TestAdminServer_Metrics(t *testing.T) {
+	srv := AdminServer{}
+	ts := httptest.NewServer(srv.routes())
+	defer ts.Close()
+
+	metrics.Updates.WithLabelValues("message", "group").Inc()
+	resp, err := http.Get(ts.URL + "/metrics")
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `multibot_updates_total{chat_type="group",type="message"}`)
+}
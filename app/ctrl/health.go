@@ -0,0 +1,157 @@
+package ctrl
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Semior001/multibot-utility/app/logging"
+)
+
+// HealthCheck reports the state of a single part of the bot, details
+// describe the state for humans, e.g. the time since the last poll
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) (details string, err error)
+}
+
+// checkResult is the reported state of the single check
+type checkResult struct {
+	Status  string `json:"status"`
+	Details string `json:"details,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// healthReport is the response of health endpoints
+type healthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// TrackPolls wraps the transport of the telegram client to mark successful polls of updates
+// and measure their latency, polls are made by the client in background, so they are not
+// visible to the listener otherwise
+func (t *TelegramBotCtrl) TrackPolls(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if !strings.HasSuffix(req.URL.Path, "/getUpdates") {
+			return base.RoundTrip(req)
+		}
+		start := time.Now()
+		resp, err := base.RoundTrip(req)
+		observe("getUpdates", start)
+		if err == nil && resp.StatusCode == http.StatusOK {
+			t.markPolled(time.Now())
+		}
+		return resp, err
+	})
+}
+
+// CheckPolling fails, if updates were not polled successfully for longer than maxAge
+func (t *TelegramBotCtrl) CheckPolling(maxAge time.Duration) HealthCheck {
+	return HealthCheck{Name: "poll", Check: func(context.Context) (string, error) {
+		last := atomic.LoadInt64(&t.lastPoll)
+		if last == 0 {
+			return "", errors.New("listener is not started")
+		}
+		age := time.Since(time.Unix(0, last)).Truncate(time.Millisecond)
+		details := "last successful poll " + age.String() + " ago"
+		if maxAge > 0 && age > maxAge {
+			return details, errors.Errorf("no successful polls for longer than %s", maxAge)
+		}
+		return details, nil
+	}}
+}
+
+// CheckTelegram fails, if telegram doesn't answer getMe
+func (t *TelegramBotCtrl) CheckTelegram() HealthCheck {
+	return HealthCheck{Name: "telegram", Check: func(ctx context.Context) (string, error) {
+		type result struct {
+			name string
+			err  error
+		}
+		// getMe doesn't accept the context, so the check doesn't wait for it longer than the context allows
+		resCh := make(chan result, 1)
+		go func() {
+			me, err := t.API.GetMe()
+			resCh <- result{name: me.UserName, err: err}
+		}()
+		select {
+		case res := <-resCh:
+			if res.err != nil {
+				return "", errors.Wrap(res.err, "getMe failed")
+			}
+			return "authorized as @" + res.name, nil
+		case <-ctx.Done():
+			return "", errors.Wrap(ctx.Err(), "getMe failed")
+		}
+	}}
+}
+
+// markPolled saves the time of the successful poll
+func (t *TelegramBotCtrl) markPolled(at time.Time) {
+	atomic.StoreInt64(&t.lastPoll, at.UnixNano())
+}
+
+// healthHandler runs checks concurrently and responds with their report,
+// the status is 503, if any of checks failed or didn't finish in time
+func (a *AdminServer) healthHandler(checks []HealthCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if a.CheckTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, a.CheckTimeout)
+			defer cancel()
+		}
+
+		report := healthReport{Status: "ok", Checks: make(map[string]checkResult, len(checks))}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, check := range checks {
+			check := check
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				details, err := check.Check(ctx)
+				res := checkResult{Status: "ok", Details: details}
+				if err != nil {
+					res.Status, res.Error = "fail", err.Error()
+				}
+				mu.Lock()
+				report.Checks[check.Name] = res
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		status := http.StatusOK
+		for name, res := range report.Checks {
+			if res.Status != "ok" {
+				report.Status, status = "fail", http.StatusServiceUnavailable
+				logging.Printf(ctx, "[WARN] health check %s failed at %s, %s", name, r.URL.Path, res.Error)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			logging.Printf(ctx, "[WARN] failed to write health report, %v", err)
+		}
+	}
+}
+
+// roundTripperFunc adapts the function to http.RoundTripper
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip calls the function
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
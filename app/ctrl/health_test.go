@@ -0,0 +1,113 @@
+package ctrl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Semior001/multibot-utility/app/metrics"
+)
+
+func TestAdminServer_Health(t *testing.T) {
+	api := mockTbAPI{}
+	api.On("GetMe").Return(tgbotapi.User{UserName: "testbot"}, nil).Once()
+	api.On("GetMe").Return(tgbotapi.User{}, errors.New("unauthorized"))
+	ctrl := TelegramBotCtrl{API: &api}
+
+	srv := AdminServer{
+		LiveChecks:  []HealthCheck{ctrl.CheckPolling(time.Minute)},
+		ReadyChecks: []HealthCheck{ctrl.CheckPolling(time.Minute), ctrl.CheckTelegram()},
+	}
+	ts := httptest.NewServer(srv.routes())
+	defer ts.Close()
+
+	get := func(path string) (int, healthReport) {
+		resp, err := http.Get(ts.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var report healthReport
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+		return resp.StatusCode, report
+	}
+
+	status, report := get("/healthz")
+	assert.Equal(t, http.StatusServiceUnavailable, status, "listener is not started yet")
+	assert.Equal(t, "listener is not started", report.Checks["poll"].Error)
+
+	ctrl.markPolled(time.Now().Add(-time.Second))
+	status, report = get("/readyz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok", report.Status)
+	assert.Contains(t, report.Checks["poll"].Details, "last successful poll 1s")
+	assert.Equal(t, checkResult{Status: "ok", Details: "authorized as @testbot"}, report.Checks["telegram"])
+
+	status, report = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "fail", report.Status)
+	assert.Equal(t, "getMe failed: unauthorized", report.Checks["telegram"].Error)
+
+	status, _ = get("/healthz")
+	assert.Equal(t, http.StatusOK, status, "telegram failures don't affect liveness")
+
+	ctrl.markPolled(time.Now().Add(-2 * time.Minute))
+	status, report = get("/healthz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "no successful polls for longer than 1m0s", report.Checks["poll"].Error)
+}
+
+func TestAdminServer_HealthTimeout(t *testing.T) {
+	srv := AdminServer{
+		CheckTimeout: 10 * time.Millisecond,
+		ReadyChecks: []HealthCheck{{Name: "slow", Check: func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}}},
+	}
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "context deadline exceeded")
+}
+
+func TestTelegramBotCtrl_TrackPolls(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bottoken/failed/getUpdates" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+
+	ctrl := TelegramBotCtrl{}
+	client := &http.Client{Transport: ctrl.TrackPolls(nil)}
+	call := func(path string) {
+		resp, err := client.Get(ts.URL + path)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+
+	polls := func() uint64 {
+		var m dto.Metric
+		require.NoError(t, metrics.TelegramAPIDuration.WithLabelValues("getUpdates").(prometheus.Histogram).Write(&m))
+		return m.GetHistogram().GetSampleCount()
+	}
+	before := polls()
+
+	call("/bottoken/getMe")
+	assert.Zero(t, ctrl.lastPoll, "only polls of updates are tracked")
+	assert.Equal(t, before, polls(), "only polls of updates are measured")
+	call("/bottoken/failed/getUpdates")
+	assert.Zero(t, ctrl.lastPoll, "failed polls are not tracked")
+	call("/bottoken/getUpdates")
+	assert.NotZero(t, ctrl.lastPoll)
+	assert.Equal(t, before+2, polls(), "each poll is measured")
+}
@@ -0,0 +1,62 @@
+package ctrl
+
+import (
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	"github.com/Semior001/multibot-utility/app/metrics"
+)
+
+// instrumentedAPI measures latency of calls to the telegram api, polls of updates
+// are made by the client in background and are measured by TrackPolls
+type instrumentedAPI struct {
+	tbAPI
+}
+
+// Send measures sending of the message
+func (a *instrumentedAPI) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	defer observe("send", time.Now())
+	return a.tbAPI.Send(c)
+}
+
+// PinChatMessage measures pinning of the message
+func (a *instrumentedAPI) PinChatMessage(config tgbotapi.PinChatMessageConfig) (tgbotapi.APIResponse, error) {
+	defer observe("pinChatMessage", time.Now())
+	return a.tbAPI.PinChatMessage(config)
+}
+
+// UnpinChatMessage measures unpinning of the message
+func (a *instrumentedAPI) UnpinChatMessage(config tgbotapi.UnpinChatMessageConfig) (tgbotapi.APIResponse, error) {
+	defer observe("unpinChatMessage", time.Now())
+	return a.tbAPI.UnpinChatMessage(config)
+}
+
+// GetChatAdministrators measures fetching of chat admins
+func (a *instrumentedAPI) GetChatAdministrators(config tgbotapi.ChatConfig) ([]tgbotapi.ChatMember, error) {
+	defer observe("getChatAdministrators", time.Now())
+	return a.tbAPI.GetChatAdministrators(config)
+}
+
+// GetFileDirectURL measures fetching of the file link
+func (a *instrumentedAPI) GetFileDirectURL(fileID string) (string, error) {
+	defer observe("getFile", time.Now())
+	return a.tbAPI.GetFileDirectURL(fileID)
+}
+
+// GetMe measures fetching of the bot info
+func (a *instrumentedAPI) GetMe() (tgbotapi.User, error) {
+	defer observe("getMe", time.Now())
+	return a.tbAPI.GetMe()
+}
+
+// AnswerCallbackQuery measures answering the press of the button
+func (a *instrumentedAPI) AnswerCallbackQuery(config tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error) {
+	defer observe("answerCallbackQuery", time.Now())
+	return a.tbAPI.AnswerCallbackQuery(config)
+}
+
+// observe records the latency of the api method
+func observe(method string, start time.Time) {
+	metrics.Since(metrics.TelegramAPIDuration.WithLabelValues(method), start)
+}
@@ -10,6 +10,27 @@ type mockTbAPI struct {
 	mock.Mock
 }
 
+// AnswerCallbackQuery provides a mock function with given fields: config
+func (_m *mockTbAPI) AnswerCallbackQuery(config tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error) {
+	ret := _m.Called(config)
+
+	var r0 tgbotapi.APIResponse
+	if rf, ok := ret.Get(0).(func(tgbotapi.CallbackConfig) tgbotapi.APIResponse); ok {
+		r0 = rf(config)
+	} else {
+		r0 = ret.Get(0).(tgbotapi.APIResponse)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(tgbotapi.CallbackConfig) error); ok {
+		r1 = rf(config)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetChatAdministrators provides a mock function with given fields: config
 func (_m *mockTbAPI) GetChatAdministrators(config tgbotapi.ChatConfig) ([]tgbotapi.ChatMember, error) {
 	ret := _m.Called(config)
@@ -33,6 +54,48 @@ func (_m *mockTbAPI) GetChatAdministrators(config tgbotapi.ChatConfig) ([]tgbota
 	return r0, r1
 }
 
+// GetFileDirectURL provides a mock function with given fields: fileID
+func (_m *mockTbAPI) GetFileDirectURL(fileID string) (string, error) {
+	ret := _m.Called(fileID)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(fileID)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(fileID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetMe provides a mock function with given fields:
+func (_m *mockTbAPI) GetMe() (tgbotapi.User, error) {
+	ret := _m.Called()
+
+	var r0 tgbotapi.User
+	if rf, ok := ret.Get(0).(func() tgbotapi.User); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(tgbotapi.User)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetUpdatesChan provides a mock function with given fields: config
 func (_m *mockTbAPI) GetUpdatesChan(config tgbotapi.UpdateConfig) (tgbotapi.UpdatesChannel, error) {
 	ret := _m.Called(config)
@@ -2,15 +2,23 @@ package ctrl
 
 import (
 	"context"
-	"log"
+	"io"
+	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Semior001/multibot-utility/app/bot"
+	"github.com/Semior001/multibot-utility/app/logging"
+	"github.com/Semior001/multibot-utility/app/metrics"
+	"github.com/Semior001/multibot-utility/app/store/schedule"
 	"github.com/go-telegram-bot-api/telegram-bot-api"
 	"github.com/pkg/errors"
 )
 
+// maxFileSize limits the size of documents, attached to commands, that are downloaded
+const maxFileSize = 1 << 20
+
 //go:generate mockery -inpkg -name tbAPI -case snake
 
 // TelegramBotCtrl is an implementation of bot ctrl
@@ -20,6 +28,16 @@ type TelegramBotCtrl struct {
 	Bots     bot.Bot
 	API      tbAPI
 	UserName string
+
+	UpdateTimeout time.Duration // maximal time to process a single update, 0 means unlimited
+
+	Schedule         schedule.Store // queue of deferred messages, might be nil
+	ScheduleInterval time.Duration  // interval to check the queue for due messages
+	ScheduleExpiry   time.Duration  // period to retry failed deliveries before dropping them, 0 means an hour
+
+	HTTPClient *http.Client // client to download attached documents, if nil - the one with 30s timeout is used
+
+	lastPoll int64 // unix nanoseconds of the last successful poll of updates, accessed atomically
 }
 
 // tbAPI wraps tgbotapi.BotAPI to allow mocking
@@ -29,10 +47,20 @@ type tbAPI interface {
 	PinChatMessage(config tgbotapi.PinChatMessageConfig) (tgbotapi.APIResponse, error)
 	UnpinChatMessage(config tgbotapi.UnpinChatMessageConfig) (tgbotapi.APIResponse, error)
 	GetChatAdministrators(config tgbotapi.ChatConfig) ([]tgbotapi.ChatMember, error)
+	GetFileDirectURL(fileID string) (string, error)
+	GetMe() (tgbotapi.User, error)
+	AnswerCallbackQuery(config tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error)
 }
 
 // Run starts bots to listen for messages
 func (t *TelegramBotCtrl) Run(ctx context.Context) error {
+	if _, ok := t.API.(*instrumentedAPI); !ok {
+		t.API = &instrumentedAPI{tbAPI: t.API}
+	}
+
+	// the listener is considered fresh at start, so the bot is not reported stuck before the first poll
+	t.markPolled(time.Now())
+
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 	updates, err := t.API.GetUpdatesChan(u)
@@ -40,57 +68,198 @@ func (t *TelegramBotCtrl) Run(ctx context.Context) error {
 		return errors.Wrap(err, "failed to start telegram bot listener")
 	}
 
+	// ticks stay nil and never fire, if there is no queue to drain
+	var ticks <-chan time.Time
+	if t.Schedule != nil {
+		interval := t.ScheduleInterval
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 
+		case now := <-ticks:
+			t.deliverScheduled(ctx, now)
+
 		case update, ok := <-updates:
 			if !ok {
 				return errors.New("telegram updates chan closed")
 			}
-			if update.Message == nil { // ignore any non-message updates
-				continue
-			}
-			if update.Message.Chat == nil { // ignore messages not from chat
-				continue
-			}
-			if update.Message.Text == "" { // ignore messages without text
-				continue
-			}
+			metrics.Updates.WithLabelValues(updateLabels(update)).Inc()
+			t.handleUpdate(ctx, update)
+		}
+	}
+}
 
-			msg := t.convertMessage(update.Message)
+// handleUpdate converts the update into the message and passes it to bots, the whole
+// processing, including downloads of attached documents, is limited by UpdateTimeout
+func (t *TelegramBotCtrl) handleUpdate(ctx context.Context, update tgbotapi.Update) {
+	// all logs of the update, made by the controller, bots and stores, are correlated by its id
+	ctx = logging.WithAttrs(ctx, logging.KeyCorrelationID, logging.NewCorrelationID())
+	if t.UpdateTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.UpdateTimeout)
+		defer cancel()
+	}
 
-			log.Printf("[DEBUG] incoming msg: %+v", msg)
+	if update.CallbackQuery != nil {
+		t.handleCallback(ctx, update.CallbackQuery)
+		return
+	}
+	if update.Message == nil { // ignore any non-message updates
+		return
+	}
+	if update.Message.Chat == nil { // ignore messages not from chat
+		return
+	}
+	if update.Message.Text == "" && !isCommandDocument(update.Message) { // ignore messages without text
+		return
+	}
+
+	t.processMessage(ctx, t.convertMessage(ctx, update.Message))
+}
+
+// processMessage passes the message to bots and sends their response
+func (t *TelegramBotCtrl) processMessage(ctx context.Context, msg bot.Message) {
+	ctx = logging.WithAttrs(ctx, logging.KeyChatID, msg.ChatID)
+	if msg.From != nil {
+		ctx = logging.WithAttrs(ctx, logging.KeyUserID, msg.From.ID)
+	}
+	logging.Debug(ctx, "incoming message", "message_id", msg.ID, "chat_type", msg.ChatType,
+		"added_bot_to_chat", msg.AddedBotToChat, "callback", msg.Callback, "has_file", msg.File != nil,
+		logging.Text(msg.Text))
+
+	start := time.Now()
+	resp := t.handleMessage(ctx, msg)
+	logging.Debug(ctx, "update handled", "responded", resp != nil, logging.Since(start))
+	if ctx.Err() != nil {
+		// the response, which came too late, is not sent
+		logging.Printf(ctx, "[WARN] dropped update %s from chat %s, %v", msg.ID, msg.ChatID, ctx.Err())
+		return
+	}
+
+	if err := t.SendBotResponse(ctx, resp, msg.ChatID); err != nil {
+		logging.Printf(ctx, "[WARN] failed to respond on update, %v", err)
+	}
+}
+
+// handleCallback passes the press of the button to bots as the message with the data of the button,
+// the press is answered at once, so the client stops showing the progress
+func (t *TelegramBotCtrl) handleCallback(ctx context.Context, cq *tgbotapi.CallbackQuery) {
+	if _, err := t.API.AnswerCallbackQuery(tgbotapi.NewCallback(cq.ID, "")); err != nil {
+		logging.Printf(ctx, "[WARN] failed to answer callback query %s, %v", cq.ID, err)
+	}
+	// buttons of inline messages and buttons without data are not supported
+	if cq.Message == nil || cq.Message.Chat == nil || cq.From == nil || cq.Data == "" {
+		return
+	}
+	t.processMessage(ctx, t.convertCallback(ctx, cq))
+}
+
+// handleMessage passes the message to bots, until the context is done, if bots didn't answer
+// in time, nil is returned, so one slow chat can't hang the bot, bots get the same context
+// and stop their work, when it is done
+func (t *TelegramBotCtrl) handleMessage(ctx context.Context, msg bot.Message) *bot.Response {
+	if ctx.Err() != nil { // the time of the update is spent already, e.g. on the download of the document
+		return nil
+	}
+
+	// buffered, so the goroutine doesn't leak, if nobody waits for the response
+	respCh := make(chan *bot.Response, 1)
+	go func() {
+		respCh <- t.Bots.OnMessage(ctx, msg)
+	}()
 
-			resp := t.Bots.OnMessage(msg)
+	select {
+	case resp := <-respCh:
+		return resp
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// deliverScheduled sends all messages from the queue, that are due at the given time,
+// messages, that failed to be sent, are kept in the queue and retried on the next check,
+// until they expire, so the outdated message is not sent after a long outage
+func (t *TelegramBotCtrl) deliverScheduled(ctx context.Context, now time.Time) {
+	due, err := t.Schedule.Due(ctx, now)
+	if err != nil {
+		logging.Printf(ctx, "[WARN] failed to get scheduled deliveries: %v", err)
+		return
+	}
 
-			fromChat := strconv.FormatInt(update.Message.Chat.ID, 10)
-			if err := t.SendBotResponse(resp, fromChat); err != nil {
-				log.Printf("[WARN] failed to respond on update, %v", err)
+	expiry := t.ScheduleExpiry
+	if expiry <= 0 {
+		expiry = time.Hour
+	}
+
+	for _, d := range due {
+		ctx := logging.WithAttrs(ctx, logging.KeyCorrelationID, logging.NewCorrelationID(), logging.KeyChatID, d.ChatID)
+		if err := t.SendBotResponse(ctx, &bot.Response{Text: d.Text()}, d.ChatID); err != nil {
+			if now.Sub(d.DeliverAt) < expiry {
+				logging.Printf(ctx, "[WARN] failed to send scheduled delivery %s, will retry, %v", d.ID, err)
+				continue
 			}
+			logging.Printf(ctx, "[WARN] failed to send scheduled delivery %s, dropped as expired, %v", d.ID, err)
+		}
+		if err := t.Schedule.Delete(ctx, d.ID); err != nil {
+			logging.Printf(ctx, "[WARN] failed to delete scheduled delivery %s from the queue, %v", d.ID, err)
 		}
 	}
 }
 
 // SendBotResponse sends bot's answer to tg channel and saves it to log
-func (t *TelegramBotCtrl) SendBotResponse(resp *bot.Response, chatIDStr string) error {
+func (t *TelegramBotCtrl) SendBotResponse(ctx context.Context, resp *bot.Response, chatIDStr string) error {
 	if resp == nil {
 		return nil
 	}
 
 	chatID, err := strconv.ParseInt(chatIDStr, 10, 64)
 	if err != nil {
+		metrics.SendErrors.WithLabelValues("invalid_chat").Inc()
 		return errors.Wrap(err, "failed to send bot response")
 	}
 
-	log.Printf("[DEBUG] bot response - %+v, pin: %t", resp.Text, resp.Pin)
-	tbMsg := tgbotapi.NewMessage(chatID, resp.Text)
-	tbMsg.ParseMode = tgbotapi.ModeMarkdown
-	tbMsg.DisableWebPagePreview = !resp.Preview
+	logging.Debug(ctx, "bot response", logging.Text(resp.Text), "pin", resp.Pin, "unpin", resp.Unpin,
+		"has_file", resp.File != nil)
+	var tbMsg tgbotapi.Chattable
+	switch {
+	case resp.EditMessage != "":
+		msgID, err := strconv.Atoi(resp.EditMessage)
+		if err != nil {
+			metrics.SendErrors.WithLabelValues("invalid_message").Inc()
+			return errors.Wrapf(err, "failed to edit message %q", resp.EditMessage)
+		}
+		edit := tgbotapi.NewEditMessageText(chatID, msgID, resp.Text)
+		edit.ParseMode = tgbotapi.ModeMarkdown
+		edit.DisableWebPagePreview = !resp.Preview
+		edit.ReplyMarkup = inlineKeyboard(resp.Buttons)
+		tbMsg = edit
+	case resp.File != nil:
+		doc := tgbotapi.NewDocumentUpload(chatID, tgbotapi.FileBytes{Name: resp.File.Name, Bytes: resp.File.Data})
+		doc.Caption = resp.Text
+		doc.ParseMode = tgbotapi.ModeMarkdown
+		tbMsg = doc
+	default:
+		msg := tgbotapi.NewMessage(chatID, resp.Text)
+		msg.ParseMode = tgbotapi.ModeMarkdown
+		msg.DisableWebPagePreview = !resp.Preview
+		if markup := inlineKeyboard(resp.Buttons); markup != nil {
+			msg.ReplyMarkup = markup
+		}
+		tbMsg = msg
+	}
 	res, err := t.API.Send(tbMsg)
 	if err != nil {
-		return errors.Wrapf(err, "can't send message to telegram %q", resp.Text)
+		metrics.SendErrors.WithLabelValues("send").Inc()
+		return errors.Wrap(err, "can't send message to telegram")
 	}
 
 	if resp.Pin {
@@ -100,6 +269,7 @@ func (t *TelegramBotCtrl) SendBotResponse(resp *bot.Response, chatIDStr string)
 			DisableNotification: true,
 		})
 		if err != nil || !res.Ok {
+			metrics.SendErrors.WithLabelValues("pin").Inc()
 			return errors.Wrapf(err, "can't pin message to telegram, response: %+v", res)
 		}
 	}
@@ -107,6 +277,7 @@ func (t *TelegramBotCtrl) SendBotResponse(resp *bot.Response, chatIDStr string)
 	if resp.Unpin {
 		_, err = t.API.UnpinChatMessage(tgbotapi.UnpinChatMessageConfig{ChatID: chatID})
 		if err != nil {
+			metrics.SendErrors.WithLabelValues("unpin").Inc()
 			return errors.Wrap(err, "can't unpin message to telegram")
 		}
 	}
@@ -115,7 +286,7 @@ func (t *TelegramBotCtrl) SendBotResponse(resp *bot.Response, chatIDStr string)
 }
 
 // convertMessage transforms a telegram message into internal struct
-func (t *TelegramBotCtrl) convertMessage(msg *tgbotapi.Message) bot.Message {
+func (t *TelegramBotCtrl) convertMessage(ctx context.Context, msg *tgbotapi.Message) bot.Message {
 	res := bot.Message{
 		ID:     strconv.Itoa(msg.MessageID),
 		ChatID: strconv.FormatInt(msg.Chat.ID, 10),
@@ -123,18 +294,17 @@ func (t *TelegramBotCtrl) convertMessage(msg *tgbotapi.Message) bot.Message {
 		Text:   msg.Text,
 	}
 
-	// taking the type of chat, where the message came from
-	if msg.Chat.IsGroup() || msg.Chat.IsSuperGroup() {
-		res.ChatType = bot.ChatTypeGroup
-	}
-
-	if msg.Chat.IsChannel() {
-		res.ChatType = bot.ChatTypeChannel
+	// documents are downloaded only for commands, that are written in their captions
+	if isCommandDocument(msg) {
+		res.Text = msg.Caption
+		file, err := t.downloadFile(ctx, msg.Document)
+		if err != nil {
+			logging.Printf(ctx, "[WARN] failed to download document %s from chat %d: %+v", msg.Document.FileID, msg.Chat.ID, err)
+		}
+		res.File = file
 	}
 
-	if msg.Chat.IsPrivate() {
-		res.ChatType = bot.ChatTypePrivate
-	}
+	res.ChatType = chatType(msg.Chat)
 
 	if msg.From != nil {
 		res.From = &bot.User{
@@ -144,7 +314,7 @@ func (t *TelegramBotCtrl) convertMessage(msg *tgbotapi.Message) bot.Message {
 			IsBot:       msg.From.IsBot,
 		}
 
-		res.From.IsAdmin = t.isUserAdmin(msg)
+		res.From.IsAdmin = t.isUserAdmin(ctx, msg.Chat, msg.From.UserName)
 	}
 
 	// checking that it is a bot addition
@@ -155,25 +325,116 @@ func (t *TelegramBotCtrl) convertMessage(msg *tgbotapi.Message) bot.Message {
 	return res
 }
 
-// isUserAdmin detects on the message data is a sender of message an admin
+// convertCallback transforms the press of the button into the message from the user, who pressed it
+func (t *TelegramBotCtrl) convertCallback(ctx context.Context, cq *tgbotapi.CallbackQuery) bot.Message {
+	return bot.Message{
+		ID:       strconv.Itoa(cq.Message.MessageID),
+		ChatID:   strconv.FormatInt(cq.Message.Chat.ID, 10),
+		ChatType: chatType(cq.Message.Chat),
+		From: &bot.User{
+			ID:          strconv.Itoa(cq.From.ID),
+			Username:    cq.From.UserName,
+			DisplayName: cq.From.FirstName + " " + cq.From.LastName,
+			IsBot:       cq.From.IsBot,
+			IsAdmin:     t.isUserAdmin(ctx, cq.Message.Chat, cq.From.UserName),
+		},
+		Sent:     time.Now(),
+		Text:     cq.Data,
+		Callback: true,
+	}
+}
+
+// inlineKeyboard converts rows of buttons into the keyboard under the message, nil if there are no buttons
+func inlineKeyboard(buttons [][]bot.Button) *tgbotapi.InlineKeyboardMarkup {
+	if len(buttons) == 0 {
+		return nil
+	}
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(buttons))
+	for _, row := range buttons {
+		tbRow := make([]tgbotapi.InlineKeyboardButton, 0, len(row))
+		for _, b := range row {
+			tbRow = append(tbRow, tgbotapi.NewInlineKeyboardButtonData(b.Text, b.Data))
+		}
+		rows = append(rows, tbRow)
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &markup
+}
+
+// isCommandDocument checks that the message is a document with a command in its caption
+func isCommandDocument(msg *tgbotapi.Message) bool {
+	return msg.Document != nil && strings.HasPrefix(msg.Caption, "/")
+}
+
+// downloadFile fetches the attached document, if it is not too large, until the context is done
+func (t *TelegramBotCtrl) downloadFile(ctx context.Context, doc *tgbotapi.Document) (*bot.File, error) {
+	if doc.FileSize > maxFileSize {
+		return nil, errors.Errorf("document is too large, %d bytes", doc.FileSize)
+	}
+
+	link, err := t.API.GetFileDirectURL(doc.FileID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get document link")
+	}
+
+	client := t.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to make document request")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to download document")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to download document, status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFileSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read document")
+	}
+	if len(data) > maxFileSize {
+		return nil, errors.Errorf("document is larger than %d bytes", maxFileSize)
+	}
+	return &bot.File{Name: doc.FileName, Data: data}, nil
+}
+
+// chatType returns the type of the chat, where the message came from
+func chatType(chat *tgbotapi.Chat) bot.ChatType {
+	switch {
+	case chat.IsGroup() || chat.IsSuperGroup():
+		return bot.ChatTypeGroup
+	case chat.IsChannel():
+		return bot.ChatTypeChannel
+	default:
+		return bot.ChatTypePrivate
+	}
+}
+
+// isUserAdmin detects whether the user with the given username is an admin of the chat
 // todo blocking call
-func (t *TelegramBotCtrl) isUserAdmin(msg *tgbotapi.Message) bool {
+func (t *TelegramBotCtrl) isUserAdmin(ctx context.Context, chat *tgbotapi.Chat, userName string) bool {
 	// if all members are admins - we do not have to get list of all users
-	if msg.Chat.AllMembersAreAdmins {
+	if chat.AllMembersAreAdmins {
 		return true
 	}
 
 	admins, err := t.API.GetChatAdministrators(tgbotapi.ChatConfig{
-		ChatID: msg.Chat.ID,
+		ChatID: chat.ID,
 	})
 
 	if err != nil {
-		log.Printf("[WARN] failed to retrieve admins for chat %d: %+v", msg.Chat.ID, err)
+		logging.Printf(ctx, "[WARN] failed to retrieve admins for chat %d: %+v", chat.ID, err)
 		return false
 	}
 
 	// if not all members are admins, then we check users contained in the list of users
-	if chatMemberContainsUsername(admins, msg.From.UserName) {
+	if chatMemberContainsUsername(admins, userName) {
 		return true
 	}
 
@@ -213,3 +474,28 @@ func (t *TelegramBotCtrl) isBotAddedToChat(msg *tgbotapi.Message) bool {
 
 	return false
 }
+
+// updateLabels returns the type of the update and the type of its chat
+func updateLabels(update tgbotapi.Update) (updateType, chatType string) {
+	var chat *tgbotapi.Chat
+	switch {
+	case update.Message != nil:
+		updateType, chat = "message", update.Message.Chat
+	case update.EditedMessage != nil:
+		updateType, chat = "edited_message", update.EditedMessage.Chat
+	case update.ChannelPost != nil:
+		updateType, chat = "channel_post", update.ChannelPost.Chat
+	case update.EditedChannelPost != nil:
+		updateType, chat = "edited_channel_post", update.EditedChannelPost.Chat
+	case update.CallbackQuery != nil:
+		updateType = "callback_query"
+	case update.InlineQuery != nil:
+		updateType = "inline_query"
+	default:
+		updateType = "other"
+	}
+	if chat == nil || chat.Type == "" {
+		return updateType, "none"
+	}
+	return updateType, chat.Type
+}
@@ -2,6 +2,9 @@ package ctrl
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"runtime/debug"
 	"testing"
@@ -14,6 +17,7 @@ import (
 	"github.com/stretchr/testify/mock"
 
 	"github.com/Semior001/multibot-utility/app/bot"
+	"github.com/Semior001/multibot-utility/app/store/schedule"
 )
 
 func TestTelegramBotCtrl_RunWithNoBots(t *testing.T) {
@@ -42,7 +46,7 @@ func TestTelegramBotCtrl_RunWithNoBots(t *testing.T) {
 	close(updChan)
 
 	api.On("GetUpdatesChan", mock.Anything).Return(tgbotapi.UpdatesChannel(updChan), nil)
-	bots.On("OnMessage", mock.Anything).Return(nil)
+	bots.On("OnMessage", mock.Anything, mock.Anything).Return(nil)
 	err := ctrl.Run(ctx)
 	assert.EqualError(t, err, "telegram updates chan closed")
 }
@@ -95,15 +99,15 @@ func TestTelegramBotCtrl_convertMessage(t *testing.T) {
 		Text:           "abc",
 		AddedBotToChat: false,
 	}
-	assert.Equal(t, expected, ctrl.convertMessage(msg), "group chat")
+	assert.Equal(t, expected, ctrl.convertMessage(context.Background(), msg), "group chat")
 
 	msg.Chat.Type = "private"
 	expected.ChatType = bot.ChatTypePrivate
-	assert.Equal(t, expected, ctrl.convertMessage(msg), "private chat")
+	assert.Equal(t, expected, ctrl.convertMessage(context.Background(), msg), "private chat")
 
 	msg.Chat.Type = "channel"
 	expected.ChatType = bot.ChatTypeChannel
-	assert.Equal(t, expected, ctrl.convertMessage(msg), "channel chat")
+	assert.Equal(t, expected, ctrl.convertMessage(context.Background(), msg), "channel chat")
 
 	msg = &tgbotapi.Message{
 		MessageID: 125,
@@ -125,7 +129,7 @@ func TestTelegramBotCtrl_convertMessage(t *testing.T) {
 		Text:           "",
 		AddedBotToChat: true,
 	}
-	assert.Equal(t, expected, ctrl.convertMessage(msg), "added bot to chat")
+	assert.Equal(t, expected, ctrl.convertMessage(context.Background(), msg), "added bot to chat")
 
 	expected = bot.Message{
 		ID:       "555",
@@ -153,7 +157,7 @@ func TestTelegramBotCtrl_convertMessage(t *testing.T) {
 		Date: 1587732716,
 		Text: "/start",
 	}
-	assert.Equal(t, expected, ctrl.convertMessage(msg), "added bot to chat with /start")
+	assert.Equal(t, expected, ctrl.convertMessage(context.Background(), msg), "added bot to chat with /start")
 
 	msg = &tgbotapi.Message{
 		MessageID: 123,
@@ -186,7 +190,7 @@ func TestTelegramBotCtrl_convertMessage(t *testing.T) {
 		Text:           "abc",
 		AddedBotToChat: false,
 	}
-	assert.Equal(t, expected, ctrl.convertMessage(msg), "all members are admins")
+	assert.Equal(t, expected, ctrl.convertMessage(context.Background(), msg), "all members are admins")
 
 	msg = &tgbotapi.Message{
 		MessageID: 123,
@@ -220,7 +224,7 @@ func TestTelegramBotCtrl_convertMessage(t *testing.T) {
 		AddedBotToChat: false,
 	}
 
-	transform := ctrl.convertMessage(msg)
+	transform := ctrl.convertMessage(context.Background(), msg)
 	if !reflect.DeepEqual(expected, transform) {
 		t.Errorf("api request to get admins \n expected: \n %+v \n got: \n %+v", expected, transform)
 	}
@@ -252,15 +256,244 @@ func TestTelegramBotCtrl_sendBotResponse(t *testing.T) {
 
 	// if we want to pin and unping message consequently - we just want to ping all
 	// users in the chat
-	err := ctrl.SendBotResponse(&bot.Response{
+	err := ctrl.SendBotResponse(context.Background(), &bot.Response{
 		Pin:   true,
 		Unpin: true,
 	}, "1234")
 	require.NoError(t, err)
 }
 
+func TestTelegramBotCtrl_sendBotResponseFailed(t *testing.T) {
+	api := mockTbAPI{}
+	ctrl := TelegramBotCtrl{API: &api}
+
+	api.On("Send", mock.Anything).Return(tgbotapi.Message{}, errors.New("too many requests"))
+
+	err := ctrl.SendBotResponse(context.Background(), &bot.Response{Text: "@user1 @user2"}, "1234")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "@user1", "text of the response is logged only with redaction")
+}
+
+func TestTelegramBotCtrl_sendBotResponseWithFile(t *testing.T) {
+	api := mockTbAPI{}
+	ctrl := TelegramBotCtrl{API: &api}
+
+	api.On("Send", mock.Anything).Return(tgbotapi.Message{MessageID: 5555}, nil)
+
+	err := ctrl.SendBotResponse(context.Background(), &bot.Response{
+		Text: "Groups of the chat",
+		File: &bot.File{Name: "groups.json", Data: []byte(`{"groups": []}`)},
+	}, "1234")
+	require.NoError(t, err)
+
+	doc, ok := api.Calls[0].Arguments.Get(0).(tgbotapi.DocumentConfig)
+	require.True(t, ok, "document is sent instead of the text message")
+	assert.Equal(t, int64(1234), doc.ChatID)
+	assert.Equal(t, "Groups of the chat", doc.Caption)
+	assert.Equal(t, tgbotapi.FileBytes{Name: "groups.json", Bytes: []byte(`{"groups": []}`)}, doc.File)
+}
+
+func TestTelegramBotCtrl_sendBotResponseWithButtons(t *testing.T) {
+	api := mockTbAPI{}
+	ctrl := TelegramBotCtrl{API: &api}
+
+	api.On("Send", mock.Anything).Return(tgbotapi.Message{MessageID: 5555}, nil)
+	buttons := [][]bot.Button{{{Text: "Verbosity: silent", Data: "/settings verbosity verbose"}}}
+	expectedMarkup := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Verbosity: silent", "/settings verbosity verbose")),
+	)
+
+	err := ctrl.SendBotResponse(context.Background(), &bot.Response{Text: "Settings", Buttons: buttons}, "1234")
+	require.NoError(t, err)
+	msg, ok := api.Calls[0].Arguments.Get(0).(tgbotapi.MessageConfig)
+	require.True(t, ok)
+	assert.Equal(t, &expectedMarkup, msg.ReplyMarkup)
+
+	err = ctrl.SendBotResponse(context.Background(), &bot.Response{Text: "Settings", Buttons: buttons, EditMessage: "42"}, "1234")
+	require.NoError(t, err)
+	edit, ok := api.Calls[1].Arguments.Get(0).(tgbotapi.EditMessageTextConfig)
+	require.True(t, ok, "message with the pressed button is edited")
+	assert.Equal(t, 42, edit.MessageID)
+	assert.Equal(t, int64(1234), edit.ChatID)
+	assert.Equal(t, "Settings", edit.Text)
+	assert.Equal(t, &expectedMarkup, edit.ReplyMarkup)
+
+	err = ctrl.SendBotResponse(context.Background(), &bot.Response{Text: "Settings", EditMessage: "invalid"}, "1234")
+	assert.Error(t, err)
+}
+
+func TestTelegramBotCtrl_handleCallback(t *testing.T) {
+	api := mockTbAPI{}
+	bots := bot.MockBot{}
+	ctrl := TelegramBotCtrl{API: &api, Bots: &bots}
+
+	api.On("AnswerCallbackQuery", tgbotapi.NewCallback("cq", "")).Return(tgbotapi.APIResponse{Ok: true}, nil)
+	api.On("GetChatAdministrators", mock.Anything).Return([]tgbotapi.ChatMember{
+		{User: &tgbotapi.User{UserName: "admin"}},
+	}, nil)
+	api.On("Send", mock.Anything).Return(tgbotapi.Message{MessageID: 5555}, nil)
+	bots.On("OnMessage", mock.Anything, mock.MatchedBy(func(msg bot.Message) bool {
+		return msg.ID == "42" && msg.ChatID == "1234" && msg.ChatType == bot.ChatTypeGroup && msg.Callback &&
+			msg.Text == "/settings verbosity verbose" && msg.From.ID == "7" && msg.From.IsAdmin
+	})).Return(&bot.Response{Text: "Settings", EditMessage: "42"})
+
+	ctrl.handleCallback(context.Background(), &tgbotapi.CallbackQuery{
+		ID:      "cq",
+		From:    &tgbotapi.User{ID: 7, UserName: "admin"},
+		Message: &tgbotapi.Message{MessageID: 42, Chat: &tgbotapi.Chat{ID: 1234, Type: "supergroup"}},
+		Data:    "/settings verbosity verbose",
+	})
+	bots.AssertExpectations(t)
+	_, ok := api.Calls[len(api.Calls)-1].Arguments.Get(0).(tgbotapi.EditMessageTextConfig)
+	assert.True(t, ok)
+
+	ctrl.handleCallback(context.Background(), &tgbotapi.CallbackQuery{ID: "cq", From: &tgbotapi.User{ID: 7}, InlineMessageID: "inline"})
+	bots.AssertNumberOfCalls(t, "OnMessage", 1)
+	api.AssertNumberOfCalls(t, "AnswerCallbackQuery", 2)
+}
+
+func TestTelegramBotCtrl_convertMessageWithDocument(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/file/groups.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("groups: []"))
+	}))
+	defer ts.Close()
+
+	api := mockTbAPI{}
+	api.On("GetFileDirectURL", "file_id").Return(ts.URL+"/file/groups.yaml", nil)
+	api.On("GetFileDirectURL", "unknown").Return(ts.URL+"/file/unknown", nil)
+	ctrl := TelegramBotCtrl{API: &api}
+
+	tbMsg := &tgbotapi.Message{
+		MessageID: 1,
+		Chat:      &tgbotapi.Chat{ID: 555, Type: "group", AllMembersAreAdmins: true},
+		Caption:   "/import_groups",
+		Document:  &tgbotapi.Document{FileID: "file_id", FileName: "groups.yaml", FileSize: 10},
+	}
+	msg := ctrl.convertMessage(context.Background(), tbMsg)
+	assert.Equal(t, "/import_groups", msg.Text)
+	assert.Equal(t, &bot.File{Name: "groups.yaml", Data: []byte("groups: []")}, msg.File)
+
+	tbMsg.Document = &tgbotapi.Document{FileID: "unknown"}
+	msg = ctrl.convertMessage(context.Background(), tbMsg)
+	assert.Equal(t, "/import_groups", msg.Text)
+	assert.Nil(t, msg.File, "failed download")
+
+	tbMsg.Document = &tgbotapi.Document{FileID: "large", FileSize: maxFileSize + 1}
+	msg = ctrl.convertMessage(context.Background(), tbMsg)
+	assert.Nil(t, msg.File, "too large document is not downloaded")
+
+	tbMsg.Caption = "look at this"
+	msg = ctrl.convertMessage(context.Background(), tbMsg)
+	assert.Equal(t, "", msg.Text)
+	assert.Nil(t, msg.File, "documents without commands are not downloaded")
+	api.AssertNumberOfCalls(t, "GetFileDirectURL", 2)
+}
+
+func TestTelegramBotCtrl_deliverScheduled(t *testing.T) {
+	api := mockTbAPI{}
+	queue := schedule.MockStore{}
+	ctrl := TelegramBotCtrl{
+		API:      &api,
+		Schedule: &queue,
+	}
+
+	now := time.Date(2020, 5, 1, 8, 0, 0, 0, time.UTC)
+	queue.On("Due", mock.Anything, now).Return([]schedule.Delivery{
+		{ID: "first", ChatID: "1234", DeliverAt: now, Header: "digest:", Lines: []string{"@blah"}},
+		{ID: "second", ChatID: "invalid", DeliverAt: now.Add(-59 * time.Minute), Lines: []string{"@blah1"}},
+		{ID: "third", ChatID: "invalid", DeliverAt: now.Add(-time.Hour), Lines: []string{"@blah2"}},
+	}, nil)
+	queue.On("Delete", mock.Anything, "first").Return(nil)
+	// the second one failed and is kept to be retried, the third one failed and expired
+	queue.On("Delete", mock.Anything, "third").Return(nil)
+
+	api.On("Send", mock.MatchedBy(func(msg tgbotapi.MessageConfig) bool {
+		return msg.ChatID == 1234 && msg.Text == "digest:\n@blah"
+	})).Return(tgbotapi.Message{MessageID: 5555}, nil)
+
+	ctrl.deliverScheduled(context.Background(), now)
+
+	queue.AssertExpectations(t)
+	queue.AssertNotCalled(t, "Delete", mock.Anything, "second")
+	api.AssertNumberOfCalls(t, "Send", 1)
+}
+
+func TestTelegramBotCtrl_handleUpdateTimeout(t *testing.T) {
+	// the server holds the download of the document until the request is canceled
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	bots, api := bot.MockBot{}, mockTbAPI{}
+	ctrl := TelegramBotCtrl{Bots: &bots, API: &api, UpdateTimeout: 50 * time.Millisecond}
+
+	slowDone := make(chan struct{})
+	bots.On("OnMessage", mock.Anything, mock.MatchedBy(func(msg bot.Message) bool {
+		return msg.ChatID == "1"
+	})).Return(func(ctx context.Context, _ bot.Message) *bot.Response {
+		defer close(slowDone)
+		<-ctx.Done() // the bot gets the context of the update and stops, when it is done
+		return &bot.Response{Text: "late"}
+	})
+	bots.On("OnMessage", mock.Anything, mock.Anything).Return(&bot.Response{Text: "fast"})
+	api.On("GetFileDirectURL", "file_id").Return(ts.URL+"/file/groups.yaml", nil)
+	api.On("Send", mock.MatchedBy(func(msg tgbotapi.MessageConfig) bool {
+		return msg.Text == "fast"
+	})).Return(tgbotapi.Message{}, nil)
+
+	update := func(chatID int64, doc *tgbotapi.Document) tgbotapi.Update {
+		msg := &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID, Type: "group", AllMembersAreAdmins: true}, Text: "ping"}
+		if doc != nil {
+			msg.Text, msg.Caption, msg.Document = "", "/import_groups", doc
+		}
+		return tgbotapi.Update{Message: msg}
+	}
+
+	st := time.Now()
+	ctrl.handleUpdate(context.Background(), update(1, nil))
+	assert.True(t, time.Since(st) < time.Second, "must not wait for the slow bot")
+	select {
+	case <-slowDone:
+	case <-time.After(time.Second):
+		t.Fatal("the slow bot is not stopped")
+	}
+
+	st = time.Now()
+	ctrl.handleUpdate(context.Background(), update(2, &tgbotapi.Document{FileID: "file_id", FileSize: 10}))
+	assert.True(t, time.Since(st) < time.Second, "must not wait for the slow download")
+
+	ctrl.handleUpdate(context.Background(), update(3, nil))
+
+	api.AssertNumberOfCalls(t, "Send", 1)
+	bots.AssertNumberOfCalls(t, "OnMessage", 2)
+}
+
 func checkPanics(t *testing.T) {
 	if r := recover(); r != nil {
 		t.Errorf("Caught panic: \n %+v \n stacktrace: \n %+v", r, string(debug.Stack()))
 	}
 }
+
+func TestUpdateLabels(t *testing.T) {
+	tbl := []struct {
+		update               tgbotapi.Update
+		updateType, chatType string
+	}{
+		{tgbotapi.Update{Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{Type: "supergroup"}}}, "message", "supergroup"},
+		{tgbotapi.Update{EditedMessage: &tgbotapi.Message{Chat: &tgbotapi.Chat{Type: "private"}}}, "edited_message", "private"},
+		{tgbotapi.Update{ChannelPost: &tgbotapi.Message{Chat: &tgbotapi.Chat{Type: "channel"}}}, "channel_post", "channel"},
+		{tgbotapi.Update{Message: &tgbotapi.Message{}}, "message", "none"},
+		{tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{}}, "callback_query", "none"},
+		{tgbotapi.Update{}, "other", "none"},
+	}
+	for _, tt := range tbl {
+		updateType, chatType := updateLabels(tt.update)
+		assert.Equal(t, tt.updateType, updateType)
+		assert.Equal(t, tt.chatType, chatType)
+	}
+}
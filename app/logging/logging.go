@@ -0,0 +1,165 @@
+// Package logging provides structured logging with attributes, carried by the context,
+// such as the correlation id of the update, and the bridge for the standard logger
+package logging
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Stable keys of logged attributes
+const (
+	KeyCorrelationID = "correlation_id"
+	KeyChatID        = "chat_id"
+	KeyUserID        = "user_id"
+	KeyCommand       = "command"
+	KeyBot           = "bot"
+	KeyDuration      = "duration"
+	KeyText          = "text"
+)
+
+// Options describe the output of logs
+type Options struct {
+	JSON       bool      // write logs as json objects, one per line
+	Debug      bool      // write debug logs and sources of log calls
+	RedactText bool      // replace texts of messages with their length
+	Writer     io.Writer // destination of logs
+}
+
+// redactText is set by Setup and checked by Text
+var redactText int32
+
+// attrsKey is the context key of attributes, that are added to all logs with the context
+type attrsKey struct{}
+
+// Setup makes the structured logger the default one and redirects the standard
+// logger into it, so legacy log.Printf("[LEVEL] ...") calls are structured too
+func Setup(opts Options) {
+	level := slog.LevelInfo
+	if opts.Debug {
+		level = slog.LevelDebug
+	}
+	handlerOpts := &slog.HandlerOptions{Level: level, AddSource: opts.Debug}
+
+	var handler slog.Handler = slog.NewTextHandler(opts.Writer, handlerOpts)
+	if opts.JSON {
+		handler = slog.NewJSONHandler(opts.Writer, handlerOpts)
+	}
+
+	var redact int32
+	if opts.RedactText {
+		redact = 1
+	}
+	atomic.StoreInt32(&redactText, redact)
+
+	// slog.SetDefault redirects the standard logger to the handler, so it is
+	// replaced afterwards with the bridge, that recognizes levels in prefixes
+	slog.SetDefault(slog.New(handler))
+	log.SetFlags(0)
+	log.SetOutput(bridge{})
+}
+
+// WithAttrs returns the context, logs with which contain the given attributes
+// in addition to the ones, that the context already has
+func WithAttrs(ctx context.Context, args ...interface{}) context.Context {
+	prev, _ := ctx.Value(attrsKey{}).([]interface{})
+	attrs := make([]interface{}, 0, len(prev)+len(args))
+	attrs = append(append(attrs, prev...), args...)
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// NewCorrelationID returns the random id to correlate logs of the single update
+func NewCorrelationID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Logger returns the default logger with attributes of the context
+func Logger(ctx context.Context) *slog.Logger {
+	attrs, _ := ctx.Value(attrsKey{}).([]interface{})
+	return slog.Default().With(attrs...)
+}
+
+// Printf logs the message with attributes of the context, the level is taken from
+// the prefix of the message, like [WARN], messages without the prefix are logged as info
+func Printf(ctx context.Context, format string, args ...interface{}) {
+	level, format := parseLevel(format)
+	if slog.Default().Enabled(ctx, level) {
+		write(ctx, level, fmt.Sprintf(format, args...))
+	}
+}
+
+// Debug logs the message with attributes of the context and the given ones, attributes
+// are not collected, if debug logs are disabled, so it is cheap to call on hot paths
+func Debug(ctx context.Context, msg string, args ...interface{}) {
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		write(ctx, slog.LevelDebug, msg, args...)
+	}
+}
+
+// write logs the record with the caller of the exported function as its source
+func write(ctx context.Context, level slog.Level, msg string, args ...interface{}) {
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.Add(args...)
+	_ = Logger(ctx).Handler().Handle(ctx, r)
+}
+
+// Text returns the attribute with the text of the message, that is redacted, if configured
+func Text(text string) slog.Attr {
+	if atomic.LoadInt32(&redactText) == 1 {
+		return slog.String(KeyText, fmt.Sprintf("[redacted, %d chars]", len([]rune(text))))
+	}
+	return slog.String(KeyText, text)
+}
+
+// Since returns the attribute with the duration, elapsed from the start
+func Since(start time.Time) slog.Attr {
+	return slog.Duration(KeyDuration, time.Since(start))
+}
+
+// parseLevel splits the message into the level from its prefix and the rest of the message
+func parseLevel(msg string) (slog.Level, string) {
+	levels := []struct {
+		prefix string
+		level  slog.Level
+	}{
+		{"[DEBUG]", slog.LevelDebug},
+		{"[INFO]", slog.LevelInfo},
+		{"[WARN]", slog.LevelWarn},
+		{"[ERROR]", slog.LevelError},
+	}
+	for _, l := range levels {
+		if strings.HasPrefix(msg, l.prefix) {
+			return l.level, strings.TrimSpace(strings.TrimPrefix(msg, l.prefix))
+		}
+	}
+	return slog.LevelInfo, msg
+}
+
+// bridge writes lines of the standard logger as structured records
+type bridge struct{}
+
+// Write logs the line with the level from its prefix
+func (bridge) Write(p []byte) (int, error) {
+	level, msg := parseLevel(string(bytes.TrimRight(p, "\n")))
+	logger := slog.Default()
+	if logger.Enabled(context.Background(), level) {
+		_ = logger.Handler().Handle(context.Background(), slog.NewRecord(time.Now(), level, msg, 0))
+	}
+	return len(p), nil
+}
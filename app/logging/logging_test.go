@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintf(t *testing.T) {
+	buf := setupTestLog(t, Options{JSON: true})
+
+	ctx := WithAttrs(context.Background(), KeyCorrelationID, "abc", KeyChatID, "-100")
+	ctx = WithAttrs(ctx, KeyCommand, "/list_groups")
+	Printf(ctx, "[WARN] failed to list groups of chat %s", "-100")
+	Printf(ctx, "[DEBUG] skipped, as debug is disabled")
+	Printf(context.Background(), "no level")
+
+	records := decodeRecords(t, buf)
+	require.Len(t, records, 2)
+	assert.Equal(t, "WARN", records[0]["level"])
+	assert.Equal(t, "failed to list groups of chat -100", records[0]["msg"])
+	assert.Equal(t, "abc", records[0][KeyCorrelationID])
+	assert.Equal(t, "-100", records[0][KeyChatID])
+	assert.Equal(t, "/list_groups", records[0][KeyCommand])
+	assert.Equal(t, "INFO", records[1]["level"])
+	assert.Equal(t, "no level", records[1]["msg"])
+	assert.NotContains(t, records[1], KeyCorrelationID)
+}
+
+func TestDebug(t *testing.T) {
+	buf := setupTestLog(t, Options{JSON: true, Debug: true})
+
+	Debug(WithAttrs(context.Background(), KeyBot, "GroupBot"), "bot handled message", "responded", true)
+
+	records := decodeRecords(t, buf)
+	require.Len(t, records, 1)
+	assert.Equal(t, "DEBUG", records[0]["level"])
+	assert.Equal(t, "GroupBot", records[0][KeyBot])
+	assert.Equal(t, true, records[0]["responded"])
+	source, ok := records[0]["source"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Contains(t, source["file"], "logging_test.go", "source is the caller of Debug")
+}
+
+func TestSetup_StandardLogger(t *testing.T) {
+	buf := setupTestLog(t, Options{JSON: true, Debug: true})
+
+	log.Printf("[DEBUG] debug message %d", 1)
+	log.Print("[ERROR] failed")
+
+	records := decodeRecords(t, buf)
+	require.Len(t, records, 2)
+	assert.Equal(t, "DEBUG", records[0]["level"])
+	assert.Equal(t, "debug message 1", records[0]["msg"])
+	assert.Equal(t, "ERROR", records[1]["level"])
+	assert.Equal(t, "failed", records[1]["msg"])
+}
+
+func TestText(t *testing.T) {
+	buf := setupTestLog(t, Options{RedactText: true})
+	Logger(context.Background()).Info("incoming message", Text("secret плохо"), Since(time.Now()))
+	assert.Contains(t, buf.String(), `text="[redacted, 12 chars]"`)
+	assert.Contains(t, buf.String(), "duration=")
+	assert.NotContains(t, buf.String(), "secret")
+
+	buf = setupTestLog(t, Options{})
+	Logger(context.Background()).Info("incoming message", Text("hello"))
+	assert.Contains(t, buf.String(), "text=hello")
+}
+
+func TestNewCorrelationID(t *testing.T) {
+	id := NewCorrelationID()
+	assert.Len(t, id, 16)
+	assert.NotEqual(t, id, NewCorrelationID())
+}
+
+// setupTestLog sets up logs into the buffer and restores the standard logger after the test
+func setupTestLog(t *testing.T, opts Options) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	opts.Writer = buf
+	Setup(opts)
+	t.Cleanup(func() {
+		Setup(Options{Writer: os.Stderr})
+	})
+	return buf
+}
+
+// decodeRecords parses json records, written one per line
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var res []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &rec), line)
+		res = append(res, rec)
+	}
+	return res
+}
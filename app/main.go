@@ -3,32 +3,42 @@ package main
 // golangci-lint warns on the use of go-flags without alias
 //noinspection GoRedundantImportAlias
 import (
-	"fmt"
 	"log"
 	"os"
 
 	"github.com/Semior001/multibot-utility/app/cmd"
-	"github.com/hashicorp/logutils"
+	"github.com/Semior001/multibot-utility/app/logging"
 	"github.com/jessevdk/go-flags"
 )
 
 // Opts describes cli arguments and flags to execute a command
 type Opts struct {
-	TgCmd cmd.TelegramCmd `command:"telegram"`
-	Dbg   bool            `long:"dbg" env:"DEBUG" description:"turn on debug mode"`
+	TgCmd      cmd.TelegramCmd `command:"telegram"`
+	MigrateCmd cmd.MigrateCmd  `command:"migrate"`
+	GroupsCmd  cmd.GroupsCmd   `command:"groups"`
+	BackupCmd  cmd.BackupCmd   `command:"backup"`
+	RestoreCmd cmd.RestoreCmd  `command:"restore"`
+	Dbg        bool            `long:"dbg" env:"DEBUG" description:"turn on debug mode"`
+	Log        struct {
+		Format     string `long:"format" env:"FORMAT" description:"format of logs" choice:"text" choice:"json" default:"text"`
+		RedactText bool   `long:"redact_text" env:"REDACT_TEXT" description:"replace texts of messages with their length in logs"`
+	} `group:"log" namespace:"log" env-namespace:"LOG"`
 }
 
 const version = "unknown"
 
-var logFlags = log.Ldate | log.Ltime
-
 func main() {
-	fmt.Printf("multibot-utility version: %s\n", version)
 	var opts Opts
 	p := flags.NewParser(&opts, flags.Default)
 
 	p.CommandHandler = func(command flags.Commander, args []string) error {
-		setupLog(opts.Dbg)
+		logging.Setup(logging.Options{
+			JSON:       opts.Log.Format == "json",
+			Debug:      opts.Dbg,
+			RedactText: opts.Log.RedactText,
+			Writer:     os.Stdout,
+		})
+		log.Printf("[INFO] multibot-utility version: %s", version)
 		err := command.Execute(args)
 		if err != nil {
 			log.Printf("[ERROR] failed to execute command %+v", err)
@@ -45,20 +55,3 @@ func main() {
 		}
 	}
 }
-
-func setupLog(dbg bool) {
-	filter := &logutils.LevelFilter{
-		Levels:   []logutils.LogLevel{"DEBUG", "INFO", "WARN", "ERROR"},
-		MinLevel: "INFO",
-		Writer:   os.Stdout,
-	}
-
-	if dbg {
-		logFlags = log.Ldate | log.Ltime | log.Lmicroseconds | log.Llongfile
-		filter.MinLevel = "DEBUG"
-	}
-
-	log.SetFlags(logFlags)
-
-	log.SetOutput(filter)
-}
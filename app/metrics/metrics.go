@@ -0,0 +1,93 @@
+// Package metrics contains prometheus collectors, that are shared by bots,
+// controllers and stores, all of them are registered in the default registry
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "multibot"
+
+// Results of executed commands
+const (
+	ResultOK      = "ok"
+	ResultDenied  = "denied"  // the user has no rights to execute the command
+	ResultInvalid = "invalid" // the command has wrong arguments
+	ResultFailed  = "failed"  // the command failed due to the storage error
+)
+
+var (
+	// Updates counts updates, received from the messenger, by update type and chat type
+	Updates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "updates_total",
+		Help:      "Number of received updates by update type and chat type.",
+	}, []string{"type", "chat_type"})
+
+	// Commands counts executed commands by name and result
+	Commands = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "commands_total",
+		Help:      "Number of executed commands by command name and result.",
+	}, []string{"command", "result"})
+
+	// Triggers counts groups, that were pinged by mentions of their aliases
+	Triggers = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "triggers_total",
+		Help:      "Number of pinged groups.",
+	})
+
+	// Mentions counts users, that were mentioned in pings of groups
+	Mentions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mentions_total",
+		Help:      "Number of users mentioned in pings of groups.",
+	})
+
+	// SendErrors counts failures to send responses by reason
+	SendErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "send_errors_total",
+		Help:      "Number of failures to send bot responses by reason.",
+	}, []string{"reason"})
+
+	// TelegramAPIDuration measures calls of the telegram api by method
+	TelegramAPIDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "telegram_api_duration_seconds",
+		Help:      "Latency of telegram api calls by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	// BoltTxDuration measures bolt transactions by store and transaction type
+	BoltTxDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "bolt_tx_duration_seconds",
+		Help:      "Duration of bolt transactions by store and transaction type.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"store", "type"})
+
+	// BotDuration measures handling of messages by child bots
+	BotDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "bot_on_message_duration_seconds",
+		Help:      "Latency of handling messages by bots.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"bot"})
+)
+
+// Since observes the time, elapsed from the start, in seconds
+func Since(o prometheus.Observer, start time.Time) {
+	o.Observe(time.Since(start).Seconds())
+}
+
+// Handler serves all collected metrics in the prometheus format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
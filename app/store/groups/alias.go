@@ -0,0 +1,72 @@
+package groups
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RegexpAlias matches aliases of groups, letters of any alphabet are allowed, e.g. @разработчики,
+// hyphens are allowed only between other characters, so the hyphen right after the alias,
+// e.g. in "@devs-", is not a part of it
+const RegexpAlias = `@[\p{L}\p{N}_]+(?:-[\p{L}\p{N}_]+)*`
+
+// ReservedAliases can not be used as group aliases, as they have special meaning
+var ReservedAliases = []string{"@all", "@everyone", "@here"}
+
+// Errors of ValidateAlias, use errors.Is to check them
+var (
+	ErrInvalidAlias  = errors.New("alias must start with @ and contain only letters, digits, underscores and hyphens between them")
+	ErrReservedAlias = errors.New("alias is reserved")
+)
+
+// aliasValidator matches the whole alias, that can be mentioned in the text
+var aliasValidator = regexp.MustCompile("^" + RegexpAlias + "$")
+
+// NormalizeAlias brings the group alias to the canonical form, as
+// aliases are case-insensitive, e.g. @Admins and @admins are the same group
+func NormalizeAlias(alias string) string {
+	return strings.ToLower(alias)
+}
+
+// ValidateAlias checks that the normalized alias can be mentioned in the text and
+// does not have any special meaning, fails with ErrInvalidAlias or ErrReservedAlias
+func ValidateAlias(alias string) error {
+	if !aliasValidator.MatchString(alias) {
+		return errors.Wrapf(ErrInvalidAlias, "alias %s", alias)
+	}
+	for _, reserved := range ReservedAliases {
+		if alias == reserved {
+			return errors.Wrapf(ErrReservedAlias, "alias %s", alias)
+		}
+	}
+	return nil
+}
+
+// PrefixUsernames returns unique usernames, prefixed with @, if they were not
+func PrefixUsernames(users []string) []string {
+	res := make([]string, 0, len(users))
+	for _, u := range users {
+		if !strings.HasPrefix(u, "@") {
+			u = "@" + u
+		}
+		res = append(res, u)
+	}
+	return unique(res)
+}
+
+// Subtract returns elements of the list, that are not present in the excluded one
+func Subtract(list []string, excluded []string) []string {
+	skip := make(map[string]struct{}, len(excluded))
+	for _, s := range excluded {
+		skip[s] = struct{}{}
+	}
+	var res []string
+	for _, s := range list {
+		if _, ok := skip[s]; !ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
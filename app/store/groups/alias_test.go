@@ -0,0 +1,42 @@
+package groups
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAlias(t *testing.T) {
+	tbl := []struct {
+		alias string
+		err   error
+	}{
+		{alias: "@devs"},
+		{alias: "@back-end"},
+		{alias: "@qa_1"},
+		{alias: "devs", err: ErrInvalidAlias},
+		{alias: "@", err: ErrInvalidAlias},
+		{alias: "@back-", err: ErrInvalidAlias},
+		{alias: "@q.a", err: ErrInvalidAlias},
+		{alias: "@бэкенд"},
+		{alias: "@über-team2"},
+		{alias: "@бэк.енд", err: ErrInvalidAlias},
+		{alias: "@бэк✓", err: ErrInvalidAlias},
+		{alias: "@all", err: ErrReservedAlias},
+		{alias: "@everyone", err: ErrReservedAlias},
+	}
+	for i, tt := range tbl {
+		err := ValidateAlias(tt.alias)
+		if tt.err == nil {
+			assert.NoError(t, err, "case #%d", i)
+			continue
+		}
+		assert.True(t, errors.Is(err, tt.err), "case #%d: %v", i, err)
+	}
+}
+
+func TestPrefixUsernames(t *testing.T) {
+	assert.Equal(t, []string{"@blah", "@blah1"}, PrefixUsernames([]string{"blah", "@blah1", "@blah"}))
+	assert.Equal(t, []string{"@blah"}, Subtract([]string{"@blah", "@blah1"}, []string{"@blah1", "@blah2"}))
+}
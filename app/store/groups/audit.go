@@ -0,0 +1,76 @@
+package groups
+
+import (
+	"context"
+	"time"
+)
+
+// Actions of audit entries, that are made by GroupBot
+const (
+	ActionCreateGroup   = "create_group"
+	ActionReplaceGroup  = "replace_group"
+	ActionDeleteGroup   = "delete_group"
+	ActionAddUsers      = "add_users"
+	ActionDeleteUsers   = "delete_users"
+	ActionRenameGroup   = "rename_group"
+	ActionCopyGroup     = "copy_group"
+	ActionDescribeGroup = "describe_group"
+	ActionAddSynonym    = "add_synonym"
+	ActionDeleteSynonym = "delete_synonym"
+	ActionAdminsOnly    = "admins_only"
+	ActionCooldown      = "cooldown"
+	ActionRestoreGroup  = "restore_group"
+	ActionRestoreUsers  = "restore_users"
+	ActionImportGroup   = "import_group"
+)
+
+// AuditEntry describes a single change of the group
+type AuditEntry struct {
+	ChatID     string    `json:"chat_id"`
+	Group      string    `json:"group"`                 // canonical alias of the group, entries follow the group on rename
+	Actor      string    `json:"actor"`                 // user, who made the change
+	Action     string    `json:"action"`                // one of Action* constants
+	Details    string    `json:"details,omitempty"`     // action-specific human-readable details, e.g. the new alias
+	OldMembers []string  `json:"old_members,omitempty"` // members of the group before the change
+	NewMembers []string  `json:"new_members,omitempty"` // members of the group after the change
+	At         time.Time `json:"at"`
+}
+
+// Change describes the author and the kind of changes of groups, stores record changes,
+// made with the context, that carries the Change, into the audit log and keep tombstones
+// of deleted groups and removed or replaced members in the same transaction, so the
+// change is never applied without its entry and tombstone and vice versa
+type Change struct {
+	Actor   string // user, who makes the change
+	Action  string // one of Action* constants
+	Details string // details of the entry, if the store doesn't describe the change itself
+	At      time.Time
+}
+
+// changeKey is the context key of the Change
+type changeKey struct{}
+
+// WithChange returns the context, that makes stores record changes into the audit log
+func WithChange(ctx context.Context, change Change) context.Context {
+	return context.WithValue(ctx, changeKey{}, change)
+}
+
+// changeFrom returns the change, carried by the context
+func changeFrom(ctx context.Context) (Change, bool) {
+	change, ok := ctx.Value(changeKey{}).(Change)
+	return change, ok
+}
+
+// changeEntry completes the audit entry, prepared by the store, with the change, carried
+// by the context, returns false, if the context carries no change and nothing is recorded
+func changeEntry(ctx context.Context, entry AuditEntry) (AuditEntry, bool) {
+	change, ok := changeFrom(ctx)
+	if !ok {
+		return AuditEntry{}, false
+	}
+	entry.Actor, entry.Action, entry.At = change.Actor, change.Action, change.At
+	if entry.Details == "" {
+		entry.Details = change.Details
+	}
+	return entry, true
+}
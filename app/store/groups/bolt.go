@@ -1,14 +1,32 @@
 package groups
 
 import (
+	"context"
+	"encoding/binary"
 	"encoding/json"
 	"log"
+	"time"
 
-	bolt "github.com/coreos/bbolt"
 	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Semior001/multibot-utility/app/logging"
+	"github.com/Semior001/multibot-utility/app/metrics"
+)
+
+const (
+	groupBotBktName   = "groupbot"
+	settingsBktName   = "groupbot_settings"
+	triggersBktName   = "groupbot_triggers"
+	quietBktName      = "groupbot_quiet_hours"
+	synonymsBktName   = "groupbot_synonyms"
+	auditBktName      = "groupbot_audit"
+	tombstonesBktName = "groupbot_tombstones"
 )
 
-const groupBotBktName = "groupbot"
+// chatQuietHoursKey is a key of chat-wide quiet hours in the chat bucket,
+// as the empty key is not allowed in boltdb
+const chatQuietHoursKey = "chat"
 
 // BoltDB implements store to put and get groups with specific alias
 type BoltDB struct {
@@ -16,21 +34,17 @@ type BoltDB struct {
 	db       *bolt.DB
 }
 
-// NewBoltDB creates new groupbot store
+// NewBoltDB creates new groupbot store, the layout of the existing database
+// is brought up to date, the copy of the database is made before that
 func NewBoltDB(fileName string, opts bolt.Options) (*BoltDB, error) {
 	log.Print("[INFO] groups.BoltDB instantiated")
 	db, err := bolt.Open(fileName, 0600, &opts)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to open boltdb at %s", fileName)
 	}
-	err = db.Update(func(tx *bolt.Tx) error {
-		if _, err := tx.CreateBucketIfNotExists([]byte(groupBotBktName)); err != nil {
-			return errors.Wrap(err, "failed to create groupbot bucket")
-		}
-		return nil
-	})
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to initialize boltdb %s buckets", fileName)
+	if err = migrateBoltDB(db); err != nil {
+		_ = db.Close()
+		return nil, errors.Wrapf(err, "failed to migrate boltdb %s", fileName)
 	}
 	return &BoltDB{
 		fileName: fileName,
@@ -39,13 +53,13 @@ func NewBoltDB(fileName string, opts bolt.Options) (*BoltDB, error) {
 }
 
 // GetGroups returns the list of groups by chatID in form map[group_alias][]users
-func (b *BoltDB) GetGroups(chatID string) (map[string][]string, error) {
+func (b *BoltDB) GetGroups(ctx context.Context, chatID string) (map[string][]string, error) {
 	res := make(map[string][]string)
-	err := b.db.View(func(tx *bolt.Tx) error {
+	err := b.view(ctx, func(tx *bolt.Tx) error {
 		chatBkt := tx.Bucket([]byte(groupBotBktName)).Bucket([]byte(chatID))
 		if chatBkt == nil {
 			return errors.Wrapf(
-				errors.New("bucket does not exist"),
+				ErrChatNotFound,
 				"failed to get groups of chat %s", chatID,
 			)
 		}
@@ -63,112 +77,128 @@ func (b *BoltDB) GetGroups(chatID string) (map[string][]string, error) {
 	return res, err
 }
 
-// DeleteUserFromGroup removes user from the group
-func (b *BoltDB) DeleteUserFromGroup(chatID string, alias string, user string) error {
-	err := b.db.Update(func(tx *bolt.Tx) error {
-		chatBkt := tx.Bucket([]byte(groupBotBktName)).Bucket([]byte(chatID))
-		if chatBkt == nil {
-			return errors.Wrapf(
-				errors.New("group bucket does not exist"),
-				"failed to delete user from group %s:%s", chatID, alias,
-			)
+// DeleteUsers removes users from the group, returns the number of actually removed ones
+func (b *BoltDB) DeleteUsers(ctx context.Context, chatID string, alias string, users []string) (int, error) {
+	alias = NormalizeAlias(alias)
+	removed := 0
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		alias = resolveSynonym(tx, chatID, alias)
+		chatBkt, members, err := groupMembers(tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete users from group %s:%s", chatID, alias)
 		}
 
-		data := chatBkt.Get([]byte(alias))
-		if data == nil {
-			return errors.Wrapf(
-				errors.New("group does not exist"),
-				"failed to delete user from group %s:%s", chatID, alias,
-			)
-		}
-		var users []string
-		err := json.Unmarshal(data, &users)
-		if err != nil {
-			return errors.Wrapf(err, "failed to delete user from group %s:%s", chatID, alias)
+		toDelete := make(map[string]struct{}, len(users))
+		for _, user := range users {
+			toDelete[user] = struct{}{}
 		}
 
-		// looking for the user in the list
-		idx := -1
-		for i := range users {
-			if users[i] == user {
-				idx = i
+		// legacy lists might contain the same user several times, so removing all occurrences
+		var rest []string
+		for _, member := range unique(members) {
+			if _, ok := toDelete[member]; ok {
+				removed++
+				continue
 			}
+			rest = append(rest, member)
 		}
-		if idx == -1 {
-			// if user does not exist in the list - we just do nothing
-			return nil
+		if removed == 0 {
+			return errors.Wrapf(ErrUserNotInGroup, "failed to delete users %v from group %s:%s", users, chatID, alias)
 		}
 
-		// removing user from the list
-		users = append(users[:idx], users[idx+1:]...)
-		data, err = json.Marshal(users)
-		if err != nil {
-			return errors.Wrapf(err, "failed to delete user from group %s:%s", chatID, alias)
+		if err = putMembers(chatBkt, alias, rest); err != nil {
+			return errors.Wrapf(err, "failed to delete users from group %s:%s", chatID, alias)
 		}
-
-		// replacing list inside the bucket
-		err = chatBkt.Put([]byte(alias), data)
-		if err != nil {
-			return errors.Wrapf(err, "failed to delete user from group %s:%s", chatID, alias)
+		entry := AuditEntry{ChatID: chatID, Group: alias, OldMembers: unique(members), NewMembers: rest}
+		if err = recordChange(ctx, tx, entry); err != nil {
+			return errors.Wrapf(err, "failed to delete users from group %s:%s", chatID, alias)
+		}
+		tombstone := Tombstone{ChatID: chatID, Group: alias, Members: Subtract(unique(members), rest)}
+		if err = keepTombstone(ctx, tx, tombstone); err != nil {
+			return errors.Wrapf(err, "failed to delete users from group %s:%s", chatID, alias)
 		}
 		return nil
 	})
-	return err
+	return removed, err
 }
 
-// AddUser adds user to the specified group
-func (b *BoltDB) AddUser(chatID string, alias string, user string) error {
-	err := b.db.Update(func(tx *bolt.Tx) error {
-		chatBkt := tx.Bucket([]byte(groupBotBktName)).Bucket([]byte(chatID))
-		if chatBkt == nil {
-			return errors.Wrapf(
-				errors.New("chat bucket does not exist"),
-				"failed to add user to group %s:%s", chatID, alias,
-			)
+// AddUsers adds users to the end of the specified group, skipping the ones, who are
+// already there, returns the number of actually added users
+func (b *BoltDB) AddUsers(ctx context.Context, chatID string, alias string, users []string) (int, error) {
+	alias = NormalizeAlias(alias)
+	added := 0
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		alias = resolveSynonym(tx, chatID, alias)
+		chatBkt, members, err := groupMembers(tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to add users to group %s:%s", chatID, alias)
 		}
 
-		data := chatBkt.Get([]byte(alias))
-		if data == nil {
-			return errors.Wrapf(
-				errors.New("group does not exist"),
-				"failed to add user to group %s:%s", chatID, alias,
-			)
-		}
+		oldMembers := unique(members)
+		members = unique(append(append([]string(nil), oldMembers...), users...))
+		added = len(members) - len(oldMembers)
 
-		var users []string
-		err := json.Unmarshal(data, &users)
-		if err != nil {
-			return errors.Wrapf(err, "failed to add user to group %s:%s", chatID, alias)
+		if err = putMembers(chatBkt, alias, members); err != nil {
+			return errors.Wrapf(err, "failed to add users to group %s:%s", chatID, alias)
 		}
-
-		users = append(users, user)
-		data, err = json.Marshal(users)
-		if err != nil {
-			return errors.Wrapf(err, "failed to add user to group %s:%s", chatID, alias)
+		if added == 0 {
+			return nil
 		}
-
-		err = chatBkt.Put([]byte(alias), data)
-		if err != nil {
-			return errors.Wrapf(err, "failed to add user to group %s:%s", chatID, alias)
+		entry := AuditEntry{ChatID: chatID, Group: alias, OldMembers: oldMembers, NewMembers: members}
+		if err = recordChange(ctx, tx, entry); err != nil {
+			return errors.Wrapf(err, "failed to add users to group %s:%s", chatID, alias)
 		}
 		return nil
 	})
-	return err
+	return added, err
 }
 
 // DeleteGroup removes group from the database by given chatID
-func (b *BoltDB) DeleteGroup(chatID string, alias string) error {
-	err := b.db.Update(func(tx *bolt.Tx) error {
-		chatBkt := tx.Bucket([]byte(groupBotBktName)).Bucket([]byte(chatID))
-		if chatBkt == nil {
-			return errors.Wrapf(
-				errors.New("chat bucket does not exist"),
-				"failed to delete group %s:%s", chatID, alias,
-			)
+func (b *BoltDB) DeleteGroup(ctx context.Context, chatID string, alias string) error {
+	alias = NormalizeAlias(alias)
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		alias = resolveSynonym(tx, chatID, alias)
+		chatBkt, members, err := groupMembers(tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete group %s:%s", chatID, alias)
 		}
 
-		err := chatBkt.Delete([]byte(alias))
-		if err != nil {
+		// settings and synonyms are gone with the group, so they are kept in the tombstone too
+		tombstone := Tombstone{ChatID: chatID, Group: alias, GroupDeleted: true, Members: unique(members)}
+		if bkt := tx.Bucket([]byte(settingsBktName)).Bucket([]byte(chatID)); bkt != nil {
+			if data := bkt.Get([]byte(alias)); data != nil {
+				if err = json.Unmarshal(data, &tombstone.Settings); err != nil {
+					return errors.Wrapf(err, "failed to delete group %s:%s", chatID, alias)
+				}
+			}
+		}
+		if tombstone.Synonyms, err = groupSynonyms(tx, chatID, alias); err != nil {
+			return errors.Wrapf(err, "failed to delete group %s:%s", chatID, alias)
+		}
+
+		if err = chatBkt.Delete([]byte(alias)); err != nil {
+			return errors.Wrapf(err, "failed to delete group %s:%s", chatID, alias)
+		}
+
+		// removing settings and trigger state of the group, if any
+		for _, bktName := range []string{settingsBktName, triggersBktName} {
+			bkt := tx.Bucket([]byte(bktName)).Bucket([]byte(chatID))
+			if bkt == nil {
+				continue
+			}
+			if err = bkt.Delete([]byte(alias)); err != nil {
+				return errors.Wrapf(err, "failed to delete %s of group %s:%s", bktName, chatID, alias)
+			}
+		}
+
+		if err = repointSynonyms(tx, chatID, alias, ""); err != nil {
+			return errors.Wrapf(err, "failed to delete synonyms of group %s:%s", chatID, alias)
+		}
+
+		if err = recordChange(ctx, tx, AuditEntry{ChatID: chatID, Group: alias, OldMembers: members}); err != nil {
+			return errors.Wrapf(err, "failed to delete group %s:%s", chatID, alias)
+		}
+		if err = keepTombstone(ctx, tx, tombstone); err != nil {
 			return errors.Wrapf(err, "failed to delete group %s:%s", chatID, alias)
 		}
 		return nil
@@ -176,43 +206,74 @@ func (b *BoltDB) DeleteGroup(chatID string, alias string) error {
 	return err
 }
 
-// PutGroup creates a new group in the database with specified users
-func (b *BoltDB) PutGroup(chatID string, alias string, users []string) error {
-	err := b.db.Update(func(tx *bolt.Tx) error {
-		chatBkt, err := tx.Bucket([]byte(groupBotBktName)).CreateBucketIfNotExists([]byte(chatID))
-		if err != nil {
-			return errors.Wrapf(err, "failed to put group %s:%s into bucket", chatID, alias)
-		}
+// CreateGroup creates the new group, fails with ErrGroupExists, if the group
+// or the synonym with the same alias exists
+func (b *BoltDB) CreateGroup(ctx context.Context, chatID string, alias string, users []string) error {
+	return b.putGroup(ctx, chatID, alias, users, false)
+}
 
-		j, err := json.Marshal(users)
-		if err != nil {
+// PutGroup creates the group or replaces members of the existing one
+func (b *BoltDB) PutGroup(ctx context.Context, chatID string, alias string, users []string) error {
+	return b.putGroup(ctx, chatID, alias, users, true)
+}
+
+// putGroup puts the group into the bucket, replacing the existing one only if allowed
+func (b *BoltDB) putGroup(ctx context.Context, chatID string, alias string, users []string, replace bool) error {
+	alias = NormalizeAlias(alias)
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		if canonical := resolveSynonym(tx, chatID, alias); canonical != alias {
 			return errors.Wrapf(
-				errors.Wrapf(err, "failed to marshal users list"),
+				errors.Wrapf(ErrGroupExists, "alias is a synonym of group %s", canonical),
 				"failed to put group %s:%s into bucket", chatID, alias,
 			)
 		}
 
-		err = chatBkt.Put([]byte(alias), j)
+		chatBkt, err := tx.Bucket([]byte(groupBotBktName)).CreateBucketIfNotExists([]byte(chatID))
 		if err != nil {
 			return errors.Wrapf(err, "failed to put group %s:%s into bucket", chatID, alias)
 		}
+
+		var oldMembers []string
+		if data := chatBkt.Get([]byte(alias)); data != nil {
+			if !replace {
+				return errors.Wrapf(ErrGroupExists, "failed to put group %s:%s into bucket", chatID, alias)
+			}
+			if err = json.Unmarshal(data, &oldMembers); err != nil {
+				return errors.Wrapf(err, "failed to put group %s:%s into bucket", chatID, alias)
+			}
+		}
+
+		members := unique(users)
+		if err = putMembers(chatBkt, alias, members); err != nil {
+			return errors.Wrapf(err, "failed to put group %s:%s into bucket", chatID, alias)
+		}
+		entry := AuditEntry{ChatID: chatID, Group: alias, OldMembers: unique(oldMembers), NewMembers: members}
+		if err = recordChange(ctx, tx, entry); err != nil {
+			return errors.Wrapf(err, "failed to put group %s:%s into bucket", chatID, alias)
+		}
+		tombstone := membersTombstone(chatID, alias, unique(oldMembers), members, true)
+		if err = keepTombstone(ctx, tx, tombstone); err != nil {
+			return errors.Wrapf(err, "failed to put group %s:%s into bucket", chatID, alias)
+		}
 		return nil
 	})
 	return err
 }
 
 // GetGroup returns all users of the single group
-func (b *BoltDB) GetGroup(chatID string, alias string) ([]string, error) {
+func (b *BoltDB) GetGroup(ctx context.Context, chatID string, alias string) ([]string, error) {
+	alias = NormalizeAlias(alias)
 	var users []string
-	err := b.db.View(func(tx *bolt.Tx) error {
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		alias = resolveSynonym(tx, chatID, alias)
 		chatBkt := tx.Bucket([]byte(groupBotBktName)).Bucket([]byte(chatID))
 		if chatBkt == nil {
-			return errors.Errorf("failed to get users of group %s:%s", chatID, alias)
+			return errors.Wrapf(ErrChatNotFound, "failed to get users of group %s:%s", chatID, alias)
 		}
 		data := chatBkt.Get([]byte(alias))
 		if data == nil {
 			return errors.Wrapf(
-				errors.New("group does not exist"),
+				ErrGroupNotFound,
 				"failed to get users of group %s:%s", chatID, alias,
 			)
 		}
@@ -225,20 +286,21 @@ func (b *BoltDB) GetGroup(chatID string, alias string) ([]string, error) {
 	return users, err
 }
 
-// FindAliases looks for group aliases in the database
-// and returns members of groups if group alias is present
-func (b *BoltDB) FindAliases(chatID string, aliases []string) ([]string, error) {
-	var users []string
-	err := b.db.View(func(tx *bolt.Tx) error {
+// FindAliases looks for group aliases and their synonyms in the database
+// and returns members of groups, which aliases are present, by canonical aliases
+func (b *BoltDB) FindAliases(ctx context.Context, chatID string, aliases []string) (map[string][]string, error) {
+	res := make(map[string][]string)
+	err := b.view(ctx, func(tx *bolt.Tx) error {
 		chatBkt := tx.Bucket([]byte(groupBotBktName)).Bucket([]byte(chatID))
 		if chatBkt == nil {
 			return errors.Wrapf(
-				errors.New("chat bucket does not exist"),
+				ErrChatNotFound,
 				"error while looking for aliases of chat %s in boltdb", chatID,
 			)
 		}
 		// looking for aliases in chat bucket
 		for _, alias := range aliases {
+			alias = resolveSynonym(tx, chatID, NormalizeAlias(alias))
 			group := chatBkt.Get([]byte(alias))
 			// this alias is not a group, skip
 			if group == nil {
@@ -249,16 +311,16 @@ func (b *BoltDB) FindAliases(chatID string, aliases []string) ([]string, error)
 			if err != nil {
 				return errors.Wrapf(err, "error while looking for aliases of chat %s in boltdb", chatID)
 			}
-			users = append(users, members...)
+			res[alias] = members
 		}
 		return nil
 	})
-	return unique(users), err
+	return res, err
 }
 
 // AddChat creates a chat bucket in the storage
-func (b *BoltDB) AddChat(id string) error {
-	err := b.db.Update(func(tx *bolt.Tx) error {
+func (b *BoltDB) AddChat(ctx context.Context, id string) error {
+	err := b.update(ctx, func(tx *bolt.Tx) error {
 		_, err := tx.Bucket([]byte(groupBotBktName)).CreateBucketIfNotExists([]byte(id))
 		if err != nil {
 			return errors.Wrapf(err, "failed to create chat bucket with chatId %s", id)
@@ -268,15 +330,1039 @@ func (b *BoltDB) AddChat(id string) error {
 	return err
 }
 
-// unique returns slice of unique string occurrences from the source one
-func unique(sl []string) []string {
-	m := make(map[string]struct{})
-	for _, s := range sl {
-		m[s] = struct{}{}
-	}
-	var res []string
-	for s := range m {
-		res = append(res, s)
+// GetChats returns sorted ids of all chats, that were added or have groups
+func (b *BoltDB) GetChats(ctx context.Context) ([]string, error) {
+	res := []string{}
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		// keys in boltdb are sorted, so ids are sorted too
+		return tx.Bucket([]byte(groupBotBktName)).ForEach(func(k, v []byte) error {
+			// chats are nested buckets, so they have no values
+			if v == nil {
+				res = append(res, string(k))
+			}
+			return nil
+		})
+	})
+	return res, err
+}
+
+// GetGroupSettings returns settings of the group, if the group has no
+// settings - returns empty ones
+func (b *BoltDB) GetGroupSettings(ctx context.Context, chatID string, alias string) (GroupSettings, error) {
+	alias = NormalizeAlias(alias)
+	var settings GroupSettings
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		alias = resolveSynonym(tx, chatID, alias)
+		chatBkt := tx.Bucket([]byte(settingsBktName)).Bucket([]byte(chatID))
+		if chatBkt == nil {
+			return nil
+		}
+		data := chatBkt.Get([]byte(alias))
+		if data == nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return errors.Wrapf(err, "failed to get settings of group %s:%s", chatID, alias)
+		}
+		return nil
+	})
+	return settings, err
+}
+
+// PutGroupSettings replaces settings of the group
+func (b *BoltDB) PutGroupSettings(ctx context.Context, chatID string, alias string, settings GroupSettings) error {
+	alias = NormalizeAlias(alias)
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		alias = resolveSynonym(tx, chatID, alias)
+		if err := checkGroupExists(tx, chatID, alias); err != nil {
+			return errors.Wrapf(err, "failed to put settings of group %s:%s", chatID, alias)
+		}
+
+		chatBkt, err := tx.Bucket([]byte(settingsBktName)).CreateBucketIfNotExists([]byte(chatID))
+		if err != nil {
+			return errors.Wrapf(err, "failed to put settings of group %s:%s", chatID, alias)
+		}
+
+		data, err := json.Marshal(settings)
+		if err != nil {
+			return errors.Wrapf(err, "failed to put settings of group %s:%s", chatID, alias)
+		}
+
+		if err = chatBkt.Put([]byte(alias), data); err != nil {
+			return errors.Wrapf(err, "failed to put settings of group %s:%s", chatID, alias)
+		}
+		if err = recordChange(ctx, tx, AuditEntry{ChatID: chatID, Group: alias}); err != nil {
+			return errors.Wrapf(err, "failed to put settings of group %s:%s", chatID, alias)
+		}
+		return nil
+	})
+	return err
+}
+
+// GetAllGroupSettings returns settings of all groups in the chat, that have any,
+// in form map[group_alias]GroupSettings
+func (b *BoltDB) GetAllGroupSettings(ctx context.Context, chatID string) (map[string]GroupSettings, error) {
+	res := make(map[string]GroupSettings)
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		chatBkt := tx.Bucket([]byte(settingsBktName)).Bucket([]byte(chatID))
+		if chatBkt == nil {
+			return nil
+		}
+		return chatBkt.ForEach(func(k, v []byte) error {
+			var settings GroupSettings
+			if err := json.Unmarshal(v, &settings); err != nil {
+				return errors.Wrapf(err, "failed to get settings of group %s:%s", chatID, string(k))
+			}
+			res[string(k)] = settings
+			return nil
+		})
+	})
+	return res, err
+}
+
+// GetLastTrigger returns the last time, when the subject (group alias or user)
+// triggered a ping in the chat, zero time if never
+func (b *BoltDB) GetLastTrigger(ctx context.Context, chatID string, subject string) (time.Time, error) {
+	var at time.Time
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		chatBkt := tx.Bucket([]byte(triggersBktName)).Bucket([]byte(chatID))
+		if chatBkt == nil {
+			return nil
+		}
+		data := chatBkt.Get([]byte(subject))
+		if data == nil {
+			return nil
+		}
+		if err := at.UnmarshalText(data); err != nil {
+			return errors.Wrapf(err, "failed to get last trigger of %s:%s", chatID, subject)
+		}
+		return nil
+	})
+	return at, err
+}
+
+// PutLastTrigger saves the time, when the subject (group alias or user)
+// triggered a ping in the chat
+func (b *BoltDB) PutLastTrigger(ctx context.Context, chatID string, subject string, at time.Time) error {
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		chatBkt, err := tx.Bucket([]byte(triggersBktName)).CreateBucketIfNotExists([]byte(chatID))
+		if err != nil {
+			return errors.Wrapf(err, "failed to put last trigger of %s:%s", chatID, subject)
+		}
+
+		data, err := at.MarshalText()
+		if err != nil {
+			return errors.Wrapf(err, "failed to put last trigger of %s:%s", chatID, subject)
+		}
+
+		if err = chatBkt.Put([]byte(subject), data); err != nil {
+			return errors.Wrapf(err, "failed to put last trigger of %s:%s", chatID, subject)
+		}
+		return nil
+	})
+	return err
+}
+
+// PutLastTriggerAfter saves the time, when the subject triggered a ping in the chat,
+// only if the cooldown has passed since the last trigger, otherwise fails with
+// ErrTriggerCooldown and returns the time, when the subject can trigger again
+func (b *BoltDB) PutLastTriggerAfter(ctx context.Context, chatID string, subject string, at time.Time,
+	cooldown time.Duration) (time.Time, error) {
+	var next time.Time
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		chatBkt, err := tx.Bucket([]byte(triggersBktName)).CreateBucketIfNotExists([]byte(chatID))
+		if err != nil {
+			return errors.Wrapf(err, "failed to put last trigger of %s:%s", chatID, subject)
+		}
+
+		if data := chatBkt.Get([]byte(subject)); data != nil {
+			var last time.Time
+			if err = last.UnmarshalText(data); err != nil {
+				return errors.Wrapf(err, "failed to get last trigger of %s:%s", chatID, subject)
+			}
+			if next = last.Add(cooldown); at.Before(next) {
+				return errors.Wrapf(ErrTriggerCooldown, "failed to put last trigger of %s:%s", chatID, subject)
+			}
+		}
+
+		data, err := at.MarshalText()
+		if err != nil {
+			return errors.Wrapf(err, "failed to put last trigger of %s:%s", chatID, subject)
+		}
+		if err = chatBkt.Put([]byte(subject), data); err != nil {
+			return errors.Wrapf(err, "failed to put last trigger of %s:%s", chatID, subject)
+		}
+		next = time.Time{}
+		return nil
+	})
+	return next, err
+}
+
+// GetQuietHours returns all quiet hours of the chat and its members in form
+// map[subject]QuietHours, chat-wide quiet hours are stored by ChatQuietHours subject
+func (b *BoltDB) GetQuietHours(ctx context.Context, chatID string) (map[string]QuietHours, error) {
+	res := make(map[string]QuietHours)
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		chatBkt := tx.Bucket([]byte(quietBktName)).Bucket([]byte(chatID))
+		if chatBkt == nil {
+			return nil
+		}
+		return chatBkt.ForEach(func(k, v []byte) error {
+			var q QuietHours
+			if err := json.Unmarshal(v, &q); err != nil {
+				return errors.Wrapf(err, "failed to get quiet hours of %s:%s", chatID, string(k))
+			}
+			subject := string(k)
+			if subject == chatQuietHoursKey {
+				subject = ChatQuietHours
+			}
+			res[subject] = q
+			return nil
+		})
+	})
+	return res, err
+}
+
+// PutQuietHours sets quiet hours of the subject (chat or user) in the chat,
+// nil quiet hours removes them
+func (b *BoltDB) PutQuietHours(ctx context.Context, chatID string, subject string, quietHours *QuietHours) error {
+	key := subject
+	if key == ChatQuietHours {
+		key = chatQuietHoursKey
 	}
-	return res
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		chatBkt, err := tx.Bucket([]byte(quietBktName)).CreateBucketIfNotExists([]byte(chatID))
+		if err != nil {
+			return errors.Wrapf(err, "failed to put quiet hours of %s:%s", chatID, subject)
+		}
+
+		if quietHours == nil {
+			if err = chatBkt.Delete([]byte(key)); err != nil {
+				return errors.Wrapf(err, "failed to delete quiet hours of %s:%s", chatID, subject)
+			}
+			return nil
+		}
+
+		data, err := json.Marshal(quietHours)
+		if err != nil {
+			return errors.Wrapf(err, "failed to put quiet hours of %s:%s", chatID, subject)
+		}
+
+		if err = chatBkt.Put([]byte(key), data); err != nil {
+			return errors.Wrapf(err, "failed to put quiet hours of %s:%s", chatID, subject)
+		}
+		return nil
+	})
+	return err
+}
+
+// AddAuditEntry appends the entry to the audit log of the chat
+func (b *BoltDB) AddAuditEntry(ctx context.Context, entry AuditEntry) error {
+	entry.Group = NormalizeAlias(entry.Group)
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		if err := appendAuditEntry(tx, entry); err != nil {
+			return errors.Wrapf(err, "failed to add audit entry of group %s:%s", entry.ChatID, entry.Group)
+		}
+		return nil
+	})
+	return err
+}
+
+// GetAuditLog returns at most limit latest entries of the audit log of the group, the group
+// may be referred by its synonym, newest entries first, empty alias means all groups of the
+// chat, non-positive limit means no limit
+func (b *BoltDB) GetAuditLog(ctx context.Context, chatID string, alias string, limit int) ([]AuditEntry, error) {
+	alias = NormalizeAlias(alias)
+	var res []AuditEntry
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		if alias != "" {
+			alias = resolveSynonym(tx, chatID, alias)
+		}
+		chatBkt := tx.Bucket([]byte(auditBktName)).Bucket([]byte(chatID))
+		if chatBkt == nil {
+			return nil
+		}
+		c := chatBkt.Cursor()
+		for k, v := c.Last(); k != nil && (limit <= 0 || len(res) < limit); k, v = c.Prev() {
+			var entry AuditEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return errors.Wrapf(err, "failed to get audit log of group %s:%s", chatID, alias)
+			}
+			if alias == "" || entry.Group == alias {
+				res = append(res, entry)
+			}
+		}
+		return nil
+	})
+	return res, err
+}
+
+// PurgeAuditLog removes entries of the chat audit log, that were made before the given time
+func (b *BoltDB) PurgeAuditLog(ctx context.Context, chatID string, before time.Time) (int, error) {
+	var purged int
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		chatBkt := tx.Bucket([]byte(auditBktName)).Bucket([]byte(chatID))
+		if chatBkt == nil {
+			return nil
+		}
+
+		// collecting keys first, as the bucket must not be modified during iteration
+		var keys [][]byte
+		err := chatBkt.ForEach(func(k, v []byte) error {
+			var entry AuditEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if entry.At.Before(before) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to purge audit log of chat %s", chatID)
+		}
+
+		for _, k := range keys {
+			if err = chatBkt.Delete(k); err != nil {
+				return errors.Wrapf(err, "failed to purge audit log of chat %s", chatID)
+			}
+		}
+		purged = len(keys)
+		return nil
+	})
+	return purged, err
+}
+
+// AddTombstone saves the copy of the deleted group or removed members
+func (b *BoltDB) AddTombstone(ctx context.Context, tombstone Tombstone) error {
+	tombstone.Group = NormalizeAlias(tombstone.Group)
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		err := putTombstone(tx, tombstone)
+		return errors.Wrapf(err, "failed to add tombstone of group %s:%s", tombstone.ChatID, tombstone.Group)
+	})
+	return err
+}
+
+// GetTombstones returns all tombstones of the chat, newest tombstones first
+func (b *BoltDB) GetTombstones(ctx context.Context, chatID string) ([]Tombstone, error) {
+	var res []Tombstone
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		chatBkt := tx.Bucket([]byte(tombstonesBktName)).Bucket([]byte(chatID))
+		if chatBkt == nil {
+			return nil
+		}
+		c := chatBkt.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var tombstone Tombstone
+			if err := json.Unmarshal(v, &tombstone); err != nil {
+				return errors.Wrapf(err, "failed to get tombstones of chat %s", chatID)
+			}
+			res = append(res, tombstone)
+		}
+		return nil
+	})
+	return res, err
+}
+
+// DeleteTombstone removes the tombstone, e.g. after the change was reverted
+func (b *BoltDB) DeleteTombstone(ctx context.Context, chatID string, id int64) error {
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		chatBkt := tx.Bucket([]byte(tombstonesBktName)).Bucket([]byte(chatID))
+		if chatBkt == nil || chatBkt.Get(sequenceKey(uint64(id))) == nil {
+			return errors.Wrapf(ErrTombstoneNotFound, "failed to delete tombstone %s:%d", chatID, id)
+		}
+		if err := chatBkt.Delete(sequenceKey(uint64(id))); err != nil {
+			return errors.Wrapf(err, "failed to delete tombstone %s:%d", chatID, id)
+		}
+		return nil
+	})
+	return err
+}
+
+// PurgeTombstones removes tombstones of the chat, that were made before the given time
+func (b *BoltDB) PurgeTombstones(ctx context.Context, chatID string, before time.Time) (int, error) {
+	var purged int
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		chatBkt := tx.Bucket([]byte(tombstonesBktName)).Bucket([]byte(chatID))
+		if chatBkt == nil {
+			return nil
+		}
+
+		// collecting keys first, as the bucket must not be modified during iteration
+		var keys [][]byte
+		err := chatBkt.ForEach(func(k, v []byte) error {
+			var tombstone Tombstone
+			if err := json.Unmarshal(v, &tombstone); err != nil {
+				return err
+			}
+			if tombstone.At.Before(before) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to purge tombstones of chat %s", chatID)
+		}
+
+		for _, k := range keys {
+			if err = chatBkt.Delete(k); err != nil {
+				return errors.Wrapf(err, "failed to purge tombstones of chat %s", chatID)
+			}
+		}
+		purged = len(keys)
+		return nil
+	})
+	return purged, err
+}
+
+// RestoreTombstone reverts the change, kept in the tombstone with the same id, and removes the
+// tombstone in a single transaction: the deleted group is created with its settings and synonyms,
+// removed members are added back and replaced ones are put instead of the current members
+func (b *BoltDB) RestoreTombstone(ctx context.Context, chatID string, tombstone Tombstone) error {
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		chatBkt := tx.Bucket([]byte(tombstonesBktName)).Bucket([]byte(chatID))
+		if chatBkt == nil || chatBkt.Get(sequenceKey(uint64(tombstone.ID))) == nil {
+			return errors.Wrapf(ErrTombstoneNotFound, "failed to restore tombstone %s:%d", chatID, tombstone.ID)
+		}
+		// the stored copy is restored, as the group might be renamed since the tombstone was read
+		var stored Tombstone
+		if err := json.Unmarshal(chatBkt.Get(sequenceKey(uint64(tombstone.ID))), &stored); err != nil {
+			return errors.Wrapf(err, "failed to restore tombstone %s:%d", chatID, tombstone.ID)
+		}
+		if err := chatBkt.Delete(sequenceKey(uint64(tombstone.ID))); err != nil {
+			return errors.Wrapf(err, "failed to restore tombstone %s:%d", chatID, tombstone.ID)
+		}
+		if err := restoreTombstone(ctx, tx, chatID, stored); err != nil {
+			return errors.Wrapf(err, "failed to restore group %s:%s", chatID, stored.Group)
+		}
+		return nil
+	})
+	return err
+}
+
+// RenameGroup changes the alias of the group with its settings, trigger state,
+// history and tombstones, fails if the group with new alias already exists
+func (b *BoltDB) RenameGroup(ctx context.Context, chatID string, oldAlias string, newAlias string) error {
+	oldAlias = NormalizeAlias(oldAlias)
+	newAlias = NormalizeAlias(newAlias)
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		oldAlias = resolveSynonym(tx, chatID, oldAlias)
+		if err := moveGroup(tx, chatID, oldAlias, newAlias, false); err != nil {
+			return errors.Wrapf(err, "failed to rename group %s:%s to %s", chatID, oldAlias, newAlias)
+		}
+		if err := renameAuditEntries(tx, chatID, oldAlias, newAlias); err != nil {
+			return errors.Wrapf(err, "failed to rename group %s:%s to %s", chatID, oldAlias, newAlias)
+		}
+		if err := renameTombstones(tx, chatID, oldAlias, newAlias); err != nil {
+			return errors.Wrapf(err, "failed to rename group %s:%s to %s", chatID, oldAlias, newAlias)
+		}
+		entry := AuditEntry{ChatID: chatID, Group: newAlias, Details: "from " + oldAlias}
+		if err := recordChange(ctx, tx, entry); err != nil {
+			return errors.Wrapf(err, "failed to rename group %s:%s to %s", chatID, oldAlias, newAlias)
+		}
+		return nil
+	})
+	return err
+}
+
+// CopyGroup creates a new group with members and settings of the source group,
+// fails if the group with destination alias already exists
+func (b *BoltDB) CopyGroup(ctx context.Context, chatID string, srcAlias string, dstAlias string) error {
+	srcAlias = NormalizeAlias(srcAlias)
+	dstAlias = NormalizeAlias(dstAlias)
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		srcAlias = resolveSynonym(tx, chatID, srcAlias)
+		if err := moveGroup(tx, chatID, srcAlias, dstAlias, true); err != nil {
+			return errors.Wrapf(err, "failed to copy group %s:%s to %s", chatID, srcAlias, dstAlias)
+		}
+		entry := AuditEntry{ChatID: chatID, Group: dstAlias, Details: "from " + srcAlias}
+		if err := recordChange(ctx, tx, entry); err != nil {
+			return errors.Wrapf(err, "failed to copy group %s:%s to %s", chatID, srcAlias, dstAlias)
+		}
+		return nil
+	})
+	return err
+}
+
+// moveGroup puts the group with its settings under the new alias and, if keepSource
+// is not set, removes the source one with its trigger state moved to the new alias
+func moveGroup(tx *bolt.Tx, chatID string, src string, dst string, keepSource bool) error {
+	chatBkt := tx.Bucket([]byte(groupBotBktName)).Bucket([]byte(chatID))
+	if chatBkt == nil {
+		return ErrChatNotFound
+	}
+
+	members := chatBkt.Get([]byte(src))
+	if members == nil {
+		return ErrGroupNotFound
+	}
+	if chatBkt.Get([]byte(dst)) != nil {
+		return ErrGroupExists
+	}
+	if canonical := resolveSynonym(tx, chatID, dst); canonical != dst {
+		return errors.Wrapf(ErrGroupExists, "alias is a synonym of group %s", canonical)
+	}
+
+	bktNames := []string{groupBotBktName, settingsBktName}
+	if !keepSource {
+		bktNames = append(bktNames, triggersBktName)
+	}
+
+	for _, bktName := range bktNames {
+		bkt := tx.Bucket([]byte(bktName)).Bucket([]byte(chatID))
+		if bkt == nil {
+			continue
+		}
+		data := bkt.Get([]byte(src))
+		if data == nil {
+			continue
+		}
+		// boltdb values are valid only during the transaction and
+		// must not be modified, so copying them before putting
+		if err := bkt.Put([]byte(dst), append([]byte(nil), data...)); err != nil {
+			return errors.Wrapf(err, "failed to put %s of the group", bktName)
+		}
+		if keepSource {
+			continue
+		}
+		if err := bkt.Delete([]byte(src)); err != nil {
+			return errors.Wrapf(err, "failed to delete %s of the group", bktName)
+		}
+	}
+
+	if keepSource {
+		return nil
+	}
+	return repointSynonyms(tx, chatID, src, dst)
+}
+
+// AddSynonym makes the synonym an alternative alias of the group, fails if the
+// synonym is already used by any group
+func (b *BoltDB) AddSynonym(ctx context.Context, chatID string, alias string, synonym string) error {
+	alias, synonym = NormalizeAlias(alias), NormalizeAlias(synonym)
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		alias = resolveSynonym(tx, chatID, alias)
+
+		if err := checkGroupExists(tx, chatID, alias); err != nil {
+			return errors.Wrapf(err, "failed to add synonym %s to group %s:%s", synonym, chatID, alias)
+		}
+
+		chatBkt := tx.Bucket([]byte(groupBotBktName)).Bucket([]byte(chatID))
+
+		if chatBkt.Get([]byte(synonym)) != nil {
+			return errors.Wrapf(
+				ErrGroupExists,
+				"failed to add synonym %s to group %s:%s", synonym, chatID, alias,
+			)
+		}
+
+		if canonical := resolveSynonym(tx, chatID, synonym); canonical != synonym {
+			return errors.Wrapf(
+				errors.Wrapf(ErrGroupExists, "alias is a synonym of group %s", canonical),
+				"failed to add synonym %s to group %s:%s", synonym, chatID, alias,
+			)
+		}
+
+		synBkt, err := tx.Bucket([]byte(synonymsBktName)).CreateBucketIfNotExists([]byte(chatID))
+		if err != nil {
+			return errors.Wrapf(err, "failed to add synonym %s to group %s:%s", synonym, chatID, alias)
+		}
+
+		if err = synBkt.Put([]byte(synonym), []byte(alias)); err != nil {
+			return errors.Wrapf(err, "failed to add synonym %s to group %s:%s", synonym, chatID, alias)
+		}
+		if err = recordChange(ctx, tx, AuditEntry{ChatID: chatID, Group: alias, Details: synonym}); err != nil {
+			return errors.Wrapf(err, "failed to add synonym %s to group %s:%s", synonym, chatID, alias)
+		}
+		return nil
+	})
+	return err
+}
+
+// DeleteSynonym removes the synonym of the group
+func (b *BoltDB) DeleteSynonym(ctx context.Context, chatID string, synonym string) error {
+	synonym = NormalizeAlias(synonym)
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		synBkt := tx.Bucket([]byte(synonymsBktName)).Bucket([]byte(chatID))
+		if synBkt == nil || synBkt.Get([]byte(synonym)) == nil {
+			return errors.Wrapf(
+				ErrSynonymNotFound,
+				"failed to delete synonym %s:%s", chatID, synonym,
+			)
+		}
+		alias := string(synBkt.Get([]byte(synonym)))
+		if err := synBkt.Delete([]byte(synonym)); err != nil {
+			return errors.Wrapf(err, "failed to delete synonym %s:%s", chatID, synonym)
+		}
+		if err := recordChange(ctx, tx, AuditEntry{ChatID: chatID, Group: alias, Details: synonym}); err != nil {
+			return errors.Wrapf(err, "failed to delete synonym %s:%s", chatID, synonym)
+		}
+		return nil
+	})
+	return err
+}
+
+// GetSynonyms returns synonyms of all groups in the chat in form
+// map[group_alias][]synonyms, synonyms are sorted
+func (b *BoltDB) GetSynonyms(ctx context.Context, chatID string) (map[string][]string, error) {
+	res := make(map[string][]string)
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		synBkt := tx.Bucket([]byte(synonymsBktName)).Bucket([]byte(chatID))
+		if synBkt == nil {
+			return nil
+		}
+		// keys in boltdb are sorted, so synonyms are sorted too
+		return synBkt.ForEach(func(k, v []byte) error {
+			res[string(v)] = append(res[string(v)], string(k))
+			return nil
+		})
+	})
+	return res, err
+}
+
+// ImportGroups creates or replaces groups with their members, settings and synonyms
+// in a single transaction, fails with ErrGroupExists, if an alias or a synonym of
+// any imported group is used by another group, nothing is imported in that case
+func (b *BoltDB) ImportGroups(ctx context.Context, chatID string, snapshots []GroupSnapshot) error {
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		chatBkt, err := tx.Bucket([]byte(groupBotBktName)).CreateBucketIfNotExists([]byte(chatID))
+		if err != nil {
+			return errors.Wrapf(err, "failed to import groups of chat %s", chatID)
+		}
+		settingsBkt, err := tx.Bucket([]byte(settingsBktName)).CreateBucketIfNotExists([]byte(chatID))
+		if err != nil {
+			return errors.Wrapf(err, "failed to import groups of chat %s", chatID)
+		}
+		synBkt, err := tx.Bucket([]byte(synonymsBktName)).CreateBucketIfNotExists([]byte(chatID))
+		if err != nil {
+			return errors.Wrapf(err, "failed to import groups of chat %s", chatID)
+		}
+
+		// synonyms of imported groups are replaced, so the old ones are dropped first
+		for _, s := range snapshots {
+			if err = repointSynonyms(tx, chatID, NormalizeAlias(s.Alias), ""); err != nil {
+				return errors.Wrapf(err, "failed to import group %s:%s", chatID, s.Alias)
+			}
+		}
+
+		for _, s := range snapshots {
+			alias := NormalizeAlias(s.Alias)
+			if canonical := resolveSynonym(tx, chatID, alias); canonical != alias {
+				return errors.Wrapf(
+					errors.Wrapf(ErrGroupExists, "alias is a synonym of group %s", canonical),
+					"failed to import group %s:%s", chatID, alias,
+				)
+			}
+
+			var oldMembers []string
+			if data := chatBkt.Get([]byte(alias)); data != nil {
+				if err = json.Unmarshal(data, &oldMembers); err != nil {
+					return errors.Wrapf(err, "failed to import group %s:%s", chatID, alias)
+				}
+			}
+			members := unique(s.Members)
+			if err = putMembers(chatBkt, alias, members); err != nil {
+				return errors.Wrapf(err, "failed to import group %s:%s", chatID, alias)
+			}
+			entry := AuditEntry{ChatID: chatID, Group: alias, OldMembers: unique(oldMembers), NewMembers: members}
+			if err = recordChange(ctx, tx, entry); err != nil {
+				return errors.Wrapf(err, "failed to import group %s:%s", chatID, alias)
+			}
+			tombstone := membersTombstone(chatID, alias, unique(oldMembers), members, true)
+			if err = keepTombstone(ctx, tx, tombstone); err != nil {
+				return errors.Wrapf(err, "failed to import group %s:%s", chatID, alias)
+			}
+
+			if s.Settings == (GroupSettings{}) {
+				err = settingsBkt.Delete([]byte(alias))
+			} else {
+				var data []byte
+				if data, err = json.Marshal(s.Settings); err == nil {
+					err = settingsBkt.Put([]byte(alias), data)
+				}
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to import settings of group %s:%s", chatID, alias)
+			}
+
+			for _, synonym := range s.Synonyms {
+				synonym = NormalizeAlias(synonym)
+				if chatBkt.Get([]byte(synonym)) != nil {
+					return errors.Wrapf(ErrGroupExists, "failed to import synonym %s of group %s:%s", synonym, chatID, alias)
+				}
+				if canonical := resolveSynonym(tx, chatID, synonym); canonical != synonym {
+					return errors.Wrapf(
+						errors.Wrapf(ErrGroupExists, "alias is a synonym of group %s", canonical),
+						"failed to import synonym %s of group %s:%s", synonym, chatID, alias,
+					)
+				}
+				if err = synBkt.Put([]byte(synonym), []byte(alias)); err != nil {
+					return errors.Wrapf(err, "failed to import synonym %s of group %s:%s", synonym, chatID, alias)
+				}
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// recordChange appends the entry to the audit log, if the context carries the change
+func recordChange(ctx context.Context, tx *bolt.Tx, entry AuditEntry) error {
+	entry, ok := changeEntry(ctx, entry)
+	if !ok {
+		return nil
+	}
+	return errors.Wrap(appendAuditEntry(tx, entry), "failed to record the change")
+}
+
+// appendAuditEntry puts the entry to the end of the audit log of the chat
+func appendAuditEntry(tx *bolt.Tx, entry AuditEntry) error {
+	chatBkt, err := tx.Bucket([]byte(auditBktName)).CreateBucketIfNotExists([]byte(entry.ChatID))
+	if err != nil {
+		return err
+	}
+	// sequential keys keep entries in order of their addition
+	seq, err := chatBkt.NextSequence()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return chatBkt.Put(sequenceKey(seq), data)
+}
+
+// keepTombstone saves the tombstone of removed data, if the context carries the change
+func keepTombstone(ctx context.Context, tx *bolt.Tx, tombstone Tombstone) error {
+	tombstone, ok := changeTombstone(ctx, tombstone)
+	if !ok {
+		return nil
+	}
+	return errors.Wrap(putTombstone(tx, tombstone), "failed to keep the tombstone")
+}
+
+// putTombstone saves the tombstone with the next id of the chat
+func putTombstone(tx *bolt.Tx, tombstone Tombstone) error {
+	chatBkt, err := tx.Bucket([]byte(tombstonesBktName)).CreateBucketIfNotExists([]byte(tombstone.ChatID))
+	if err != nil {
+		return err
+	}
+	seq, err := chatBkt.NextSequence()
+	if err != nil {
+		return err
+	}
+	tombstone.ID = int64(seq)
+	data, err := json.Marshal(tombstone)
+	if err != nil {
+		return err
+	}
+	return chatBkt.Put(sequenceKey(seq), data)
+}
+
+// renameAuditEntries moves entries of the audit log of the group to its new alias
+func renameAuditEntries(tx *bolt.Tx, chatID string, from string, to string) error {
+	chatBkt := tx.Bucket([]byte(auditBktName)).Bucket([]byte(chatID))
+	if chatBkt == nil {
+		return nil
+	}
+
+	// collecting entries first, as the bucket must not be modified during iteration
+	renamed := map[string][]byte{}
+	err := chatBkt.ForEach(func(k, v []byte) error {
+		var entry AuditEntry
+		if err := json.Unmarshal(v, &entry); err != nil {
+			return err
+		}
+		if entry.Group != from {
+			return nil
+		}
+		entry.Group = to
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		renamed[string(k)] = data
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to rename audit entries")
+	}
+
+	for k, data := range renamed {
+		if err = chatBkt.Put([]byte(k), data); err != nil {
+			return errors.Wrap(err, "failed to rename audit entries")
+		}
+	}
+	return nil
+}
+
+// renameTombstones moves tombstones of the group to its new alias, so it can be restored after rename
+func renameTombstones(tx *bolt.Tx, chatID string, from string, to string) error {
+	chatBkt := tx.Bucket([]byte(tombstonesBktName)).Bucket([]byte(chatID))
+	if chatBkt == nil {
+		return nil
+	}
+
+	// collecting tombstones first, as the bucket must not be modified during iteration
+	renamed := map[string][]byte{}
+	err := chatBkt.ForEach(func(k, v []byte) error {
+		var tombstone Tombstone
+		if err := json.Unmarshal(v, &tombstone); err != nil {
+			return err
+		}
+		if tombstone.Group != from {
+			return nil
+		}
+		tombstone.Group = to
+		data, err := json.Marshal(tombstone)
+		if err != nil {
+			return err
+		}
+		renamed[string(k)] = data
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to rename tombstones")
+	}
+
+	for k, data := range renamed {
+		if err = chatBkt.Put([]byte(k), data); err != nil {
+			return errors.Wrap(err, "failed to rename tombstones")
+		}
+	}
+	return nil
+}
+
+// restoreTombstone reverts the change, kept in the tombstone, and records the restore
+// into the audit log, the restore itself keeps no tombstone
+func restoreTombstone(ctx context.Context, tx *bolt.Tx, chatID string, tombstone Tombstone) error {
+	alias := tombstone.Group
+	if !tombstone.GroupDeleted {
+		chatBkt, oldMembers, err := groupMembers(tx, chatID, alias)
+		if err != nil {
+			return err
+		}
+		members := tombstone.Members
+		if !tombstone.Replaced {
+			members = append(append([]string(nil), oldMembers...), tombstone.Members...)
+		}
+		members = unique(members)
+		if err = putMembers(chatBkt, alias, members); err != nil {
+			return err
+		}
+		return recordChange(ctx, tx, AuditEntry{ChatID: chatID, Group: alias, OldMembers: unique(oldMembers), NewMembers: members})
+	}
+
+	for _, a := range append([]string{alias}, tombstone.Synonyms...) {
+		if err := checkGroupExists(tx, chatID, a); err == nil {
+			return errors.Wrapf(ErrGroupExists, "alias %s is used", a)
+		}
+		if canonical := resolveSynonym(tx, chatID, a); canonical != a {
+			return errors.Wrapf(ErrGroupExists, "alias %s is a synonym of group %s", a, canonical)
+		}
+	}
+
+	chatBkt, err := tx.Bucket([]byte(groupBotBktName)).CreateBucketIfNotExists([]byte(chatID))
+	if err != nil {
+		return err
+	}
+	members := unique(tombstone.Members)
+	if err = putMembers(chatBkt, alias, members); err != nil {
+		return err
+	}
+
+	if tombstone.Settings != (GroupSettings{}) {
+		settingsBkt, err := tx.Bucket([]byte(settingsBktName)).CreateBucketIfNotExists([]byte(chatID))
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(tombstone.Settings)
+		if err != nil {
+			return err
+		}
+		if err = settingsBkt.Put([]byte(alias), data); err != nil {
+			return errors.Wrap(err, "failed to restore settings")
+		}
+	}
+
+	synBkt, err := tx.Bucket([]byte(synonymsBktName)).CreateBucketIfNotExists([]byte(chatID))
+	if err != nil {
+		return err
+	}
+	for _, synonym := range tombstone.Synonyms {
+		if err = synBkt.Put([]byte(synonym), []byte(alias)); err != nil {
+			return errors.Wrapf(err, "failed to restore synonym %s", synonym)
+		}
+	}
+	return recordChange(ctx, tx, AuditEntry{ChatID: chatID, Group: alias, NewMembers: members})
+}
+
+// checkGroupExists returns ErrChatNotFound or ErrGroupNotFound,
+// if the group with given alias does not exist
+func checkGroupExists(tx *bolt.Tx, chatID string, alias string) error {
+	chatBkt := tx.Bucket([]byte(groupBotBktName)).Bucket([]byte(chatID))
+	if chatBkt == nil {
+		return ErrChatNotFound
+	}
+	if chatBkt.Get([]byte(alias)) == nil {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// groupMembers returns the bucket of the chat and the members of the group
+func groupMembers(tx *bolt.Tx, chatID string, alias string) (*bolt.Bucket, []string, error) {
+	chatBkt := tx.Bucket([]byte(groupBotBktName)).Bucket([]byte(chatID))
+	if chatBkt == nil {
+		return nil, nil, ErrChatNotFound
+	}
+	data := chatBkt.Get([]byte(alias))
+	if data == nil {
+		return nil, nil, ErrGroupNotFound
+	}
+	var members []string
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to unmarshal users list")
+	}
+	return chatBkt, members, nil
+}
+
+// putMembers replaces members of the group in the chat bucket
+func putMembers(chatBkt *bolt.Bucket, alias string, members []string) error {
+	data, err := json.Marshal(members)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal users list")
+	}
+	return chatBkt.Put([]byte(alias), data)
+}
+
+// resolveSynonym returns the canonical alias of the group, if the given
+// alias is its synonym, otherwise returns alias as is
+func resolveSynonym(tx *bolt.Tx, chatID string, alias string) string {
+	synBkt := tx.Bucket([]byte(synonymsBktName)).Bucket([]byte(chatID))
+	if synBkt == nil {
+		return alias
+	}
+	if canonical := synBkt.Get([]byte(alias)); canonical != nil {
+		return string(canonical)
+	}
+	return alias
+}
+
+// repointSynonyms makes synonyms of the group with alias from to point to the group
+// with alias to, if to is empty - removes synonyms
+func repointSynonyms(tx *bolt.Tx, chatID string, from string, to string) error {
+	// collecting synonyms first, as the bucket must not be modified during iteration
+	synonyms, err := groupSynonyms(tx, chatID, from)
+	if err != nil {
+		return err
+	}
+
+	synBkt := tx.Bucket([]byte(synonymsBktName)).Bucket([]byte(chatID))
+	for _, synonym := range synonyms {
+		if to == "" {
+			err = synBkt.Delete([]byte(synonym))
+		} else {
+			err = synBkt.Put([]byte(synonym), []byte(to))
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to update synonym %s", synonym)
+		}
+	}
+	return nil
+}
+
+// groupSynonyms returns sorted synonyms of the group
+func groupSynonyms(tx *bolt.Tx, chatID string, alias string) ([]string, error) {
+	synBkt := tx.Bucket([]byte(synonymsBktName)).Bucket([]byte(chatID))
+	if synBkt == nil {
+		return nil, nil
+	}
+	var synonyms []string
+	err := synBkt.ForEach(func(k, v []byte) error {
+		if string(v) == alias {
+			synonyms = append(synonyms, string(k))
+		}
+		return nil
+	})
+	return synonyms, err
+}
+
+// DB returns the underlying boltdb instance to share it with other stores
+func (b *BoltDB) DB() *bolt.DB {
+	return b.db
+}
+
+// Ping checks, that the database is readable by opening the read transaction
+func (b *BoltDB) Ping(ctx context.Context) error {
+	return b.view(ctx, func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(groupBotBktName)) == nil {
+			return errors.Errorf("bucket %s not found", groupBotBktName)
+		}
+		return nil
+	})
+}
+
+// Close closes the database
+func (b *BoltDB) Close() error {
+	return b.db.Close()
+}
+
+// unique returns slice of unique string occurrences from the source one
+// in order of their first occurrence
+func unique(sl []string) []string {
+	m := make(map[string]struct{})
+	var res []string
+	for _, s := range sl {
+		if _, ok := m[s]; ok {
+			continue
+		}
+		m[s] = struct{}{}
+		res = append(res, s)
+	}
+	return res
+}
+
+// sequenceKey encodes the sequence number, so keys are sorted in order of numbers
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// view runs the read-only transaction, if the context is not done yet
+func (b *BoltDB) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer observeTx(ctx, "view", time.Now())
+	return b.db.View(func(tx *bolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// update runs the read-write transaction, if the context is not done yet,
+// the context is checked again after acquiring the write lock, so the
+// transaction, that waited for the lock too long, is not applied
+func (b *BoltDB) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer observeTx(ctx, "update", time.Now())
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// observeTx records the duration of the bolt transaction of the given type
+func observeTx(ctx context.Context, txType string, start time.Time) {
+	metrics.Since(metrics.BoltTxDuration.WithLabelValues("groups", txType), start)
+	logging.Debug(ctx, "bolt transaction", "store", "groups", "type", txType, logging.Since(start))
 }
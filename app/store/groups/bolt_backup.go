@@ -0,0 +1,186 @@
+package groups
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// backupTimeFormat is used in names of backup files, so they are sorted by the time
+const backupTimeFormat = "20060102T150405"
+
+// Backup writes the consistent copy of the database within the read transaction,
+// so it doesn't block writers and is safe to make while the bot is running
+func (b *BoltDB) Backup(ctx context.Context, w io.Writer) (int64, error) {
+	var n int64
+	err := b.view(ctx, func(tx *bolt.Tx) (err error) {
+		n, err = tx.WriteTo(w)
+		return errors.Wrapf(err, "failed to backup boltdb %s", b.fileName)
+	})
+	return n, err
+}
+
+// BackupToDir saves the backup into the directory as <database file>.<time>.backup
+// and removes the oldest backups of the database, so only keep ones remain, 0 keeps all
+func (b *BoltDB) BackupToDir(ctx context.Context, dir string, keep int) (string, error) {
+	base := filepath.Base(b.fileName)
+	fileName := filepath.Join(dir, fmt.Sprintf("%s.%s.backup", base, time.Now().Format(backupTimeFormat)))
+	if err := writeFileAtomic(fileName, func(w io.Writer) error {
+		_, err := b.Backup(ctx, w)
+		return err
+	}); err != nil {
+		return "", err
+	}
+
+	if keep <= 0 {
+		return fileName, nil
+	}
+	backups, err := filepath.Glob(filepath.Join(dir, base+".*.backup"))
+	if err != nil {
+		return fileName, errors.Wrapf(err, "failed to list backups in %s", dir)
+	}
+	sort.Strings(backups)
+	for len(backups) > keep {
+		if err = os.Remove(backups[0]); err != nil {
+			return fileName, errors.Wrapf(err, "failed to remove outdated backup %s", backups[0])
+		}
+		log.Printf("[DEBUG] outdated backup %s removed", backups[0])
+		backups = backups[1:]
+	}
+	return fileName, nil
+}
+
+// ValidateBoltBackup checks, that the file is a consistent bolt database of groups
+// with the supported schema version
+func ValidateBoltBackup(fileName string) error {
+	if _, err := os.Stat(fileName); err != nil {
+		return errors.Wrapf(err, "failed to find backup %s", fileName)
+	}
+	db, err := bolt.Open(fileName, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return errors.Wrapf(err, "failed to open backup %s", fileName)
+	}
+	defer db.Close() //nolint:errcheck // nothing is written
+
+	err = db.View(func(tx *bolt.Tx) error {
+		// draining all errors, as the checking goroutine doesn't stop on the first one
+		var corrupted error
+		for err := range tx.Check() {
+			if corrupted == nil {
+				corrupted = errors.Wrap(err, "backup is corrupted")
+			}
+		}
+		if corrupted != nil {
+			return corrupted
+		}
+
+		version, err := schemaVersion(tx)
+		if err != nil {
+			return err
+		}
+		if version > len(boltMigrations) {
+			return errors.Errorf("schema version %d is newer than the supported one %d", version, len(boltMigrations))
+		}
+
+		groupsBkt := tx.Bucket([]byte(groupBotBktName))
+		if groupsBkt == nil {
+			return errors.Errorf("backup has no %s bucket", groupBotBktName)
+		}
+		return groupsBkt.ForEach(func(chatID, v []byte) error {
+			chatBkt := groupsBkt.Bucket(chatID)
+			if v != nil || chatBkt == nil {
+				return errors.Errorf("unexpected value of chat %s", chatID)
+			}
+			return chatBkt.ForEach(func(alias, v []byte) error {
+				var members []string
+				if err := json.Unmarshal(v, &members); err != nil {
+					return errors.Wrapf(err, "invalid members of group %s:%s", chatID, alias)
+				}
+				return nil
+			})
+		})
+	})
+	return errors.Wrapf(err, "invalid backup %s", fileName)
+}
+
+// RestoreBoltDB validates the backup and replaces the database with it, the replaced
+// database is kept as <database file>.<time>.bak, its name is returned, if it existed,
+// the database must not be used by the running bot, it is waited for opts.Timeout
+func RestoreBoltDB(backupFile, fileName string, opts bolt.Options) (string, error) {
+	if err := ValidateBoltBackup(backupFile); err != nil {
+		return "", err
+	}
+
+	var kept string
+	if _, err := os.Stat(fileName); err == nil {
+		// holding the lock of the database, so the bot can't start in the middle of restore
+		db, err := bolt.Open(fileName, 0600, &opts)
+		switch {
+		case errors.Is(err, bolt.ErrTimeout):
+			return "", errors.Wrapf(err, "database %s is used, stop the bot before restore", fileName)
+		case err != nil:
+			log.Printf("[WARN] failed to open database %s, it will be replaced as is: %v", fileName, err)
+		default:
+			defer db.Close() //nolint:errcheck // the file is already replaced
+		}
+		kept = fmt.Sprintf("%s.%s.bak", fileName, time.Now().Format(backupTimeFormat))
+	}
+
+	tmp := fileName + ".restore"
+	err := writeFileAtomic(tmp, func(w io.Writer) error {
+		src, err := os.Open(backupFile) //nolint:gosec // the file is given by the administrator
+		if err != nil {
+			return errors.Wrapf(err, "failed to open backup %s", backupFile)
+		}
+		defer src.Close() //nolint:errcheck // opened only for reading
+		_, err = io.Copy(w, src)
+		return errors.Wrapf(err, "failed to copy backup %s", backupFile)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if kept != "" {
+		if err = os.Rename(fileName, kept); err != nil {
+			_ = os.Remove(tmp)
+			return "", errors.Wrapf(err, "failed to keep database %s", fileName)
+		}
+	}
+	if err = os.Rename(tmp, fileName); err != nil {
+		return kept, errors.Wrapf(err, "failed to replace database %s, the previous one is kept at %s", fileName, kept)
+	}
+	return kept, nil
+}
+
+// writeFileAtomic writes the file through the temporary one, so the partially written
+// file never appears under the given name
+func writeFileAtomic(fileName string, write func(w io.Writer) error) error {
+	tmp := fileName + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600) //nolint:gosec // the name is made from options
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s", tmp)
+	}
+
+	if err = write(f); err == nil {
+		err = errors.Wrapf(f.Sync(), "failed to sync %s", tmp)
+	}
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = errors.Wrapf(closeErr, "failed to close %s", tmp)
+	}
+	if err == nil {
+		err = errors.Wrapf(os.Rename(tmp, fileName), "failed to rename %s", tmp)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package groups
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltDB_BackupToDir(t *testing.T) {
+	svc := prepareBoltDB(t)
+	ctx := context.Background()
+	require.NoError(t, svc.PutGroup(ctx, "foo", "@devs", []string{"@blah", "@blah1"}))
+
+	dir := filepath.Dir(svc.fileName)
+	base := filepath.Base(svc.fileName)
+	for _, ts := range []string{"20200101T000000", "20200102T000000", "20200103T000000"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, base+"."+ts+".backup"), []byte("old"), 0600))
+	}
+
+	fileName, err := svc.BackupToDir(ctx, dir, 2)
+	require.NoError(t, err)
+
+	backups, err := filepath.Glob(filepath.Join(dir, base+".*.backup"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, base+".20200103T000000.backup"), fileName}, backups,
+		"only the latest backups are kept")
+
+	require.NoError(t, ValidateBoltBackup(fileName))
+	backup, err := NewBoltDB(fileName, bolt.Options{})
+	require.NoError(t, err)
+	grp, err := backup.GetGroup(ctx, "foo", "@devs")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah", "@blah1"}, grp)
+	require.NoError(t, backup.Close())
+
+	var buf bytes.Buffer
+	n, err := svc.Backup(ctx, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+}
+
+func TestValidateBoltBackup(t *testing.T) {
+	svc := prepareBoltDB(t)
+	dir := filepath.Dir(svc.fileName)
+
+	garbage := filepath.Join(dir, "garbage.backup")
+	require.NoError(t, ioutil.WriteFile(garbage, bytes.Repeat([]byte("garbage"), 1000), 0600))
+	assert.Error(t, ValidateBoltBackup(garbage))
+
+	assert.Error(t, ValidateBoltBackup(filepath.Join(dir, "unknown.backup")))
+
+	// the database of other application
+	other := filepath.Join(dir, "other.backup")
+	db, err := bolt.Open(other, 0600, &bolt.Options{})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	err = ValidateBoltBackup(other)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "backup has no groupbot bucket")
+
+	broken, err := svc.BackupToDir(context.Background(), dir, 0)
+	require.NoError(t, err)
+	db, err = bolt.Open(broken, 0600, &bolt.Options{})
+	require.NoError(t, err)
+	err = db.Update(func(tx *bolt.Tx) error {
+		chatBkt, err := tx.Bucket([]byte(groupBotBktName)).CreateBucket([]byte("foo"))
+		require.NoError(t, err)
+		return chatBkt.Put([]byte("@devs"), []byte("not a list"))
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	err = ValidateBoltBackup(broken)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid members of group foo:@devs")
+}
+
+func TestRestoreBoltDB(t *testing.T) {
+	svc := prepareBoltDB(t)
+	ctx := context.Background()
+	require.NoError(t, svc.PutGroup(ctx, "foo", "@devs", []string{"@blah"}))
+	backup, err := svc.BackupToDir(ctx, filepath.Dir(svc.fileName), 0)
+	require.NoError(t, err)
+	require.NoError(t, svc.PutGroup(ctx, "foo", "@devs", []string{"@blah1"}))
+
+	_, err = RestoreBoltDB(backup, svc.fileName, bolt.Options{Timeout: 10 * time.Millisecond})
+	require.Error(t, err, "database, used by the bot, must not be replaced")
+	assert.Contains(t, err.Error(), "stop the bot before restore")
+	require.NoError(t, svc.Close())
+
+	kept, err := RestoreBoltDB(backup, svc.fileName, bolt.Options{Timeout: 10 * time.Millisecond})
+	require.NoError(t, err)
+	assert.FileExists(t, kept)
+
+	svc, err = NewBoltDB(svc.fileName, bolt.Options{})
+	require.NoError(t, err)
+	grp, err := svc.GetGroup(ctx, "foo", "@devs")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah"}, grp)
+	require.NoError(t, svc.Close())
+
+	_, err = os.Stat(svc.fileName + ".restore")
+	assert.True(t, os.IsNotExist(err), "temporary file must not be left")
+
+	garbage := filepath.Join(filepath.Dir(svc.fileName), "garbage.backup")
+	require.NoError(t, ioutil.WriteFile(garbage, []byte("garbage"), 0600))
+	_, err = RestoreBoltDB(garbage, svc.fileName, bolt.Options{})
+	assert.Error(t, err, "invalid backup must not be restored")
+}
@@ -0,0 +1,247 @@
+package groups
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	metaBktName      = "groupbot_meta"
+	schemaVersionKey = "schema_version"
+)
+
+// boltBuckets are the top-level buckets of the database
+var boltBuckets = []string{groupBotBktName, settingsBktName, triggersBktName, quietBktName, synonymsBktName, auditBktName, tombstonesBktName, metaBktName}
+
+// reportFn describes the change, made by migration
+type reportFn func(format string, args ...interface{})
+
+// boltMigration changes the layout of the data in the database, migrations must be
+// idempotent, so it is safe to apply them over the partially migrated data
+type boltMigration struct {
+	name  string
+	apply func(tx *bolt.Tx, report reportFn) error
+}
+
+// boltMigrations are applied in order, the number of applied ones is kept
+// in the meta bucket, so the new migration must be appended to the end of the list
+var boltMigrations = []boltMigration{
+	{name: "normalize group aliases", apply: normalizeAliases},
+	{name: "remove duplicate group members", apply: removeDuplicateMembers},
+}
+
+// errDryRun rolls back the transaction with applied migrations
+var errDryRun = errors.New("dry run")
+
+// migrateBoltDB applies all migrations, that were not applied yet, the copy
+// of the database is made before the migration of the existing data
+func migrateBoltDB(db *bolt.DB) error {
+	var version int
+	var empty bool
+	err := db.View(func(tx *bolt.Tx) (err error) {
+		empty = tx.Bucket([]byte(groupBotBktName)) == nil
+		version, err = schemaVersion(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if version < len(boltMigrations) && !empty {
+		backup := fmt.Sprintf("%s.v%d.%s.bak", db.Path(), version, time.Now().Format("20060102T150405"))
+		if err = db.View(func(tx *bolt.Tx) error { return tx.CopyFile(backup, 0600) }); err != nil {
+			return errors.Wrapf(err, "failed to backup database to %s", backup)
+		}
+		log.Printf("[INFO] database %s backed up to %s before migration", db.Path(), backup)
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		return applyBoltMigrations(tx, func(format string, args ...interface{}) {
+			log.Printf("[INFO] "+format, args...)
+		})
+	})
+}
+
+// DryRunBoltMigrations applies migrations to the existing database at the given
+// location without saving the changes and returns the description of changes
+func DryRunBoltMigrations(fileName string, opts bolt.Options) ([]string, error) {
+	// opening only the existing file, so the dry run doesn't leave the empty database
+	if _, err := os.Stat(fileName); err != nil {
+		return nil, errors.Wrapf(err, "failed to find boltdb at %s", fileName)
+	}
+	db, err := bolt.Open(fileName, 0600, &opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open boltdb at %s", fileName)
+	}
+	defer db.Close() //nolint:errcheck // nothing is written
+
+	var changes []string
+	err = db.Update(func(tx *bolt.Tx) error {
+		err := applyBoltMigrations(tx, func(format string, args ...interface{}) {
+			changes = append(changes, fmt.Sprintf(format, args...))
+		})
+		if err != nil {
+			return err
+		}
+		return errDryRun
+	})
+	if !errors.Is(err, errDryRun) {
+		return nil, errors.Wrapf(err, "failed to migrate boltdb %s", fileName)
+	}
+	return changes, nil
+}
+
+// applyBoltMigrations creates missing buckets and applies migrations, that
+// were not applied yet, in the single transaction
+func applyBoltMigrations(tx *bolt.Tx, report reportFn) error {
+	for _, bktName := range boltBuckets {
+		if _, err := tx.CreateBucketIfNotExists([]byte(bktName)); err != nil {
+			return errors.Wrapf(err, "failed to create %s bucket", bktName)
+		}
+	}
+
+	version, err := schemaVersion(tx)
+	if err != nil {
+		return err
+	}
+	if version > len(boltMigrations) {
+		return errors.Errorf("schema version %d is newer than the supported one %d", version, len(boltMigrations))
+	}
+
+	for ; version < len(boltMigrations); version++ {
+		migration := boltMigrations[version]
+		report("applying migration #%d: %s", version+1, migration.name)
+		if err = migration.apply(tx, report); err != nil {
+			return errors.Wrapf(err, "failed to apply migration #%d", version+1)
+		}
+	}
+
+	err = tx.Bucket([]byte(metaBktName)).Put([]byte(schemaVersionKey), []byte(strconv.Itoa(version)))
+	return errors.Wrapf(err, "failed to set schema version %d", version)
+}
+
+// schemaVersion returns the number of applied migrations, zero for the database
+// created before migrations were introduced
+func schemaVersion(tx *bolt.Tx) (int, error) {
+	metaBkt := tx.Bucket([]byte(metaBktName))
+	if metaBkt == nil {
+		return 0, nil
+	}
+	data := metaBkt.Get([]byte(schemaVersionKey))
+	if data == nil {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse schema version %q", string(data))
+	}
+	return version, nil
+}
+
+// normalizeAliases brings all group aliases, stored in the database before aliases
+// became case-insensitive, to the normalized form, members of groups, whose aliases
+// differ only in case, are merged
+func normalizeAliases(tx *bolt.Tx, report reportFn) error {
+	merge := map[string]func(dst, src []byte) ([]byte, error){
+		groupBotBktName: func(dst, src []byte) ([]byte, error) {
+			var dstUsers, srcUsers []string
+			if err := json.Unmarshal(dst, &dstUsers); err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(src, &srcUsers); err != nil {
+				return nil, err
+			}
+			return json.Marshal(unique(append(dstUsers, srcUsers...)))
+		},
+		// settings and trigger state of the group with normalized alias take precedence
+		settingsBktName: func(dst, _ []byte) ([]byte, error) { return dst, nil },
+		triggersBktName: func(dst, _ []byte) ([]byte, error) { return dst, nil },
+	}
+
+	for bktName, mergeFn := range merge {
+		err := tx.Bucket([]byte(bktName)).ForEach(func(chatID, _ []byte) error {
+			chatBkt := tx.Bucket([]byte(bktName)).Bucket(chatID)
+			if chatBkt == nil {
+				return nil
+			}
+
+			// collecting keys first, as the bucket must not be modified during iteration
+			var keys []string
+			err := chatBkt.ForEach(func(k, _ []byte) error {
+				key := string(k)
+				if strings.HasPrefix(key, "@") && NormalizeAlias(key) != key {
+					keys = append(keys, key)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, key := range keys {
+				normalized := NormalizeAlias(key)
+				data := append([]byte(nil), chatBkt.Get([]byte(key))...)
+				if existing := chatBkt.Get([]byte(normalized)); existing != nil {
+					if data, err = mergeFn(append([]byte(nil), existing...), data); err != nil {
+						return errors.Wrapf(err, "failed to merge %s into %s", key, normalized)
+					}
+				}
+				if err = chatBkt.Put([]byte(normalized), data); err != nil {
+					return errors.Wrapf(err, "failed to put %s", normalized)
+				}
+				if err = chatBkt.Delete([]byte(key)); err != nil {
+					return errors.Wrapf(err, "failed to delete %s", key)
+				}
+				report("group alias %s:%s normalized to %s in %s", string(chatID), key, normalized, bktName)
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to normalize aliases in %s bucket", bktName)
+		}
+	}
+	return nil
+}
+
+// removeDuplicateMembers removes users, that were added to the same group
+// several times before members of the group became a set
+func removeDuplicateMembers(tx *bolt.Tx, report reportFn) error {
+	return tx.Bucket([]byte(groupBotBktName)).ForEach(func(chatID, _ []byte) error {
+		chatBkt := tx.Bucket([]byte(groupBotBktName)).Bucket(chatID)
+		if chatBkt == nil {
+			return nil
+		}
+
+		// collecting changes first, as the bucket must not be modified during iteration
+		changed := make(map[string][]string)
+		err := chatBkt.ForEach(func(k, v []byte) error {
+			var users []string
+			if err := json.Unmarshal(v, &users); err != nil {
+				return errors.Wrapf(err, "failed to unmarshal members of group %s:%s", string(chatID), string(k))
+			}
+			if uniq := unique(users); len(uniq) != len(users) {
+				changed[string(k)] = uniq
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for alias, users := range changed {
+			if err = putMembers(chatBkt, alias, users); err != nil {
+				return errors.Wrapf(err, "failed to put members of group %s:%s", string(chatID), alias)
+			}
+			report("duplicate members removed from group %s:%s", string(chatID), alias)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,128 @@
+package groups
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltDB_Migrations(t *testing.T) {
+	fileName := prepareLegacyBoltDB(t)
+
+	changes, err := DryRunBoltMigrations(fileName, bolt.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"applying migration #1: normalize group aliases",
+		"group alias foo:@Admins normalized to @admins in groupbot",
+		"applying migration #2: remove duplicate group members",
+		"duplicate members removed from group foo:@devs",
+	}, changes)
+
+	backups, err := filepath.Glob(fileName + ".*.bak")
+	require.NoError(t, err)
+	assert.Empty(t, backups, "dry run must not make backups")
+
+	svc, err := NewBoltDB(fileName, bolt.Options{})
+	require.NoError(t, err)
+
+	grps, err := svc.GetGroups(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"@admins": {"@blah1", "@blah2", "@blah"}, "@devs": {"@blah3", "@blah4"}}, grps)
+
+	err = svc.db.View(func(tx *bolt.Tx) error {
+		version, err := schemaVersion(tx)
+		require.NoError(t, err)
+		assert.Equal(t, len(boltMigrations), version)
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, svc.Close())
+
+	backups, err = filepath.Glob(fileName + ".v0.*.bak")
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+
+	// backup keeps the data as it was before migration
+	backup, err := bolt.Open(backups[0], 0600, &bolt.Options{ReadOnly: true})
+	require.NoError(t, err)
+	err = backup.View(func(tx *bolt.Tx) error {
+		assert.NotNil(t, tx.Bucket([]byte(groupBotBktName)).Bucket([]byte("foo")).Get([]byte("@Admins")))
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, backup.Close())
+
+	// up-to-date database is neither changed nor backed up
+	changes, err = DryRunBoltMigrations(fileName, bolt.Options{})
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	svc, err = NewBoltDB(fileName, bolt.Options{})
+	require.NoError(t, err)
+	require.NoError(t, svc.Close())
+
+	backups, err = filepath.Glob(fileName + ".*.bak")
+	require.NoError(t, err)
+	assert.Len(t, backups, 1)
+}
+
+func TestBoltDB_MigrationsNewDatabase(t *testing.T) {
+	svc := prepareBoltDB(t)
+	require.NoError(t, svc.Close())
+
+	backups, err := filepath.Glob(svc.fileName + ".*.bak")
+	require.NoError(t, err)
+	assert.Empty(t, backups, "empty database is not backed up")
+
+	_, err = DryRunBoltMigrations(svc.fileName+".unknown", bolt.Options{})
+	assert.Error(t, err)
+	_, err = os.Stat(svc.fileName + ".unknown")
+	assert.True(t, os.IsNotExist(err), "dry run must not create the database")
+}
+
+func TestBoltDB_MigrationsNewerSchema(t *testing.T) {
+	svc := prepareBoltDB(t)
+	err := svc.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(metaBktName)).Put([]byte(schemaVersionKey), []byte(strconv.Itoa(len(boltMigrations)+1)))
+	})
+	require.NoError(t, err)
+	require.NoError(t, svc.Close())
+
+	_, err = NewBoltDB(svc.fileName, bolt.Options{})
+	assert.Error(t, err, "database of the newer version must not be opened")
+}
+
+// prepareLegacyBoltDB creates the database in the layout, that was used
+// before schema versions were introduced
+func prepareLegacyBoltDB(t *testing.T) string {
+	loc, err := ioutil.TempDir("", "test_groups_multibot")
+	require.NoError(t, err, "failed to make temp dir")
+	t.Cleanup(func() {
+		assert.NoError(t, os.RemoveAll(loc))
+	})
+
+	fileName := path.Join(loc, "groups_bot_test.db")
+	db, err := bolt.Open(fileName, 0600, &bolt.Options{})
+	require.NoError(t, err)
+	err = db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.CreateBucket([]byte(groupBotBktName))
+		require.NoError(t, err)
+		chatBkt, err := bkt.CreateBucket([]byte("foo"))
+		require.NoError(t, err)
+		require.NoError(t, chatBkt.Put([]byte("@Admins"), []byte(`["@blah","@blah1"]`)))
+		require.NoError(t, chatBkt.Put([]byte("@admins"), []byte(`["@blah1","@blah2"]`)))
+		require.NoError(t, chatBkt.Put([]byte("@devs"), []byte(`["@blah3","@blah4","@blah3"]`)))
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	return fileName
+}
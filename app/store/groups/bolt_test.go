@@ -1,22 +1,25 @@
 package groups
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path"
 	"testing"
+	"time"
 
-	bolt "github.com/coreos/bbolt"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
 )
 
 func TestBoltDB_PutGroup(t *testing.T) {
 	svc := prepareBoltDB(t)
 
 	users := []string{"@blah", "@blah1", "@blah2"}
-	err := svc.PutGroup("foo", "@bar", users)
+	err := svc.PutGroup(context.Background(), "foo", "@bar", users)
 	require.NoError(t, err)
 
 	err = svc.db.View(func(tx *bolt.Tx) error {
@@ -41,7 +44,7 @@ func TestBoltDB_PutGroup(t *testing.T) {
 	require.NoError(t, err)
 }
 
-func TestBoltDB_DeleteUserFromGroup(t *testing.T) {
+func TestBoltDB_DeleteUsers(t *testing.T) {
 	svc := prepareBoltDB(t)
 
 	users := []string{"@blah", "@blah1", "@blah2"}
@@ -61,8 +64,9 @@ func TestBoltDB_DeleteUserFromGroup(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	err = svc.DeleteUserFromGroup("foo", "@bar", "@blah1")
+	removed, err := svc.DeleteUsers(context.Background(), "foo", "@bar", []string{"@blah1"})
 	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
 
 	err = svc.db.View(func(tx *bolt.Tx) error {
 		bkt := tx.Bucket([]byte(groupBotBktName))
@@ -83,7 +87,8 @@ func TestBoltDB_DeleteUserFromGroup(t *testing.T) {
 		return nil
 	})
 
-	err = svc.DeleteUserFromGroup("foo", "@bar", "@blah1")
+	_, err = svc.DeleteUsers(context.Background(), "foo", "@bar", []string{"@blah1"})
+	assert.True(t, errors.Is(err, ErrUserNotInGroup), "deleting absent user must fail")
 	err = svc.db.View(func(tx *bolt.Tx) error {
 		bkt := tx.Bucket([]byte(groupBotBktName))
 		assert.NotNil(t, bkt)
@@ -92,16 +97,14 @@ func TestBoltDB_DeleteUserFromGroup(t *testing.T) {
 		assert.NotNil(t, chat)
 
 		j := chat.Get([]byte("@bar"))
-		require.NoError(t, err)
-
-		err = json.Unmarshal(j, &users)
-		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(j, &users))
 
 		assert.Contains(t, users, "@blah")
 		assert.Contains(t, users, "@blah2")
 		assert.NotContains(t, users, "@blah1")
 		return nil
 	})
+	require.NoError(t, err)
 }
 
 func TestBoltDB_GetGroup(t *testing.T) {
@@ -124,7 +127,7 @@ func TestBoltDB_GetGroup(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	q, err := svc.GetGroup("foo", "@bar")
+	q, err := svc.GetGroup(context.Background(), "foo", "@bar")
 	require.NoError(t, err)
 	assert.Contains(t, q, "@blah")
 	assert.Contains(t, q, "@blah1")
@@ -157,7 +160,7 @@ func TestBoltDB_GetGroups(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	groups, err := svc.GetGroups("foo")
+	groups, err := svc.GetGroups(context.Background(), "foo")
 	require.NoError(t, err)
 
 	assert.Contains(t, groups, "@bar")
@@ -197,7 +200,7 @@ func TestBoltDB_DeleteGroup(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	err = svc.DeleteGroup("foo", "@bar")
+	err = svc.DeleteGroup(context.Background(), "foo", "@bar")
 	require.NoError(t, err)
 
 	err = svc.db.View(func(tx *bolt.Tx) error {
@@ -214,7 +217,7 @@ func TestBoltDB_DeleteGroup(t *testing.T) {
 	require.NoError(t, err)
 }
 
-func TestBoltDB_AddUser(t *testing.T) {
+func TestBoltDB_AddUsers(t *testing.T) {
 	svc := prepareBoltDB(t)
 
 	users := []string{"@blah", "@blah1", "@blah2"}
@@ -234,7 +237,9 @@ func TestBoltDB_AddUser(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	err = svc.AddUser("foo", "@bar", "@blah3")
+	added, err := svc.AddUsers(context.Background(), "foo", "@bar", []string{"@blah3"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
 
 	err = svc.db.View(func(tx *bolt.Tx) error {
 		bkt := tx.Bucket([]byte(groupBotBktName))
@@ -280,32 +285,74 @@ func TestBoltDB_FindAliases(t *testing.T) {
 		j, err = json.Marshal(usersA)
 		require.NoError(t, err)
 
-		err = chatBkt.Put([]byte("@usersA"), j)
+		err = chatBkt.Put([]byte("@usersa"), j)
 		require.NoError(t, err)
 
 		j, err = json.Marshal(usersC)
 		require.NoError(t, err)
 
-		err = chatBkt.Put([]byte("@usersC"), j)
+		err = chatBkt.Put([]byte("@usersc"), j)
 		require.NoError(t, err)
 		return nil
 	})
 	require.NoError(t, err)
 
-	queried, err := svc.FindAliases("foo", []string{"@usersA", "@usersC"})
+	queried, err := svc.FindAliases(context.Background(), "foo", []string{"@usersA", "@usersC", "@unknown"})
 	require.NoError(t, err)
 
-	for _, u := range usersA {
-		assert.Contains(t, queried, u)
-	}
+	assert.Equal(t, map[string][]string{"@usersa": usersA, "@usersc": usersC}, queried)
+}
 
-	for _, u := range usersC {
-		assert.Contains(t, queried, u)
-	}
+func TestBoltDB_NormalizeAliases(t *testing.T) {
+	svc := prepareBoltDB(t)
 
-	for _, u := range users {
-		assert.NotContains(t, queried, u)
-	}
+	// putting groups in the legacy format, with case-sensitive aliases and without schema version
+	err := svc.db.Update(func(tx *bolt.Tx) error {
+		require.NoError(t, tx.DeleteBucket([]byte(metaBktName)))
+		for bktName, kv := range map[string]map[string]string{
+			groupBotBktName: {
+				"@Admins": `["@blah","@blah1"]`,
+				"@admins": `["@blah1","@blah2"]`,
+				"@DEVS":   `["@blah3"]`,
+			},
+			settingsBktName: {
+				"@Admins": `{"description":"legacy"}`,
+				"@admins": `{"description":"admins"}`,
+				"@DEVS":   `{"admins_only":true}`,
+			},
+			triggersBktName: {
+				"user:Blah": `2020-05-01T12:00:00Z`,
+			},
+		} {
+			chatBkt, err := tx.Bucket([]byte(bktName)).CreateBucketIfNotExists([]byte("foo"))
+			require.NoError(t, err)
+			for k, v := range kv {
+				require.NoError(t, chatBkt.Put([]byte(k), []byte(v)))
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, svc.db.Close())
+
+	svc, err = NewBoltDB(svc.fileName, bolt.Options{})
+	require.NoError(t, err)
+
+	groups, err := svc.GetGroups(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"@admins": {"@blah1", "@blah2", "@blah"}, "@devs": {"@blah3"}}, groups)
+
+	settings, err := svc.GetAllGroupSettings(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]GroupSettings{"@admins": {Description: "admins"}, "@devs": {AdminsOnly: true}}, settings)
+
+	at, err := svc.GetLastTrigger(context.Background(), "foo", "user:Blah")
+	require.NoError(t, err)
+	assert.False(t, at.IsZero(), "non-alias keys must be left as is")
+
+	users, err := svc.GetGroup(context.Background(), "foo", "@ADMINS")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah1", "@blah2", "@blah"}, users)
 }
 
 func TestBoltDB_Unique(t *testing.T) {
@@ -325,7 +372,7 @@ func TestBoltDB_Unique(t *testing.T) {
 func TestBoltDB_AddChat(t *testing.T) {
 	svc := prepareBoltDB(t)
 
-	err := svc.AddChat("qwerty")
+	err := svc.AddChat(context.Background(), "qwerty")
 	require.NoError(t, err)
 
 	err = svc.db.View(func(tx *bolt.Tx) error {
@@ -340,6 +387,273 @@ func TestBoltDB_AddChat(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestBoltDB_GroupSettings(t *testing.T) {
+	svc := prepareBoltDB(t)
+
+	settings, err := svc.GetGroupSettings(context.Background(), "foo", "@bar")
+	require.NoError(t, err)
+	assert.Equal(t, GroupSettings{}, settings)
+
+	err = svc.PutGroupSettings(context.Background(), "foo", "@bar", GroupSettings{AdminsOnly: true})
+	assert.Error(t, err, "settings of non-existing group must not be saved")
+
+	require.NoError(t, svc.PutGroup(context.Background(), "foo", "@bar", []string{"@blah"}))
+	require.NoError(t, svc.PutGroupSettings(context.Background(), "foo", "@bar", GroupSettings{AdminsOnly: true, Cooldown: time.Minute}))
+
+	settings, err = svc.GetGroupSettings(context.Background(), "foo", "@bar")
+	require.NoError(t, err)
+	assert.Equal(t, GroupSettings{AdminsOnly: true, Cooldown: time.Minute}, settings)
+
+	require.NoError(t, svc.DeleteGroup(context.Background(), "foo", "@bar"))
+
+	settings, err = svc.GetGroupSettings(context.Background(), "foo", "@bar")
+	require.NoError(t, err)
+	assert.Equal(t, GroupSettings{}, settings)
+}
+
+func TestBoltDB_LastTrigger(t *testing.T) {
+	svc := prepareBoltDB(t)
+
+	at, err := svc.GetLastTrigger(context.Background(), "foo", "@bar")
+	require.NoError(t, err)
+	assert.True(t, at.IsZero())
+
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, svc.PutLastTrigger(context.Background(), "foo", "@bar", now))
+	require.NoError(t, svc.PutLastTrigger(context.Background(), "foo", "user:1", now.Add(time.Minute)))
+
+	at, err = svc.GetLastTrigger(context.Background(), "foo", "@bar")
+	require.NoError(t, err)
+	assert.True(t, now.Equal(at))
+
+	at, err = svc.GetLastTrigger(context.Background(), "foo", "user:1")
+	require.NoError(t, err)
+	assert.True(t, now.Add(time.Minute).Equal(at))
+}
+
+func TestBoltDB_QuietHours(t *testing.T) {
+	svc := prepareBoltDB(t)
+
+	q, err := svc.GetQuietHours(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Empty(t, q)
+
+	chatQuiet := QuietHours{From: 22 * 60, To: 8 * 60, Location: "UTC"}
+	userQuiet := QuietHours{From: 23 * 60, To: 7 * 60, Location: "Asia/Almaty", Skip: true}
+
+	require.NoError(t, svc.PutQuietHours(context.Background(), "foo", ChatQuietHours, &chatQuiet))
+	require.NoError(t, svc.PutQuietHours(context.Background(), "foo", "@blah", &userQuiet))
+
+	q, err = svc.GetQuietHours(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]QuietHours{ChatQuietHours: chatQuiet, "@blah": userQuiet}, q)
+
+	require.NoError(t, svc.PutQuietHours(context.Background(), "foo", ChatQuietHours, nil))
+
+	q, err = svc.GetQuietHours(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]QuietHours{"@blah": userQuiet}, q)
+}
+
+func TestBoltDB_RenameGroup(t *testing.T) {
+	svc := prepareBoltDB(t)
+
+	require.NoError(t, svc.PutGroup(context.Background(), "foo", "@be", []string{"@blah", "@blah1"}))
+	require.NoError(t, svc.PutGroup(context.Background(), "foo", "@fe", []string{"@blah2"}))
+	require.NoError(t, svc.PutGroupSettings(context.Background(), "foo", "@be", GroupSettings{Description: "backend"}))
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, svc.PutLastTrigger(context.Background(), "foo", "@be", now))
+
+	assert.Error(t, svc.RenameGroup(context.Background(), "foo", "@be", "@fe"), "must not overwrite existing group")
+	assert.Error(t, svc.RenameGroup(context.Background(), "foo", "@unknown", "@backend"), "must not rename non-existing group")
+	assert.Error(t, svc.RenameGroup(context.Background(), "bar", "@be", "@backend"), "must not rename group in unknown chat")
+
+	require.NoError(t, svc.RenameGroup(context.Background(), "foo", "@be", "@backend"))
+
+	groups, err := svc.GetGroups(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"@backend": {"@blah", "@blah1"}, "@fe": {"@blah2"}}, groups)
+
+	settings, err := svc.GetAllGroupSettings(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]GroupSettings{"@backend": {Description: "backend"}}, settings)
+
+	at, err := svc.GetLastTrigger(context.Background(), "foo", "@backend")
+	require.NoError(t, err)
+	assert.True(t, now.Equal(at))
+
+	at, err = svc.GetLastTrigger(context.Background(), "foo", "@be")
+	require.NoError(t, err)
+	assert.True(t, at.IsZero())
+}
+
+func TestBoltDB_CopyGroup(t *testing.T) {
+	svc := prepareBoltDB(t)
+
+	require.NoError(t, svc.PutGroup(context.Background(), "foo", "@be", []string{"@blah", "@blah1"}))
+	require.NoError(t, svc.PutGroupSettings(context.Background(), "foo", "@be", GroupSettings{Description: "backend", AdminsOnly: true}))
+
+	require.NoError(t, svc.CopyGroup(context.Background(), "foo", "@be", "@backend"))
+	assert.Error(t, svc.CopyGroup(context.Background(), "foo", "@be", "@backend"), "must not overwrite existing group")
+
+	groups, err := svc.GetGroups(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"@backend": {"@blah", "@blah1"}, "@be": {"@blah", "@blah1"}}, groups)
+
+	settings, err := svc.GetAllGroupSettings(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]GroupSettings{
+		"@backend": {Description: "backend", AdminsOnly: true},
+		"@be":      {Description: "backend", AdminsOnly: true},
+	}, settings)
+}
+
+func TestBoltDB_Synonyms(t *testing.T) {
+	svc := prepareBoltDB(t)
+
+	require.NoError(t, svc.PutGroup(context.Background(), "foo", "@backend", []string{"@blah", "@blah1"}))
+	require.NoError(t, svc.PutGroup(context.Background(), "foo", "@frontend", []string{"@blah2"}))
+
+	assert.Error(t, svc.AddSynonym(context.Background(), "foo", "@unknown", "@be"), "group must exist")
+	assert.Error(t, svc.AddSynonym(context.Background(), "foo", "@backend", "@frontend"), "synonym must not be a group")
+
+	require.NoError(t, svc.AddSynonym(context.Background(), "foo", "@backend", "@BE"))
+	require.NoError(t, svc.AddSynonym(context.Background(), "foo", "@be", "@back_end"), "synonym of synonym is a synonym of the group")
+	require.NoError(t, svc.AddSynonym(context.Background(), "foo", "@frontend", "@fe"))
+
+	assert.Error(t, svc.AddSynonym(context.Background(), "foo", "@frontend", "@be"), "synonym must not be used twice")
+	assert.Error(t, svc.PutGroup(context.Background(), "foo", "@be", []string{"@blah3"}), "group must not shadow a synonym")
+	assert.Error(t, svc.CopyGroup(context.Background(), "foo", "@frontend", "@be"), "group must not shadow a synonym")
+
+	synonyms, err := svc.GetSynonyms(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"@backend": {"@back_end", "@be"}, "@frontend": {"@fe"}}, synonyms)
+
+	found, err := svc.FindAliases(context.Background(), "foo", []string{"@be", "@backend", "@fe"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"@backend": {"@blah", "@blah1"}, "@frontend": {"@blah2"}}, found)
+
+	_, err = svc.AddUsers(context.Background(), "foo", "@be", []string{"@blah3"})
+	require.NoError(t, err)
+	users, err := svc.GetGroup(context.Background(), "foo", "@back_end")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah", "@blah1", "@blah3"}, users)
+
+	require.NoError(t, svc.RenameGroup(context.Background(), "foo", "@backend", "@server"))
+	synonyms, err = svc.GetSynonyms(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"@server": {"@back_end", "@be"}, "@frontend": {"@fe"}}, synonyms)
+
+	require.NoError(t, svc.DeleteSynonym(context.Background(), "foo", "@back_end"))
+	assert.Error(t, svc.DeleteSynonym(context.Background(), "foo", "@back_end"))
+
+	require.NoError(t, svc.DeleteGroup(context.Background(), "foo", "@frontend"))
+	synonyms, err = svc.GetSynonyms(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"@server": {"@be"}}, synonyms)
+}
+
+func TestBoltDB_Errors(t *testing.T) {
+	svc := prepareBoltDB(t)
+
+	_, err := svc.GetGroups(context.Background(), "foo")
+	assert.True(t, errors.Is(err, ErrChatNotFound), err)
+	_, err = svc.GetGroup(context.Background(), "foo", "@bar")
+	assert.True(t, errors.Is(err, ErrChatNotFound), err)
+	_, err = svc.FindAliases(context.Background(), "foo", []string{"@bar"})
+	assert.True(t, errors.Is(err, ErrChatNotFound), err)
+	_, err = svc.AddUsers(context.Background(), "foo", "@bar", []string{"@blah"})
+	assert.True(t, errors.Is(err, ErrChatNotFound), err)
+	err = svc.DeleteGroup(context.Background(), "foo", "@bar")
+	assert.True(t, errors.Is(err, ErrChatNotFound), err)
+
+	require.NoError(t, svc.PutGroup(context.Background(), "foo", "@bar", []string{"@blah"}))
+	require.NoError(t, svc.PutGroup(context.Background(), "foo", "@baz", []string{"@blah"}))
+
+	_, err = svc.GetGroup(context.Background(), "foo", "@qux")
+	assert.True(t, errors.Is(err, ErrGroupNotFound), err)
+	_, err = svc.AddUsers(context.Background(), "foo", "@qux", []string{"@blah"})
+	assert.True(t, errors.Is(err, ErrGroupNotFound), err)
+	_, err = svc.DeleteUsers(context.Background(), "foo", "@qux", []string{"@blah"})
+	assert.True(t, errors.Is(err, ErrGroupNotFound), err)
+	err = svc.DeleteGroup(context.Background(), "foo", "@qux")
+	assert.True(t, errors.Is(err, ErrGroupNotFound), err)
+	err = svc.PutGroupSettings(context.Background(), "foo", "@qux", GroupSettings{})
+	assert.True(t, errors.Is(err, ErrGroupNotFound), err)
+	err = svc.RenameGroup(context.Background(), "foo", "@qux", "@quux")
+	assert.True(t, errors.Is(err, ErrGroupNotFound), err)
+
+	_, err = svc.DeleteUsers(context.Background(), "foo", "@bar", []string{"@blah1"})
+	assert.True(t, errors.Is(err, ErrUserNotInGroup), err)
+
+	err = svc.RenameGroup(context.Background(), "foo", "@bar", "@baz")
+	assert.True(t, errors.Is(err, ErrGroupExists), err)
+	err = svc.CopyGroup(context.Background(), "foo", "@bar", "@baz")
+	assert.True(t, errors.Is(err, ErrGroupExists), err)
+	require.NoError(t, svc.AddSynonym(context.Background(), "foo", "@bar", "@ba"))
+	err = svc.PutGroup(context.Background(), "foo", "@ba", []string{"@blah"})
+	assert.True(t, errors.Is(err, ErrGroupExists), err)
+
+	err = svc.DeleteSynonym(context.Background(), "foo", "@bz")
+	assert.True(t, errors.Is(err, ErrSynonymNotFound), err)
+}
+
+func TestBoltDB_LegacyDuplicates(t *testing.T) {
+	svc := prepareBoltDB(t)
+
+	// lists, saved by older versions, might contain duplicates
+	err := svc.db.Update(func(tx *bolt.Tx) error {
+		chat, err := tx.Bucket([]byte(groupBotBktName)).CreateBucket([]byte("foo"))
+		require.NoError(t, err)
+		j, err := json.Marshal([]string{"@blah", "@blah1", "@blah", "@blah2"})
+		require.NoError(t, err)
+		return chat.Put([]byte("@bar"), j)
+	})
+	require.NoError(t, err)
+
+	added, err := svc.AddUsers(context.Background(), "foo", "@bar", []string{"@blah2", "@blah3"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+
+	removed, err := svc.DeleteUsers(context.Background(), "foo", "@bar", []string{"@blah"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	users, err := svc.GetGroup(context.Background(), "foo", "@bar")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah1", "@blah2", "@blah3"}, users, "all occurrences are removed")
+}
+
+func TestBoltDB_ContextCanceled(t *testing.T) {
+	svc := prepareBoltDB(t)
+	require.NoError(t, svc.AddChat(context.Background(), "chat"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := svc.PutGroup(ctx, "chat", "@blah", []string{"@user"})
+	assert.True(t, errors.Is(err, context.Canceled), err)
+
+	_, err = svc.GetGroups(ctx, "chat")
+	assert.True(t, errors.Is(err, context.Canceled), err)
+
+	groups, err := svc.GetGroups(context.Background(), "chat")
+	require.NoError(t, err)
+	assert.Empty(t, groups, "canceled update must not be applied")
+}
+
+func TestBoltDB_Ping(t *testing.T) {
+	svc := prepareBoltDB(t)
+	assert.NoError(t, svc.Ping(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, svc.Ping(ctx))
+
+	require.NoError(t, svc.Close())
+	assert.Error(t, svc.Ping(context.Background()), "closed database is unreachable")
+}
+
 func prepareBoltDB(t *testing.T) *BoltDB {
 	loc, err := ioutil.TempDir("", "test_groups_multibot")
 	require.NoError(t, err, "failed to make temp dir")
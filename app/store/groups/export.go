@@ -0,0 +1,233 @@
+package groups
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Formats of exported documents
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// GroupSnapshot is the complete state of the group with its settings and synonyms
+type GroupSnapshot struct {
+	Alias    string
+	Members  []string
+	Settings GroupSettings
+	Synonyms []string
+}
+
+// Document is the portable representation of groups of the chat, that is
+// exported and imported as JSON or YAML
+type Document struct {
+	Chat   string          `json:"chat,omitempty" yaml:"chat,omitempty"` // id of the exported chat, informational only
+	Groups []DocumentGroup `json:"groups" yaml:"groups"`
+}
+
+// DocumentGroup describes a single group of the Document
+type DocumentGroup struct {
+	Alias       string   `json:"alias" yaml:"alias"`
+	Members     []string `json:"members" yaml:"members"`
+	Synonyms    []string `json:"synonyms,omitempty" yaml:"synonyms,omitempty"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	AdminsOnly  bool     `json:"admins_only,omitempty" yaml:"admins_only,omitempty"`
+	Cooldown    string   `json:"cooldown,omitempty" yaml:"cooldown,omitempty"` // duration, e.g. 10m
+}
+
+// ExportGroups returns snapshots of all groups of the chat, sorted by alias
+func ExportGroups(ctx context.Context, store Store, chatID string) ([]GroupSnapshot, error) {
+	grps, err := store.GetGroups(ctx, chatID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to export groups of chat %s", chatID)
+	}
+	settings, err := store.GetAllGroupSettings(ctx, chatID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to export groups of chat %s", chatID)
+	}
+	synonyms, err := store.GetSynonyms(ctx, chatID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to export groups of chat %s", chatID)
+	}
+
+	res := make([]GroupSnapshot, 0, len(grps))
+	for alias, members := range grps {
+		res = append(res, GroupSnapshot{
+			Alias:    alias,
+			Members:  members,
+			Settings: settings[alias],
+			Synonyms: synonyms[alias],
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Alias < res[j].Alias })
+	return res, nil
+}
+
+// NewDocument makes the document of the chat from snapshots of its groups
+func NewDocument(chatID string, snapshots []GroupSnapshot) Document {
+	doc := Document{Chat: chatID, Groups: make([]DocumentGroup, 0, len(snapshots))}
+	for _, s := range snapshots {
+		g := DocumentGroup{
+			Alias:       s.Alias,
+			Members:     s.Members,
+			Synonyms:    s.Synonyms,
+			Description: s.Settings.Description,
+			AdminsOnly:  s.Settings.AdminsOnly,
+		}
+		if s.Settings.Cooldown > 0 {
+			g.Cooldown = s.Settings.Cooldown.String()
+		}
+		doc.Groups = append(doc.Groups, g)
+	}
+	return doc
+}
+
+// Snapshots validates the document and returns snapshots of its groups with
+// normalized aliases, usernames without the prefix are prefixed with @
+func (d Document) Snapshots() ([]GroupSnapshot, error) {
+	used := make(map[string]string) // alias or synonym -> group, that uses it
+	use := func(alias, group string) error {
+		if err := ValidateAlias(alias); err != nil {
+			return errors.Wrapf(err, "invalid alias of group %s", group)
+		}
+		if other, ok := used[alias]; ok {
+			return errors.Errorf("alias %s of group %s is already used by group %s", alias, group, other)
+		}
+		used[alias] = group
+		return nil
+	}
+
+	res := make([]GroupSnapshot, 0, len(d.Groups))
+	for i, g := range d.Groups {
+		s := GroupSnapshot{
+			Alias: NormalizeAlias(g.Alias),
+			Settings: GroupSettings{
+				AdminsOnly:  g.AdminsOnly,
+				Description: g.Description,
+			},
+		}
+		if s.Alias == "" {
+			return nil, errors.Errorf("group #%d has no alias", i+1)
+		}
+		if err := use(s.Alias, s.Alias); err != nil {
+			return nil, err
+		}
+
+		for _, synonym := range g.Synonyms {
+			synonym = NormalizeAlias(synonym)
+			if err := use(synonym, s.Alias); err != nil {
+				return nil, err
+			}
+			s.Synonyms = append(s.Synonyms, synonym)
+		}
+
+		for _, member := range g.Members {
+			if member == "" || strings.ContainsAny(member, " \t\n") {
+				return nil, errors.Errorf("invalid username %q in group %s", member, s.Alias)
+			}
+			if !strings.HasPrefix(member, "@") {
+				member = "@" + member
+			}
+			s.Members = append(s.Members, member)
+		}
+		s.Members = unique(s.Members)
+		if len(s.Members) == 0 {
+			return nil, errors.Errorf("group %s has no members", s.Alias)
+		}
+
+		if g.Cooldown != "" {
+			cooldown, err := time.ParseDuration(g.Cooldown)
+			if err != nil || cooldown < 0 {
+				return nil, errors.Errorf("invalid cooldown %q of group %s", g.Cooldown, s.Alias)
+			}
+			s.Settings.Cooldown = cooldown
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// MarshalDocument encodes the document in the given format
+func MarshalDocument(doc Document, format string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(doc, "", "  ")
+		return data, errors.Wrap(err, "failed to marshal document to json")
+	case FormatYAML:
+		data, err := yaml.Marshal(doc)
+		return data, errors.Wrap(err, "failed to marshal document to yaml")
+	}
+	return nil, errors.Errorf("unknown format %q", format)
+}
+
+// UnmarshalDocument decodes the document, JSON documents are recognized by
+// the leading brace, anything else is parsed as YAML, unknown fields are not allowed
+func UnmarshalDocument(data []byte) (Document, error) {
+	var doc Document
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&doc); err != nil {
+			return Document{}, errors.Wrap(err, "failed to parse json document")
+		}
+		return doc, nil
+	}
+	if err := yaml.UnmarshalStrict(data, &doc); err != nil {
+		return Document{}, errors.Wrap(err, "failed to parse yaml document")
+	}
+	return doc, nil
+}
+
+// DiffSnapshots describes changes, that importing of incoming snapshots makes to
+// the current ones, a line per changed group, groups, that are not imported, are kept
+func DiffSnapshots(current, incoming []GroupSnapshot) []string {
+	existing := make(map[string]GroupSnapshot, len(current))
+	for _, s := range current {
+		existing[s.Alias] = s
+	}
+
+	var res []string
+	for _, s := range incoming {
+		old, ok := existing[s.Alias]
+		if !ok {
+			res = append(res, fmt.Sprintf("+ %s: %s", s.Alias, strings.Join(s.Members, ", ")))
+			continue
+		}
+
+		var changes []string
+		for _, u := range Subtract(s.Members, old.Members) {
+			changes = append(changes, "+"+u)
+		}
+		for _, u := range Subtract(old.Members, s.Members) {
+			changes = append(changes, "-"+u)
+		}
+		for _, syn := range Subtract(s.Synonyms, old.Synonyms) {
+			changes = append(changes, "synonym +"+syn)
+		}
+		for _, syn := range Subtract(old.Synonyms, s.Synonyms) {
+			changes = append(changes, "synonym -"+syn)
+		}
+		if s.Settings.Description != old.Settings.Description {
+			changes = append(changes, fmt.Sprintf("description %q", s.Settings.Description))
+		}
+		if s.Settings.AdminsOnly != old.Settings.AdminsOnly {
+			changes = append(changes, fmt.Sprintf("admins only %t", s.Settings.AdminsOnly))
+		}
+		if s.Settings.Cooldown != old.Settings.Cooldown {
+			changes = append(changes, fmt.Sprintf("cooldown %s", s.Settings.Cooldown))
+		}
+		if len(changes) > 0 {
+			res = append(res, fmt.Sprintf("~ %s: %s", s.Alias, strings.Join(changes, ", ")))
+		}
+	}
+	return res
+}
@@ -0,0 +1,95 @@
+package groups
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocument_RoundTrip(t *testing.T) {
+	snapshots := []GroupSnapshot{
+		{Alias: "@devs", Members: []string{"@blah", "@blah1"},
+			Settings: GroupSettings{AdminsOnly: true, Cooldown: 10 * time.Minute, Description: "backend team"},
+			Synonyms: []string{"@backend"}},
+		{Alias: "@qa", Members: []string{"@blah2"}},
+	}
+
+	for _, format := range []string{FormatJSON, FormatYAML} {
+		t.Run(format, func(t *testing.T) {
+			data, err := MarshalDocument(NewDocument("chat", snapshots), format)
+			require.NoError(t, err)
+
+			doc, err := UnmarshalDocument(data)
+			require.NoError(t, err)
+			assert.Equal(t, "chat", doc.Chat)
+			assert.Equal(t, "10m0s", doc.Groups[0].Cooldown)
+
+			res, err := doc.Snapshots()
+			require.NoError(t, err)
+			assert.Equal(t, snapshots, res)
+		})
+	}
+
+	_, err := MarshalDocument(Document{}, "xml")
+	assert.Error(t, err)
+}
+
+func TestDocument_Snapshots(t *testing.T) {
+	doc, err := UnmarshalDocument([]byte(`
+groups:
+  - alias: "@Devs"
+    members: [blah, "@blah1", blah]
+    synonyms: ["@Backend"]
+`))
+	require.NoError(t, err)
+	res, err := doc.Snapshots()
+	require.NoError(t, err)
+	assert.Equal(t, []GroupSnapshot{{Alias: "@devs", Members: []string{"@blah", "@blah1"}, Synonyms: []string{"@backend"}}}, res,
+		"aliases are normalized, members are prefixed and unique")
+
+	tbl := []struct {
+		doc string
+		err string
+	}{
+		{doc: `{"groups": [{"alias": "@devs", "members": ["@blah"], "unknown": 1}]}`, err: "unknown field"},
+		{doc: "groups:\n  - alias: '@devs'\n    members: ['@blah']\n    unknown: 1", err: "not found in type"},
+		{doc: `{"groups": [{"members": ["@blah"]}]}`, err: "group #1 has no alias"},
+		{doc: `{"groups": [{"alias": "devs", "members": ["@blah"]}]}`, err: "invalid alias of group devs: alias devs: alias must start with @"},
+		{doc: `{"groups": [{"alias": "@all", "members": ["@blah"]}]}`, err: "invalid alias of group @all: alias @all: alias is reserved"},
+		{doc: `{"groups": [{"alias": "@devs", "members": ["@blah"], "synonyms": ["@бэк енд"]}]}`, err: "invalid alias of group @devs"},
+		{doc: `{"groups": [{"alias": "@devs"}]}`, err: "group @devs has no members"},
+		{doc: `{"groups": [{"alias": "@devs", "members": ["@bl ah"]}]}`, err: `invalid username "@bl ah" in group @devs`},
+		{doc: `{"groups": [{"alias": "@devs", "members": ["@blah"], "cooldown": "soon"}]}`, err: `invalid cooldown "soon" of group @devs`},
+		{doc: `{"groups": [{"alias": "@devs", "members": ["@blah"]}, {"alias": "@qa", "members": ["@blah"], "synonyms": ["@Devs"]}]}`,
+			err: "alias @devs of group @qa is already used by group @devs"},
+	}
+	for _, tt := range tbl {
+		doc, err := UnmarshalDocument([]byte(tt.doc))
+		if err == nil {
+			_, err = doc.Snapshots()
+		}
+		require.Error(t, err, tt.doc)
+		assert.Contains(t, err.Error(), tt.err)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	current := []GroupSnapshot{
+		{Alias: "@devs", Members: []string{"@blah", "@blah1"}, Synonyms: []string{"@dev"}},
+		{Alias: "@qa", Members: []string{"@blah2"}},
+		{Alias: "@ops", Members: []string{"@blah3"}},
+	}
+	incoming := []GroupSnapshot{
+		{Alias: "@devs", Members: []string{"@blah1", "@blah4"}, Synonyms: []string{"@backend"},
+			Settings: GroupSettings{AdminsOnly: true, Cooldown: time.Minute, Description: "backend team"}},
+		{Alias: "@qa", Members: []string{"@blah2"}},
+		{Alias: "@fe", Members: []string{"@blah5", "@blah6"}},
+	}
+	assert.Equal(t, []string{
+		`~ @devs: +@blah4, -@blah, synonym +@backend, synonym -@dev, description "backend team", admins only true, cooldown 1m0s`,
+		"+ @fe: @blah5, @blah6",
+	}, DiffSnapshots(current, incoming))
+	assert.Empty(t, DiffSnapshots(current, current))
+}
@@ -0,0 +1,893 @@
+package groups
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Memory implements thread-safe store, that keeps groups in memory,
+// all data is lost after restart, so it is suitable only for tests
+type Memory struct {
+	mu         sync.RWMutex
+	groups     map[string]map[string][]string      // chat -> alias -> members
+	settings   map[string]map[string]GroupSettings // chat -> alias -> settings
+	triggers   map[string]map[string]time.Time     // chat -> subject -> last trigger
+	quietHours map[string]map[string]QuietHours    // chat -> subject -> quiet hours
+	synonyms   map[string]map[string]string        // chat -> synonym -> alias
+	audit      map[string][]AuditEntry             // chat -> entries in order of addition
+	tombstones map[string][]Tombstone              // chat -> tombstones in order of addition
+	lastID     int64                               // id of the last added tombstone
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		groups:     make(map[string]map[string][]string),
+		settings:   make(map[string]map[string]GroupSettings),
+		triggers:   make(map[string]map[string]time.Time),
+		quietHours: make(map[string]map[string]QuietHours),
+		synonyms:   make(map[string]map[string]string),
+		audit:      make(map[string][]AuditEntry),
+		tombstones: make(map[string][]Tombstone),
+	}
+}
+
+// CreateGroup creates the new group, fails with ErrGroupExists, if the group
+// or the synonym with the same alias exists
+func (m *Memory) CreateGroup(ctx context.Context, chatID string, alias string, users []string) error {
+	return m.putGroup(ctx, chatID, alias, users, false)
+}
+
+// PutGroup creates the group or replaces members of the existing one
+func (m *Memory) PutGroup(ctx context.Context, chatID string, alias string, users []string) error {
+	return m.putGroup(ctx, chatID, alias, users, true)
+}
+
+// putGroup saves the group with specified users, replacing the existing one only if allowed
+func (m *Memory) putGroup(ctx context.Context, chatID string, alias string, users []string, replace bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	alias = NormalizeAlias(alias)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if canonical := m.resolveSynonym(chatID, alias); canonical != alias {
+		return errors.Wrapf(
+			errors.Wrapf(ErrGroupExists, "alias is a synonym of group %s", canonical),
+			"failed to put group %s:%s", chatID, alias,
+		)
+	}
+
+	if m.groups[chatID] == nil {
+		m.groups[chatID] = make(map[string][]string)
+	}
+	oldMembers, ok := m.groups[chatID][alias]
+	if ok && !replace {
+		return errors.Wrapf(ErrGroupExists, "failed to put group %s:%s", chatID, alias)
+	}
+	m.groups[chatID][alias] = unique(users)
+	m.recordChange(ctx, AuditEntry{ChatID: chatID, Group: alias, OldMembers: oldMembers, NewMembers: m.groups[chatID][alias]})
+	m.keepTombstone(ctx, membersTombstone(chatID, alias, oldMembers, m.groups[chatID][alias], true))
+	return nil
+}
+
+// AddUsers adds users to the end of the specified group, skipping the ones, who are
+// already there, returns the number of actually added users
+func (m *Memory) AddUsers(ctx context.Context, chatID string, alias string, users []string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	alias = NormalizeAlias(alias)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alias = m.resolveSynonym(chatID, alias)
+	if err := m.checkGroupExists(chatID, alias); err != nil {
+		return 0, errors.Wrapf(err, "failed to add users to group %s:%s", chatID, alias)
+	}
+	oldMembers := m.groups[chatID][alias]
+	members := unique(append(copyUsers(oldMembers), users...))
+	m.groups[chatID][alias] = members
+	added := len(members) - len(oldMembers)
+	if added > 0 {
+		m.recordChange(ctx, AuditEntry{ChatID: chatID, Group: alias, OldMembers: oldMembers, NewMembers: members})
+	}
+	return added, nil
+}
+
+// GetGroup returns all users of the single group
+func (m *Memory) GetGroup(ctx context.Context, chatID string, alias string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	alias = NormalizeAlias(alias)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	alias = m.resolveSynonym(chatID, alias)
+	if err := m.checkGroupExists(chatID, alias); err != nil {
+		return nil, errors.Wrapf(err, "failed to get users of group %s:%s", chatID, alias)
+	}
+	return copyUsers(m.groups[chatID][alias]), nil
+}
+
+// GetGroups returns the list of groups by chatID in form map[group_alias][]users
+func (m *Memory) GetGroups(ctx context.Context, chatID string) (map[string][]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	chat, ok := m.groups[chatID]
+	if !ok {
+		return map[string][]string{}, errors.Wrapf(ErrChatNotFound, "failed to get groups of chat %s", chatID)
+	}
+	res := make(map[string][]string, len(chat))
+	for alias, users := range chat {
+		res[alias] = copyUsers(users)
+	}
+	return res, nil
+}
+
+// DeleteUsers removes users from the group, returns the number of actually removed ones
+func (m *Memory) DeleteUsers(ctx context.Context, chatID string, alias string, users []string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	alias = NormalizeAlias(alias)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alias = m.resolveSynonym(chatID, alias)
+	if err := m.checkGroupExists(chatID, alias); err != nil {
+		return 0, errors.Wrapf(err, "failed to delete users from group %s:%s", chatID, alias)
+	}
+
+	toDelete := make(map[string]struct{}, len(users))
+	for _, user := range users {
+		toDelete[user] = struct{}{}
+	}
+
+	members := m.groups[chatID][alias]
+	res := make([]string, 0, len(members))
+	for _, u := range members {
+		if _, ok := toDelete[u]; !ok {
+			res = append(res, u)
+		}
+	}
+	removed := len(members) - len(res)
+	if removed == 0 {
+		return 0, errors.Wrapf(ErrUserNotInGroup, "failed to delete users %v from group %s:%s", users, chatID, alias)
+	}
+	m.groups[chatID][alias] = res
+	m.recordChange(ctx, AuditEntry{ChatID: chatID, Group: alias, OldMembers: members, NewMembers: res})
+	m.keepTombstone(ctx, Tombstone{ChatID: chatID, Group: alias, Members: Subtract(members, res)})
+	return removed, nil
+}
+
+// DeleteGroup removes group from the store by given chatID
+func (m *Memory) DeleteGroup(ctx context.Context, chatID string, alias string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	alias = NormalizeAlias(alias)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alias = m.resolveSynonym(chatID, alias)
+	if err := m.checkGroupExists(chatID, alias); err != nil {
+		return errors.Wrapf(err, "failed to delete group %s:%s", chatID, alias)
+	}
+	members := m.groups[chatID][alias]
+	// settings and synonyms are gone with the group, so they are kept in the tombstone too
+	tombstone := Tombstone{ChatID: chatID, Group: alias, GroupDeleted: true, Members: members,
+		Settings: m.settings[chatID][alias], Synonyms: m.groupSynonyms(chatID, alias)}
+	delete(m.groups[chatID], alias)
+	delete(m.settings[chatID], alias)
+	delete(m.triggers[chatID], alias)
+	m.repointSynonyms(chatID, alias, "")
+	m.recordChange(ctx, AuditEntry{ChatID: chatID, Group: alias, OldMembers: members})
+	m.keepTombstone(ctx, tombstone)
+	return nil
+}
+
+// FindAliases looks for group aliases and their synonyms in the store
+// and returns members of groups, which aliases are present, by canonical aliases
+func (m *Memory) FindAliases(ctx context.Context, chatID string, aliases []string) (map[string][]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res := make(map[string][]string)
+	chat, ok := m.groups[chatID]
+	if !ok {
+		return res, errors.Wrapf(ErrChatNotFound, "error while looking for aliases of chat %s in memory", chatID)
+	}
+	for _, alias := range aliases {
+		alias = m.resolveSynonym(chatID, NormalizeAlias(alias))
+		if users, ok := chat[alias]; ok {
+			res[alias] = copyUsers(users)
+		}
+	}
+	return res, nil
+}
+
+// AddChat saves the chat in the store
+func (m *Memory) AddChat(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.groups[id] == nil {
+		m.groups[id] = make(map[string][]string)
+	}
+	return nil
+}
+
+// GetChats returns sorted ids of all chats, that were added or have groups
+func (m *Memory) GetChats(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res := make([]string, 0, len(m.groups))
+	for id := range m.groups {
+		res = append(res, id)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// RenameGroup changes the alias of the group with its settings, trigger state,
+// history and tombstones, fails if the group with new alias already exists
+func (m *Memory) RenameGroup(ctx context.Context, chatID string, oldAlias string, newAlias string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	oldAlias, newAlias = NormalizeAlias(oldAlias), NormalizeAlias(newAlias)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldAlias = m.resolveSynonym(chatID, oldAlias)
+	if err := m.checkMove(chatID, oldAlias, newAlias); err != nil {
+		return errors.Wrapf(err, "failed to rename group %s:%s to %s", chatID, oldAlias, newAlias)
+	}
+
+	m.groups[chatID][newAlias] = m.groups[chatID][oldAlias]
+	delete(m.groups[chatID], oldAlias)
+	if settings, ok := m.settings[chatID][oldAlias]; ok {
+		m.settings[chatID][newAlias] = settings
+		delete(m.settings[chatID], oldAlias)
+	}
+	if at, ok := m.triggers[chatID][oldAlias]; ok {
+		m.triggers[chatID][newAlias] = at
+		delete(m.triggers[chatID], oldAlias)
+	}
+	m.repointSynonyms(chatID, oldAlias, newAlias)
+	for i := range m.audit[chatID] {
+		if m.audit[chatID][i].Group == oldAlias {
+			m.audit[chatID][i].Group = newAlias
+		}
+	}
+	for i := range m.tombstones[chatID] {
+		if m.tombstones[chatID][i].Group == oldAlias {
+			m.tombstones[chatID][i].Group = newAlias
+		}
+	}
+	m.recordChange(ctx, AuditEntry{ChatID: chatID, Group: newAlias, Details: "from " + oldAlias})
+	return nil
+}
+
+// CopyGroup creates a new group with members and settings of the source group,
+// fails if the group with destination alias already exists
+func (m *Memory) CopyGroup(ctx context.Context, chatID string, srcAlias string, dstAlias string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	srcAlias, dstAlias = NormalizeAlias(srcAlias), NormalizeAlias(dstAlias)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	srcAlias = m.resolveSynonym(chatID, srcAlias)
+	if err := m.checkMove(chatID, srcAlias, dstAlias); err != nil {
+		return errors.Wrapf(err, "failed to copy group %s:%s to %s", chatID, srcAlias, dstAlias)
+	}
+
+	m.groups[chatID][dstAlias] = copyUsers(m.groups[chatID][srcAlias])
+	if settings, ok := m.settings[chatID][srcAlias]; ok {
+		m.settings[chatID][dstAlias] = settings
+	}
+	m.recordChange(ctx, AuditEntry{ChatID: chatID, Group: dstAlias, Details: "from " + srcAlias})
+	return nil
+}
+
+// AddSynonym makes the synonym an alternative alias of the group, fails if the
+// synonym is already used by any group
+func (m *Memory) AddSynonym(ctx context.Context, chatID string, alias string, synonym string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	alias, synonym = NormalizeAlias(alias), NormalizeAlias(synonym)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alias = m.resolveSynonym(chatID, alias)
+	if err := m.checkGroupExists(chatID, alias); err != nil {
+		return errors.Wrapf(err, "failed to add synonym %s to group %s:%s", synonym, chatID, alias)
+	}
+	if err := m.checkAliasFree(chatID, synonym); err != nil {
+		return errors.Wrapf(err, "failed to add synonym %s to group %s:%s", synonym, chatID, alias)
+	}
+
+	if m.synonyms[chatID] == nil {
+		m.synonyms[chatID] = make(map[string]string)
+	}
+	m.synonyms[chatID][synonym] = alias
+	m.recordChange(ctx, AuditEntry{ChatID: chatID, Group: alias, Details: synonym})
+	return nil
+}
+
+// DeleteSynonym removes the synonym of the group
+func (m *Memory) DeleteSynonym(ctx context.Context, chatID string, synonym string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	synonym = NormalizeAlias(synonym)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alias, ok := m.synonyms[chatID][synonym]
+	if !ok {
+		return errors.Wrapf(ErrSynonymNotFound, "failed to delete synonym %s:%s", chatID, synonym)
+	}
+	delete(m.synonyms[chatID], synonym)
+	m.recordChange(ctx, AuditEntry{ChatID: chatID, Group: alias, Details: synonym})
+	return nil
+}
+
+// GetSynonyms returns synonyms of all groups in the chat in form
+// map[group_alias][]synonyms, synonyms are sorted
+func (m *Memory) GetSynonyms(ctx context.Context, chatID string) (map[string][]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res := make(map[string][]string)
+	for synonym, alias := range m.synonyms[chatID] {
+		res[alias] = append(res[alias], synonym)
+	}
+	for alias := range res {
+		sort.Strings(res[alias])
+	}
+	return res, nil
+}
+
+// ImportGroups creates or replaces groups with their members, settings and synonyms
+// in a single transaction, fails with ErrGroupExists, if an alias or a synonym of
+// any imported group is used by another group, nothing is imported in that case
+func (m *Memory) ImportGroups(ctx context.Context, chatID string, snapshots []GroupSnapshot) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// changes are made on copies of the chat data, that replace the original ones
+	// only if everything is imported, so the failed import leaves no traces
+	grps, settings, synonyms := maps.Clone(m.groups[chatID]), maps.Clone(m.settings[chatID]), maps.Clone(m.synonyms[chatID])
+	if grps == nil {
+		grps = make(map[string][]string)
+	}
+	if settings == nil {
+		settings = make(map[string]GroupSettings)
+	}
+	if synonyms == nil {
+		synonyms = make(map[string]string)
+	}
+
+	// synonyms of imported groups are replaced, so the old ones are dropped first
+	for _, s := range snapshots {
+		for synonym, alias := range synonyms {
+			if alias == NormalizeAlias(s.Alias) {
+				delete(synonyms, synonym)
+			}
+		}
+	}
+
+	var (
+		entries    []AuditEntry
+		tombstones []Tombstone
+	)
+	for _, s := range snapshots {
+		alias := NormalizeAlias(s.Alias)
+		if canonical, ok := synonyms[alias]; ok {
+			return errors.Wrapf(
+				errors.Wrapf(ErrGroupExists, "alias is a synonym of group %s", canonical),
+				"failed to import group %s:%s", chatID, alias,
+			)
+		}
+		entries = append(entries, AuditEntry{ChatID: chatID, Group: alias, OldMembers: grps[alias], NewMembers: unique(s.Members)})
+		tombstones = append(tombstones, membersTombstone(chatID, alias, grps[alias], unique(s.Members), true))
+		grps[alias] = unique(s.Members)
+		settings[alias] = s.Settings
+
+		for _, synonym := range s.Synonyms {
+			synonym = NormalizeAlias(synonym)
+			if _, ok := grps[synonym]; ok {
+				return errors.Wrapf(ErrGroupExists, "failed to import synonym %s of group %s:%s", synonym, chatID, alias)
+			}
+			if canonical, ok := synonyms[synonym]; ok {
+				return errors.Wrapf(
+					errors.Wrapf(ErrGroupExists, "alias is a synonym of group %s", canonical),
+					"failed to import synonym %s of group %s:%s", synonym, chatID, alias,
+				)
+			}
+			synonyms[synonym] = alias
+		}
+	}
+
+	m.groups[chatID], m.settings[chatID], m.synonyms[chatID] = grps, settings, synonyms
+	for _, entry := range entries {
+		m.recordChange(ctx, entry)
+	}
+	for _, tombstone := range tombstones {
+		m.keepTombstone(ctx, tombstone)
+	}
+	return nil
+}
+
+// GetGroupSettings returns settings of the group, if the group has no
+// settings - returns empty ones
+func (m *Memory) GetGroupSettings(ctx context.Context, chatID string, alias string) (GroupSettings, error) {
+	if err := ctx.Err(); err != nil {
+		return GroupSettings{}, err
+	}
+	alias = NormalizeAlias(alias)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.settings[chatID][m.resolveSynonym(chatID, alias)], nil
+}
+
+// PutGroupSettings replaces settings of the group
+func (m *Memory) PutGroupSettings(ctx context.Context, chatID string, alias string, settings GroupSettings) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	alias = NormalizeAlias(alias)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alias = m.resolveSynonym(chatID, alias)
+	if err := m.checkGroupExists(chatID, alias); err != nil {
+		return errors.Wrapf(err, "failed to put settings of group %s:%s", chatID, alias)
+	}
+	if m.settings[chatID] == nil {
+		m.settings[chatID] = make(map[string]GroupSettings)
+	}
+	m.settings[chatID][alias] = settings
+	m.recordChange(ctx, AuditEntry{ChatID: chatID, Group: alias})
+	return nil
+}
+
+// GetAllGroupSettings returns settings of all groups in the chat, that have any,
+// in form map[group_alias]GroupSettings
+func (m *Memory) GetAllGroupSettings(ctx context.Context, chatID string) (map[string]GroupSettings, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res := make(map[string]GroupSettings)
+	for alias, settings := range m.settings[chatID] {
+		if settings != (GroupSettings{}) {
+			res[alias] = settings
+		}
+	}
+	return res, nil
+}
+
+// GetLastTrigger returns the last time, when the subject (group alias or user)
+// triggered a ping in the chat, zero time if never
+func (m *Memory) GetLastTrigger(ctx context.Context, chatID string, subject string) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.triggers[chatID][subject], nil
+}
+
+// PutLastTrigger saves the time, when the subject (group alias or user)
+// triggered a ping in the chat
+func (m *Memory) PutLastTrigger(ctx context.Context, chatID string, subject string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.triggers[chatID] == nil {
+		m.triggers[chatID] = make(map[string]time.Time)
+	}
+	m.triggers[chatID][subject] = at
+	return nil
+}
+
+// PutLastTriggerAfter saves the time, when the subject triggered a ping in the chat,
+// only if the cooldown has passed since the last trigger, otherwise fails with
+// ErrTriggerCooldown and returns the time, when the subject can trigger again
+func (m *Memory) PutLastTriggerAfter(ctx context.Context, chatID string, subject string, at time.Time,
+	cooldown time.Duration) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if last, ok := m.triggers[chatID][subject]; ok && at.Before(last.Add(cooldown)) {
+		return last.Add(cooldown), errors.Wrapf(ErrTriggerCooldown, "failed to put last trigger of %s:%s", chatID, subject)
+	}
+	if m.triggers[chatID] == nil {
+		m.triggers[chatID] = make(map[string]time.Time)
+	}
+	m.triggers[chatID][subject] = at
+	return time.Time{}, nil
+}
+
+// GetQuietHours returns all quiet hours of the chat and its members in form
+// map[subject]QuietHours, chat-wide quiet hours are stored by ChatQuietHours subject
+func (m *Memory) GetQuietHours(ctx context.Context, chatID string) (map[string]QuietHours, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res := make(map[string]QuietHours, len(m.quietHours[chatID]))
+	for subject, q := range m.quietHours[chatID] {
+		res[subject] = q
+	}
+	return res, nil
+}
+
+// PutQuietHours sets quiet hours of the subject (chat or user) in the chat,
+// nil quiet hours removes them
+func (m *Memory) PutQuietHours(ctx context.Context, chatID string, subject string, quietHours *QuietHours) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if quietHours == nil {
+		delete(m.quietHours[chatID], subject)
+		return nil
+	}
+	if m.quietHours[chatID] == nil {
+		m.quietHours[chatID] = make(map[string]QuietHours)
+	}
+	m.quietHours[chatID][subject] = *quietHours
+	return nil
+}
+
+// AddAuditEntry appends the entry to the audit log of the chat
+func (m *Memory) AddAuditEntry(ctx context.Context, entry AuditEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry.Group = NormalizeAlias(entry.Group)
+	m.appendAuditEntry(entry)
+	return nil
+}
+
+// GetAuditLog returns at most limit latest entries of the audit log of the group, the group
+// may be referred by its synonym, newest entries first, empty alias means all groups of the
+// chat, non-positive limit means no limit
+func (m *Memory) GetAuditLog(ctx context.Context, chatID string, alias string, limit int) ([]AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	alias = NormalizeAlias(alias)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if alias != "" {
+		alias = m.resolveSynonym(chatID, alias)
+	}
+	var res []AuditEntry
+	entries := m.audit[chatID]
+	for i := len(entries) - 1; i >= 0 && (limit <= 0 || len(res) < limit); i-- {
+		if alias == "" || entries[i].Group == alias {
+			entry := entries[i]
+			entry.OldMembers = copyUsers(entry.OldMembers)
+			entry.NewMembers = copyUsers(entry.NewMembers)
+			res = append(res, entry)
+		}
+	}
+	return res, nil
+}
+
+// PurgeAuditLog removes entries of the chat audit log, that were made before the given time
+func (m *Memory) PurgeAuditLog(ctx context.Context, chatID string, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := m.audit[chatID]
+	var rest []AuditEntry
+	for _, entry := range entries {
+		if !entry.At.Before(before) {
+			rest = append(rest, entry)
+		}
+	}
+	m.audit[chatID] = rest
+	return len(entries) - len(rest), nil
+}
+
+// AddTombstone saves the copy of the deleted group or removed members
+func (m *Memory) AddTombstone(ctx context.Context, tombstone Tombstone) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tombstone.Group = NormalizeAlias(tombstone.Group)
+	m.appendTombstone(tombstone)
+	return nil
+}
+
+// GetTombstones returns all tombstones of the chat, newest tombstones first
+func (m *Memory) GetTombstones(ctx context.Context, chatID string) ([]Tombstone, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var res []Tombstone
+	tombstones := m.tombstones[chatID]
+	for i := len(tombstones) - 1; i >= 0; i-- {
+		tombstone := tombstones[i]
+		tombstone.Members = copyUsers(tombstone.Members)
+		tombstone.Synonyms = copyUsers(tombstone.Synonyms)
+		res = append(res, tombstone)
+	}
+	return res, nil
+}
+
+// DeleteTombstone removes the tombstone, e.g. after the change was reverted
+func (m *Memory) DeleteTombstone(ctx context.Context, chatID string, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tombstones := m.tombstones[chatID]
+	for i := range tombstones {
+		if tombstones[i].ID == id {
+			m.tombstones[chatID] = append(tombstones[:i:i], tombstones[i+1:]...)
+			return nil
+		}
+	}
+	return errors.Wrapf(ErrTombstoneNotFound, "failed to delete tombstone %s:%d", chatID, id)
+}
+
+// RestoreTombstone reverts the change, kept in the tombstone with the same id, and removes the
+// tombstone: the deleted group is created with its settings and synonyms, removed members
+// are added back and replaced ones are put instead of the current members
+func (m *Memory) RestoreTombstone(ctx context.Context, chatID string, tombstone Tombstone) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	idx := -1
+	for i := range m.tombstones[chatID] {
+		if m.tombstones[chatID][i].ID == tombstone.ID {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return errors.Wrapf(ErrTombstoneNotFound, "failed to restore tombstone %s:%d", chatID, tombstone.ID)
+	}
+	// the stored copy is restored, as the group might be renamed since the tombstone was read
+	stored, alias := m.tombstones[chatID][idx], m.tombstones[chatID][idx].Group
+
+	// everything is checked before the first change, so the failed restore leaves no traces
+	var oldMembers []string
+	if stored.GroupDeleted {
+		for _, a := range append([]string{alias}, stored.Synonyms...) {
+			if err := m.checkAliasFree(chatID, a); err != nil {
+				return errors.Wrapf(err, "failed to restore group %s:%s", chatID, alias)
+			}
+		}
+	} else {
+		if err := m.checkGroupExists(chatID, alias); err != nil {
+			return errors.Wrapf(err, "failed to restore group %s:%s", chatID, alias)
+		}
+		oldMembers = m.groups[chatID][alias]
+	}
+
+	members := stored.Members
+	if !stored.GroupDeleted && !stored.Replaced {
+		members = append(copyUsers(oldMembers), stored.Members...)
+	}
+	if m.groups[chatID] == nil {
+		m.groups[chatID] = make(map[string][]string)
+	}
+	m.groups[chatID][alias] = unique(members)
+
+	if stored.GroupDeleted && stored.Settings != (GroupSettings{}) {
+		if m.settings[chatID] == nil {
+			m.settings[chatID] = make(map[string]GroupSettings)
+		}
+		m.settings[chatID][alias] = stored.Settings
+	}
+	for _, synonym := range stored.Synonyms {
+		if m.synonyms[chatID] == nil {
+			m.synonyms[chatID] = make(map[string]string)
+		}
+		m.synonyms[chatID][synonym] = alias
+	}
+
+	m.tombstones[chatID] = append(m.tombstones[chatID][:idx:idx], m.tombstones[chatID][idx+1:]...)
+	m.recordChange(ctx, AuditEntry{ChatID: chatID, Group: alias, OldMembers: oldMembers, NewMembers: m.groups[chatID][alias]})
+	return nil
+}
+
+// PurgeTombstones removes tombstones of the chat, that were made before the given time
+func (m *Memory) PurgeTombstones(ctx context.Context, chatID string, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tombstones := m.tombstones[chatID]
+	var rest []Tombstone
+	for _, tombstone := range tombstones {
+		if !tombstone.At.Before(before) {
+			rest = append(rest, tombstone)
+		}
+	}
+	m.tombstones[chatID] = rest
+	return len(tombstones) - len(rest), nil
+}
+
+// Ping checks, that the store is reachable, the memory store always is
+func (m *Memory) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// recordChange appends the entry to the audit log, if the context carries the change
+func (m *Memory) recordChange(ctx context.Context, entry AuditEntry) {
+	if entry, ok := changeEntry(ctx, entry); ok {
+		m.appendAuditEntry(entry)
+	}
+}
+
+// appendAuditEntry puts the copy of the entry to the end of the audit log of the chat
+func (m *Memory) appendAuditEntry(entry AuditEntry) {
+	entry.OldMembers = copyUsers(entry.OldMembers)
+	entry.NewMembers = copyUsers(entry.NewMembers)
+	m.audit[entry.ChatID] = append(m.audit[entry.ChatID], entry)
+}
+
+// keepTombstone saves the tombstone of removed data, if the context carries the change
+func (m *Memory) keepTombstone(ctx context.Context, tombstone Tombstone) {
+	if tombstone, ok := changeTombstone(ctx, tombstone); ok {
+		m.appendTombstone(tombstone)
+	}
+}
+
+// appendTombstone puts the copy of the tombstone with the next id to the tombstones of the chat
+func (m *Memory) appendTombstone(tombstone Tombstone) {
+	m.lastID++
+	tombstone.ID = m.lastID
+	tombstone.Members = copyUsers(tombstone.Members)
+	tombstone.Synonyms = copyUsers(tombstone.Synonyms)
+	m.tombstones[tombstone.ChatID] = append(m.tombstones[tombstone.ChatID], tombstone)
+}
+
+// checkGroupExists returns ErrChatNotFound or ErrGroupNotFound,
+// if the group with given alias does not exist
+func (m *Memory) checkGroupExists(chatID string, alias string) error {
+	chat, ok := m.groups[chatID]
+	if !ok {
+		return ErrChatNotFound
+	}
+	if _, ok = chat[alias]; !ok {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// checkAliasFree returns ErrGroupExists, if the alias is used by any group
+// or as a synonym of any group
+func (m *Memory) checkAliasFree(chatID string, alias string) error {
+	if _, ok := m.groups[chatID][alias]; ok {
+		return ErrGroupExists
+	}
+	if canonical := m.resolveSynonym(chatID, alias); canonical != alias {
+		return errors.Wrapf(ErrGroupExists, "alias is a synonym of group %s", canonical)
+	}
+	return nil
+}
+
+// checkMove checks, that the source group exists and the destination alias is free
+func (m *Memory) checkMove(chatID string, src string, dst string) error {
+	if err := m.checkGroupExists(chatID, src); err != nil {
+		return err
+	}
+	return m.checkAliasFree(chatID, dst)
+}
+
+// resolveSynonym returns the canonical alias of the group, if the given
+// alias is its synonym, otherwise returns alias as is
+func (m *Memory) resolveSynonym(chatID string, alias string) string {
+	if canonical, ok := m.synonyms[chatID][alias]; ok {
+		return canonical
+	}
+	return alias
+}
+
+// repointSynonyms makes synonyms of the group with alias from to point to the group
+// with alias to, if to is empty - removes synonyms
+func (m *Memory) repointSynonyms(chatID string, from string, to string) {
+	for synonym, alias := range m.synonyms[chatID] {
+		if alias != from {
+			continue
+		}
+		if to == "" {
+			delete(m.synonyms[chatID], synonym)
+			continue
+		}
+		m.synonyms[chatID][synonym] = to
+	}
+}
+
+// groupSynonyms returns sorted synonyms of the group
+func (m *Memory) groupSynonyms(chatID string, alias string) []string {
+	var res []string
+	for synonym, canonical := range m.synonyms[chatID] {
+		if canonical == alias {
+			res = append(res, synonym)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// copyUsers returns a copy of the members list, so the caller can't modify stored data
+func copyUsers(users []string) []string {
+	if users == nil {
+		return nil
+	}
+	return append([]string{}, users...)
+}
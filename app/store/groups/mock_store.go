@@ -2,20 +2,22 @@
 
 package groups
 
+import context "context"
 import mock "github.com/stretchr/testify/mock"
+import time "time"
 
 // MockStore is an autogenerated mock type for the Store type
 type MockStore struct {
 	mock.Mock
 }
 
-// AddChat provides a mock function with given fields: id
-func (_m *MockStore) AddChat(id string) error {
-	ret := _m.Called(id)
+// AddAuditEntry provides a mock function with given fields: ctx, entry
+func (_m *MockStore) AddAuditEntry(ctx context.Context, entry AuditEntry) error {
+	ret := _m.Called(ctx, entry)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string) error); ok {
-		r0 = rf(id)
+	if rf, ok := ret.Get(0).(func(context.Context, AuditEntry) error); ok {
+		r0 = rf(ctx, entry)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -23,13 +25,13 @@ func (_m *MockStore) AddChat(id string) error {
 	return r0
 }
 
-// AddUser provides a mock function with given fields: chatID, alias, user
-func (_m *MockStore) AddUser(chatID string, alias string, user string) error {
-	ret := _m.Called(chatID, alias, user)
+// AddChat provides a mock function with given fields: ctx, id
+func (_m *MockStore) AddChat(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string, string, string) error); ok {
-		r0 = rf(chatID, alias, user)
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -37,13 +39,13 @@ func (_m *MockStore) AddUser(chatID string, alias string, user string) error {
 	return r0
 }
 
-// DeleteGroup provides a mock function with given fields: chatID, alias
-func (_m *MockStore) DeleteGroup(chatID string, alias string) error {
-	ret := _m.Called(chatID, alias)
+// AddSynonym provides a mock function with given fields: ctx, chatID, alias, synonym
+func (_m *MockStore) AddSynonym(ctx context.Context, chatID string, alias string, synonym string) error {
+	ret := _m.Called(ctx, chatID, alias, synonym)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string, string) error); ok {
-		r0 = rf(chatID, alias)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) error); ok {
+		r0 = rf(ctx, chatID, alias, synonym)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -51,13 +53,13 @@ func (_m *MockStore) DeleteGroup(chatID string, alias string) error {
 	return r0
 }
 
-// DeleteUserFromGroup provides a mock function with given fields: chatID, alias, user
-func (_m *MockStore) DeleteUserFromGroup(chatID string, alias string, user string) error {
-	ret := _m.Called(chatID, alias, user)
+// AddTombstone provides a mock function with given fields: ctx, tombstone
+func (_m *MockStore) AddTombstone(ctx context.Context, tombstone Tombstone) error {
+	ret := _m.Called(ctx, tombstone)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string, string, string) error); ok {
-		r0 = rf(chatID, alias, user)
+	if rf, ok := ret.Get(0).(func(context.Context, Tombstone) error); ok {
+		r0 = rf(ctx, tombstone)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -65,13 +67,194 @@ func (_m *MockStore) DeleteUserFromGroup(chatID string, alias string, user strin
 	return r0
 }
 
-// FindAliases provides a mock function with given fields: chatID, aliases
-func (_m *MockStore) FindAliases(chatID string, aliases []string) ([]string, error) {
-	ret := _m.Called(chatID, aliases)
+// AddUsers provides a mock function with given fields: ctx, chatID, alias, users
+func (_m *MockStore) AddUsers(ctx context.Context, chatID string, alias string, users []string) (int, error) {
+	ret := _m.Called(ctx, chatID, alias, users)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, []string) int); ok {
+		r0 = rf(ctx, chatID, alias, users)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, []string) error); ok {
+		r1 = rf(ctx, chatID, alias, users)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CopyGroup provides a mock function with given fields: ctx, chatID, srcAlias, dstAlias
+func (_m *MockStore) CopyGroup(ctx context.Context, chatID string, srcAlias string, dstAlias string) error {
+	ret := _m.Called(ctx, chatID, srcAlias, dstAlias)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) error); ok {
+		r0 = rf(ctx, chatID, srcAlias, dstAlias)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateGroup provides a mock function with given fields: ctx, chatID, alias, users
+func (_m *MockStore) CreateGroup(ctx context.Context, chatID string, alias string, users []string) error {
+	ret := _m.Called(ctx, chatID, alias, users)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, []string) error); ok {
+		r0 = rf(ctx, chatID, alias, users)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteGroup provides a mock function with given fields: ctx, chatID, alias
+func (_m *MockStore) DeleteGroup(ctx context.Context, chatID string, alias string) error {
+	ret := _m.Called(ctx, chatID, alias)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, chatID, alias)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteSynonym provides a mock function with given fields: ctx, chatID, synonym
+func (_m *MockStore) DeleteSynonym(ctx context.Context, chatID string, synonym string) error {
+	ret := _m.Called(ctx, chatID, synonym)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, chatID, synonym)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteTombstone provides a mock function with given fields: ctx, chatID, id
+func (_m *MockStore) DeleteTombstone(ctx context.Context, chatID string, id int64) error {
+	ret := _m.Called(ctx, chatID, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) error); ok {
+		r0 = rf(ctx, chatID, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteUsers provides a mock function with given fields: ctx, chatID, alias, users
+func (_m *MockStore) DeleteUsers(ctx context.Context, chatID string, alias string, users []string) (int, error) {
+	ret := _m.Called(ctx, chatID, alias, users)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, []string) int); ok {
+		r0 = rf(ctx, chatID, alias, users)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, []string) error); ok {
+		r1 = rf(ctx, chatID, alias, users)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindAliases provides a mock function with given fields: ctx, chatID, aliases
+func (_m *MockStore) FindAliases(ctx context.Context, chatID string, aliases []string) (map[string][]string, error) {
+	ret := _m.Called(ctx, chatID, aliases)
+
+	var r0 map[string][]string
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) map[string][]string); ok {
+		r0 = rf(ctx, chatID, aliases)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string][]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, []string) error); ok {
+		r1 = rf(ctx, chatID, aliases)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAllGroupSettings provides a mock function with given fields: ctx, chatID
+func (_m *MockStore) GetAllGroupSettings(ctx context.Context, chatID string) (map[string]GroupSettings, error) {
+	ret := _m.Called(ctx, chatID)
+
+	var r0 map[string]GroupSettings
+	if rf, ok := ret.Get(0).(func(context.Context, string) map[string]GroupSettings); ok {
+		r0 = rf(ctx, chatID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]GroupSettings)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, chatID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAuditLog provides a mock function with given fields: ctx, chatID, alias, limit
+func (_m *MockStore) GetAuditLog(ctx context.Context, chatID string, alias string, limit int) ([]AuditEntry, error) {
+	ret := _m.Called(ctx, chatID, alias, limit)
+
+	var r0 []AuditEntry
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int) []AuditEntry); ok {
+		r0 = rf(ctx, chatID, alias, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]AuditEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int) error); ok {
+		r1 = rf(ctx, chatID, alias, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetChats provides a mock function with given fields: ctx
+func (_m *MockStore) GetChats(ctx context.Context) ([]string, error) {
+	ret := _m.Called(ctx)
 
 	var r0 []string
-	if rf, ok := ret.Get(0).(func(string, []string) []string); ok {
-		r0 = rf(chatID, aliases)
+	if rf, ok := ret.Get(0).(func(context.Context) []string); ok {
+		r0 = rf(ctx)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]string)
@@ -79,8 +262,8 @@ func (_m *MockStore) FindAliases(chatID string, aliases []string) ([]string, err
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string, []string) error); ok {
-		r1 = rf(chatID, aliases)
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -88,13 +271,13 @@ func (_m *MockStore) FindAliases(chatID string, aliases []string) ([]string, err
 	return r0, r1
 }
 
-// GetGroup provides a mock function with given fields: chatID, alias
-func (_m *MockStore) GetGroup(chatID string, alias string) ([]string, error) {
-	ret := _m.Called(chatID, alias)
+// GetGroup provides a mock function with given fields: ctx, chatID, alias
+func (_m *MockStore) GetGroup(ctx context.Context, chatID string, alias string) ([]string, error) {
+	ret := _m.Called(ctx, chatID, alias)
 
 	var r0 []string
-	if rf, ok := ret.Get(0).(func(string, string) []string); ok {
-		r0 = rf(chatID, alias)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) []string); ok {
+		r0 = rf(ctx, chatID, alias)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]string)
@@ -102,8 +285,73 @@ func (_m *MockStore) GetGroup(chatID string, alias string) ([]string, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string, string) error); ok {
-		r1 = rf(chatID, alias)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, chatID, alias)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetGroupSettings provides a mock function with given fields: ctx, chatID, alias
+func (_m *MockStore) GetGroupSettings(ctx context.Context, chatID string, alias string) (GroupSettings, error) {
+	ret := _m.Called(ctx, chatID, alias)
+
+	var r0 GroupSettings
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) GroupSettings); ok {
+		r0 = rf(ctx, chatID, alias)
+	} else {
+		r0 = ret.Get(0).(GroupSettings)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, chatID, alias)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetGroups provides a mock function with given fields: ctx, chatID
+func (_m *MockStore) GetGroups(ctx context.Context, chatID string) (map[string][]string, error) {
+	ret := _m.Called(ctx, chatID)
+
+	var r0 map[string][]string
+	if rf, ok := ret.Get(0).(func(context.Context, string) map[string][]string); ok {
+		r0 = rf(ctx, chatID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string][]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, chatID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLastTrigger provides a mock function with given fields: ctx, chatID, subject
+func (_m *MockStore) GetLastTrigger(ctx context.Context, chatID string, subject string) (time.Time, error) {
+	ret := _m.Called(ctx, chatID, subject)
+
+	var r0 time.Time
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) time.Time); ok {
+		r0 = rf(ctx, chatID, subject)
+	} else {
+		r0 = ret.Get(0).(time.Time)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, chatID, subject)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -111,13 +359,36 @@ func (_m *MockStore) GetGroup(chatID string, alias string) ([]string, error) {
 	return r0, r1
 }
 
-// GetGroups provides a mock function with given fields: chatID
-func (_m *MockStore) GetGroups(chatID string) (map[string][]string, error) {
-	ret := _m.Called(chatID)
+// GetQuietHours provides a mock function with given fields: ctx, chatID
+func (_m *MockStore) GetQuietHours(ctx context.Context, chatID string) (map[string]QuietHours, error) {
+	ret := _m.Called(ctx, chatID)
+
+	var r0 map[string]QuietHours
+	if rf, ok := ret.Get(0).(func(context.Context, string) map[string]QuietHours); ok {
+		r0 = rf(ctx, chatID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]QuietHours)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, chatID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSynonyms provides a mock function with given fields: ctx, chatID
+func (_m *MockStore) GetSynonyms(ctx context.Context, chatID string) (map[string][]string, error) {
+	ret := _m.Called(ctx, chatID)
 
 	var r0 map[string][]string
-	if rf, ok := ret.Get(0).(func(string) map[string][]string); ok {
-		r0 = rf(chatID)
+	if rf, ok := ret.Get(0).(func(context.Context, string) map[string][]string); ok {
+		r0 = rf(ctx, chatID)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(map[string][]string)
@@ -125,8 +396,164 @@ func (_m *MockStore) GetGroups(chatID string) (map[string][]string, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(chatID)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, chatID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTombstones provides a mock function with given fields: ctx, chatID
+func (_m *MockStore) GetTombstones(ctx context.Context, chatID string) ([]Tombstone, error) {
+	ret := _m.Called(ctx, chatID)
+
+	var r0 []Tombstone
+	if rf, ok := ret.Get(0).(func(context.Context, string) []Tombstone); ok {
+		r0 = rf(ctx, chatID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]Tombstone)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, chatID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ImportGroups provides a mock function with given fields: ctx, chatID, snapshots
+func (_m *MockStore) ImportGroups(ctx context.Context, chatID string, snapshots []GroupSnapshot) error {
+	ret := _m.Called(ctx, chatID, snapshots)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []GroupSnapshot) error); ok {
+		r0 = rf(ctx, chatID, snapshots)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Ping provides a mock function with given fields: ctx
+func (_m *MockStore) Ping(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// PurgeAuditLog provides a mock function with given fields: ctx, chatID, before
+func (_m *MockStore) PurgeAuditLog(ctx context.Context, chatID string, before time.Time) (int, error) {
+	ret := _m.Called(ctx, chatID, before)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) int); ok {
+		r0 = rf(ctx, chatID, before)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, chatID, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PurgeTombstones provides a mock function with given fields: ctx, chatID, before
+func (_m *MockStore) PurgeTombstones(ctx context.Context, chatID string, before time.Time) (int, error) {
+	ret := _m.Called(ctx, chatID, before)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) int); ok {
+		r0 = rf(ctx, chatID, before)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, chatID, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PutGroup provides a mock function with given fields: ctx, chatID, alias, users
+func (_m *MockStore) PutGroup(ctx context.Context, chatID string, alias string, users []string) error {
+	ret := _m.Called(ctx, chatID, alias, users)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, []string) error); ok {
+		r0 = rf(ctx, chatID, alias, users)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// PutGroupSettings provides a mock function with given fields: ctx, chatID, alias, settings
+func (_m *MockStore) PutGroupSettings(ctx context.Context, chatID string, alias string, settings GroupSettings) error {
+	ret := _m.Called(ctx, chatID, alias, settings)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, GroupSettings) error); ok {
+		r0 = rf(ctx, chatID, alias, settings)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// PutLastTrigger provides a mock function with given fields: ctx, chatID, subject, at
+func (_m *MockStore) PutLastTrigger(ctx context.Context, chatID string, subject string, at time.Time) error {
+	ret := _m.Called(ctx, chatID, subject, at)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time) error); ok {
+		r0 = rf(ctx, chatID, subject, at)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// PutLastTriggerAfter provides a mock function with given fields: ctx, chatID, subject, at, cooldown
+func (_m *MockStore) PutLastTriggerAfter(ctx context.Context, chatID string, subject string, at time.Time, cooldown time.Duration) (time.Time, error) {
+	ret := _m.Called(ctx, chatID, subject, at, cooldown)
+
+	var r0 time.Time
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time, time.Duration) time.Time); ok {
+		r0 = rf(ctx, chatID, subject, at, cooldown)
+	} else {
+		r0 = ret.Get(0).(time.Time)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, time.Time, time.Duration) error); ok {
+		r1 = rf(ctx, chatID, subject, at, cooldown)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -134,13 +561,41 @@ func (_m *MockStore) GetGroups(chatID string) (map[string][]string, error) {
 	return r0, r1
 }
 
-// PutGroup provides a mock function with given fields: chatID, alias, users
-func (_m *MockStore) PutGroup(chatID string, alias string, users []string) error {
-	ret := _m.Called(chatID, alias, users)
+// PutQuietHours provides a mock function with given fields: ctx, chatID, subject, quietHours
+func (_m *MockStore) PutQuietHours(ctx context.Context, chatID string, subject string, quietHours *QuietHours) error {
+	ret := _m.Called(ctx, chatID, subject, quietHours)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *QuietHours) error); ok {
+		r0 = rf(ctx, chatID, subject, quietHours)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RenameGroup provides a mock function with given fields: ctx, chatID, oldAlias, newAlias
+func (_m *MockStore) RenameGroup(ctx context.Context, chatID string, oldAlias string, newAlias string) error {
+	ret := _m.Called(ctx, chatID, oldAlias, newAlias)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) error); ok {
+		r0 = rf(ctx, chatID, oldAlias, newAlias)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RestoreTombstone provides a mock function with given fields: ctx, chatID, tombstone
+func (_m *MockStore) RestoreTombstone(ctx context.Context, chatID string, tombstone Tombstone) error {
+	ret := _m.Called(ctx, chatID, tombstone)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string, string, []string) error); ok {
-		r0 = rf(chatID, alias, users)
+	if rf, ok := ret.Get(0).(func(context.Context, string, Tombstone) error); ok {
+		r0 = rf(ctx, chatID, tombstone)
 	} else {
 		r0 = ret.Error(0)
 	}
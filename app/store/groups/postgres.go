@@ -0,0 +1,161 @@
+package groups
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	// registers postgres driver
+	_ "github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// postgresMigrationsLock is a key of the advisory lock, that prevents
+// several instances of the bot from migrating the database simultaneously
+const postgresMigrationsLock = 6_174_862_031
+
+// postgresMigrations describe the schema of the database, migrations are applied
+// in order, the number of applied ones is kept in the schema_version table,
+// so the new migration must be appended to the end of the list
+var postgresMigrations = []string{
+	`CREATE TABLE chats (
+		id TEXT PRIMARY KEY
+	);
+	CREATE TABLE user_groups (
+		id          BIGSERIAL PRIMARY KEY,
+		chat_id     TEXT      NOT NULL REFERENCES chats (id) ON DELETE CASCADE,
+		alias       TEXT      NOT NULL,
+		admins_only BOOLEAN   NOT NULL DEFAULT FALSE,
+		cooldown    BIGINT    NOT NULL DEFAULT 0,
+		description TEXT      NOT NULL DEFAULT '',
+		UNIQUE (chat_id, alias)
+	);
+	CREATE TABLE members (
+		group_id BIGINT  NOT NULL REFERENCES user_groups (id) ON DELETE CASCADE,
+		username TEXT    NOT NULL,
+		position INTEGER NOT NULL,
+		PRIMARY KEY (group_id, username)
+	);
+	CREATE INDEX members_position ON members (group_id, position);
+	CREATE INDEX members_username ON members (username);
+	CREATE TABLE synonyms (
+		chat_id  TEXT   NOT NULL REFERENCES chats (id) ON DELETE CASCADE,
+		synonym  TEXT   NOT NULL,
+		group_id BIGINT NOT NULL REFERENCES user_groups (id) ON DELETE CASCADE,
+		PRIMARY KEY (chat_id, synonym)
+	);
+	CREATE INDEX synonyms_group ON synonyms (group_id);
+	CREATE TABLE triggers (
+		chat_id TEXT NOT NULL REFERENCES chats (id) ON DELETE CASCADE,
+		subject TEXT NOT NULL,
+		at      TEXT NOT NULL,
+		PRIMARY KEY (chat_id, subject)
+	);
+	CREATE TABLE quiet_hours (
+		chat_id     TEXT    NOT NULL REFERENCES chats (id) ON DELETE CASCADE,
+		subject     TEXT    NOT NULL,
+		from_minute INTEGER NOT NULL,
+		to_minute   INTEGER NOT NULL,
+		location    TEXT    NOT NULL,
+		skip        BOOLEAN NOT NULL,
+		PRIMARY KEY (chat_id, subject)
+	);`,
+	// audit log is append-only and outlives groups, members are JSON lists, time is in unix nanoseconds
+	`CREATE TABLE audit_log (
+		id          BIGSERIAL PRIMARY KEY,
+		chat_id     TEXT      NOT NULL,
+		group_alias TEXT      NOT NULL,
+		actor       TEXT      NOT NULL,
+		action      TEXT      NOT NULL,
+		details     TEXT      NOT NULL,
+		old_members TEXT      NOT NULL,
+		new_members TEXT      NOT NULL,
+		at          BIGINT    NOT NULL
+	);
+	CREATE INDEX audit_log_group ON audit_log (chat_id, group_alias, id);
+	CREATE INDEX audit_log_at ON audit_log (chat_id, at);`,
+	// tombstones are kept as JSON documents, time is in unix nanoseconds
+	`CREATE TABLE tombstones (
+		id      BIGSERIAL PRIMARY KEY,
+		chat_id TEXT      NOT NULL,
+		at      BIGINT    NOT NULL,
+		data    TEXT      NOT NULL
+	);
+	CREATE INDEX tombstones_at ON tombstones (chat_id, at);`,
+}
+
+// PostgresOptions describes settings of the connection pool
+type PostgresOptions struct {
+	MaxOpenConns    int           // maximal number of open connections, 0 means unlimited
+	MaxIdleConns    int           // maximal number of idle connections, 0 means the default one
+	ConnMaxLifetime time.Duration // maximal time a connection may be reused, 0 means unlimited
+}
+
+// Postgres implements store to put and get groups with specific alias in the postgres
+// database, so several instances of the bot are able to share the same data
+type Postgres struct {
+	*sqlStore
+}
+
+// NewPostgres connects to the postgres database by the given url and brings its schema up to date
+func NewPostgres(connURL string, opts PostgresOptions) (*Postgres, error) {
+	log.Print("[INFO] groups.Postgres instantiated")
+	db, err := sql.Open("postgres", connURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open postgres connection")
+	}
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	if opts.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+
+	if err = migratePostgres(db); err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "failed to migrate postgres")
+	}
+	return &Postgres{sqlStore: &sqlStore{
+		db:      db,
+		dialect: sqlDialect{numberedParams: true, lockRows: " FOR UPDATE"},
+	}}, nil
+}
+
+// migratePostgres applies all migrations, that were not applied yet
+func migratePostgres(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	if _, err = tx.Exec(`SELECT pg_advisory_xact_lock($1)`, postgresMigrationsLock); err != nil {
+		return errors.Wrap(err, "failed to acquire migrations lock")
+	}
+
+	if _, err = tx.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return errors.Wrap(err, "failed to create schema version table")
+	}
+
+	var version int
+	err = tx.QueryRow(`SELECT version FROM schema_version`).Scan(&version)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if _, err = tx.Exec(`INSERT INTO schema_version (version) VALUES (0)`); err != nil {
+			return errors.Wrap(err, "failed to init schema version")
+		}
+	case err != nil:
+		return errors.Wrap(err, "failed to get schema version")
+	}
+
+	for ; version < len(postgresMigrations); version++ {
+		if _, err = tx.Exec(postgresMigrations[version]); err != nil {
+			return errors.Wrapf(err, "failed to apply migration #%d", version+1)
+		}
+		if _, err = tx.Exec(`UPDATE schema_version SET version = $1`, version+1); err != nil {
+			return errors.Wrapf(err, "failed to set schema version %d", version+1)
+		}
+		log.Printf("[INFO] postgres migration #%d applied", version+1)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,78 @@
+package groups
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ChatQuietHours is a subject of quiet hours, that are applied to the whole chat
+const ChatQuietHours = ""
+
+// QuietHours describes a daily interval, during which members must not be pinged
+type QuietHours struct {
+	From     int    `json:"from"`           // minutes since midnight
+	To       int    `json:"to"`             // minutes since midnight, might be less than From if interval passes midnight
+	Location string `json:"location"`       // IANA time zone name, e.g. Europe/Berlin
+	Skip     bool   `json:"skip,omitempty"` // leave mentions out instead of deferring them
+}
+
+// ParseQuietHours parses the interval in format 22:00-08:00 in the given time zone
+func ParseQuietHours(interval string, location string) (QuietHours, error) {
+	if _, err := time.LoadLocation(location); err != nil {
+		return QuietHours{}, errors.Wrapf(err, "invalid time zone %q", location)
+	}
+
+	bounds := strings.Split(interval, "-")
+	if len(bounds) != 2 {
+		return QuietHours{}, errors.Errorf("invalid interval %q, must be in format 22:00-08:00", interval)
+	}
+
+	var res = QuietHours{Location: location}
+	for i, ptr := range []*int{&res.From, &res.To} {
+		t, err := time.Parse("15:04", bounds[i])
+		if err != nil {
+			return QuietHours{}, errors.Wrapf(err, "invalid interval %q, must be in format 22:00-08:00", interval)
+		}
+		*ptr = t.Hour()*60 + t.Minute()
+	}
+
+	if res.From == res.To {
+		return QuietHours{}, errors.Errorf("invalid interval %q, bounds must differ", interval)
+	}
+
+	return res, nil
+}
+
+// Active checks whether the given time is inside quiet hours and, if so,
+// returns the time when quiet hours end
+func (q QuietHours) Active(t time.Time) (bool, time.Time) {
+	loc, err := time.LoadLocation(q.Location)
+	if err != nil {
+		loc = time.UTC
+	}
+	lt := t.In(loc)
+	minutes := lt.Hour()*60 + lt.Minute()
+	end := time.Date(lt.Year(), lt.Month(), lt.Day(), q.To/60, q.To%60, 0, 0, loc)
+
+	switch {
+	case q.From < q.To && minutes >= q.From && minutes < q.To:
+		return true, end
+	case q.From > q.To && minutes >= q.From:
+		return true, end.AddDate(0, 0, 1)
+	case q.From > q.To && minutes < q.To:
+		return true, end
+	}
+	return false, time.Time{}
+}
+
+// String returns quiet hours in human-readable format
+func (q QuietHours) String() string {
+	mode := "deferring mentions"
+	if q.Skip {
+		mode = "skipping mentions"
+	}
+	return fmt.Sprintf("%02d:%02d-%02d:%02d %s, %s", q.From/60, q.From%60, q.To/60, q.To%60, q.Location, mode)
+}
@@ -0,0 +1,73 @@
+package groups
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	q, err := ParseQuietHours("22:30-08:00", "Asia/Almaty")
+	require.NoError(t, err)
+	assert.Equal(t, QuietHours{From: 22*60 + 30, To: 8 * 60, Location: "Asia/Almaty"}, q)
+	assert.Equal(t, "22:30-08:00 Asia/Almaty, deferring mentions", q.String())
+
+	_, err = ParseQuietHours("22:30", "UTC")
+	assert.Error(t, err)
+
+	_, err = ParseQuietHours("22:30-25:00", "UTC")
+	assert.Error(t, err)
+
+	_, err = ParseQuietHours("22:30-22:30", "UTC")
+	assert.Error(t, err)
+
+	_, err = ParseQuietHours("22:30-08:00", "Mars/Olympus")
+	assert.Error(t, err)
+}
+
+func TestQuietHours_Active(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	tbl := []struct {
+		q      QuietHours
+		t      time.Time
+		active bool
+		end    time.Time
+	}{
+		{
+			q:      QuietHours{From: 22 * 60, To: 8 * 60, Location: "Europe/Berlin"},
+			t:      time.Date(2020, 5, 1, 23, 0, 0, 0, berlin),
+			active: true,
+			end:    time.Date(2020, 5, 2, 8, 0, 0, 0, berlin),
+		},
+		{
+			q:      QuietHours{From: 22 * 60, To: 8 * 60, Location: "Europe/Berlin"},
+			t:      time.Date(2020, 5, 1, 5, 0, 0, 0, berlin),
+			active: true,
+			end:    time.Date(2020, 5, 1, 8, 0, 0, 0, berlin),
+		},
+		{
+			q: QuietHours{From: 22 * 60, To: 8 * 60, Location: "Europe/Berlin"},
+			t: time.Date(2020, 5, 1, 12, 0, 0, 0, berlin),
+		},
+		{
+			q:      QuietHours{From: 13 * 60, To: 14 * 60, Location: "Europe/Berlin"},
+			t:      time.Date(2020, 5, 1, 11, 30, 0, 0, time.UTC), // 13:30 in Berlin
+			active: true,
+			end:    time.Date(2020, 5, 1, 14, 0, 0, 0, berlin),
+		},
+		{
+			q: QuietHours{From: 13 * 60, To: 14 * 60, Location: "Europe/Berlin"},
+			t: time.Date(2020, 5, 1, 14, 0, 0, 0, berlin),
+		},
+	}
+
+	for i, tt := range tbl {
+		active, end := tt.q.Active(tt.t)
+		assert.Equal(t, tt.active, active, "case %d", i)
+		assert.True(t, tt.end.Equal(end), "case %d, expected end %s, got %s", i, tt.end, end)
+	}
+}
@@ -0,0 +1,1357 @@
+package groups
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Semior001/multibot-utility/app/logging"
+)
+
+// sqlDialect describes differences of sql databases, that matter for sqlStore
+type sqlDialect struct {
+	numberedParams bool   // query parameters are $1, $2, ... instead of ?
+	lockRows       string // clause to lock selected rows till the end of transaction, if supported
+}
+
+// sqlStore implements Store over the relational schema, shared by sql databases,
+// queries are written with ? parameters and rebound for the dialect
+type sqlStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+// GetGroups returns the list of groups by chatID in form map[group_alias][]users
+func (s *sqlStore) GetGroups(ctx context.Context, chatID string) (map[string][]string, error) {
+	res := make(map[string][]string)
+	err := s.view(ctx, func(tx *sql.Tx) error {
+		if err := s.checkChatExists(ctx, tx, chatID); err != nil {
+			return errors.Wrapf(err, "failed to get groups of chat %s", chatID)
+		}
+		rows, err := tx.QueryContext(ctx,
+			s.rebind(`SELECT g.alias, m.username FROM user_groups g
+			LEFT JOIN members m ON m.group_id = g.id
+			WHERE g.chat_id = ? ORDER BY g.alias, m.position`),
+			chatID,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get groups of chat %s", chatID)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var alias string
+			var user sql.NullString
+			if err = rows.Scan(&alias, &user); err != nil {
+				return errors.Wrapf(err, "failed to get groups of chat %s", chatID)
+			}
+			if !user.Valid {
+				res[alias] = nil
+				continue
+			}
+			res[alias] = append(res[alias], user.String)
+		}
+		return errors.Wrapf(rows.Err(), "failed to get groups of chat %s", chatID)
+	})
+	return res, err
+}
+
+// DeleteUsers removes users from the group, returns the number of actually removed ones
+func (s *sqlStore) DeleteUsers(ctx context.Context, chatID string, alias string, users []string) (int, error) {
+	alias = NormalizeAlias(alias)
+	removed := 0
+	err := s.update(ctx, func(tx *sql.Tx) error {
+		alias, err := s.resolveSynonym(ctx, tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete users from group %s:%s", chatID, alias)
+		}
+		id, err := s.lockGroup(ctx, tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete users from group %s:%s", chatID, alias)
+		}
+		oldMembers, err := s.groupMembers(ctx, tx, id)
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete users from group %s:%s", chatID, alias)
+		}
+		for _, user := range unique(users) {
+			res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM members WHERE group_id = ? AND username = ?`), id, user)
+			if err != nil {
+				return errors.Wrapf(err, "failed to delete user %s from group %s:%s", user, chatID, alias)
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return errors.Wrapf(err, "failed to delete user %s from group %s:%s", user, chatID, alias)
+			}
+			removed += int(n)
+		}
+		if removed == 0 {
+			return errors.Wrapf(ErrUserNotInGroup, "failed to delete users %v from group %s:%s", users, chatID, alias)
+		}
+		err = s.recordMembersChange(ctx, tx, AuditEntry{ChatID: chatID, Group: alias, OldMembers: oldMembers}, id, false)
+		return errors.Wrapf(err, "failed to delete users from group %s:%s", chatID, alias)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// AddUsers adds users to the end of the specified group, skipping the ones, who are
+// already there, returns the number of actually added users
+func (s *sqlStore) AddUsers(ctx context.Context, chatID string, alias string, users []string) (int, error) {
+	alias = NormalizeAlias(alias)
+	added := 0
+	err := s.update(ctx, func(tx *sql.Tx) error {
+		alias, err := s.resolveSynonym(ctx, tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to add users to group %s:%s", chatID, alias)
+		}
+		id, err := s.lockGroup(ctx, tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to add users to group %s:%s", chatID, alias)
+		}
+		oldMembers, err := s.groupMembers(ctx, tx, id)
+		if err != nil {
+			return errors.Wrapf(err, "failed to add users to group %s:%s", chatID, alias)
+		}
+		var position int
+		err = tx.QueryRowContext(ctx,
+			s.rebind(`SELECT COALESCE(MAX(position), -1) + 1 FROM members WHERE group_id = ?`),
+			id,
+		).Scan(&position)
+		if err != nil {
+			return errors.Wrapf(err, "failed to add users to group %s:%s", chatID, alias)
+		}
+		if added, err = s.insertMembers(ctx, tx, id, position, users); err != nil || added == 0 {
+			return errors.Wrapf(err, "failed to add users to group %s:%s", chatID, alias)
+		}
+		err = s.recordMembersChange(ctx, tx, AuditEntry{ChatID: chatID, Group: alias, OldMembers: oldMembers}, id, false)
+		return errors.Wrapf(err, "failed to add users to group %s:%s", chatID, alias)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// DeleteGroup removes group from the database by given chatID
+func (s *sqlStore) DeleteGroup(ctx context.Context, chatID string, alias string) error {
+	alias = NormalizeAlias(alias)
+	return s.update(ctx, func(tx *sql.Tx) error {
+		alias, err := s.resolveSynonym(ctx, tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete group %s:%s", chatID, alias)
+		}
+		id, err := s.groupID(ctx, tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete group %s:%s", chatID, alias)
+		}
+		tombstone, err := s.groupTombstone(ctx, tx, chatID, alias, id)
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete group %s:%s", chatID, alias)
+		}
+		// members and synonyms are removed by cascade
+		if _, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM user_groups WHERE id = ?`), id); err != nil {
+			return errors.Wrapf(err, "failed to delete group %s:%s", chatID, alias)
+		}
+		_, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM triggers WHERE chat_id = ? AND subject = ?`), chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete trigger state of group %s:%s", chatID, alias)
+		}
+		err = s.recordChange(ctx, tx, AuditEntry{ChatID: chatID, Group: alias, OldMembers: tombstone.Members})
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete group %s:%s", chatID, alias)
+		}
+		err = s.keepTombstone(ctx, tx, tombstone)
+		return errors.Wrapf(err, "failed to delete group %s:%s", chatID, alias)
+	})
+}
+
+// CreateGroup creates the new group, fails with ErrGroupExists, if the group
+// or the synonym with the same alias exists
+func (s *sqlStore) CreateGroup(ctx context.Context, chatID string, alias string, users []string) error {
+	return s.putGroup(ctx, chatID, alias, users, false)
+}
+
+// PutGroup creates the group or replaces members of the existing one
+func (s *sqlStore) PutGroup(ctx context.Context, chatID string, alias string, users []string) error {
+	return s.putGroup(ctx, chatID, alias, users, true)
+}
+
+// putGroup saves the group with specified users, replacing the existing one only if allowed
+func (s *sqlStore) putGroup(ctx context.Context, chatID string, alias string, users []string, replace bool) error {
+	alias = NormalizeAlias(alias)
+	return s.update(ctx, func(tx *sql.Tx) error {
+		canonical, err := s.resolveSynonym(ctx, tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to put group %s:%s", chatID, alias)
+		}
+		if canonical != alias {
+			return errors.Wrapf(
+				errors.Wrapf(ErrGroupExists, "alias is a synonym of group %s", canonical),
+				"failed to put group %s:%s", chatID, alias,
+			)
+		}
+
+		if _, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO chats (id) VALUES (?) ON CONFLICT DO NOTHING`), chatID); err != nil {
+			return errors.Wrapf(err, "failed to put group %s:%s", chatID, alias)
+		}
+		res, err := tx.ExecContext(ctx,
+			s.rebind(`INSERT INTO user_groups (chat_id, alias) VALUES (?, ?) ON CONFLICT DO NOTHING`),
+			chatID, alias,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "failed to put group %s:%s", chatID, alias)
+		}
+		created, err := res.RowsAffected()
+		if err != nil {
+			return errors.Wrapf(err, "failed to put group %s:%s", chatID, alias)
+		}
+		if created == 0 && !replace {
+			return errors.Wrapf(ErrGroupExists, "failed to put group %s:%s", chatID, alias)
+		}
+		id, err := s.lockGroup(ctx, tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to put group %s:%s", chatID, alias)
+		}
+		oldMembers, err := s.groupMembers(ctx, tx, id)
+		if err != nil {
+			return errors.Wrapf(err, "failed to put group %s:%s", chatID, alias)
+		}
+
+		if _, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM members WHERE group_id = ?`), id); err != nil {
+			return errors.Wrapf(err, "failed to put group %s:%s", chatID, alias)
+		}
+		if _, err = s.insertMembers(ctx, tx, id, 0, users); err != nil {
+			return errors.Wrapf(err, "failed to put group %s:%s", chatID, alias)
+		}
+		err = s.recordMembersChange(ctx, tx, AuditEntry{ChatID: chatID, Group: alias, OldMembers: oldMembers}, id, true)
+		return errors.Wrapf(err, "failed to put group %s:%s", chatID, alias)
+	})
+}
+
+// GetGroup returns all users of the single group
+func (s *sqlStore) GetGroup(ctx context.Context, chatID string, alias string) ([]string, error) {
+	alias = NormalizeAlias(alias)
+	var users []string
+	err := s.view(ctx, func(tx *sql.Tx) error {
+		alias, err := s.resolveSynonym(ctx, tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get users of group %s:%s", chatID, alias)
+		}
+		id, err := s.groupID(ctx, tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get users of group %s:%s", chatID, alias)
+		}
+		users, err = s.groupMembers(ctx, tx, id)
+		return errors.Wrapf(err, "failed to get users of group %s:%s", chatID, alias)
+	})
+	return users, err
+}
+
+// FindAliases looks for group aliases and their synonyms in the database
+// and returns members of groups, which aliases are present, by canonical aliases
+func (s *sqlStore) FindAliases(ctx context.Context, chatID string, aliases []string) (map[string][]string, error) {
+	res := make(map[string][]string)
+	err := s.view(ctx, func(tx *sql.Tx) error {
+		if err := s.checkChatExists(ctx, tx, chatID); err != nil {
+			return errors.Wrapf(err, "error while looking for aliases of chat %s in sql database", chatID)
+		}
+		for _, alias := range aliases {
+			alias, err := s.resolveSynonym(ctx, tx, chatID, NormalizeAlias(alias))
+			if err != nil {
+				return errors.Wrapf(err, "error while looking for aliases of chat %s in sql database", chatID)
+			}
+			id, err := s.groupID(ctx, tx, chatID, alias)
+			// this alias is not a group, skip
+			if errors.Is(err, ErrGroupNotFound) {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "error while looking for aliases of chat %s in sql database", chatID)
+			}
+			if res[alias], err = s.groupMembers(ctx, tx, id); err != nil {
+				return errors.Wrapf(err, "error while looking for aliases of chat %s in sql database", chatID)
+			}
+		}
+		return nil
+	})
+	return res, err
+}
+
+// AddChat saves the chat in the storage
+func (s *sqlStore) AddChat(ctx context.Context, id string) error {
+	return s.update(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO chats (id) VALUES (?) ON CONFLICT DO NOTHING`), id)
+		return errors.Wrapf(err, "failed to add chat %s", id)
+	})
+}
+
+// GetChats returns sorted ids of all chats, that were added or have groups
+func (s *sqlStore) GetChats(ctx context.Context) ([]string, error) {
+	res := []string{}
+	err := s.view(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT id FROM chats ORDER BY id`)
+		if err != nil {
+			return errors.Wrap(err, "failed to get chats")
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			if err = rows.Scan(&id); err != nil {
+				return errors.Wrap(err, "failed to get chats")
+			}
+			res = append(res, id)
+		}
+		return errors.Wrap(rows.Err(), "failed to get chats")
+	})
+	return res, err
+}
+
+// GetGroupSettings returns settings of the group, if the group has no
+// settings - returns empty ones
+func (s *sqlStore) GetGroupSettings(ctx context.Context, chatID string, alias string) (GroupSettings, error) {
+	alias = NormalizeAlias(alias)
+	var settings GroupSettings
+	err := s.view(ctx, func(tx *sql.Tx) error {
+		alias, err := s.resolveSynonym(ctx, tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get settings of group %s:%s", chatID, alias)
+		}
+		err = tx.QueryRowContext(ctx,
+			s.rebind(`SELECT admins_only, cooldown, description FROM user_groups WHERE chat_id = ? AND alias = ?`),
+			chatID, alias,
+		).Scan(&settings.AdminsOnly, &settings.Cooldown, &settings.Description)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to get settings of group %s:%s", chatID, alias)
+	})
+	return settings, err
+}
+
+// PutGroupSettings replaces settings of the group
+func (s *sqlStore) PutGroupSettings(ctx context.Context, chatID string, alias string, settings GroupSettings) error {
+	alias = NormalizeAlias(alias)
+	return s.update(ctx, func(tx *sql.Tx) error {
+		alias, err := s.resolveSynonym(ctx, tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to put settings of group %s:%s", chatID, alias)
+		}
+		id, err := s.lockGroup(ctx, tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to put settings of group %s:%s", chatID, alias)
+		}
+		_, err = tx.ExecContext(ctx,
+			s.rebind(`UPDATE user_groups SET admins_only = ?, cooldown = ?, description = ? WHERE id = ?`),
+			settings.AdminsOnly, settings.Cooldown, settings.Description, id,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "failed to put settings of group %s:%s", chatID, alias)
+		}
+		err = s.recordChange(ctx, tx, AuditEntry{ChatID: chatID, Group: alias})
+		return errors.Wrapf(err, "failed to put settings of group %s:%s", chatID, alias)
+	})
+}
+
+// GetAllGroupSettings returns settings of all groups in the chat, that have any,
+// in form map[group_alias]GroupSettings
+func (s *sqlStore) GetAllGroupSettings(ctx context.Context, chatID string) (map[string]GroupSettings, error) {
+	res := make(map[string]GroupSettings)
+	err := s.view(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			s.rebind(`SELECT alias, admins_only, cooldown, description FROM user_groups
+			WHERE chat_id = ? AND (admins_only OR cooldown <> 0 OR description <> '')`),
+			chatID,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get settings of groups of chat %s", chatID)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var alias string
+			var settings GroupSettings
+			if err = rows.Scan(&alias, &settings.AdminsOnly, &settings.Cooldown, &settings.Description); err != nil {
+				return errors.Wrapf(err, "failed to get settings of groups of chat %s", chatID)
+			}
+			res[alias] = settings
+		}
+		return errors.Wrapf(rows.Err(), "failed to get settings of groups of chat %s", chatID)
+	})
+	return res, err
+}
+
+// GetLastTrigger returns the last time, when the subject (group alias or user)
+// triggered a ping in the chat, zero time if never
+func (s *sqlStore) GetLastTrigger(ctx context.Context, chatID string, subject string) (time.Time, error) {
+	var at time.Time
+	err := s.view(ctx, func(tx *sql.Tx) error {
+		var data string
+		err := tx.QueryRowContext(ctx,
+			s.rebind(`SELECT at FROM triggers WHERE chat_id = ? AND subject = ?`),
+			chatID, subject,
+		).Scan(&data)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to get last trigger of %s:%s", chatID, subject)
+		}
+		return errors.Wrapf(at.UnmarshalText([]byte(data)), "failed to get last trigger of %s:%s", chatID, subject)
+	})
+	return at, err
+}
+
+// PutLastTrigger saves the time, when the subject (group alias or user)
+// triggered a ping in the chat
+func (s *sqlStore) PutLastTrigger(ctx context.Context, chatID string, subject string, at time.Time) error {
+	data, err := at.MarshalText()
+	if err != nil {
+		return errors.Wrapf(err, "failed to put last trigger of %s:%s", chatID, subject)
+	}
+	return s.update(ctx, func(tx *sql.Tx) error {
+		if _, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO chats (id) VALUES (?) ON CONFLICT DO NOTHING`), chatID); err != nil {
+			return errors.Wrapf(err, "failed to put last trigger of %s:%s", chatID, subject)
+		}
+		_, err = tx.ExecContext(ctx,
+			s.rebind(`INSERT INTO triggers (chat_id, subject, at) VALUES (?, ?, ?)
+			ON CONFLICT (chat_id, subject) DO UPDATE SET at = excluded.at`),
+			chatID, subject, string(data),
+		)
+		return errors.Wrapf(err, "failed to put last trigger of %s:%s", chatID, subject)
+	})
+}
+
+// PutLastTriggerAfter saves the time, when the subject triggered a ping in the chat,
+// only if the cooldown has passed since the last trigger, otherwise fails with
+// ErrTriggerCooldown and returns the time, when the subject can trigger again,
+// the row of the trigger is locked, so concurrent triggers are checked one by one
+func (s *sqlStore) PutLastTriggerAfter(ctx context.Context, chatID string, subject string, at time.Time,
+	cooldown time.Duration) (time.Time, error) {
+	data, err := at.MarshalText()
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "failed to put last trigger of %s:%s", chatID, subject)
+	}
+	var next time.Time
+	err = s.update(ctx, func(tx *sql.Tx) error {
+		if _, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO chats (id) VALUES (?) ON CONFLICT DO NOTHING`), chatID); err != nil {
+			return errors.Wrapf(err, "failed to put last trigger of %s:%s", chatID, subject)
+		}
+
+		var last string
+		err = tx.QueryRowContext(ctx,
+			s.rebind(`SELECT at FROM triggers WHERE chat_id = ? AND subject = ?`+s.dialect.lockRows),
+			chatID, subject,
+		).Scan(&last)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return errors.Wrapf(err, "failed to get last trigger of %s:%s", chatID, subject)
+		}
+		if err == nil {
+			var lastAt time.Time
+			if err = lastAt.UnmarshalText([]byte(last)); err != nil {
+				return errors.Wrapf(err, "failed to get last trigger of %s:%s", chatID, subject)
+			}
+			if next = lastAt.Add(cooldown); at.Before(next) {
+				return errors.Wrapf(ErrTriggerCooldown, "failed to put last trigger of %s:%s", chatID, subject)
+			}
+		}
+
+		// the first trigger of the subject is not locked by the select, the concurrent
+		// one, that inserted it first, wins and the other one is left in cooldown
+		res, err := tx.ExecContext(ctx,
+			s.rebind(`INSERT INTO triggers (chat_id, subject, at) VALUES (?, ?, ?)
+			ON CONFLICT (chat_id, subject) DO UPDATE SET at = excluded.at WHERE triggers.at = ?`),
+			chatID, subject, string(data), last,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "failed to put last trigger of %s:%s", chatID, subject)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return errors.Wrapf(err, "failed to put last trigger of %s:%s", chatID, subject)
+		}
+		if n == 0 {
+			next = at.Add(cooldown)
+			return errors.Wrapf(ErrTriggerCooldown, "failed to put last trigger of %s:%s", chatID, subject)
+		}
+		next = time.Time{}
+		return nil
+	})
+	return next, err
+}
+
+// GetQuietHours returns all quiet hours of the chat and its members in form
+// map[subject]QuietHours, chat-wide quiet hours are stored by ChatQuietHours subject
+func (s *sqlStore) GetQuietHours(ctx context.Context, chatID string) (map[string]QuietHours, error) {
+	res := make(map[string]QuietHours)
+	err := s.view(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			s.rebind(`SELECT subject, from_minute, to_minute, location, skip FROM quiet_hours WHERE chat_id = ?`),
+			chatID,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get quiet hours of chat %s", chatID)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var subject string
+			var q QuietHours
+			if err = rows.Scan(&subject, &q.From, &q.To, &q.Location, &q.Skip); err != nil {
+				return errors.Wrapf(err, "failed to get quiet hours of chat %s", chatID)
+			}
+			res[subject] = q
+		}
+		return errors.Wrapf(rows.Err(), "failed to get quiet hours of chat %s", chatID)
+	})
+	return res, err
+}
+
+// PutQuietHours sets quiet hours of the subject (chat or user) in the chat,
+// nil quiet hours removes them
+func (s *sqlStore) PutQuietHours(ctx context.Context, chatID string, subject string, quietHours *QuietHours) error {
+	return s.update(ctx, func(tx *sql.Tx) error {
+		if quietHours == nil {
+			_, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM quiet_hours WHERE chat_id = ? AND subject = ?`), chatID, subject)
+			return errors.Wrapf(err, "failed to delete quiet hours of %s:%s", chatID, subject)
+		}
+
+		if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO chats (id) VALUES (?) ON CONFLICT DO NOTHING`), chatID); err != nil {
+			return errors.Wrapf(err, "failed to put quiet hours of %s:%s", chatID, subject)
+		}
+		_, err := tx.ExecContext(ctx,
+			s.rebind(`INSERT INTO quiet_hours (chat_id, subject, from_minute, to_minute, location, skip)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (chat_id, subject) DO UPDATE SET
+			from_minute = excluded.from_minute, to_minute = excluded.to_minute,
+			location = excluded.location, skip = excluded.skip`),
+			chatID, subject, quietHours.From, quietHours.To, quietHours.Location, quietHours.Skip,
+		)
+		return errors.Wrapf(err, "failed to put quiet hours of %s:%s", chatID, subject)
+	})
+}
+
+// AddAuditEntry appends the entry to the audit log of the chat
+func (s *sqlStore) AddAuditEntry(ctx context.Context, entry AuditEntry) error {
+	entry.Group = NormalizeAlias(entry.Group)
+	return s.update(ctx, func(tx *sql.Tx) error {
+		err := s.insertAuditEntry(ctx, tx, entry)
+		return errors.Wrapf(err, "failed to add audit entry of group %s:%s", entry.ChatID, entry.Group)
+	})
+}
+
+// GetAuditLog returns at most limit latest entries of the audit log of the group, the group
+// may be referred by its synonym, newest entries first, empty alias means all groups of the
+// chat, non-positive limit means no limit
+func (s *sqlStore) GetAuditLog(ctx context.Context, chatID string, alias string, limit int) ([]AuditEntry, error) {
+	alias = NormalizeAlias(alias)
+	var res []AuditEntry
+	err := s.view(ctx, func(tx *sql.Tx) error {
+		query := `SELECT group_alias, actor, action, details, old_members, new_members, at FROM audit_log WHERE chat_id = ?`
+		args := []interface{}{chatID}
+		if alias != "" {
+			canonical, err := s.resolveSynonym(ctx, tx, chatID, alias)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get audit log of group %s:%s", chatID, alias)
+			}
+			query += ` AND group_alias = ?`
+			args = append(args, canonical)
+		}
+		query += ` ORDER BY id DESC`
+		if limit > 0 {
+			query += ` LIMIT ?`
+			args = append(args, limit)
+		}
+
+		rows, err := tx.QueryContext(ctx, s.rebind(query), args...)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get audit log of group %s:%s", chatID, alias)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			entry := AuditEntry{ChatID: chatID}
+			var oldMembers, newMembers string
+			var at int64
+			err = rows.Scan(&entry.Group, &entry.Actor, &entry.Action, &entry.Details, &oldMembers, &newMembers, &at)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get audit log of group %s:%s", chatID, alias)
+			}
+			if err = json.Unmarshal([]byte(oldMembers), &entry.OldMembers); err != nil {
+				return errors.Wrapf(err, "failed to get audit log of group %s:%s", chatID, alias)
+			}
+			if err = json.Unmarshal([]byte(newMembers), &entry.NewMembers); err != nil {
+				return errors.Wrapf(err, "failed to get audit log of group %s:%s", chatID, alias)
+			}
+			entry.At = time.Unix(0, at).UTC()
+			res = append(res, entry)
+		}
+		return errors.Wrapf(rows.Err(), "failed to get audit log of group %s:%s", chatID, alias)
+	})
+	return res, err
+}
+
+// PurgeAuditLog removes entries of the chat audit log, that were made before the given time
+func (s *sqlStore) PurgeAuditLog(ctx context.Context, chatID string, before time.Time) (int, error) {
+	var purged int64
+	err := s.update(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM audit_log WHERE chat_id = ? AND at < ?`), chatID, before.UnixNano())
+		if err != nil {
+			return errors.Wrapf(err, "failed to purge audit log of chat %s", chatID)
+		}
+		purged, err = res.RowsAffected()
+		return errors.Wrapf(err, "failed to purge audit log of chat %s", chatID)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(purged), nil
+}
+
+// AddTombstone saves the copy of the deleted group or removed members
+func (s *sqlStore) AddTombstone(ctx context.Context, tombstone Tombstone) error {
+	tombstone.Group = NormalizeAlias(tombstone.Group)
+	return s.update(ctx, func(tx *sql.Tx) error {
+		err := s.insertTombstone(ctx, tx, tombstone)
+		return errors.Wrapf(err, "failed to add tombstone of group %s:%s", tombstone.ChatID, tombstone.Group)
+	})
+}
+
+// GetTombstones returns all tombstones of the chat, newest tombstones first
+func (s *sqlStore) GetTombstones(ctx context.Context, chatID string) ([]Tombstone, error) {
+	var res []Tombstone
+	err := s.view(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			s.rebind(`SELECT id, data FROM tombstones WHERE chat_id = ? ORDER BY id DESC`),
+			chatID,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get tombstones of chat %s", chatID)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			var data string
+			if err = rows.Scan(&id, &data); err != nil {
+				return errors.Wrapf(err, "failed to get tombstones of chat %s", chatID)
+			}
+			var tombstone Tombstone
+			if err = json.Unmarshal([]byte(data), &tombstone); err != nil {
+				return errors.Wrapf(err, "failed to get tombstones of chat %s", chatID)
+			}
+			tombstone.ID = id
+			res = append(res, tombstone)
+		}
+		return errors.Wrapf(rows.Err(), "failed to get tombstones of chat %s", chatID)
+	})
+	return res, err
+}
+
+// DeleteTombstone removes the tombstone, e.g. after the change was reverted
+func (s *sqlStore) DeleteTombstone(ctx context.Context, chatID string, id int64) error {
+	return s.update(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM tombstones WHERE chat_id = ? AND id = ?`), chatID, id)
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete tombstone %s:%d", chatID, id)
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return errors.Wrapf(ErrTombstoneNotFound, "failed to delete tombstone %s:%d", chatID, id)
+		}
+		return nil
+	})
+}
+
+// PurgeTombstones removes tombstones of the chat, that were made before the given time
+func (s *sqlStore) PurgeTombstones(ctx context.Context, chatID string, before time.Time) (int, error) {
+	var purged int64
+	err := s.update(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM tombstones WHERE chat_id = ? AND at < ?`), chatID, before.UnixNano())
+		if err != nil {
+			return errors.Wrapf(err, "failed to purge tombstones of chat %s", chatID)
+		}
+		purged, err = res.RowsAffected()
+		return errors.Wrapf(err, "failed to purge tombstones of chat %s", chatID)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(purged), nil
+}
+
+// RestoreTombstone reverts the change, kept in the tombstone with the same id, and removes the
+// tombstone in a single transaction: the deleted group is created with its settings and synonyms,
+// removed members are added back and replaced ones are put instead of the current members
+func (s *sqlStore) RestoreTombstone(ctx context.Context, chatID string, tombstone Tombstone) error {
+	return s.update(ctx, func(tx *sql.Tx) error {
+		// the stored copy is restored, as the group might be renamed since the tombstone was read
+		var data string
+		err := tx.QueryRowContext(ctx,
+			s.rebind(`DELETE FROM tombstones WHERE chat_id = ? AND id = ? RETURNING data`),
+			chatID, tombstone.ID,
+		).Scan(&data)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.Wrapf(ErrTombstoneNotFound, "failed to restore tombstone %s:%d", chatID, tombstone.ID)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to restore tombstone %s:%d", chatID, tombstone.ID)
+		}
+		var stored Tombstone
+		if err = json.Unmarshal([]byte(data), &stored); err != nil {
+			return errors.Wrapf(err, "failed to restore tombstone %s:%d", chatID, tombstone.ID)
+		}
+		err = s.restoreTombstone(ctx, tx, chatID, stored)
+		return errors.Wrapf(err, "failed to restore group %s:%s", chatID, stored.Group)
+	})
+}
+
+// RenameGroup changes the alias of the group with its settings, trigger state,
+// history and tombstones, fails if the group with new alias already exists
+func (s *sqlStore) RenameGroup(ctx context.Context, chatID string, oldAlias string, newAlias string) error {
+	oldAlias = NormalizeAlias(oldAlias)
+	newAlias = NormalizeAlias(newAlias)
+	return s.update(ctx, func(tx *sql.Tx) error {
+		oldAlias, err := s.resolveSynonym(ctx, tx, chatID, oldAlias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to rename group %s:%s to %s", chatID, oldAlias, newAlias)
+		}
+		id, err := s.checkMove(ctx, tx, chatID, oldAlias, newAlias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to rename group %s:%s to %s", chatID, oldAlias, newAlias)
+		}
+		// members, settings and synonyms follow the group by its id
+		if _, err = tx.ExecContext(ctx, s.rebind(`UPDATE user_groups SET alias = ? WHERE id = ?`), newAlias, id); err != nil {
+			return errors.Wrapf(err, "failed to rename group %s:%s to %s", chatID, oldAlias, newAlias)
+		}
+		// dropping the stale trigger state of the new alias, if any, as its key is unique
+		_, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM triggers WHERE chat_id = ? AND subject = ?`), chatID, newAlias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to rename group %s:%s to %s", chatID, oldAlias, newAlias)
+		}
+		_, err = tx.ExecContext(ctx,
+			s.rebind(`UPDATE triggers SET subject = ? WHERE chat_id = ? AND subject = ?`),
+			newAlias, chatID, oldAlias,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "failed to rename group %s:%s to %s", chatID, oldAlias, newAlias)
+		}
+		_, err = tx.ExecContext(ctx,
+			s.rebind(`UPDATE audit_log SET group_alias = ? WHERE chat_id = ? AND group_alias = ?`),
+			newAlias, chatID, oldAlias,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "failed to rename history of group %s:%s to %s", chatID, oldAlias, newAlias)
+		}
+		if err = s.renameTombstones(ctx, tx, chatID, oldAlias, newAlias); err != nil {
+			return errors.Wrapf(err, "failed to rename tombstones of group %s:%s to %s", chatID, oldAlias, newAlias)
+		}
+		err = s.recordChange(ctx, tx, AuditEntry{ChatID: chatID, Group: newAlias, Details: "from " + oldAlias})
+		return errors.Wrapf(err, "failed to rename group %s:%s to %s", chatID, oldAlias, newAlias)
+	})
+}
+
+// CopyGroup creates a new group with members and settings of the source group,
+// fails if the group with destination alias already exists
+func (s *sqlStore) CopyGroup(ctx context.Context, chatID string, srcAlias string, dstAlias string) error {
+	srcAlias = NormalizeAlias(srcAlias)
+	dstAlias = NormalizeAlias(dstAlias)
+	return s.update(ctx, func(tx *sql.Tx) error {
+		srcAlias, err := s.resolveSynonym(ctx, tx, chatID, srcAlias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to copy group %s:%s to %s", chatID, srcAlias, dstAlias)
+		}
+		srcID, err := s.checkMove(ctx, tx, chatID, srcAlias, dstAlias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to copy group %s:%s to %s", chatID, srcAlias, dstAlias)
+		}
+		var settings GroupSettings
+		err = tx.QueryRowContext(ctx,
+			s.rebind(`SELECT admins_only, cooldown, description FROM user_groups WHERE id = ?`),
+			srcID,
+		).Scan(&settings.AdminsOnly, &settings.Cooldown, &settings.Description)
+		if err != nil {
+			return errors.Wrapf(err, "failed to copy group %s:%s to %s", chatID, srcAlias, dstAlias)
+		}
+		var dstID int64
+		err = tx.QueryRowContext(ctx,
+			s.rebind(`INSERT INTO user_groups (chat_id, alias, admins_only, cooldown, description)
+			VALUES (?, ?, ?, ?, ?) RETURNING id`),
+			chatID, dstAlias, settings.AdminsOnly, settings.Cooldown, settings.Description,
+		).Scan(&dstID)
+		if err != nil {
+			return errors.Wrapf(err, "failed to copy group %s:%s to %s", chatID, srcAlias, dstAlias)
+		}
+		users, err := s.groupMembers(ctx, tx, srcID)
+		if err != nil {
+			return errors.Wrapf(err, "failed to copy members of group %s:%s to %s", chatID, srcAlias, dstAlias)
+		}
+		if _, err = s.insertMembers(ctx, tx, dstID, 0, users); err != nil {
+			return errors.Wrapf(err, "failed to copy members of group %s:%s to %s", chatID, srcAlias, dstAlias)
+		}
+		err = s.recordChange(ctx, tx, AuditEntry{ChatID: chatID, Group: dstAlias, Details: "from " + srcAlias})
+		return errors.Wrapf(err, "failed to copy group %s:%s to %s", chatID, srcAlias, dstAlias)
+	})
+}
+
+// AddSynonym makes the synonym an alternative alias of the group, fails if the
+// synonym is already used by any group
+func (s *sqlStore) AddSynonym(ctx context.Context, chatID string, alias string, synonym string) error {
+	alias, synonym = NormalizeAlias(alias), NormalizeAlias(synonym)
+	return s.update(ctx, func(tx *sql.Tx) error {
+		alias, err := s.resolveSynonym(ctx, tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to add synonym %s to group %s:%s", synonym, chatID, alias)
+		}
+		id, err := s.groupID(ctx, tx, chatID, alias)
+		if err != nil {
+			return errors.Wrapf(err, "failed to add synonym %s to group %s:%s", synonym, chatID, alias)
+		}
+		if err = s.checkAliasFree(ctx, tx, chatID, synonym); err != nil {
+			return errors.Wrapf(err, "failed to add synonym %s to group %s:%s", synonym, chatID, alias)
+		}
+		_, err = tx.ExecContext(ctx,
+			s.rebind(`INSERT INTO synonyms (chat_id, synonym, group_id) VALUES (?, ?, ?)`),
+			chatID, synonym, id,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "failed to add synonym %s to group %s:%s", synonym, chatID, alias)
+		}
+		err = s.recordChange(ctx, tx, AuditEntry{ChatID: chatID, Group: alias, Details: synonym})
+		return errors.Wrapf(err, "failed to add synonym %s to group %s:%s", synonym, chatID, alias)
+	})
+}
+
+// DeleteSynonym removes the synonym of the group
+func (s *sqlStore) DeleteSynonym(ctx context.Context, chatID string, synonym string) error {
+	synonym = NormalizeAlias(synonym)
+	return s.update(ctx, func(tx *sql.Tx) error {
+		alias, err := s.resolveSynonym(ctx, tx, chatID, synonym)
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete synonym %s:%s", chatID, synonym)
+		}
+		res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM synonyms WHERE chat_id = ? AND synonym = ?`), chatID, synonym)
+		if err != nil {
+			return errors.Wrapf(err, "failed to delete synonym %s:%s", chatID, synonym)
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return errors.Wrapf(ErrSynonymNotFound, "failed to delete synonym %s:%s", chatID, synonym)
+		}
+		err = s.recordChange(ctx, tx, AuditEntry{ChatID: chatID, Group: alias, Details: synonym})
+		return errors.Wrapf(err, "failed to delete synonym %s:%s", chatID, synonym)
+	})
+}
+
+// GetSynonyms returns synonyms of all groups in the chat in form
+// map[group_alias][]synonyms, synonyms are sorted
+func (s *sqlStore) GetSynonyms(ctx context.Context, chatID string) (map[string][]string, error) {
+	res := make(map[string][]string)
+	err := s.view(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			s.rebind(`SELECT g.alias, s.synonym FROM synonyms s
+			JOIN user_groups g ON g.id = s.group_id
+			WHERE s.chat_id = ? ORDER BY s.synonym`),
+			chatID,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get synonyms of chat %s", chatID)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var alias, synonym string
+			if err = rows.Scan(&alias, &synonym); err != nil {
+				return errors.Wrapf(err, "failed to get synonyms of chat %s", chatID)
+			}
+			res[alias] = append(res[alias], synonym)
+		}
+		return errors.Wrapf(rows.Err(), "failed to get synonyms of chat %s", chatID)
+	})
+	return res, err
+}
+
+// ImportGroups creates or replaces groups with their members, settings and synonyms
+// in a single transaction, fails with ErrGroupExists, if an alias or a synonym of
+// any imported group is used by another group, nothing is imported in that case
+func (s *sqlStore) ImportGroups(ctx context.Context, chatID string, snapshots []GroupSnapshot) error {
+	return s.update(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO chats (id) VALUES (?) ON CONFLICT DO NOTHING`), chatID); err != nil {
+			return errors.Wrapf(err, "failed to import groups of chat %s", chatID)
+		}
+
+		// synonyms of imported groups are replaced, so the old ones are dropped first
+		for _, snap := range snapshots {
+			_, err := tx.ExecContext(ctx,
+				s.rebind(`DELETE FROM synonyms WHERE group_id IN (SELECT id FROM user_groups WHERE chat_id = ? AND alias = ?)`),
+				chatID, NormalizeAlias(snap.Alias),
+			)
+			if err != nil {
+				return errors.Wrapf(err, "failed to import group %s:%s", chatID, snap.Alias)
+			}
+		}
+
+		for _, snap := range snapshots {
+			alias := NormalizeAlias(snap.Alias)
+			canonical, err := s.resolveSynonym(ctx, tx, chatID, alias)
+			if err != nil {
+				return errors.Wrapf(err, "failed to import group %s:%s", chatID, alias)
+			}
+			if canonical != alias {
+				return errors.Wrapf(
+					errors.Wrapf(ErrGroupExists, "alias is a synonym of group %s", canonical),
+					"failed to import group %s:%s", chatID, alias,
+				)
+			}
+
+			_, err = tx.ExecContext(ctx,
+				s.rebind(`INSERT INTO user_groups (chat_id, alias) VALUES (?, ?) ON CONFLICT DO NOTHING`),
+				chatID, alias,
+			)
+			if err != nil {
+				return errors.Wrapf(err, "failed to import group %s:%s", chatID, alias)
+			}
+			id, err := s.lockGroup(ctx, tx, chatID, alias)
+			if err != nil {
+				return errors.Wrapf(err, "failed to import group %s:%s", chatID, alias)
+			}
+			_, err = tx.ExecContext(ctx,
+				s.rebind(`UPDATE user_groups SET admins_only = ?, cooldown = ?, description = ? WHERE id = ?`),
+				snap.Settings.AdminsOnly, snap.Settings.Cooldown, snap.Settings.Description, id,
+			)
+			if err != nil {
+				return errors.Wrapf(err, "failed to import settings of group %s:%s", chatID, alias)
+			}
+			oldMembers, err := s.groupMembers(ctx, tx, id)
+			if err != nil {
+				return errors.Wrapf(err, "failed to import group %s:%s", chatID, alias)
+			}
+			if _, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM members WHERE group_id = ?`), id); err != nil {
+				return errors.Wrapf(err, "failed to import group %s:%s", chatID, alias)
+			}
+			if _, err = s.insertMembers(ctx, tx, id, 0, snap.Members); err != nil {
+				return errors.Wrapf(err, "failed to import group %s:%s", chatID, alias)
+			}
+			err = s.recordMembersChange(ctx, tx, AuditEntry{ChatID: chatID, Group: alias, OldMembers: oldMembers}, id, true)
+			if err != nil {
+				return errors.Wrapf(err, "failed to import group %s:%s", chatID, alias)
+			}
+
+			for _, synonym := range snap.Synonyms {
+				synonym = NormalizeAlias(synonym)
+				if err = s.checkAliasFree(ctx, tx, chatID, synonym); err != nil {
+					return errors.Wrapf(err, "failed to import synonym %s of group %s:%s", synonym, chatID, alias)
+				}
+				_, err = tx.ExecContext(ctx,
+					s.rebind(`INSERT INTO synonyms (chat_id, synonym, group_id) VALUES (?, ?, ?)`),
+					chatID, synonym, id,
+				)
+				if err != nil {
+					return errors.Wrapf(err, "failed to import synonym %s of group %s:%s", synonym, chatID, alias)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// DB returns the underlying database to share it with other stores
+func (s *sqlStore) DB() *sql.DB {
+	return s.db
+}
+
+// Ping checks, that the database is reachable
+func (s *sqlStore) Ping(ctx context.Context) error {
+	return errors.Wrap(s.db.PingContext(ctx), "failed to ping database")
+}
+
+// Close closes the database
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+// view runs the read-only transaction
+func (s *sqlStore) view(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	defer observeSQLTx(ctx, "view", time.Now())
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback() //nolint:errcheck // read-only transaction has nothing to commit
+	return fn(tx)
+}
+
+// update runs the read-write transaction and commits it, if fn succeeded
+func (s *sqlStore) update(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	defer observeSQLTx(ctx, "update", time.Now())
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "failed to commit transaction")
+}
+
+// observeSQLTx logs the duration of the sql transaction of the given type
+func observeSQLTx(ctx context.Context, txType string, start time.Time) {
+	logging.Debug(ctx, "sql transaction", "store", "groups", "type", txType, logging.Since(start))
+}
+
+// checkChatExists returns ErrChatNotFound, if the chat was not saved
+func (s *sqlStore) checkChatExists(ctx context.Context, tx *sql.Tx, chatID string) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, s.rebind(`SELECT EXISTS (SELECT 1 FROM chats WHERE id = ?)`), chatID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrChatNotFound
+	}
+	return nil
+}
+
+// groupID returns the id of the group, ErrChatNotFound or ErrGroupNotFound,
+// if the group with given alias does not exist
+func (s *sqlStore) groupID(ctx context.Context, tx *sql.Tx, chatID string, alias string) (int64, error) {
+	return s.selectGroupID(ctx, tx, chatID, alias, "")
+}
+
+// lockGroup returns the id of the group, like groupID, and locks the group
+// till the end of transaction, so concurrent changes of its members are serialized
+func (s *sqlStore) lockGroup(ctx context.Context, tx *sql.Tx, chatID string, alias string) (int64, error) {
+	return s.selectGroupID(ctx, tx, chatID, alias, s.dialect.lockRows)
+}
+
+// selectGroupID looks for the id of the group, suffix is appended to the query
+func (s *sqlStore) selectGroupID(ctx context.Context, tx *sql.Tx, chatID, alias, suffix string) (int64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx,
+		s.rebind(`SELECT id FROM user_groups WHERE chat_id = ? AND alias = ?`+suffix),
+		chatID, alias,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		if err = s.checkChatExists(ctx, tx, chatID); err != nil {
+			return 0, err
+		}
+		return 0, ErrGroupNotFound
+	}
+	return id, err
+}
+
+// groupMembers returns usernames of the group in order of their addition
+func (s *sqlStore) groupMembers(ctx context.Context, tx *sql.Tx, id int64) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, s.rebind(`SELECT username FROM members WHERE group_id = ? ORDER BY position`), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []string
+	for rows.Next() {
+		var user string
+		if err = rows.Scan(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// insertMembers adds users to the group with positions starting from the given one,
+// users, that are already in the group, are skipped, returns the number of inserted users
+func (s *sqlStore) insertMembers(ctx context.Context, tx *sql.Tx, id int64, position int, users []string) (int, error) {
+	inserted := 0
+	for _, user := range users {
+		res, err := tx.ExecContext(ctx,
+			s.rebind(`INSERT INTO members (group_id, username, position) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`),
+			id, user, position+inserted,
+		)
+		if err != nil {
+			return inserted, errors.Wrapf(err, "failed to insert user %s", user)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return inserted, errors.Wrapf(err, "failed to insert user %s", user)
+		}
+		inserted += int(n)
+	}
+	return inserted, nil
+}
+
+// resolveSynonym returns the canonical alias of the group, if the given
+// alias is its synonym, otherwise returns alias as is
+func (s *sqlStore) resolveSynonym(ctx context.Context, tx *sql.Tx, chatID string, alias string) (string, error) {
+	var canonical string
+	err := tx.QueryRowContext(ctx,
+		s.rebind(`SELECT g.alias FROM synonyms s JOIN user_groups g ON g.id = s.group_id
+		WHERE s.chat_id = ? AND s.synonym = ?`),
+		chatID, alias,
+	).Scan(&canonical)
+	if errors.Is(err, sql.ErrNoRows) {
+		return alias, nil
+	}
+	if err != nil {
+		return alias, errors.Wrapf(err, "failed to resolve synonym %s", alias)
+	}
+	return canonical, nil
+}
+
+// checkAliasFree returns ErrGroupExists, if the alias is used by any group
+// or as a synonym of any group
+func (s *sqlStore) checkAliasFree(ctx context.Context, tx *sql.Tx, chatID string, alias string) error {
+	_, err := s.groupID(ctx, tx, chatID, alias)
+	switch {
+	case err == nil:
+		return ErrGroupExists
+	case !errors.Is(err, ErrGroupNotFound):
+		return err
+	}
+
+	canonical, err := s.resolveSynonym(ctx, tx, chatID, alias)
+	if err != nil {
+		return err
+	}
+	if canonical != alias {
+		return errors.Wrapf(ErrGroupExists, "alias is a synonym of group %s", canonical)
+	}
+	return nil
+}
+
+// checkMove checks, that the source group exists and the destination
+// alias is free, and returns the id of the source group
+func (s *sqlStore) checkMove(ctx context.Context, tx *sql.Tx, chatID string, src string, dst string) (int64, error) {
+	id, err := s.groupID(ctx, tx, chatID, src)
+	if err != nil {
+		return 0, err
+	}
+	if err = s.checkAliasFree(ctx, tx, chatID, dst); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// recordChange inserts the entry into the audit log, if the context carries the change
+func (s *sqlStore) recordChange(ctx context.Context, tx *sql.Tx, entry AuditEntry) error {
+	entry, ok := changeEntry(ctx, entry)
+	if !ok {
+		return nil
+	}
+	return errors.Wrap(s.insertAuditEntry(ctx, tx, entry), "failed to record the change")
+}
+
+// recordMembersChange records the change of members of the group with the given id and
+// keeps the tombstone of removed or replaced members, members after the change are taken
+// from the database
+func (s *sqlStore) recordMembersChange(ctx context.Context, tx *sql.Tx, entry AuditEntry, id int64, replaced bool) error {
+	if _, ok := changeFrom(ctx); !ok {
+		return nil
+	}
+	members, err := s.groupMembers(ctx, tx, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to record the change")
+	}
+	entry.NewMembers = members
+	if err = s.recordChange(ctx, tx, entry); err != nil {
+		return err
+	}
+	return s.keepTombstone(ctx, tx, membersTombstone(entry.ChatID, entry.Group, entry.OldMembers, members, replaced))
+}
+
+// keepTombstone inserts the tombstone of removed data, if the context carries the change
+func (s *sqlStore) keepTombstone(ctx context.Context, tx *sql.Tx, tombstone Tombstone) error {
+	tombstone, ok := changeTombstone(ctx, tombstone)
+	if !ok {
+		return nil
+	}
+	return errors.Wrap(s.insertTombstone(ctx, tx, tombstone), "failed to keep the tombstone")
+}
+
+// renameTombstones moves tombstones of the group to its new alias, so it can be restored after rename
+func (s *sqlStore) renameTombstones(ctx context.Context, tx *sql.Tx, chatID string, from string, to string) error {
+	rows, err := tx.QueryContext(ctx, s.rebind(`SELECT id, data FROM tombstones WHERE chat_id = ?`), chatID)
+	if err != nil {
+		return err
+	}
+	// collecting tombstones first, as the query must be finished before updates
+	renamed := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var data string
+		if err = rows.Scan(&id, &data); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		var tombstone Tombstone
+		if err = json.Unmarshal([]byte(data), &tombstone); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		if tombstone.Group != from {
+			continue
+		}
+		tombstone.Group = to
+		updated, err := json.Marshal(tombstone)
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+		renamed[id] = string(updated)
+	}
+	if err = rows.Close(); err != nil {
+		return err
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for id, data := range renamed {
+		if _, err = tx.ExecContext(ctx, s.rebind(`UPDATE tombstones SET data = ? WHERE id = ?`), data, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreTombstone reverts the change, kept in the tombstone, and records the restore
+// into the audit log, the restore itself keeps no tombstone
+func (s *sqlStore) restoreTombstone(ctx context.Context, tx *sql.Tx, chatID string, tombstone Tombstone) error {
+	alias := tombstone.Group
+	if !tombstone.GroupDeleted {
+		id, err := s.lockGroup(ctx, tx, chatID, alias)
+		if err != nil {
+			return err
+		}
+		oldMembers, err := s.groupMembers(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		position := len(oldMembers)
+		if tombstone.Replaced {
+			if _, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM members WHERE group_id = ?`), id); err != nil {
+				return err
+			}
+			position = 0
+		}
+		if _, err = s.insertMembers(ctx, tx, id, position, tombstone.Members); err != nil {
+			return err
+		}
+		members, err := s.groupMembers(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return s.recordChange(ctx, tx, AuditEntry{ChatID: chatID, Group: alias, OldMembers: oldMembers, NewMembers: members})
+	}
+
+	if err := s.checkAliasFree(ctx, tx, chatID, alias); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO chats (id) VALUES (?) ON CONFLICT DO NOTHING`), chatID); err != nil {
+		return err
+	}
+	var id int64
+	err := tx.QueryRowContext(ctx,
+		s.rebind(`INSERT INTO user_groups (chat_id, alias, admins_only, cooldown, description)
+		VALUES (?, ?, ?, ?, ?) RETURNING id`),
+		chatID, alias, tombstone.Settings.AdminsOnly, tombstone.Settings.Cooldown, tombstone.Settings.Description,
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+	if _, err = s.insertMembers(ctx, tx, id, 0, tombstone.Members); err != nil {
+		return err
+	}
+	for _, synonym := range tombstone.Synonyms {
+		if err = s.checkAliasFree(ctx, tx, chatID, synonym); err != nil {
+			return errors.Wrapf(err, "failed to restore synonym %s", synonym)
+		}
+		_, err = tx.ExecContext(ctx,
+			s.rebind(`INSERT INTO synonyms (chat_id, synonym, group_id) VALUES (?, ?, ?)`),
+			chatID, synonym, id,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "failed to restore synonym %s", synonym)
+		}
+	}
+	return s.recordChange(ctx, tx, AuditEntry{ChatID: chatID, Group: alias, NewMembers: unique(tombstone.Members)})
+}
+
+// insertTombstone saves the tombstone, its id is assigned by the database
+func (s *sqlStore) insertTombstone(ctx context.Context, tx *sql.Tx, tombstone Tombstone) error {
+	data, err := json.Marshal(tombstone)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		s.rebind(`INSERT INTO tombstones (chat_id, at, data) VALUES (?, ?, ?)`),
+		tombstone.ChatID, tombstone.At.UnixNano(), string(data),
+	)
+	return err
+}
+
+// groupTombstone returns the tombstone of the group with the given id with its
+// members, settings and synonyms, as they are gone with the group
+func (s *sqlStore) groupTombstone(ctx context.Context, tx *sql.Tx, chatID string, alias string, id int64) (Tombstone, error) {
+	tombstone := Tombstone{ChatID: chatID, Group: alias, GroupDeleted: true}
+	members, err := s.groupMembers(ctx, tx, id)
+	if err != nil {
+		return Tombstone{}, err
+	}
+	tombstone.Members = members
+	err = tx.QueryRowContext(ctx,
+		s.rebind(`SELECT admins_only, cooldown, description FROM user_groups WHERE id = ?`),
+		id,
+	).Scan(&tombstone.Settings.AdminsOnly, &tombstone.Settings.Cooldown, &tombstone.Settings.Description)
+	if err != nil {
+		return Tombstone{}, err
+	}
+	rows, err := tx.QueryContext(ctx, s.rebind(`SELECT synonym FROM synonyms WHERE group_id = ? ORDER BY synonym`), id)
+	if err != nil {
+		return Tombstone{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var synonym string
+		if err = rows.Scan(&synonym); err != nil {
+			return Tombstone{}, err
+		}
+		tombstone.Synonyms = append(tombstone.Synonyms, synonym)
+	}
+	return tombstone, rows.Err()
+}
+
+// insertAuditEntry puts the entry to the end of the audit log of the chat
+func (s *sqlStore) insertAuditEntry(ctx context.Context, tx *sql.Tx, entry AuditEntry) error {
+	oldMembers, err := json.Marshal(entry.OldMembers)
+	if err != nil {
+		return err
+	}
+	newMembers, err := json.Marshal(entry.NewMembers)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		s.rebind(`INSERT INTO audit_log (chat_id, group_alias, actor, action, details, old_members, new_members, at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+		entry.ChatID, entry.Group, entry.Actor, entry.Action, entry.Details,
+		string(oldMembers), string(newMembers), entry.At.UnixNano(),
+	)
+	return err
+}
+
+// rebind replaces ? parameters of the query with ones of the dialect
+func (s *sqlStore) rebind(query string) string {
+	if !s.dialect.numberedParams {
+		return query
+	}
+	sb := strings.Builder{}
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			_, _ = sb.WriteRune(r)
+			continue
+		}
+		n++
+		_, _ = sb.WriteString("$" + strconv.Itoa(n))
+	}
+	return sb.String()
+}
@@ -0,0 +1,131 @@
+package groups
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	// registers pure-go sqlite3 driver
+	_ "github.com/ncruces/go-sqlite3/driver"
+	"github.com/pkg/errors"
+)
+
+// sqliteMigrations describe the schema of the database, migrations are applied
+// in order, the number of applied ones is kept in the user_version pragma,
+// so the new migration must be appended to the end of the list
+var sqliteMigrations = []string{
+	`CREATE TABLE chats (
+		id TEXT PRIMARY KEY
+	);
+	CREATE TABLE user_groups (
+		id          INTEGER PRIMARY KEY,
+		chat_id     TEXT    NOT NULL REFERENCES chats (id) ON DELETE CASCADE,
+		alias       TEXT    NOT NULL,
+		admins_only INTEGER NOT NULL DEFAULT 0,
+		cooldown    INTEGER NOT NULL DEFAULT 0,
+		description TEXT    NOT NULL DEFAULT '',
+		UNIQUE (chat_id, alias)
+	);
+	CREATE TABLE members (
+		group_id INTEGER NOT NULL REFERENCES user_groups (id) ON DELETE CASCADE,
+		username TEXT    NOT NULL,
+		position INTEGER NOT NULL,
+		PRIMARY KEY (group_id, username)
+	);
+	CREATE INDEX members_position ON members (group_id, position);
+	CREATE INDEX members_username ON members (username);
+	CREATE TABLE synonyms (
+		chat_id  TEXT    NOT NULL REFERENCES chats (id) ON DELETE CASCADE,
+		synonym  TEXT    NOT NULL,
+		group_id INTEGER NOT NULL REFERENCES user_groups (id) ON DELETE CASCADE,
+		PRIMARY KEY (chat_id, synonym)
+	);
+	CREATE INDEX synonyms_group ON synonyms (group_id);
+	CREATE TABLE triggers (
+		chat_id TEXT NOT NULL REFERENCES chats (id) ON DELETE CASCADE,
+		subject TEXT NOT NULL,
+		at      TEXT NOT NULL,
+		PRIMARY KEY (chat_id, subject)
+	);
+	CREATE TABLE quiet_hours (
+		chat_id     TEXT    NOT NULL REFERENCES chats (id) ON DELETE CASCADE,
+		subject     TEXT    NOT NULL,
+		from_minute INTEGER NOT NULL,
+		to_minute   INTEGER NOT NULL,
+		location    TEXT    NOT NULL,
+		skip        INTEGER NOT NULL,
+		PRIMARY KEY (chat_id, subject)
+	);`,
+	// audit log is append-only and outlives groups, members are JSON lists, time is in unix nanoseconds
+	`CREATE TABLE audit_log (
+		id          INTEGER PRIMARY KEY,
+		chat_id     TEXT    NOT NULL,
+		group_alias TEXT    NOT NULL,
+		actor       TEXT    NOT NULL,
+		action      TEXT    NOT NULL,
+		details     TEXT    NOT NULL,
+		old_members TEXT    NOT NULL,
+		new_members TEXT    NOT NULL,
+		at          INTEGER NOT NULL
+	);
+	CREATE INDEX audit_log_group ON audit_log (chat_id, group_alias, id);
+	CREATE INDEX audit_log_at ON audit_log (chat_id, at);`,
+	// tombstones are kept as JSON documents, time is in unix nanoseconds
+	`CREATE TABLE tombstones (
+		id      INTEGER PRIMARY KEY,
+		chat_id TEXT    NOT NULL,
+		at      INTEGER NOT NULL,
+		data    TEXT    NOT NULL
+	);
+	CREATE INDEX tombstones_at ON tombstones (chat_id, at);`,
+}
+
+// SQLite implements store to put and get groups with specific alias in the sqlite database
+type SQLite struct {
+	*sqlStore
+}
+
+// NewSQLite opens the sqlite database at the given location and brings its schema up to date
+func NewSQLite(location string) (*SQLite, error) {
+	log.Print("[INFO] groups.SQLite instantiated")
+	// wal journal allows to read the database, while the bot is writing into it,
+	// immediate transactions prevent deadlocks on upgrading read locks to write ones
+	dsn := "file:" + location +
+		"?_pragma=foreign_keys(1)&_pragma=busy_timeout(10000)&_pragma=journal_mode(wal)&_txlock=immediate"
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open sqlite at %s", location)
+	}
+	if err = migrateSQLite(db); err != nil {
+		_ = db.Close()
+		return nil, errors.Wrapf(err, "failed to migrate sqlite at %s", location)
+	}
+	return &SQLite{sqlStore: &sqlStore{db: db}}, nil
+}
+
+// migrateSQLite applies all migrations, that were not applied yet
+func migrateSQLite(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	var version int
+	if err = tx.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return errors.Wrap(err, "failed to get schema version")
+	}
+
+	for ; version < len(sqliteMigrations); version++ {
+		if _, err = tx.Exec(sqliteMigrations[version]); err != nil {
+			return errors.Wrapf(err, "failed to apply migration #%d", version+1)
+		}
+		// pragmas don't accept query parameters
+		if _, err = tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+			return errors.Wrapf(err, "failed to set schema version %d", version+1)
+		}
+		log.Printf("[INFO] sqlite migration #%d applied", version+1)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,44 @@
+package groups
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLite_Migrate(t *testing.T) {
+	svc := prepareSQLite(t)
+
+	var version int
+	require.NoError(t, svc.db.QueryRow(`PRAGMA user_version`).Scan(&version))
+	assert.Equal(t, len(sqliteMigrations), version)
+
+	// applying migrations again is no-op
+	require.NoError(t, migrateSQLite(svc.db))
+	require.NoError(t, svc.db.QueryRow(`PRAGMA user_version`).Scan(&version))
+	assert.Equal(t, len(sqliteMigrations), version)
+}
+
+func TestSQLite_Ping(t *testing.T) {
+	svc := prepareSQLite(t)
+	assert.NoError(t, svc.Ping(context.Background()))
+}
+
+func prepareSQLite(t *testing.T) *SQLite {
+	loc, err := ioutil.TempDir("", "test_groups_multibot")
+	require.NoError(t, err, "failed to make temp dir")
+
+	svc, err := NewSQLite(path.Join(loc, "groups_bot_test.sqlite"))
+	require.NoError(t, err, "new sqlite storage")
+
+	t.Cleanup(func() {
+		assert.NoError(t, svc.Close())
+		assert.NoError(t, os.RemoveAll(loc))
+	})
+	return svc
+}
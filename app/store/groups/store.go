@@ -1,15 +1,76 @@
 package groups
 
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Errors, that are returned by all implementations of Store, possibly wrapped,
+// use errors.Is to check them
+var (
+	ErrChatNotFound      = errors.New("chat not found")
+	ErrGroupNotFound     = errors.New("group not found")
+	ErrUserNotInGroup    = errors.New("user is not in the group")
+	ErrGroupExists       = errors.New("group already exists")
+	ErrSynonymNotFound   = errors.New("synonym not found")
+	ErrTombstoneNotFound = errors.New("tombstone not found")
+	ErrTriggerCooldown   = errors.New("trigger is in cooldown")
+)
+
 //go:generate mockery -inpkg -name Store -case snake
 
-// Store defines methods to store and fetch user groups
+// Store defines methods to store and fetch user groups, members of the group
+// are a set of usernames, kept in order of their addition
 type Store interface {
-	PutGroup(chatID string, alias string, users []string) (err error)
-	AddUser(chatID string, alias string, user string) (err error)
-	GetGroup(chatID string, alias string) (users []string, err error)
-	GetGroups(chatID string) (groups map[string][]string, err error)
-	DeleteUserFromGroup(chatID string, alias string, user string) (err error)
-	DeleteGroup(chatID string, alias string) (err error)
-	FindAliases(chatID string, aliases []string) (users []string, err error)
-	AddChat(id string) (err error)
+	CreateGroup(ctx context.Context, chatID string, alias string, users []string) (err error) // fails with ErrGroupExists, if the group exists
+	PutGroup(ctx context.Context, chatID string, alias string, users []string) (err error)    // creates the group or replaces its members
+	AddUsers(ctx context.Context, chatID string, alias string, users []string) (added int, err error)
+	GetGroup(ctx context.Context, chatID string, alias string) (users []string, err error)
+	GetGroups(ctx context.Context, chatID string) (groups map[string][]string, err error)
+	DeleteUsers(ctx context.Context, chatID string, alias string, users []string) (removed int, err error) // fails with ErrUserNotInGroup, if nothing removed
+	DeleteGroup(ctx context.Context, chatID string, alias string) (err error)
+	FindAliases(ctx context.Context, chatID string, aliases []string) (groups map[string][]string, err error)
+	AddChat(ctx context.Context, id string) (err error)
+	GetChats(ctx context.Context) (ids []string, err error) // sorted ids of all known chats
+	RenameGroup(ctx context.Context, chatID string, oldAlias string, newAlias string) (err error)
+	CopyGroup(ctx context.Context, chatID string, srcAlias string, dstAlias string) (err error)
+	AddSynonym(ctx context.Context, chatID string, alias string, synonym string) (err error)
+	DeleteSynonym(ctx context.Context, chatID string, synonym string) (err error)
+	GetSynonyms(ctx context.Context, chatID string) (synonyms map[string][]string, err error)
+	ImportGroups(ctx context.Context, chatID string, snapshots []GroupSnapshot) (err error) // creates or replaces groups in a single transaction
+
+	GetGroupSettings(ctx context.Context, chatID string, alias string) (settings GroupSettings, err error)
+	PutGroupSettings(ctx context.Context, chatID string, alias string, settings GroupSettings) (err error)
+	GetAllGroupSettings(ctx context.Context, chatID string) (settings map[string]GroupSettings, err error)
+	GetLastTrigger(ctx context.Context, chatID string, subject string) (at time.Time, err error)
+	PutLastTrigger(ctx context.Context, chatID string, subject string, at time.Time) (err error)
+	// PutLastTriggerAfter saves the trigger only if the cooldown has passed since the last one, checked and saved
+	// in a single transaction, otherwise fails with ErrTriggerCooldown and returns the time of the next allowed trigger
+	PutLastTriggerAfter(ctx context.Context, chatID string, subject string, at time.Time, cooldown time.Duration) (next time.Time, err error)
+
+	GetQuietHours(ctx context.Context, chatID string) (quietHours map[string]QuietHours, err error)
+	PutQuietHours(ctx context.Context, chatID string, subject string, quietHours *QuietHours) (err error)
+
+	AddAuditEntry(ctx context.Context, entry AuditEntry) (err error)
+	GetAuditLog(ctx context.Context, chatID string, alias string, limit int) (entries []AuditEntry, err error) // newest entries first
+	PurgeAuditLog(ctx context.Context, chatID string, before time.Time) (purged int, err error)
+
+	AddTombstone(ctx context.Context, tombstone Tombstone) (err error)
+	GetTombstones(ctx context.Context, chatID string) (tombstones []Tombstone, err error) // newest tombstones first
+	DeleteTombstone(ctx context.Context, chatID string, id int64) (err error)             // fails with ErrTombstoneNotFound, if there is no such
+	// RestoreTombstone reverts the change, kept in the tombstone with the same id, and removes the tombstone in a single
+	// transaction, fails with ErrTombstoneNotFound, if there is no such, nothing is restored, if any part fails
+	RestoreTombstone(ctx context.Context, chatID string, tombstone Tombstone) (err error)
+	PurgeTombstones(ctx context.Context, chatID string, before time.Time) (purged int, err error)
+
+	Ping(ctx context.Context) (err error) // checks, that the storage is reachable
+}
+
+// GroupSettings describes per-group options and metadata
+type GroupSettings struct {
+	AdminsOnly  bool          `json:"admins_only,omitempty"` // only admins are allowed to trigger the group
+	Cooldown    time.Duration `json:"cooldown,omitempty"`    // overrides the default group cooldown, if not zero
+	Description string        `json:"description,omitempty"` // human-readable purpose of the group
 }
@@ -0,0 +1,807 @@
+// Package storetest contains the conformance test suite, that every
+// implementation of groups.Store has to pass
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Semior001/multibot-utility/app/store/groups"
+)
+
+// Run runs all conformance tests against the store, prepare has to
+// return a new empty store for each test
+func Run(t *testing.T, prepare func(t *testing.T) groups.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, svc groups.Store)
+	}{
+		{name: "Groups", fn: testGroups},
+		{name: "AddChat", fn: testAddChat},
+		{name: "MissingChat", fn: testMissingChat},
+		{name: "DuplicateUsers", fn: testDuplicateUsers},
+		{name: "CreateGroup", fn: testCreateGroup},
+		{name: "UnicodeAliases", fn: testUnicodeAliases},
+		{name: "GroupSettings", fn: testGroupSettings},
+		{name: "LastTrigger", fn: testLastTrigger},
+		{name: "QuietHours", fn: testQuietHours},
+		{name: "RenameAndCopyGroup", fn: testRenameAndCopyGroup},
+		{name: "Synonyms", fn: testSynonyms},
+		{name: "AuditLog", fn: testAuditLog},
+		{name: "RecordChanges", fn: testRecordChanges},
+		{name: "KeepTombstones", fn: testKeepTombstones},
+		{name: "Tombstones", fn: testTombstones},
+		{name: "RestoreTombstones", fn: testRestoreTombstones},
+		{name: "ImportGroups", fn: testImportGroups},
+		{name: "ContextCanceled", fn: testContextCanceled},
+		{name: "Ping", fn: testPing},
+		{name: "ConcurrentMembers", fn: testConcurrentMembers},
+		{name: "ConcurrentTriggers", fn: testConcurrentTriggers},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { tt.fn(t, prepare(t)) })
+	}
+}
+
+func testGroups(t *testing.T, svc groups.Store) {
+	ctx := context.Background()
+
+	_, err := svc.GetGroups(ctx, "foo")
+	assert.True(t, errors.Is(err, groups.ErrChatNotFound), err)
+
+	require.NoError(t, svc.PutGroup(ctx, "foo", "@Bar", []string{"@blah", "@blah1", "@blah2"}))
+	require.NoError(t, svc.PutGroup(ctx, "foo", "@empty", nil))
+
+	users, err := svc.GetGroup(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah", "@blah1", "@blah2"}, users)
+
+	added, err := svc.AddUsers(ctx, "foo", "@bar", []string{"@blah3"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+	added, err = svc.AddUsers(ctx, "foo", "@bar", []string{"@blah"})
+	require.NoError(t, err, "already added user is ignored")
+	assert.Equal(t, 0, added)
+	removed, err := svc.DeleteUsers(ctx, "foo", "@bar", []string{"@blah1"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	_, err = svc.DeleteUsers(ctx, "foo", "@bar", []string{"@blah1"})
+	assert.True(t, errors.Is(err, groups.ErrUserNotInGroup), err)
+
+	grps, err := svc.GetGroups(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"@bar":   {"@blah", "@blah2", "@blah3"},
+		"@empty": nil,
+	}, grps)
+
+	// putting the group again replaces its members
+	require.NoError(t, svc.PutGroup(ctx, "foo", "@bar", []string{"@blah4"}))
+	found, err := svc.FindAliases(ctx, "foo", []string{"@BAR", "@unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"@bar": {"@blah4"}}, found)
+
+	require.NoError(t, svc.DeleteGroup(ctx, "foo", "@bar"))
+	_, err = svc.GetGroup(ctx, "foo", "@bar")
+	assert.True(t, errors.Is(err, groups.ErrGroupNotFound), err)
+	err = svc.DeleteGroup(ctx, "foo", "@bar")
+	assert.True(t, errors.Is(err, groups.ErrGroupNotFound), err)
+}
+
+func testAddChat(t *testing.T, svc groups.Store) {
+	ctx := context.Background()
+
+	require.NoError(t, svc.AddChat(ctx, "foo"))
+	require.NoError(t, svc.AddChat(ctx, "foo"), "adding chat twice is allowed")
+
+	grps, err := svc.GetGroups(ctx, "foo")
+	require.NoError(t, err)
+	assert.Empty(t, grps)
+
+	_, err = svc.AddUsers(ctx, "foo", "@bar", []string{"@blah"})
+	assert.True(t, errors.Is(err, groups.ErrGroupNotFound), err)
+	_, err = svc.AddUsers(ctx, "unknown", "@bar", []string{"@blah"})
+	assert.True(t, errors.Is(err, groups.ErrChatNotFound), err)
+
+	require.NoError(t, svc.CreateGroup(ctx, "bar", "@bar", []string{"@blah"}))
+	require.NoError(t, svc.AddChat(ctx, "-100"))
+	chats, err := svc.GetChats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-100", "bar", "foo"}, chats)
+}
+
+func testGroupSettings(t *testing.T, svc groups.Store) {
+	ctx := context.Background()
+
+	settings, err := svc.GetGroupSettings(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.Equal(t, groups.GroupSettings{}, settings)
+
+	err = svc.PutGroupSettings(ctx, "foo", "@bar", groups.GroupSettings{AdminsOnly: true})
+	assert.True(t, errors.Is(err, groups.ErrChatNotFound), err)
+
+	require.NoError(t, svc.PutGroup(ctx, "foo", "@bar", []string{"@blah"}))
+	require.NoError(t, svc.PutGroup(ctx, "foo", "@baz", []string{"@blah"}))
+	expected := groups.GroupSettings{AdminsOnly: true, Cooldown: 5 * time.Minute, Description: "backend team"}
+	require.NoError(t, svc.PutGroupSettings(ctx, "foo", "@Bar", expected))
+
+	settings, err = svc.GetGroupSettings(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.Equal(t, expected, settings)
+
+	all, err := svc.GetAllGroupSettings(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]groups.GroupSettings{"@bar": expected}, all)
+}
+
+func testLastTrigger(t *testing.T, svc groups.Store) {
+	ctx := context.Background()
+
+	at, err := svc.GetLastTrigger(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.True(t, at.IsZero())
+
+	now := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, svc.PutLastTrigger(ctx, "foo", "@bar", now))
+	require.NoError(t, svc.PutLastTrigger(ctx, "foo", "@bar", now.Add(time.Minute)))
+
+	at, err = svc.GetLastTrigger(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.True(t, now.Add(time.Minute).Equal(at))
+
+	next, err := svc.PutLastTriggerAfter(ctx, "foo", "@bar", now.Add(5*time.Minute), 10*time.Minute)
+	assert.True(t, errors.Is(err, groups.ErrTriggerCooldown), err)
+	assert.True(t, now.Add(11*time.Minute).Equal(next), next)
+
+	next, err = svc.PutLastTriggerAfter(ctx, "foo", "@bar", now.Add(11*time.Minute), 10*time.Minute)
+	require.NoError(t, err)
+	assert.True(t, next.IsZero())
+	at, err = svc.GetLastTrigger(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.True(t, now.Add(11*time.Minute).Equal(at))
+
+	_, err = svc.PutLastTriggerAfter(ctx, "baz", "user:1", now, time.Minute)
+	require.NoError(t, err, "the first trigger of the subject is always allowed")
+	at, err = svc.GetLastTrigger(ctx, "baz", "user:1")
+	require.NoError(t, err)
+	assert.True(t, now.Equal(at))
+}
+
+func testConcurrentTriggers(t *testing.T, svc groups.Store) {
+	ctx := context.Background()
+	now := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	for _, subject := range []string{"@new", "@old"} {
+		if subject == "@old" {
+			require.NoError(t, svc.PutLastTrigger(ctx, "foo", subject, now.Add(-time.Hour)))
+		}
+
+		var mu sync.Mutex
+		var passed int
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := svc.PutLastTriggerAfter(ctx, "foo", subject, now, time.Minute)
+				if errors.Is(err, groups.ErrTriggerCooldown) {
+					return
+				}
+				assert.NoError(t, err)
+				mu.Lock()
+				passed++
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, 1, passed, "only one of concurrent triggers of %s passes", subject)
+	}
+}
+
+func testQuietHours(t *testing.T, svc groups.Store) {
+	ctx := context.Background()
+
+	chat := groups.QuietHours{From: 22 * 60, To: 8 * 60, Location: "Europe/Berlin"}
+	user := groups.QuietHours{From: 0, To: 9 * 60, Location: "UTC", Skip: true}
+	require.NoError(t, svc.PutQuietHours(ctx, "foo", groups.ChatQuietHours, &chat))
+	require.NoError(t, svc.PutQuietHours(ctx, "foo", "@blah", &user))
+
+	res, err := svc.GetQuietHours(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]groups.QuietHours{groups.ChatQuietHours: chat, "@blah": user}, res)
+
+	require.NoError(t, svc.PutQuietHours(ctx, "foo", "@blah", nil))
+	res, err = svc.GetQuietHours(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]groups.QuietHours{groups.ChatQuietHours: chat}, res)
+}
+
+func testRenameAndCopyGroup(t *testing.T, svc groups.Store) {
+	ctx := context.Background()
+
+	settings := groups.GroupSettings{Description: "backend team"}
+	now := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, svc.PutGroup(ctx, "foo", "@bar", []string{"@blah", "@blah1"}))
+	require.NoError(t, svc.PutGroupSettings(ctx, "foo", "@bar", settings))
+	require.NoError(t, svc.PutLastTrigger(ctx, "foo", "@bar", now))
+	require.NoError(t, svc.AddSynonym(ctx, "foo", "@bar", "@be"))
+
+	require.NoError(t, svc.RenameGroup(ctx, "foo", "@bar", "@backend"))
+
+	users, err := svc.GetGroup(ctx, "foo", "@be")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah", "@blah1"}, users)
+	s, err := svc.GetGroupSettings(ctx, "foo", "@backend")
+	require.NoError(t, err)
+	assert.Equal(t, settings, s)
+	at, err := svc.GetLastTrigger(ctx, "foo", "@backend")
+	require.NoError(t, err)
+	assert.True(t, now.Equal(at))
+
+	require.NoError(t, svc.CopyGroup(ctx, "foo", "@backend", "@bar"))
+	users, err = svc.GetGroup(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah", "@blah1"}, users)
+	s, err = svc.GetGroupSettings(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.Equal(t, settings, s)
+	at, err = svc.GetLastTrigger(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.True(t, at.IsZero(), "trigger state is not copied")
+
+	err = svc.RenameGroup(ctx, "foo", "@bar", "@backend")
+	assert.True(t, errors.Is(err, groups.ErrGroupExists), err)
+	err = svc.CopyGroup(ctx, "foo", "@bar", "@be")
+	assert.True(t, errors.Is(err, groups.ErrGroupExists), err)
+	err = svc.RenameGroup(ctx, "foo", "@unknown", "@new")
+	assert.True(t, errors.Is(err, groups.ErrGroupNotFound), err)
+}
+
+func testSynonyms(t *testing.T, svc groups.Store) {
+	ctx := context.Background()
+
+	require.NoError(t, svc.PutGroup(ctx, "foo", "@backend", []string{"@blah"}))
+	require.NoError(t, svc.PutGroup(ctx, "foo", "@frontend", []string{"@blah1"}))
+	require.NoError(t, svc.AddSynonym(ctx, "foo", "@backend", "@BE"))
+	require.NoError(t, svc.AddSynonym(ctx, "foo", "@be", "@back_end"))
+
+	err := svc.AddSynonym(ctx, "foo", "@frontend", "@be")
+	assert.True(t, errors.Is(err, groups.ErrGroupExists), err)
+	err = svc.AddSynonym(ctx, "foo", "@frontend", "@backend")
+	assert.True(t, errors.Is(err, groups.ErrGroupExists), err)
+	err = svc.PutGroup(ctx, "foo", "@be", nil)
+	assert.True(t, errors.Is(err, groups.ErrGroupExists), err)
+
+	synonyms, err := svc.GetSynonyms(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"@backend": {"@back_end", "@be"}}, synonyms)
+
+	require.NoError(t, svc.DeleteSynonym(ctx, "foo", "@back_end"))
+	err = svc.DeleteSynonym(ctx, "foo", "@back_end")
+	assert.True(t, errors.Is(err, groups.ErrSynonymNotFound), err)
+
+	// groups are copied, renamed and deleted by their synonyms too
+	_, err = svc.AddUsers(ctx, "foo", "@be", []string{"@blah2"})
+	require.NoError(t, err)
+	require.NoError(t, svc.CopyGroup(ctx, "foo", "@be", "@backend_copy"))
+	users, err := svc.GetGroup(ctx, "foo", "@backend_copy")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah", "@blah2"}, users)
+
+	require.NoError(t, svc.RenameGroup(ctx, "foo", "@be", "@back-end"))
+	users, err = svc.GetGroup(ctx, "foo", "@be")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah", "@blah2"}, users, "synonym follows the renamed group")
+	synonyms, err = svc.GetSynonyms(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"@back-end": {"@be"}}, synonyms)
+
+	require.NoError(t, svc.DeleteGroup(ctx, "foo", "@be"))
+	_, err = svc.GetGroup(ctx, "foo", "@back-end")
+	assert.True(t, errors.Is(err, groups.ErrGroupNotFound), err)
+	synonyms, err = svc.GetSynonyms(ctx, "foo")
+	require.NoError(t, err)
+	assert.Empty(t, synonyms, "synonyms are removed with the group")
+}
+
+func testContextCanceled(t *testing.T, svc groups.Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := svc.PutGroup(ctx, "foo", "@bar", []string{"@blah"})
+	assert.True(t, errors.Is(err, context.Canceled), err)
+}
+
+func testPing(t *testing.T, svc groups.Store) {
+	assert.NoError(t, svc.Ping(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, svc.Ping(ctx), "canceled ping fails")
+}
+
+func testAuditLog(t *testing.T, svc groups.Store) {
+	ctx := context.Background()
+
+	entries, err := svc.GetAuditLog(ctx, "foo", "@bar", 10)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	start := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	expected := []groups.AuditEntry{
+		{ChatID: "foo", Group: "@bar", Actor: "@admin", Action: groups.ActionCreateGroup,
+			NewMembers: []string{"@blah", "@blah1"}, At: start},
+		{ChatID: "foo", Group: "@baz", Actor: "@admin", Action: groups.ActionCreateGroup,
+			NewMembers: []string{"@blah"}, At: start.Add(time.Minute)},
+		{ChatID: "foo", Group: "@bar", Actor: "@admin1", Action: groups.ActionDeleteUsers,
+			OldMembers: []string{"@blah", "@blah1"}, NewMembers: []string{"@blah"}, At: start.Add(2 * time.Minute)},
+		{ChatID: "foo", Group: "@bar", Actor: "@admin", Action: groups.ActionDescribeGroup,
+			Details: "backend team", At: start.Add(3 * time.Minute)},
+	}
+	for _, entry := range expected {
+		require.NoError(t, svc.AddAuditEntry(ctx, entry))
+	}
+	require.NoError(t, svc.AddAuditEntry(ctx, groups.AuditEntry{ChatID: "other", Group: "@bar", Action: groups.ActionDeleteGroup, At: start}))
+
+	entries, err = svc.GetAuditLog(ctx, "foo", "@BAR", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []groups.AuditEntry{expected[3], expected[2], expected[0]}, entries, "newest entries first")
+
+	entries, err = svc.GetAuditLog(ctx, "foo", "@bar", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []groups.AuditEntry{expected[3], expected[2]}, entries)
+
+	entries, err = svc.GetAuditLog(ctx, "foo", "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []groups.AuditEntry{expected[3], expected[2], expected[1], expected[0]}, entries, "empty alias means all groups")
+
+	purged, err := svc.PurgeAuditLog(ctx, "foo", start.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged)
+
+	entries, err = svc.GetAuditLog(ctx, "foo", "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []groups.AuditEntry{expected[3], expected[2]}, entries)
+
+	entries, err = svc.GetAuditLog(ctx, "other", "@bar", 0)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "purge is limited to the chat")
+}
+
+func testRecordChanges(t *testing.T, svc groups.Store) {
+	at := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	change := func(action, details string) context.Context {
+		return groups.WithChange(context.Background(), groups.Change{Actor: "@admin", Action: action, Details: details, At: at})
+	}
+	entry := func(alias, action, details string, oldMembers, newMembers []string) groups.AuditEntry {
+		return groups.AuditEntry{ChatID: "foo", Group: alias, Actor: "@admin", Action: action, Details: details,
+			OldMembers: oldMembers, NewMembers: newMembers, At: at}
+	}
+
+	require.NoError(t, svc.CreateGroup(change(groups.ActionCreateGroup, ""), "foo", "@bar", []string{"@blah"}))
+	require.NoError(t, svc.AddSynonym(change(groups.ActionAddSynonym, ""), "foo", "@bar", "@be"))
+	_, err := svc.AddUsers(change(groups.ActionAddUsers, ""), "foo", "@be", []string{"@blah1"})
+	require.NoError(t, err)
+	_, err = svc.AddUsers(change(groups.ActionAddUsers, ""), "foo", "@be", []string{"@blah1"})
+	require.NoError(t, err, "nothing is recorded, if no users were added")
+	_, err = svc.DeleteUsers(change(groups.ActionDeleteUsers, ""), "foo", "@be", []string{"@blah"})
+	require.NoError(t, err)
+	err = svc.PutGroupSettings(change(groups.ActionDescribeGroup, "backend"), "foo", "@be", groups.GroupSettings{Description: "backend"})
+	require.NoError(t, err)
+	require.NoError(t, svc.RenameGroup(change(groups.ActionRenameGroup, ""), "foo", "@be", "@devs"))
+	require.NoError(t, svc.PutGroup(change(groups.ActionReplaceGroup, ""), "foo", "@devs", []string{"@blah2"}))
+	require.NoError(t, svc.DeleteSynonym(change(groups.ActionDeleteSynonym, ""), "foo", "@be"))
+
+	err = svc.CreateGroup(change(groups.ActionCreateGroup, ""), "foo", "@devs", []string{"@blah"})
+	require.True(t, errors.Is(err, groups.ErrGroupExists))
+	require.NoError(t, svc.CreateGroup(context.Background(), "foo", "@qa", []string{"@blah"}), "change without context is not recorded")
+
+	entries, err := svc.GetAuditLog(context.Background(), "foo", "@devs", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []groups.AuditEntry{
+		entry("@devs", groups.ActionDeleteSynonym, "@be", nil, nil),
+		entry("@devs", groups.ActionReplaceGroup, "", []string{"@blah1"}, []string{"@blah2"}),
+		entry("@devs", groups.ActionRenameGroup, "from @bar", nil, nil),
+		entry("@devs", groups.ActionDescribeGroup, "backend", nil, nil),
+		entry("@devs", groups.ActionDeleteUsers, "", []string{"@blah", "@blah1"}, []string{"@blah1"}),
+		entry("@devs", groups.ActionAddUsers, "", []string{"@blah"}, []string{"@blah", "@blah1"}),
+		entry("@devs", groups.ActionAddSynonym, "@be", nil, nil),
+		entry("@devs", groups.ActionCreateGroup, "", nil, []string{"@blah"}),
+	}, entries, "entries are kept under the canonical alias and follow the group on rename")
+
+	require.NoError(t, svc.CopyGroup(change(groups.ActionCopyGroup, ""), "foo", "@devs", "@ops"))
+	require.NoError(t, svc.AddSynonym(change(groups.ActionAddSynonym, ""), "foo", "@ops", "@sre"))
+	err = svc.ImportGroups(change(groups.ActionImportGroup, ""), "foo", []groups.GroupSnapshot{
+		{Alias: "@ops", Members: []string{"@blah3"}},
+		{Alias: "@qa", Members: []string{"@blah4"}, Synonyms: []string{"@devs"}},
+	})
+	require.True(t, errors.Is(err, groups.ErrGroupExists), "failed import is not recorded")
+	err = svc.ImportGroups(change(groups.ActionImportGroup, ""), "foo", []groups.GroupSnapshot{
+		{Alias: "@ops", Members: []string{"@blah3"}, Synonyms: []string{"@sre"}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, svc.DeleteGroup(change(groups.ActionDeleteGroup, ""), "foo", "@sre"))
+
+	entries, err = svc.GetAuditLog(context.Background(), "foo", "@ops", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []groups.AuditEntry{
+		entry("@ops", groups.ActionDeleteGroup, "", []string{"@blah3"}, nil),
+		entry("@ops", groups.ActionImportGroup, "", []string{"@blah2"}, []string{"@blah3"}),
+		entry("@ops", groups.ActionAddSynonym, "@sre", nil, nil),
+		entry("@ops", groups.ActionCopyGroup, "from @devs", nil, nil),
+	}, entries)
+
+	entries, err = svc.GetAuditLog(context.Background(), "foo", "@qa", 0)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func testKeepTombstones(t *testing.T, svc groups.Store) {
+	at := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	change := func(action string) context.Context {
+		return groups.WithChange(context.Background(), groups.Change{Actor: "@admin", Action: action, At: at})
+	}
+	settings := groups.GroupSettings{AdminsOnly: true, Description: "backend"}
+
+	require.NoError(t, svc.CreateGroup(change(groups.ActionCreateGroup), "foo", "@bar", []string{"@blah", "@blah1", "@blah2"}))
+	require.NoError(t, svc.PutGroupSettings(context.Background(), "foo", "@bar", settings))
+	require.NoError(t, svc.AddSynonym(context.Background(), "foo", "@bar", "@be"))
+	_, err := svc.AddUsers(change(groups.ActionAddUsers), "foo", "@bar", []string{"@blah3"})
+	require.NoError(t, err)
+	_, err = svc.DeleteUsers(change(groups.ActionDeleteUsers), "foo", "@be", []string{"@blah", "@blah4"})
+	require.NoError(t, err)
+	require.NoError(t, svc.PutGroup(change(groups.ActionReplaceGroup), "foo", "@bar", []string{"@blah1", "@blah5"}))
+	require.NoError(t, svc.PutGroup(change(groups.ActionReplaceGroup), "foo", "@bar", []string{"@blah1", "@blah5", "@blah6"}))
+	err = svc.ImportGroups(change(groups.ActionImportGroup), "foo", []groups.GroupSnapshot{
+		{Alias: "@bar", Members: []string{"@blah6"}, Settings: settings, Synonyms: []string{"@be"}},
+		{Alias: "@qa", Members: []string{"@blah"}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, svc.DeleteGroup(change(groups.ActionDeleteGroup), "foo", "@be"))
+	require.NoError(t, svc.DeleteGroup(context.Background(), "foo", "@qa"), "change without context keeps no tombstone")
+
+	tombstones, err := svc.GetTombstones(context.Background(), "foo")
+	require.NoError(t, err)
+	for i := range tombstones {
+		assert.NotZero(t, tombstones[i].ID)
+		tombstones[i].ID = 0
+	}
+	assert.Equal(t, []groups.Tombstone{
+		{ChatID: "foo", Group: "@bar", Actor: "@admin", GroupDeleted: true, Members: []string{"@blah6"},
+			Settings: settings, Synonyms: []string{"@be"}, At: at},
+		{ChatID: "foo", Group: "@bar", Actor: "@admin", Replaced: true, Members: []string{"@blah1", "@blah5", "@blah6"}, At: at},
+		{ChatID: "foo", Group: "@bar", Actor: "@admin", Replaced: true, Members: []string{"@blah1", "@blah2", "@blah3"}, At: at},
+		{ChatID: "foo", Group: "@bar", Actor: "@admin", Members: []string{"@blah"}, At: at},
+	}, tombstones, "removed members and the whole list of replaced ones are kept, nothing is kept, if nobody was removed")
+}
+
+func testTombstones(t *testing.T, svc groups.Store) {
+	ctx := context.Background()
+
+	tombstones, err := svc.GetTombstones(ctx, "foo")
+	require.NoError(t, err)
+	assert.Empty(t, tombstones)
+
+	start := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	expected := []groups.Tombstone{
+		{ChatID: "foo", Group: "@bar", Actor: "@admin", GroupDeleted: true, Members: []string{"@blah", "@blah1"},
+			Settings: groups.GroupSettings{AdminsOnly: true, Description: "backend team"}, Synonyms: []string{"@backend"}, At: start},
+		{ChatID: "foo", Group: "@baz", Actor: "@admin1", Members: []string{"@blah"}, At: start.Add(time.Minute)},
+		{ChatID: "foo", Group: "@bar", Actor: "@admin", Members: []string{"@blah2"}, At: start.Add(2 * time.Minute)},
+	}
+	for _, tombstone := range expected {
+		require.NoError(t, svc.AddTombstone(ctx, tombstone))
+	}
+	require.NoError(t, svc.AddTombstone(ctx, groups.Tombstone{ChatID: "other", Group: "@bar", GroupDeleted: true, At: start}))
+
+	tombstones, err = svc.GetTombstones(ctx, "foo")
+	require.NoError(t, err)
+	require.Len(t, tombstones, 3)
+	for i, tombstone := range tombstones {
+		assert.NotZero(t, tombstone.ID)
+		tombstone.ID = 0
+		assert.Equal(t, expected[len(expected)-1-i], tombstone, "newest tombstones first")
+	}
+	assert.NotEqual(t, tombstones[0].ID, tombstones[1].ID)
+
+	require.NoError(t, svc.DeleteTombstone(ctx, "foo", tombstones[1].ID))
+	err = svc.DeleteTombstone(ctx, "foo", tombstones[1].ID)
+	assert.True(t, errors.Is(err, groups.ErrTombstoneNotFound), "tombstone is already deleted")
+	err = svc.DeleteTombstone(ctx, "unknown", tombstones[0].ID)
+	assert.True(t, errors.Is(err, groups.ErrTombstoneNotFound), "tombstone of the other chat")
+
+	left, err := svc.GetTombstones(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, []groups.Tombstone{tombstones[0], tombstones[2]}, left)
+
+	purged, err := svc.PurgeTombstones(ctx, "foo", start.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	left, err = svc.GetTombstones(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, []groups.Tombstone{tombstones[0]}, left)
+
+	left, err = svc.GetTombstones(ctx, "other")
+	require.NoError(t, err)
+	assert.Len(t, left, 1, "purge is limited to the chat")
+}
+
+func testRestoreTombstones(t *testing.T, svc groups.Store) {
+	ctx, at := context.Background(), time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	change := func(action string) context.Context {
+		return groups.WithChange(ctx, groups.Change{Actor: "@admin", Action: action, At: at})
+	}
+	settings := groups.GroupSettings{AdminsOnly: true, Description: "backend"}
+
+	require.NoError(t, svc.CreateGroup(ctx, "foo", "@bar", []string{"@blah", "@blah1", "@blah2"}))
+	require.NoError(t, svc.PutGroupSettings(ctx, "foo", "@bar", settings))
+	require.NoError(t, svc.AddSynonym(ctx, "foo", "@bar", "@be"))
+	_, err := svc.DeleteUsers(change(groups.ActionDeleteUsers), "foo", "@bar", []string{"@blah"})
+	require.NoError(t, err)
+	require.NoError(t, svc.PutGroup(change(groups.ActionReplaceGroup), "foo", "@bar", []string{"@blah3"}))
+	require.NoError(t, svc.RenameGroup(ctx, "foo", "@bar", "@baz"))
+	require.NoError(t, svc.DeleteGroup(change(groups.ActionDeleteGroup), "foo", "@baz"))
+
+	tombstones, err := svc.GetTombstones(ctx, "foo")
+	require.NoError(t, err)
+	require.Len(t, tombstones, 3)
+	for _, tombstone := range tombstones {
+		assert.Equal(t, "@baz", tombstone.Group, "tombstones follow the renamed group")
+	}
+	deleted, replaced, removed := tombstones[0], tombstones[1], tombstones[2]
+
+	err = svc.RestoreTombstone(ctx, "foo", replaced)
+	assert.True(t, errors.Is(err, groups.ErrGroupNotFound), "members of the deleted group")
+
+	require.NoError(t, svc.CreateGroup(ctx, "foo", "@be", []string{"@blah4"}))
+	err = svc.RestoreTombstone(ctx, "foo", deleted)
+	assert.True(t, errors.Is(err, groups.ErrGroupExists), "synonym of the deleted group is taken")
+	_, err = svc.GetGroup(ctx, "foo", "@baz")
+	assert.True(t, errors.Is(err, groups.ErrGroupNotFound), "failed restore leaves no traces")
+	require.NoError(t, svc.DeleteGroup(ctx, "foo", "@be"))
+
+	tombstones, err = svc.GetTombstones(ctx, "foo")
+	require.NoError(t, err)
+	assert.Len(t, tombstones, 3, "failed restore keeps the tombstone")
+
+	require.NoError(t, svc.RestoreTombstone(change(groups.ActionRestoreGroup), "foo", deleted))
+	err = svc.RestoreTombstone(ctx, "foo", deleted)
+	assert.True(t, errors.Is(err, groups.ErrTombstoneNotFound), "tombstone is removed after restore")
+
+	users, err := svc.GetGroup(ctx, "foo", "@be")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah3"}, users, "group is restored with its synonyms")
+	restoredSettings, err := svc.GetGroupSettings(ctx, "foo", "@baz")
+	require.NoError(t, err)
+	assert.Equal(t, settings, restoredSettings)
+
+	require.NoError(t, svc.RestoreTombstone(change(groups.ActionRestoreUsers), "foo", replaced))
+	users, err = svc.GetGroup(ctx, "foo", "@baz")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah1", "@blah2"}, users, "replaced members are put back instead of the current ones")
+
+	require.NoError(t, svc.RestoreTombstone(change(groups.ActionRestoreUsers), "foo", removed))
+	users, err = svc.GetGroup(ctx, "foo", "@baz")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah1", "@blah2", "@blah"}, users, "removed members are added back")
+
+	tombstones, err = svc.GetTombstones(ctx, "foo")
+	require.NoError(t, err)
+	assert.Empty(t, tombstones, "restore keeps no tombstones")
+
+	entries, err := svc.GetAuditLog(ctx, "foo", "@baz", 1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, groups.AuditEntry{ChatID: "foo", Group: "@baz", Actor: "@admin", Action: groups.ActionRestoreUsers,
+		OldMembers: []string{"@blah1", "@blah2"}, NewMembers: []string{"@blah1", "@blah2", "@blah"}, At: at}, entries[0])
+}
+
+func testImportGroups(t *testing.T, svc groups.Store) {
+	ctx := context.Background()
+
+	require.NoError(t, svc.CreateGroup(ctx, "foo", "@devs", []string{"@blah", "@blah1"}))
+	require.NoError(t, svc.PutGroupSettings(ctx, "foo", "@devs", groups.GroupSettings{Description: "old"}))
+	require.NoError(t, svc.AddSynonym(ctx, "foo", "@devs", "@dev"))
+	require.NoError(t, svc.CreateGroup(ctx, "foo", "@qa", []string{"@blah2"}))
+	require.NoError(t, svc.AddSynonym(ctx, "foo", "@qa", "@testers"))
+
+	err := svc.ImportGroups(ctx, "foo", []groups.GroupSnapshot{
+		{Alias: "@devs", Members: []string{"@blah3"}},
+		{Alias: "@ops", Members: []string{"@blah4"}, Synonyms: []string{"@testers"}},
+	})
+	assert.True(t, errors.Is(err, groups.ErrGroupExists), "synonym of the group, that is not imported")
+
+	snapshots, err := groups.ExportGroups(ctx, svc, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, []groups.GroupSnapshot{
+		{Alias: "@devs", Members: []string{"@blah", "@blah1"}, Settings: groups.GroupSettings{Description: "old"}, Synonyms: []string{"@dev"}},
+		{Alias: "@qa", Members: []string{"@blah2"}, Synonyms: []string{"@testers"}},
+	}, snapshots, "failed import leaves no traces")
+
+	err = svc.ImportGroups(ctx, "foo", []groups.GroupSnapshot{
+		{Alias: "@Devs", Members: []string{"@blah1", "@blah3", "@blah1"}, Settings: groups.GroupSettings{AdminsOnly: true, Cooldown: time.Minute},
+			Synonyms: []string{"@backend"}},
+		{Alias: "@ops", Members: []string{"@blah4"}, Synonyms: []string{"@dev"}},
+	})
+	require.NoError(t, err)
+
+	snapshots, err = groups.ExportGroups(ctx, svc, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, []groups.GroupSnapshot{
+		{Alias: "@devs", Members: []string{"@blah1", "@blah3"}, Settings: groups.GroupSettings{AdminsOnly: true, Cooldown: time.Minute},
+			Synonyms: []string{"@backend"}},
+		{Alias: "@ops", Members: []string{"@blah4"}, Synonyms: []string{"@dev"}},
+		{Alias: "@qa", Members: []string{"@blah2"}, Synonyms: []string{"@testers"}},
+	}, snapshots, "synonym of the imported group might be moved to another one")
+
+	require.NoError(t, svc.ImportGroups(ctx, "bar", []groups.GroupSnapshot{{Alias: "@devs", Members: []string{"@blah"}}}))
+	users, err := svc.GetGroup(ctx, "bar", "@devs")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah"}, users, "chat is created by import")
+}
+
+func testConcurrentMembers(t *testing.T, svc groups.Store) {
+	ctx := context.Background()
+	require.NoError(t, svc.PutGroup(ctx, "foo", "@bar", nil))
+
+	var users []string
+	for i := 0; i < 20; i++ {
+		users = append(users, fmt.Sprintf("@user%d", i))
+	}
+
+	wg := sync.WaitGroup{}
+	for _, user := range users {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			_, err := svc.AddUsers(ctx, "foo", "@bar", []string{user})
+			assert.NoError(t, err)
+		}(user)
+	}
+	wg.Wait()
+
+	members, err := svc.GetGroup(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, users, members, "no updates are lost")
+
+	for _, user := range users[:10] {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			_, err := svc.DeleteUsers(ctx, "foo", "@bar", []string{user})
+			assert.NoError(t, err)
+		}(user)
+	}
+	wg.Wait()
+
+	members, err = svc.GetGroup(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, users[10:], members, "no updates are lost")
+}
+
+func testMissingChat(t *testing.T, svc groups.Store) {
+	ctx := context.Background()
+
+	_, err := svc.GetGroups(ctx, "unknown")
+	assert.True(t, errors.Is(err, groups.ErrChatNotFound), err)
+	_, err = svc.GetGroup(ctx, "unknown", "@bar")
+	assert.True(t, errors.Is(err, groups.ErrChatNotFound), err)
+	_, err = svc.FindAliases(ctx, "unknown", []string{"@bar"})
+	assert.True(t, errors.Is(err, groups.ErrChatNotFound), err)
+	_, err = svc.AddUsers(ctx, "unknown", "@bar", []string{"@blah"})
+	assert.True(t, errors.Is(err, groups.ErrChatNotFound), err)
+	_, err = svc.DeleteUsers(ctx, "unknown", "@bar", []string{"@blah"})
+	assert.True(t, errors.Is(err, groups.ErrChatNotFound), err)
+	err = svc.DeleteGroup(ctx, "unknown", "@bar")
+	assert.True(t, errors.Is(err, groups.ErrChatNotFound), err)
+	err = svc.RenameGroup(ctx, "unknown", "@bar", "@baz")
+	assert.True(t, errors.Is(err, groups.ErrChatNotFound), err)
+	err = svc.CopyGroup(ctx, "unknown", "@bar", "@baz")
+	assert.True(t, errors.Is(err, groups.ErrChatNotFound), err)
+	err = svc.AddSynonym(ctx, "unknown", "@bar", "@baz")
+	assert.True(t, errors.Is(err, groups.ErrChatNotFound), err)
+	err = svc.DeleteSynonym(ctx, "unknown", "@baz")
+	assert.True(t, errors.Is(err, groups.ErrSynonymNotFound), err)
+
+	// state of the missing chat is empty
+	synonyms, err := svc.GetSynonyms(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Empty(t, synonyms)
+	settings, err := svc.GetAllGroupSettings(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Empty(t, settings)
+	quietHours, err := svc.GetQuietHours(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Empty(t, quietHours)
+}
+
+func testDuplicateUsers(t *testing.T, svc groups.Store) {
+	ctx := context.Background()
+
+	require.NoError(t, svc.PutGroup(ctx, "foo", "@bar", []string{"@blah", "@blah1", "@blah", "@blah2", "@blah1"}))
+	users, err := svc.GetGroup(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah", "@blah1", "@blah2"}, users, "duplicates are dropped, order is kept")
+
+	added, err := svc.AddUsers(ctx, "foo", "@bar", []string{"@blah1", "@blah3", "@blah4", "@blah3"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, added, "only absent users are counted")
+	added, err = svc.AddUsers(ctx, "foo", "@bar", []string{"@blah3"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, added)
+	users, err = svc.GetGroup(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah", "@blah1", "@blah2", "@blah3", "@blah4"}, users)
+
+	removed, err := svc.DeleteUsers(ctx, "foo", "@bar", []string{"@blah1", "@blah4", "@blah5", "@blah1"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed, "only present users are counted")
+	users, err = svc.GetGroup(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah", "@blah2", "@blah3"}, users)
+
+	_, err = svc.DeleteUsers(ctx, "foo", "@bar", []string{"@blah5"})
+	assert.True(t, errors.Is(err, groups.ErrUserNotInGroup), err)
+}
+
+func testCreateGroup(t *testing.T, svc groups.Store) {
+	ctx := context.Background()
+
+	require.NoError(t, svc.CreateGroup(ctx, "foo", "@Bar", []string{"@blah", "@blah1", "@blah"}))
+	users, err := svc.GetGroup(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah", "@blah1"}, users)
+
+	err = svc.CreateGroup(ctx, "foo", "@bar", []string{"@blah2"})
+	assert.True(t, errors.Is(err, groups.ErrGroupExists), err)
+	require.NoError(t, svc.AddSynonym(ctx, "foo", "@bar", "@ba"))
+	err = svc.CreateGroup(ctx, "foo", "@ba", []string{"@blah2"})
+	assert.True(t, errors.Is(err, groups.ErrGroupExists), err)
+
+	users, err = svc.GetGroup(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah", "@blah1"}, users, "existing group is not clobbered")
+
+	require.NoError(t, svc.PutGroup(ctx, "foo", "@bar", []string{"@blah2"}))
+	users, err = svc.GetGroup(ctx, "foo", "@bar")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@blah2"}, users)
+}
+
+func testUnicodeAliases(t *testing.T, svc groups.Store) {
+	ctx := context.Background()
+
+	require.NoError(t, svc.PutGroup(ctx, "foo", "@Разработчики", []string{"@юзер", "@user"}))
+	require.NoError(t, svc.PutGroup(ctx, "foo", "@ÜBER_team", []string{"@blah"}))
+	require.NoError(t, svc.AddSynonym(ctx, "foo", "@разработчики", "@Девы"))
+
+	users, err := svc.GetGroup(ctx, "foo", "@РАЗРАБОТЧИКИ")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@юзер", "@user"}, users)
+
+	found, err := svc.FindAliases(ctx, "foo", []string{"@девы", "@über_TEAM", "@нет"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"@разработчики": {"@юзер", "@user"},
+		"@über_team":    {"@blah"},
+	}, found)
+
+	grps, err := svc.GetGroups(ctx, "foo")
+	require.NoError(t, err)
+	assert.Len(t, grps, 2)
+	assert.Contains(t, grps, "@разработчики")
+	assert.Contains(t, grps, "@über_team")
+
+	require.NoError(t, svc.RenameGroup(ctx, "foo", "@Разработчики", "@Команда"))
+	users, err = svc.GetGroup(ctx, "foo", "@девы")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@юзер", "@user"}, users)
+}
@@ -0,0 +1,42 @@
+package groups
+
+import (
+	"context"
+	"time"
+)
+
+// Tombstone keeps the copy of the deleted group or members, removed from the group
+// or replaced by other ones, so the destructive change can be reverted
+type Tombstone struct {
+	ID           int64         `json:"id"` // assigned by the store
+	ChatID       string        `json:"chat_id"`
+	Group        string        `json:"group"`                   // canonical alias of the group
+	Actor        string        `json:"actor"`                   // user, who made the change
+	GroupDeleted bool          `json:"group_deleted,omitempty"` // whole group was deleted, otherwise only members were removed
+	Replaced     bool          `json:"replaced,omitempty"`      // members were replaced, Members keep the whole previous list
+	Members      []string      `json:"members,omitempty"`       // members of the deleted group, removed or replaced members
+	Settings     GroupSettings `json:"settings"`                // settings of the deleted group
+	Synonyms     []string      `json:"synonyms,omitempty"`      // synonyms of the deleted group
+	At           time.Time     `json:"at"`
+}
+
+// membersTombstone returns the tombstone of members, removed from the group by the change,
+// if members were replaced, the whole previous list is kept to put it back on restore
+func membersTombstone(chatID string, alias string, oldMembers []string, members []string, replaced bool) Tombstone {
+	removed := Subtract(oldMembers, members)
+	if !replaced || len(removed) == 0 {
+		return Tombstone{ChatID: chatID, Group: alias, Members: removed}
+	}
+	return Tombstone{ChatID: chatID, Group: alias, Replaced: true, Members: oldMembers}
+}
+
+// changeTombstone completes the tombstone, prepared by the store, with the change, carried
+// by the context, returns false, if the context carries no change or nothing was removed
+func changeTombstone(ctx context.Context, tombstone Tombstone) (Tombstone, bool) {
+	change, ok := changeFrom(ctx)
+	if !ok || (!tombstone.GroupDeleted && len(tombstone.Members) == 0) {
+		return Tombstone{}, false
+	}
+	tombstone.Actor, tombstone.At = change.Actor, change.At
+	return tombstone, true
+}
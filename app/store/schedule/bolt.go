@@ -0,0 +1,135 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Semior001/multibot-utility/app/logging"
+	"github.com/Semior001/multibot-utility/app/metrics"
+)
+
+const deliveriesBktName = "schedule"
+
+// BoltDB implements store of scheduled deliveries over the shared boltdb instance
+type BoltDB struct {
+	db *bolt.DB
+}
+
+// NewBoltDB creates new schedule store in the given boltdb instance
+func NewBoltDB(db *bolt.DB) (*BoltDB, error) {
+	log.Print("[INFO] schedule.BoltDB instantiated")
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte(deliveriesBktName)); err != nil {
+			return errors.Wrap(err, "failed to create schedule bucket")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to initialize boltdb %s buckets", db.Path())
+	}
+	return &BoltDB{db: db}, nil
+}
+
+// Put adds the delivery to the queue, if the delivery with the same ID is
+// already queued - appends lines of the given delivery to it
+func (b *BoltDB) Put(ctx context.Context, d Delivery) error {
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(deliveriesBktName))
+
+		if data := bkt.Get([]byte(d.ID)); data != nil {
+			var queued Delivery
+			if err := json.Unmarshal(data, &queued); err != nil {
+				return errors.Wrapf(err, "failed to put delivery %s", d.ID)
+			}
+			queued.Lines = append(queued.Lines, d.Lines...)
+			d = queued
+		}
+
+		data, err := json.Marshal(d)
+		if err != nil {
+			return errors.Wrapf(err, "failed to put delivery %s", d.ID)
+		}
+
+		if err = bkt.Put([]byte(d.ID), data); err != nil {
+			return errors.Wrapf(err, "failed to put delivery %s", d.ID)
+		}
+		return nil
+	})
+	return err
+}
+
+// Due returns deliveries, that have to be delivered at the given time,
+// sorted by the time of delivery
+func (b *BoltDB) Due(ctx context.Context, at time.Time) ([]Delivery, error) {
+	var res []Delivery
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(deliveriesBktName)).ForEach(func(k, v []byte) error {
+			var d Delivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return errors.Wrapf(err, "failed to unmarshal delivery %s", string(k))
+			}
+			if !d.DeliverAt.After(at) {
+				res = append(res, d)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get due deliveries")
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].DeliverAt.Before(res[j].DeliverAt) })
+	return res, nil
+}
+
+// Delete removes the delivery from the queue
+func (b *BoltDB) Delete(ctx context.Context, id string) error {
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		if err := tx.Bucket([]byte(deliveriesBktName)).Delete([]byte(id)); err != nil {
+			return errors.Wrapf(err, "failed to delete delivery %s", id)
+		}
+		return nil
+	})
+	return err
+}
+
+// view runs the read-only transaction, if the context is not done yet
+func (b *BoltDB) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer observeTx(ctx, "view", time.Now())
+	return b.db.View(func(tx *bolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// update runs the read-write transaction, if the context is not done yet,
+// the context is checked again after acquiring the write lock, so the
+// transaction, that waited for the lock too long, is not applied
+func (b *BoltDB) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer observeTx(ctx, "update", time.Now())
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// observeTx records the duration of the bolt transaction of the given type
+func observeTx(ctx context.Context, txType string, start time.Time) {
+	metrics.Since(metrics.BoltTxDuration.WithLabelValues("schedule", txType), start)
+	logging.Debug(ctx, "bolt transaction", "store", "schedule", "type", txType, logging.Since(start))
+}
@@ -0,0 +1,61 @@
+package schedule
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltDB_PutDueDelete(t *testing.T) {
+	svc := prepareBoltDB(t)
+
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, svc.Put(context.Background(), Delivery{ID: "late", ChatID: "foo", DeliverAt: now.Add(time.Hour), Lines: []string{"late"}}))
+	require.NoError(t, svc.Put(context.Background(), Delivery{ID: "digest", ChatID: "foo", DeliverAt: now, Header: "digest:", Lines: []string{"first"}}))
+	require.NoError(t, svc.Put(context.Background(), Delivery{ID: "digest", ChatID: "foo", DeliverAt: now, Lines: []string{"second"}}))
+	require.NoError(t, svc.Put(context.Background(), Delivery{ID: "early", ChatID: "bar", DeliverAt: now.Add(-time.Hour), Lines: []string{"early"}}))
+
+	due, err := svc.Due(context.Background(), now)
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	assert.Equal(t, "early", due[0].ID)
+	assert.Equal(t, "digest", due[1].ID)
+	assert.Equal(t, "digest:\nfirst\nsecond", due[1].Text())
+
+	require.NoError(t, svc.Delete(context.Background(), "digest"))
+	require.NoError(t, svc.Delete(context.Background(), "early"))
+
+	due, err = svc.Due(context.Background(), now)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+
+	due, err = svc.Due(context.Background(), now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, "late", due[0].Text())
+}
+
+func prepareBoltDB(t *testing.T) *BoltDB {
+	loc, err := ioutil.TempDir("", "test_schedule_multibot")
+	require.NoError(t, err, "failed to make temp dir")
+
+	db, err := bolt.Open(path.Join(loc, "schedule_test.db"), 0600, &bolt.Options{})
+	require.NoError(t, err, "failed to open boltdb")
+
+	svc, err := NewBoltDB(db)
+	require.NoError(t, err, "New bolt storage")
+
+	t.Cleanup(func() {
+		assert.NoError(t, db.Close())
+		assert.NoError(t, os.RemoveAll(loc))
+	})
+	return svc
+}
@@ -0,0 +1,100 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// claimLease is a time, during which deliveries, returned by Due, are not
+// returned to other instances of the bot, so they are not sent twice
+const claimLease = 5 * time.Minute
+
+// Postgres implements store of scheduled deliveries over the shared postgres database,
+// that is safe to be drained by several instances of the bot simultaneously
+type Postgres struct {
+	db *sql.DB
+}
+
+// NewPostgres creates new schedule store in the given postgres database
+func NewPostgres(db *sql.DB) (*Postgres, error) {
+	log.Print("[INFO] schedule.Postgres instantiated")
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schedule (
+		id            TEXT   PRIMARY KEY,
+		chat_id       TEXT   NOT NULL,
+		deliver_at    BIGINT NOT NULL,
+		header        TEXT   NOT NULL,
+		lines         JSONB  NOT NULL,
+		claimed_until BIGINT NOT NULL DEFAULT 0
+	);
+	CREATE INDEX IF NOT EXISTS schedule_deliver_at ON schedule (deliver_at);`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create schedule table")
+	}
+	return &Postgres{db: db}, nil
+}
+
+// Put adds the delivery to the queue, if the delivery with the same ID is
+// already queued - appends lines of the given delivery to it
+func (p *Postgres) Put(ctx context.Context, d Delivery) error {
+	lines, err := json.Marshal(d.Lines)
+	if err != nil {
+		return errors.Wrapf(err, "failed to put delivery %s", d.ID)
+	}
+	if d.Lines == nil {
+		lines = []byte("[]")
+	}
+	_, err = p.db.ExecContext(ctx,
+		`INSERT INTO schedule (id, chat_id, deliver_at, header, lines) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET lines = schedule.lines || excluded.lines`,
+		d.ID, d.ChatID, d.DeliverAt.UnixNano(), d.Header, string(lines),
+	)
+	return errors.Wrapf(err, "failed to put delivery %s", d.ID)
+}
+
+// Due claims deliveries, that have to be delivered at the given time, and are not
+// claimed by other instances, and returns them sorted by the time of delivery
+func (p *Postgres) Due(ctx context.Context, at time.Time) ([]Delivery, error) {
+	rows, err := p.db.QueryContext(ctx,
+		`UPDATE schedule SET claimed_until = $1 WHERE id IN (
+			SELECT id FROM schedule WHERE deliver_at <= $2 AND claimed_until <= $2
+			FOR UPDATE SKIP LOCKED
+		) RETURNING id, chat_id, deliver_at, header, lines`,
+		at.Add(claimLease).UnixNano(), at.UnixNano(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get due deliveries")
+	}
+	defer rows.Close()
+
+	var res []Delivery
+	for rows.Next() {
+		var d Delivery
+		var deliverAt int64
+		var lines []byte
+		if err = rows.Scan(&d.ID, &d.ChatID, &deliverAt, &d.Header, &lines); err != nil {
+			return nil, errors.Wrap(err, "failed to get due deliveries")
+		}
+		if err = json.Unmarshal(lines, &d.Lines); err != nil {
+			return nil, errors.Wrapf(err, "failed to unmarshal lines of delivery %s", d.ID)
+		}
+		d.DeliverAt = time.Unix(0, deliverAt)
+		res = append(res, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to get due deliveries")
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].DeliverAt.Before(res[j].DeliverAt) })
+	return res, nil
+}
+
+// Delete removes the delivery from the queue
+func (p *Postgres) Delete(ctx context.Context, id string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM schedule WHERE id = $1`, id)
+	return errors.Wrapf(err, "failed to delete delivery %s", id)
+}
@@ -0,0 +1,83 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPostgres_PutDueDelete requires a running postgres, the url to connect to it
+// has to be specified in MULTIBOT_TEST_POSTGRES env variable
+func TestPostgres_PutDueDelete(t *testing.T) {
+	connURL := os.Getenv("MULTIBOT_TEST_POSTGRES")
+	if connURL == "" {
+		t.Skip("MULTIBOT_TEST_POSTGRES is not set")
+	}
+	svc := preparePostgres(t, connURL)
+
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, svc.Put(context.Background(), Delivery{ID: "late", ChatID: "foo", DeliverAt: now.Add(time.Hour), Lines: []string{"late"}}))
+	require.NoError(t, svc.Put(context.Background(), Delivery{ID: "digest", ChatID: "foo", DeliverAt: now, Header: "digest:", Lines: []string{"first"}}))
+	require.NoError(t, svc.Put(context.Background(), Delivery{ID: "digest", ChatID: "foo", DeliverAt: now, Lines: []string{"second"}}))
+	require.NoError(t, svc.Put(context.Background(), Delivery{ID: "early", ChatID: "bar", DeliverAt: now.Add(-time.Hour), Lines: []string{"early"}}))
+
+	due, err := svc.Due(context.Background(), now)
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	assert.Equal(t, "early", due[0].ID)
+	assert.Equal(t, "digest", due[1].ID)
+	assert.Equal(t, "digest:\nfirst\nsecond", due[1].Text())
+
+	due, err = svc.Due(context.Background(), now)
+	require.NoError(t, err)
+	assert.Empty(t, due, "claimed deliveries are not returned again")
+
+	due, err = svc.Due(context.Background(), now.Add(claimLease))
+	require.NoError(t, err)
+	assert.Len(t, due, 2, "deliveries are returned again after the lease expired")
+
+	require.NoError(t, svc.Delete(context.Background(), "digest"))
+	require.NoError(t, svc.Delete(context.Background(), "early"))
+
+	due, err = svc.Due(context.Background(), now.Add(2*claimLease))
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, "late", due[0].Text())
+}
+
+// preparePostgres creates a separate schema for the test, so tests don't interfere
+func preparePostgres(t *testing.T, connURL string) *Postgres {
+	db, err := sql.Open("postgres", connURL)
+	require.NoError(t, err, "failed to connect to postgres")
+
+	schema := fmt.Sprintf("test_multibot_schedule_%d", time.Now().UnixNano())
+	_, err = db.Exec("CREATE SCHEMA " + schema)
+	require.NoError(t, err, "failed to create schema")
+	require.NoError(t, db.Close())
+
+	sep := "?"
+	if strings.Contains(connURL, "?") {
+		sep = "&"
+	}
+	db, err = sql.Open("postgres", connURL+sep+"search_path="+schema)
+	require.NoError(t, err, "failed to connect to postgres")
+
+	svc, err := NewPostgres(db)
+	require.NoError(t, err, "new postgres storage")
+
+	t.Cleanup(func() {
+		_, err := db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		assert.NoError(t, err, "failed to drop schema")
+		assert.NoError(t, db.Close())
+	})
+	return svc
+}
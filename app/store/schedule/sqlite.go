@@ -0,0 +1,106 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SQLite implements store of scheduled deliveries over the shared sqlite database
+type SQLite struct {
+	db *sql.DB
+}
+
+// NewSQLite creates new schedule store in the given sqlite database
+func NewSQLite(db *sql.DB) (*SQLite, error) {
+	log.Print("[INFO] schedule.SQLite instantiated")
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schedule (
+		id         TEXT    PRIMARY KEY,
+		chat_id    TEXT    NOT NULL,
+		deliver_at INTEGER NOT NULL,
+		header     TEXT    NOT NULL,
+		lines      TEXT    NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS schedule_deliver_at ON schedule (deliver_at);`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create schedule table")
+	}
+	return &SQLite{db: db}, nil
+}
+
+// Put adds the delivery to the queue, if the delivery with the same ID is
+// already queued - appends lines of the given delivery to it
+func (s *SQLite) Put(ctx context.Context, d Delivery) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to put delivery %s", d.ID)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	var queued string
+	err = tx.QueryRowContext(ctx, `SELECT lines FROM schedule WHERE id = ?`, d.ID).Scan(&queued)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return errors.Wrapf(err, "failed to put delivery %s", d.ID)
+	}
+	if err == nil {
+		var lines []string
+		if err = json.Unmarshal([]byte(queued), &lines); err != nil {
+			return errors.Wrapf(err, "failed to put delivery %s", d.ID)
+		}
+		d.Lines = append(lines, d.Lines...)
+	}
+
+	lines, err := json.Marshal(d.Lines)
+	if err != nil {
+		return errors.Wrapf(err, "failed to put delivery %s", d.ID)
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO schedule (id, chat_id, deliver_at, header, lines) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET lines = excluded.lines`,
+		d.ID, d.ChatID, d.DeliverAt.UnixNano(), d.Header, string(lines),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to put delivery %s", d.ID)
+	}
+	return errors.Wrapf(tx.Commit(), "failed to put delivery %s", d.ID)
+}
+
+// Due returns deliveries, that have to be delivered at the given time,
+// sorted by the time of delivery
+func (s *SQLite) Due(ctx context.Context, at time.Time) ([]Delivery, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, chat_id, deliver_at, header, lines FROM schedule
+		WHERE deliver_at <= ? ORDER BY deliver_at`,
+		at.UnixNano(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get due deliveries")
+	}
+	defer rows.Close()
+
+	var res []Delivery
+	for rows.Next() {
+		var d Delivery
+		var deliverAt int64
+		var lines string
+		if err = rows.Scan(&d.ID, &d.ChatID, &deliverAt, &d.Header, &lines); err != nil {
+			return nil, errors.Wrap(err, "failed to get due deliveries")
+		}
+		if err = json.Unmarshal([]byte(lines), &d.Lines); err != nil {
+			return nil, errors.Wrapf(err, "failed to unmarshal lines of delivery %s", d.ID)
+		}
+		d.DeliverAt = time.Unix(0, deliverAt)
+		res = append(res, d)
+	}
+	return res, errors.Wrap(rows.Err(), "failed to get due deliveries")
+}
+
+// Delete removes the delivery from the queue
+func (s *SQLite) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM schedule WHERE id = ?`, id)
+	return errors.Wrapf(err, "failed to delete delivery %s", id)
+}
@@ -0,0 +1,63 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	_ "github.com/ncruces/go-sqlite3/driver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLite_PutDueDelete(t *testing.T) {
+	svc := prepareSQLite(t)
+
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, svc.Put(context.Background(), Delivery{ID: "late", ChatID: "foo", DeliverAt: now.Add(time.Hour), Lines: []string{"late"}}))
+	require.NoError(t, svc.Put(context.Background(), Delivery{ID: "digest", ChatID: "foo", DeliverAt: now, Header: "digest:", Lines: []string{"first"}}))
+	require.NoError(t, svc.Put(context.Background(), Delivery{ID: "digest", ChatID: "foo", DeliverAt: now, Lines: []string{"second"}}))
+	require.NoError(t, svc.Put(context.Background(), Delivery{ID: "early", ChatID: "bar", DeliverAt: now.Add(-time.Hour), Lines: []string{"early"}}))
+
+	due, err := svc.Due(context.Background(), now)
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	assert.Equal(t, "early", due[0].ID)
+	assert.Equal(t, "digest", due[1].ID)
+	assert.True(t, now.Equal(due[1].DeliverAt))
+	assert.Equal(t, "digest:\nfirst\nsecond", due[1].Text())
+
+	require.NoError(t, svc.Delete(context.Background(), "digest"))
+	require.NoError(t, svc.Delete(context.Background(), "early"))
+
+	due, err = svc.Due(context.Background(), now)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+
+	due, err = svc.Due(context.Background(), now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, "late", due[0].Text())
+}
+
+func prepareSQLite(t *testing.T) *SQLite {
+	loc, err := ioutil.TempDir("", "test_schedule_multibot")
+	require.NoError(t, err, "failed to make temp dir")
+
+	db, err := sql.Open("sqlite3", "file:"+path.Join(loc, "schedule_test.sqlite"))
+	require.NoError(t, err, "failed to open sqlite")
+
+	svc, err := NewSQLite(db)
+	require.NoError(t, err, "new sqlite storage")
+
+	t.Cleanup(func() {
+		assert.NoError(t, db.Close())
+		assert.NoError(t, os.RemoveAll(loc))
+	})
+	return svc
+}
@@ -0,0 +1,35 @@
+// Package schedule contains a persistent queue of messages, that have to be
+// delivered later, e.g. digests of mentions, deferred until the end of quiet hours
+package schedule
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+//go:generate mockery -inpkg -name Store -case snake
+
+// Store defines methods to put deliveries into the queue and drain them
+type Store interface {
+	Put(ctx context.Context, d Delivery) (err error)
+	Due(ctx context.Context, at time.Time) (deliveries []Delivery, err error)
+	Delete(ctx context.Context, id string) (err error)
+}
+
+// Delivery describes a message, that has to be sent to the chat at specified time
+type Delivery struct {
+	ID        string    `json:"id"` // defined by producer, deliveries with the same ID are merged
+	ChatID    string    `json:"chat_id"`
+	DeliverAt time.Time `json:"deliver_at"`
+	Header    string    `json:"header,omitempty"` // the first line of the message
+	Lines     []string  `json:"lines,omitempty"`  // the rest of message, each one on its own line
+}
+
+// Text composes the text of the message to deliver
+func (d Delivery) Text() string {
+	if d.Header == "" {
+		return strings.Join(d.Lines, "\n")
+	}
+	return strings.Join(append([]string{d.Header}, d.Lines...), "\n")
+}
@@ -0,0 +1,122 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Semior001/multibot-utility/app/logging"
+	"github.com/Semior001/multibot-utility/app/metrics"
+)
+
+const settingsBktName = "chat_settings"
+
+// BoltDB implements store of chat settings over the shared boltdb instance
+type BoltDB struct {
+	db *bolt.DB
+}
+
+// NewBoltDB creates new settings store in the given boltdb instance
+func NewBoltDB(db *bolt.DB) (*BoltDB, error) {
+	log.Print("[INFO] settings.BoltDB instantiated")
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte(settingsBktName)); err != nil {
+			return errors.Wrap(err, "failed to create settings bucket")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to initialize boltdb %s buckets", db.Path())
+	}
+	return &BoltDB{db: db}, nil
+}
+
+// Get returns settings of the chat, empty ones, if the chat has none
+func (b *BoltDB) Get(ctx context.Context, chatID string) (Settings, error) {
+	var res Settings
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(settingsBktName)).Get([]byte(chatID))
+		if data == nil {
+			return nil
+		}
+		return errors.Wrapf(json.Unmarshal(data, &res), "failed to unmarshal settings of chat %s", chatID)
+	})
+	if err != nil {
+		return Settings{}, errors.Wrapf(err, "failed to get settings of chat %s", chatID)
+	}
+	return res, nil
+}
+
+// Put replaces settings of the chat
+func (b *BoltDB) Put(ctx context.Context, chatID string, s Settings) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrapf(err, "failed to put settings of chat %s", chatID)
+	}
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		err := tx.Bucket([]byte(settingsBktName)).Put([]byte(chatID), data)
+		return errors.Wrapf(err, "failed to put settings of chat %s", chatID)
+	})
+}
+
+// Update changes settings of the chat by fn in a single transaction
+func (b *BoltDB) Update(ctx context.Context, chatID string, fn func(s *Settings) error) error {
+	err := b.update(ctx, func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(settingsBktName))
+		var s Settings
+		if data := bkt.Get([]byte(chatID)); data != nil {
+			if err := json.Unmarshal(data, &s); err != nil {
+				return errors.Wrap(err, "failed to unmarshal settings")
+			}
+		}
+		if err := fn(&s); err != nil {
+			return err
+		}
+		data, err := json.Marshal(s)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal settings")
+		}
+		return bkt.Put([]byte(chatID), data)
+	})
+	return errors.Wrapf(err, "failed to update settings of chat %s", chatID)
+}
+
+// view runs the read-only transaction, if the context is not done yet
+func (b *BoltDB) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer observeTx(ctx, "view", time.Now())
+	return b.db.View(func(tx *bolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// update runs the read-write transaction, if the context is not done yet,
+// the context is checked again after acquiring the write lock, so the
+// transaction, that waited for the lock too long, is not applied
+func (b *BoltDB) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer observeTx(ctx, "update", time.Now())
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// observeTx records the duration of the bolt transaction of the given type
+func observeTx(ctx context.Context, txType string, start time.Time) {
+	metrics.Since(metrics.BoltTxDuration.WithLabelValues("settings", txType), start)
+	logging.Debug(ctx, "bolt transaction", "store", "settings", "type", txType, logging.Since(start))
+}
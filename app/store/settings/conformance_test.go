@@ -0,0 +1,88 @@
+package settings_test
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/ncruces/go-sqlite3/driver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Semior001/multibot-utility/app/store/settings"
+	"github.com/Semior001/multibot-utility/app/store/settings/storetest"
+)
+
+func TestBoltDB_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) settings.Store {
+		db, err := bolt.Open(path.Join(tempDir(t), "settings_test.db"), 0600, &bolt.Options{})
+		require.NoError(t, err, "failed to open boltdb")
+		t.Cleanup(func() { assert.NoError(t, db.Close()) })
+
+		svc, err := settings.NewBoltDB(db)
+		require.NoError(t, err, "new bolt storage")
+		return svc
+	})
+}
+
+func TestSQLite_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) settings.Store {
+		db, err := sql.Open("sqlite3", "file:"+path.Join(tempDir(t), "settings_test.sqlite"))
+		require.NoError(t, err, "failed to open sqlite")
+		t.Cleanup(func() { assert.NoError(t, db.Close()) })
+
+		svc, err := settings.NewSQLite(db)
+		require.NoError(t, err, "new sqlite storage")
+		return svc
+	})
+}
+
+// TestPostgres_Conformance requires a running postgres, the url to connect to it
+// has to be specified in MULTIBOT_TEST_POSTGRES env variable
+func TestPostgres_Conformance(t *testing.T) {
+	connURL := os.Getenv("MULTIBOT_TEST_POSTGRES")
+	if connURL == "" {
+		t.Skip("MULTIBOT_TEST_POSTGRES is not set")
+	}
+	storetest.Run(t, func(t *testing.T) settings.Store {
+		// each test works in its own schema, so tests don't interfere
+		db, err := sql.Open("postgres", connURL)
+		require.NoError(t, err, "failed to connect to postgres")
+
+		schema := fmt.Sprintf("test_multibot_settings_%d", time.Now().UnixNano())
+		_, err = db.Exec("CREATE SCHEMA " + schema)
+		require.NoError(t, err, "failed to create schema")
+		require.NoError(t, db.Close())
+
+		sep := "?"
+		if strings.Contains(connURL, "?") {
+			sep = "&"
+		}
+		db, err = sql.Open("postgres", connURL+sep+"search_path="+schema)
+		require.NoError(t, err, "failed to connect to postgres")
+
+		svc, err := settings.NewPostgres(db)
+		require.NoError(t, err, "new postgres storage")
+
+		t.Cleanup(func() {
+			_, err := db.Exec("DROP SCHEMA " + schema + " CASCADE")
+			assert.NoError(t, err, "failed to drop schema")
+			assert.NoError(t, db.Close())
+		})
+		return svc
+	})
+}
+
+func tempDir(t *testing.T) string {
+	loc, err := ioutil.TempDir("", "test_settings_multibot")
+	require.NoError(t, err, "failed to make temp dir")
+	t.Cleanup(func() { assert.NoError(t, os.RemoveAll(loc)) })
+	return loc
+}
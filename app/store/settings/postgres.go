@@ -0,0 +1,102 @@
+package settings
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+
+	"github.com/pkg/errors"
+)
+
+// Postgres implements store of chat settings over the shared postgres database
+type Postgres struct {
+	db *sql.DB
+}
+
+// NewPostgres creates new settings store in the given postgres database
+func NewPostgres(db *sql.DB) (*Postgres, error) {
+	log.Print("[INFO] settings.Postgres instantiated")
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS chat_settings (
+		chat_id  TEXT  PRIMARY KEY,
+		settings JSONB NOT NULL
+	)`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create settings table")
+	}
+	return &Postgres{db: db}, nil
+}
+
+// Get returns settings of the chat, empty ones, if the chat has none
+func (p *Postgres) Get(ctx context.Context, chatID string) (Settings, error) {
+	var data []byte
+	err := p.db.QueryRowContext(ctx, `SELECT settings FROM chat_settings WHERE chat_id = $1`, chatID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Settings{}, nil
+	}
+	if err != nil {
+		return Settings{}, errors.Wrapf(err, "failed to get settings of chat %s", chatID)
+	}
+	var res Settings
+	if err = json.Unmarshal(data, &res); err != nil {
+		return Settings{}, errors.Wrapf(err, "failed to unmarshal settings of chat %s", chatID)
+	}
+	return res, nil
+}
+
+// Put replaces settings of the chat
+func (p *Postgres) Put(ctx context.Context, chatID string, s Settings) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrapf(err, "failed to put settings of chat %s", chatID)
+	}
+	_, err = p.db.ExecContext(ctx,
+		`INSERT INTO chat_settings (chat_id, settings) VALUES ($1, $2)
+		ON CONFLICT (chat_id) DO UPDATE SET settings = excluded.settings`,
+		chatID, string(data),
+	)
+	return errors.Wrapf(err, "failed to put settings of chat %s", chatID)
+}
+
+// Update changes settings of the chat by fn in a single transaction, the row of
+// the chat is inserted first, so the transaction holds the write lock on it
+func (p *Postgres) Update(ctx context.Context, chatID string, fn func(s *Settings) error) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to begin update of settings of chat %s", chatID)
+	}
+	if err = p.update(ctx, tx, chatID, fn); err != nil {
+		_ = tx.Rollback()
+		return errors.Wrapf(err, "failed to update settings of chat %s", chatID)
+	}
+	return errors.Wrapf(tx.Commit(), "failed to commit settings of chat %s", chatID)
+}
+
+// update loads settings of the chat in the transaction, changes them by fn and saves
+func (p *Postgres) update(ctx context.Context, tx *sql.Tx, chatID string, fn func(s *Settings) error) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO chat_settings (chat_id, settings) VALUES ($1, '{}') ON CONFLICT (chat_id) DO NOTHING`,
+		chatID,
+	)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	err = tx.QueryRowContext(ctx, `SELECT settings FROM chat_settings WHERE chat_id = $1 FOR UPDATE`, chatID).Scan(&data)
+	if err != nil {
+		return err
+	}
+	var st Settings
+	if err = json.Unmarshal(data, &st); err != nil {
+		return errors.Wrap(err, "failed to unmarshal settings")
+	}
+	if err = fn(&st); err != nil {
+		return err
+	}
+	res, err := json.Marshal(st)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal settings")
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE chat_settings SET settings = $2 WHERE chat_id = $1`, chatID, string(res))
+	return err
+}
@@ -0,0 +1,102 @@
+package settings
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+
+	"github.com/pkg/errors"
+)
+
+// SQLite implements store of chat settings over the shared sqlite database
+type SQLite struct {
+	db *sql.DB
+}
+
+// NewSQLite creates new settings store in the given sqlite database
+func NewSQLite(db *sql.DB) (*SQLite, error) {
+	log.Print("[INFO] settings.SQLite instantiated")
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS chat_settings (
+		chat_id  TEXT PRIMARY KEY,
+		settings TEXT NOT NULL
+	)`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create settings table")
+	}
+	return &SQLite{db: db}, nil
+}
+
+// Get returns settings of the chat, empty ones, if the chat has none
+func (s *SQLite) Get(ctx context.Context, chatID string) (Settings, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT settings FROM chat_settings WHERE chat_id = ?`, chatID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Settings{}, nil
+	}
+	if err != nil {
+		return Settings{}, errors.Wrapf(err, "failed to get settings of chat %s", chatID)
+	}
+	var res Settings
+	if err = json.Unmarshal([]byte(data), &res); err != nil {
+		return Settings{}, errors.Wrapf(err, "failed to unmarshal settings of chat %s", chatID)
+	}
+	return res, nil
+}
+
+// Put replaces settings of the chat
+func (s *SQLite) Put(ctx context.Context, chatID string, st Settings) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return errors.Wrapf(err, "failed to put settings of chat %s", chatID)
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO chat_settings (chat_id, settings) VALUES (?, ?)
+		ON CONFLICT (chat_id) DO UPDATE SET settings = excluded.settings`,
+		chatID, string(data),
+	)
+	return errors.Wrapf(err, "failed to put settings of chat %s", chatID)
+}
+
+// Update changes settings of the chat by fn in a single transaction, the row of
+// the chat is inserted first, so the transaction holds the write lock on it
+func (s *SQLite) Update(ctx context.Context, chatID string, fn func(s *Settings) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to begin update of settings of chat %s", chatID)
+	}
+	if err = s.update(ctx, tx, chatID, fn); err != nil {
+		_ = tx.Rollback()
+		return errors.Wrapf(err, "failed to update settings of chat %s", chatID)
+	}
+	return errors.Wrapf(tx.Commit(), "failed to commit settings of chat %s", chatID)
+}
+
+// update loads settings of the chat in the transaction, changes them by fn and saves
+func (s *SQLite) update(ctx context.Context, tx *sql.Tx, chatID string, fn func(s *Settings) error) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO chat_settings (chat_id, settings) VALUES (?, '{}') ON CONFLICT (chat_id) DO NOTHING`,
+		chatID,
+	)
+	if err != nil {
+		return err
+	}
+	var data string
+	err = tx.QueryRowContext(ctx, `SELECT settings FROM chat_settings WHERE chat_id = ?`, chatID).Scan(&data)
+	if err != nil {
+		return err
+	}
+	var st Settings
+	if err = json.Unmarshal([]byte(data), &st); err != nil {
+		return errors.Wrap(err, "failed to unmarshal settings")
+	}
+	if err = fn(&st); err != nil {
+		return err
+	}
+	res, err := json.Marshal(st)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal settings")
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE chat_settings SET settings = ? WHERE chat_id = ?`, string(res), chatID)
+	return err
+}
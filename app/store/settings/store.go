@@ -0,0 +1,92 @@
+// Package settings contains a store of per-chat settings, that are chosen by admins
+// of the chat and define the behavior of bots in it
+package settings
+
+import (
+	"context"
+)
+
+//go:generate mockery -inpkg -name Store -case snake
+
+// Store defines methods to get and put settings of chats
+type Store interface {
+	Get(ctx context.Context, chatID string) (s Settings, err error) // empty settings, if the chat has none
+	Put(ctx context.Context, chatID string, s Settings) (err error)
+	// Update changes settings of the chat by fn atomically, nothing is saved, if fn fails
+	Update(ctx context.Context, chatID string, fn func(s *Settings) error) (err error)
+}
+
+// Verbosity defines how bots answer invalid commands
+type Verbosity string
+
+// All recognizable verbosities, empty means the default of the bot
+const (
+	VerbositySilent  Verbosity = "silent"  // invalid commands are ignored
+	VerbosityVerbose Verbosity = "verbose" // invalid commands are answered with the reason
+)
+
+// TriggerPermission defines who is allowed to ping groups of the chat
+type TriggerPermission string
+
+// All recognizable trigger permissions, empty means everyone
+const (
+	TriggerEveryone TriggerPermission = "everyone"
+	TriggerAdmins   TriggerPermission = "admins"
+)
+
+// MentionStyle defines how mentions of group members are formatted
+type MentionStyle string
+
+// All recognizable mention styles, empty means inline
+const (
+	MentionsInline MentionStyle = "inline" // all mentions in one line
+	MentionsList   MentionStyle = "list"   // each mention on its own line
+)
+
+// Languages, in which bots are able to answer, the first one is the default,
+// command help and argument hints are always in english
+var Languages = []string{"en", "ru"}
+
+// Settings describes the behavior of bots in the chat, empty fields mean defaults
+type Settings struct {
+	Verbosity    Verbosity         `json:"verbosity,omitempty"`
+	Language     string            `json:"language,omitempty"`
+	Trigger      TriggerPermission `json:"trigger,omitempty"`
+	Mentions     MentionStyle      `json:"mentions,omitempty"`
+	DisabledBots []string          `json:"disabled_bots,omitempty"` // names of bots, that ignore the chat
+}
+
+// BotEnabled checks whether the bot with the given name serves the chat
+func (s Settings) BotEnabled(name string) bool {
+	for _, b := range s.DisabledBots {
+		if b == name {
+			return false
+		}
+	}
+	return true
+}
+
+// SetBotEnabled enables or disables the bot with the given name in the chat
+func (s *Settings) SetBotEnabled(name string, enabled bool) {
+	bots := make([]string, 0, len(s.DisabledBots)+1)
+	for _, b := range s.DisabledBots {
+		if b != name {
+			bots = append(bots, b)
+		}
+	}
+	if !enabled {
+		bots = append(bots, name)
+	}
+	if len(bots) == 0 {
+		bots = nil
+	}
+	s.DisabledBots = bots
+}
+
+// Lang returns the language of the chat, or the default one, if it is not set
+func (s Settings) Lang() string {
+	if s.Language == "" {
+		return Languages[0]
+	}
+	return s.Language
+}
@@ -0,0 +1,24 @@
+package settings
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettings_SetBotEnabled(t *testing.T) {
+	var s Settings
+	assert.True(t, s.BotEnabled("groups"))
+
+	s.SetBotEnabled("groups", false)
+	s.SetBotEnabled("groups", false)
+	s.SetBotEnabled("other", false)
+	assert.Equal(t, []string{"groups", "other"}, s.DisabledBots)
+	assert.False(t, s.BotEnabled("groups"))
+
+	s.SetBotEnabled("groups", true)
+	s.SetBotEnabled("other", true)
+	assert.Nil(t, s.DisabledBots)
+	assert.True(t, s.BotEnabled("other"))
+	assert.Equal(t, "en", s.Lang())
+}
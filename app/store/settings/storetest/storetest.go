@@ -0,0 +1,147 @@
+// Package storetest contains the conformance test suite, that every
+// implementation of settings.Store has to pass
+package storetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Semior001/multibot-utility/app/store/settings"
+)
+
+// Run runs all conformance tests against the store, prepare has to
+// return a new empty store for each test
+func Run(t *testing.T, prepare func(t *testing.T) settings.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, svc settings.Store)
+	}{
+		{name: "GetPut", fn: testGetPut},
+		{name: "Defaults", fn: testDefaults},
+		{name: "Chats", fn: testChats},
+		{name: "Update", fn: testUpdate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { tt.fn(t, prepare(t)) })
+	}
+}
+
+func testGetPut(t *testing.T, svc settings.Store) {
+	ctx := context.Background()
+
+	expected := settings.Settings{
+		Verbosity:    settings.VerbositySilent,
+		Language:     "ru",
+		Trigger:      settings.TriggerAdmins,
+		Mentions:     settings.MentionsList,
+		DisabledBots: []string{"groups", "schedule"},
+	}
+	require.NoError(t, svc.Put(ctx, "foo", expected))
+	require.NoError(t, svc.Put(ctx, "foo", expected), "put is idempotent")
+
+	s, err := svc.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, expected, s)
+
+	expected.Verbosity, expected.DisabledBots = settings.VerbosityVerbose, nil
+	require.NoError(t, svc.Put(ctx, "foo", expected))
+	s, err = svc.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, expected, s, "settings are replaced")
+}
+
+func testDefaults(t *testing.T, svc settings.Store) {
+	ctx := context.Background()
+
+	s, err := svc.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, settings.Settings{}, s, "chat without settings has defaults")
+	assert.Equal(t, "en", s.Lang())
+	assert.True(t, s.BotEnabled("groups"))
+
+	require.NoError(t, svc.Put(ctx, "foo", settings.Settings{Language: "ru", DisabledBots: []string{"groups"}}))
+	require.NoError(t, svc.Put(ctx, "foo", settings.Settings{}))
+	s, err = svc.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, settings.Settings{}, s, "settings are reset to defaults")
+}
+
+func testChats(t *testing.T, svc settings.Store) {
+	ctx := context.Background()
+
+	require.NoError(t, svc.Put(ctx, "foo", settings.Settings{Trigger: settings.TriggerAdmins}))
+	require.NoError(t, svc.Put(ctx, "bar", settings.Settings{Mentions: settings.MentionsList}))
+	require.NoError(t, svc.Put(ctx, "-100123", settings.Settings{Language: "ru"}))
+
+	s, err := svc.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, settings.Settings{Trigger: settings.TriggerAdmins}, s)
+
+	s, err = svc.Get(ctx, "bar")
+	require.NoError(t, err)
+	assert.Equal(t, settings.Settings{Mentions: settings.MentionsList}, s)
+
+	s, err = svc.Get(ctx, "-100123")
+	require.NoError(t, err)
+	assert.Equal(t, settings.Settings{Language: "ru"}, s)
+
+	s, err = svc.Get(ctx, "baz")
+	require.NoError(t, err)
+	assert.Equal(t, settings.Settings{}, s)
+}
+
+func testUpdate(t *testing.T, svc settings.Store) {
+	ctx := context.Background()
+
+	err := svc.Update(ctx, "foo", func(s *settings.Settings) error {
+		assert.Equal(t, settings.Settings{}, *s, "chat without settings is updated from defaults")
+		s.Language = "ru"
+		return nil
+	})
+	require.NoError(t, err)
+	s, err := svc.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, settings.Settings{Language: "ru"}, s)
+
+	failed := errors.New("failed")
+	err = svc.Update(ctx, "foo", func(s *settings.Settings) error {
+		s.Language = "en"
+		return failed
+	})
+	assert.True(t, errors.Is(err, failed), "error of fn is returned")
+	err = svc.Update(ctx, "bar", func(s *settings.Settings) error {
+		s.Trigger = settings.TriggerAdmins
+		return failed
+	})
+	assert.True(t, errors.Is(err, failed), "error of fn is returned")
+	s, err = svc.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, settings.Settings{Language: "ru"}, s, "nothing is saved, if fn fails")
+	s, err = svc.Get(ctx, "bar")
+	require.NoError(t, err)
+	assert.Equal(t, settings.Settings{}, s, "nothing is saved, if fn fails")
+
+	// concurrent updates of different settings don't overwrite each other
+	bots := []string{"groups", "schedule", "stats", "admin"}
+	wg := sync.WaitGroup{}
+	for _, name := range bots {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			assert.NoError(t, svc.Update(ctx, "foo", func(s *settings.Settings) error {
+				s.SetBotEnabled(name, false)
+				return nil
+			}))
+		}(name)
+	}
+	wg.Wait()
+	s, err = svc.Get(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, "ru", s.Language)
+	assert.ElementsMatch(t, bots, s.DisabledBots)
+}
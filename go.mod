@@ -1,15 +1,33 @@
 module github.com/Semior001/multibot-utility
 
-go 1.14
+go 1.26.0
 
 require (
-	github.com/coreos/bbolt v1.3.3
 	github.com/go-telegram-bot-api/telegram-bot-api v4.6.4+incompatible
-	github.com/hashicorp/logutils v1.0.0
 	github.com/jessevdk/go-flags v1.4.0
+	github.com/lib/pq v1.12.3
+	github.com/ncruces/go-sqlite3 v0.35.6
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.7.0
+	github.com/prometheus/client_model v0.2.0
 	github.com/stretchr/testify v1.5.1
+	go.etcd.io/bbolt v1.3.6
+	gopkg.in/yaml.v2 v2.2.5
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.1.1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang/protobuf v1.4.2 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/ncruces/go-sqlite3-wasm/v6 v6.3.35304 // indirect
+	github.com/ncruces/julianday v1.0.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/prometheus/common v0.10.0 // indirect
+	github.com/prometheus/procfs v0.1.3 // indirect
+	github.com/stretchr/objx v0.1.1 // indirect
 	github.com/technoweenie/multipartstreamer v1.0.1 // indirect
-	go.etcd.io/bbolt v1.3.3 // indirect
-	golang.org/x/sys v0.0.0-20200323222414-85ca7c5b95cd // indirect
+	golang.org/x/sys v0.48.0 // indirect
+	google.golang.org/protobuf v1.23.0 // indirect
 )